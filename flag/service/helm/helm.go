@@ -6,8 +6,15 @@ import (
 )
 
 type Helm struct {
-	HTTP            http.HTTP
-	Kubernetes      kubernetes.Kubernetes
-	MaxRollback     string
-	TillerNamespace string
+	DriftCheckInterval      string
+	HTTP                    http.HTTP
+	Kubernetes              kubernetes.Kubernetes
+	MaxConcurrentOperations string
+	MaxRollback             string
+	SecretNamespaces        string
+	SelfHealInterval        string
+	ShutdownGracePeriod     string
+	TarballCacheMaxSize     string
+	TillerNamespace         string
+	VerifyPolicy            string
 }
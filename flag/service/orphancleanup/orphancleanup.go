@@ -0,0 +1,8 @@
+package orphancleanup
+
+type OrphanCleanup struct {
+	DryRun      string
+	Enabled     string
+	GracePeriod string
+	Interval    string
+}
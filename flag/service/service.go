@@ -5,11 +5,17 @@ import (
 
 	"github.com/giantswarm/chart-operator/v2/flag/service/helm"
 	"github.com/giantswarm/chart-operator/v2/flag/service/image"
+	"github.com/giantswarm/chart-operator/v2/flag/service/leaderelection"
+	"github.com/giantswarm/chart-operator/v2/flag/service/orphancleanup"
+	"github.com/giantswarm/chart-operator/v2/flag/service/webhook"
 )
 
 // Service is an intermediate data structure for command line configuration flags.
 type Service struct {
-	Helm       helm.Helm
-	Image      image.Image
-	Kubernetes kubernetes.Kubernetes
+	Helm           helm.Helm
+	Image          image.Image
+	Kubernetes     kubernetes.Kubernetes
+	LeaderElection leaderelection.LeaderElection
+	OrphanCleanup  orphancleanup.OrphanCleanup
+	Webhook        webhook.Webhook
 }
@@ -17,11 +17,14 @@ require (
 	github.com/giantswarm/operatorkit/v4 v4.3.1
 	github.com/giantswarm/to v0.3.0
 	github.com/giantswarm/versionbundle v0.2.0
+	github.com/go-kit/kit v0.10.0
 	github.com/google/go-cmp v0.5.6
 	github.com/imdario/mergo v0.3.12
 	github.com/prometheus/client_golang v1.11.0
 	github.com/spf13/afero v1.6.0
 	github.com/spf13/viper v1.8.1
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
+	helm.sh/helm/v3 v3.5.4
 	k8s.io/api v0.20.4
 	k8s.io/apimachinery v0.20.4
 	k8s.io/client-go v0.20.4
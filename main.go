@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/microkit/command"
@@ -31,7 +33,17 @@ func main() {
 func mainWithError() error {
 	var err error
 
-	ctx := context.Background()
+	// The context is canceled when the operator is asked to stop so the
+	// service can shut down gracefully before the microkit command exits.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		cancel()
+	}()
 
 	// Create a new logger that is used by all packages.
 	var newLogger micrologger.Logger
@@ -106,9 +118,16 @@ func mainWithError() error {
 
 	daemonCommand := newCommand.DaemonCommand().CobraCommand()
 
+	daemonCommand.PersistentFlags().String(f.Service.Helm.DriftCheckInterval, "5m", "How often the objects of deployed releases are compared with the objects in the cluster.")
 	daemonCommand.PersistentFlags().String(f.Service.Helm.HTTP.ClientTimeout, "5s", "HTTP timeout for pulling chart tarballs.")
 	daemonCommand.PersistentFlags().String(f.Service.Helm.Kubernetes.WaitTimeout, "10s", "Wait timeout when calling the Kubernetes API.")
+	daemonCommand.PersistentFlags().Int(f.Service.Helm.MaxConcurrentOperations, 10, "Maximum number of Helm operations in progress at the same time.")
 	daemonCommand.PersistentFlags().Int(f.Service.Helm.MaxRollback, 3, "the maximum number of rollback attempts for pending apps.")
+	daemonCommand.PersistentFlags().StringSlice(f.Service.Helm.SecretNamespaces, []string{}, "Namespaces besides the chart CR namespace chart CRs may reference credentials, pull secrets and values sources in.")
+	daemonCommand.PersistentFlags().String(f.Service.Helm.SelfHealInterval, "30m", "Minimum time between upgrades of a release to revert drifted objects.")
+	daemonCommand.PersistentFlags().String(f.Service.Helm.ShutdownGracePeriod, "2m", "How long to wait for the Helm operations in progress when the operator stops.")
+	daemonCommand.PersistentFlags().Int64(f.Service.Helm.TarballCacheMaxSize, 100*1024*1024, "Maximum size in bytes of the cached chart tarballs.")
+	daemonCommand.PersistentFlags().String(f.Service.Helm.VerifyPolicy, "off", "Default policy for verifying chart provenance. One of enforce, warn or off.")
 	daemonCommand.PersistentFlags().String(f.Service.Helm.TillerNamespace, "giantswarm", "Namespace for the Tiller pod.")
 	daemonCommand.PersistentFlags().String(f.Service.Image.Registry, "quay.io", "Container image registry.")
 	daemonCommand.PersistentFlags().String(f.Service.Kubernetes.Address, "", "Address used to connect to Kubernetes. When empty in-cluster config is created.")
@@ -117,6 +136,16 @@ func mainWithError() error {
 	daemonCommand.PersistentFlags().String(f.Service.Kubernetes.TLS.CAFile, "", "Certificate authority file path to use to authenticate with Kubernetes.")
 	daemonCommand.PersistentFlags().String(f.Service.Kubernetes.TLS.CrtFile, "", "Certificate file path to use to authenticate with Kubernetes.")
 	daemonCommand.PersistentFlags().String(f.Service.Kubernetes.TLS.KeyFile, "", "Key file path to use to authenticate with Kubernetes.")
+	daemonCommand.PersistentFlags().Bool(f.Service.LeaderElection.Enabled, false, "Whether to elect a leader so multiple replicas can run. Only the leader reconciles chart CRs.")
+	daemonCommand.PersistentFlags().String(f.Service.LeaderElection.LeaseDuration, "15s", "How long standby replicas wait before taking over the lease of a leader which stopped renewing it.")
+	daemonCommand.PersistentFlags().String(f.Service.LeaderElection.Namespace, "giantswarm", "Namespace of the leader election lease.")
+	daemonCommand.PersistentFlags().String(f.Service.LeaderElection.RenewDeadline, "10s", "How long the leader retries renewing the lease before giving up leadership.")
+	daemonCommand.PersistentFlags().String(f.Service.LeaderElection.RetryPeriod, "2s", "How often replicas try to acquire or renew the lease.")
+	daemonCommand.PersistentFlags().Bool(f.Service.OrphanCleanup.DryRun, false, "Whether to only log the orphaned configmaps and secrets which would be deleted.")
+	daemonCommand.PersistentFlags().Bool(f.Service.OrphanCleanup.Enabled, false, "Whether to delete configmaps and secrets managed by app-operator which are not used by a chart CR.")
+	daemonCommand.PersistentFlags().String(f.Service.OrphanCleanup.GracePeriod, "24h", "How long configmaps and secrets must be orphaned before they are deleted.")
+	daemonCommand.PersistentFlags().String(f.Service.OrphanCleanup.Interval, "10m", "How often orphaned configmaps and secrets are looked for.")
+	daemonCommand.PersistentFlags().StringSlice(f.Service.Webhook.AllowedHosts, []string{".giantswarm", ".giantswarm.svc"}, "Hosts status webhooks may be sent to. Entries starting with a dot match subdomains. When empty no status webhooks are sent.")
 
 	err = newCommand.CobraCommand().Execute()
 	if err != nil {
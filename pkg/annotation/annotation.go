@@ -7,25 +7,160 @@ const (
 	// reconciling the resource.
 	ChartOperatorPaused = "chart-operator.giantswarm.io/paused"
 
+	// ChartDigest is the name of the annotation storing the SHA-256 digest
+	// of the chart tarball e.g. sha256:<hex>. When set tarballs with a
+	// different digest are rejected.
+	ChartDigest = "chart-operator.giantswarm.io/chart-digest"
+
 	// CordonReason is the name of the annotation that indicates
 	// the reason of why chart-operator should not apply any update on this chart CR.
 	CordonReason = "chart-operator.giantswarm.io/cordon-reason"
 
 	// CordonUntilDate is the name of the annotation that indicates
-	// the expiration date of rule of this cordon.
+	// the expiration date of rule of this cordon. The date must be in
+	// RFC 3339 format e.g. 2019-12-31T23:59:59Z.
 	CordonUntilDate = "chart-operator.giantswarm.io/cordon-until"
 
+	// CredentialsSecret is the name of the annotation referencing the secret
+	// with the credentials for pulling the chart tarball. It is either the
+	// secret name in the chart CR namespace or namespace/name. The secret may
+	// have a username and password or a token and a tls.crt and tls.key client
+	// certificate and a ca.crt the server certificate must be signed by.
+	CredentialsSecret = "chart-operator.giantswarm.io/credentials-secret"
+
+	// DependsOn is the name of the annotation listing the chart CRs in the
+	// same namespace which must be deployed before the release of this chart
+	// CR is installed or upgraded. It is a comma separated list of chart CR
+	// names e.g. cilium,coredns.
+	DependsOn = "chart-operator.giantswarm.io/depends-on"
+
+	// DependencyDeployed is the name of the annotation storing the name and
+	// revision of the last deployed chart CR the release of this chart CR
+	// was waiting for e.g. cilium/3. Setting it triggers the reconciliation
+	// of the chart CR.
+	DependencyDeployed = "chart-operator.giantswarm.io/dependency-deployed"
+
+	// DriftIgnore is the name of the annotation listing the fields which are
+	// not compared by the drift check. It is a comma separated list of field
+	// paths e.g. spec.replicas for Deployments scaled by an HPA. A path may be
+	// prefixed by the kind to only ignore it for objects of that kind e.g.
+	// Deployment:spec.replicas. Fields below the path are ignored too.
+	DriftIgnore = "chart-operator.giantswarm.io/drift-ignore"
+
+	// DryRun is the name of the annotation that when set to true prevents
+	// chart-operator from installing or updating the Helm release. Instead
+	// the chart is rendered and the changes compared to the deployed release
+	// are stored in a configmap for review.
+	DryRun = "chart-operator.giantswarm.io/dry-run"
+
+	// DryRunHash is the name of the annotation storing the hash of the
+	// release the dry run configmap was rendered for. The dry run is only
+	// rendered again when the hash changes.
+	DryRunHash = "chart-operator.giantswarm.io/dry-run-hash"
+
 	// ForceHelmUpgrade is the name of the annotation that controls whether
 	// force is used when upgrading the Helm release.
 	ForceHelmUpgrade = "chart-operator.giantswarm.io/force-helm-upgrade"
 
+	// HealthCheck is the name of the annotation that when set to true makes
+	// chart-operator check the Deployments, StatefulSets and DaemonSets of
+	// the deployed release are ready. The release status is set to
+	// deployed-unhealthy while they are not.
+	HealthCheck = "chart-operator.giantswarm.io/health-check"
+
+	// HealthCheckDeadline is the name of the annotation storing how long the
+	// workloads of the release may be unhealthy after chart-operator
+	// upgraded it before it is rolled back e.g. 10m. The release is not
+	// rolled back when it is not set.
+	HealthCheckDeadline = "chart-operator.giantswarm.io/health-check-deadline"
+
+	// HealthCheckStarted is the name of the annotation storing when the last
+	// upgrade of the release by chart-operator started in RFC 3339 format.
+	// The health check deadline is measured from it and it is removed once
+	// the release is healthy or rolled back. Releases without it are never
+	// rolled back by the health check.
+	HealthCheckStarted = "chart-operator.giantswarm.io/health-check-started"
+
+	// KeepOrphan is the name of the annotation that when set to true on a
+	// configmap or secret managed by app-operator prevents chart-operator from
+	// deleting it once no chart CR references it.
+	KeepOrphan = "chart-operator.giantswarm.io/keep-orphan"
+
+	// MaxHistory is the name of the annotation storing the maximum number of
+	// revisions kept for the release of the chart CR. Older revisions are
+	// deleted including successful and superseded ones. The deployed
+	// revision and revisions in a pending status are never deleted.
+	MaxHistory = "chart-operator.giantswarm.io/max-history"
+
+	// OCIDigest is the name of the annotation storing the digest of the
+	// manifest an OCI chart reference was last resolved to e.g. sha256:<hex>.
+	OCIDigest = "chart-operator.giantswarm.io/oci-digest"
+
+	// OCIPullSecret is the name of the annotation referencing the
+	// kubernetes.io/dockerconfigjson secret with the credentials for pulling
+	// charts from OCI registries. It is either the secret name in the chart
+	// CR namespace or namespace/name.
+	OCIPullSecret = "chart-operator.giantswarm.io/oci-pull-secret"
+
+	// Priority is the name of the annotation storing the priority of the chart
+	// CR as an integer. It defaults to 0. Releases are only installed or
+	// upgraded once the chart CRs in the same namespace with a higher
+	// priority are deployed.
+	Priority = "chart-operator.giantswarm.io/priority"
+
+	// RolledBackFrom is the name of the annotation storing the version, values
+	// checksum and failure reason of the upgrade that was rolled back when
+	// RollbackOnFailure is set. That upgrade is not retried until the version
+	// or values of the chart CR change.
+	RolledBackFrom = "chart-operator.giantswarm.io/rolled-back-from"
+
+	// RollbackOnFailure is the name of the annotation that when set to true
+	// makes chart-operator roll back failed upgrades to the last deployed
+	// revision of the release.
+	RollbackOnFailure = "chart-operator.giantswarm.io/rollback-on-failure"
+
 	// RollbackCount is the name of the annotation storing the number of
 	// rollbacks performed from the previous pending status.
 	RollbackCount = "chart-operator.giantswarm.io/rollback-count"
 
+	// SelfHeal is the name of the annotation that when set to true makes
+	// chart-operator upgrade the deployed release with its stored manifest
+	// when objects of the release were changed or deleted in the cluster.
+	// Fields changed by other controllers e.g. the replicas of a Deployment
+	// scaled by an HPA must be listed in the drift ignore annotation. The
+	// release is upgraded at most once per self heal interval of the operator.
+	SelfHeal = "chart-operator.giantswarm.io/self-heal"
+
+	// ValuesChanged is the name of the annotation storing the last created,
+	// changed or deleted configmap or secret providing values for the chart
+	// CR and its resource version e.g. ConfigMap/monitoring/prometheus-values@42.
+	// Setting it triggers the reconciliation of the chart CR.
+	ValuesChanged = "chart-operator.giantswarm.io/values-changed"
+
+	// ValuesChecksum is the name of the annotation storing a SHA-256 checksum
+	// of the Helm release values encoded as JSON with sorted keys.
+	ValuesChecksum = "chart-operator.giantswarm.io/values-checksum"
+
+	// ValuesSources is the name of the annotation listing additional
+	// configmaps and secrets used as Helm values. It is a JSON list of
+	// sources e.g. [{"kind":"ConfigMap","name":"app-values","keys":["values"]}].
+	// Sources are merged in order after the configmap and secret in the
+	// chart CR spec so later sources override earlier ones.
+	ValuesSources = "chart-operator.giantswarm.io/values-sources"
+
 	// ValuesMD5Checksum is the name of the annotation storing an MD5 checksum
 	// of the Helm release values.
+	//
+	// Deprecated: It is only read to migrate chart CRs to ValuesChecksum and
+	// is removed once the new annotation is set.
 	ValuesMD5Checksum = "chart-operator.giantswarm.io/values-md5-checksum"
 
+	// VerifyPolicy is the name of the annotation setting whether the
+	// provenance of the chart is verified before it is installed or updated.
+	// It is enforce, warn or off. It may be set on chart CRs and on the
+	// namespaces releases are installed to. The chart CR annotation takes
+	// precedence.
+	VerifyPolicy = "chart-operator.giantswarm.io/verify-policy"
+
 	Webhook = "chart-operator.giantswarm.io/webhook-url"
 )
@@ -0,0 +1,132 @@
+// Package cosign verifies cosign signatures of OCI artifacts signed with a key
+// pair. A signature is a simple signing payload with the digest of the signed
+// manifest and the signature of the payload. Keyless signatures with Fulcio
+// certificates and the Rekor transparency log are not supported.
+package cosign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+
+	"github.com/giantswarm/microerror"
+)
+
+const (
+	// payloadType is the type of the simple signing payloads created by
+	// cosign.
+	payloadType = "cosign container image signature"
+)
+
+// PublicKey is a public key trusted to sign artifacts.
+type PublicKey struct {
+	// Fingerprint is the SHA-256 digest of the DER encoded key e.g.
+	// sha256:<hex>.
+	Fingerprint string
+
+	key crypto.PublicKey
+}
+
+type payload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// ReadPublicKeys parses the PEM encoded public keys e.g. the cosign.pub files
+// created by cosign generate-key-pair. ECDSA, RSA and Ed25519 keys are
+// supported.
+func ReadPublicKeys(data []byte) ([]PublicKey, error) {
+	var keys []PublicKey
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, microerror.Maskf(invalidKeyError, "%s", err)
+		}
+
+		switch key.(type) {
+		case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		default:
+			return nil, microerror.Maskf(invalidKeyError, "unsupported key type %T", key)
+		}
+
+		sum := sha256.Sum256(block.Bytes)
+		keys = append(keys, PublicKey{
+			Fingerprint: "sha256:" + hex.EncodeToString(sum[:]),
+			key:         key,
+		})
+	}
+
+	if len(keys) == 0 {
+		return nil, microerror.Maskf(invalidKeyError, "no public keys found")
+	}
+
+	return keys, nil
+}
+
+// Verify checks the signature of the payload is valid for one of the keys and
+// the payload is for the manifest digest. It returns the fingerprint of the
+// key.
+func Verify(keys []PublicKey, manifestDigest string, data, signature []byte) (string, error) {
+	var signer string
+	for _, k := range keys {
+		if verifySignature(k.key, data, signature) {
+			signer = k.Fingerprint
+			break
+		}
+	}
+	if signer == "" {
+		return "", microerror.Maskf(invalidSignatureError, "signature is not valid for any key")
+	}
+
+	var p payload
+	err := json.Unmarshal(data, &p)
+	if err != nil {
+		return "", microerror.Maskf(invalidSignatureError, "cannot parse signature payload: %s", err)
+	}
+	if p.Critical.Type != payloadType {
+		return "", microerror.Maskf(invalidSignatureError, "signature payload has type %#q, expected %#q", p.Critical.Type, payloadType)
+	}
+	if p.Critical.Image.DockerManifestDigest != manifestDigest {
+		return "", microerror.Maskf(invalidSignatureError, "signature is for manifest %#q, expected %#q", p.Critical.Image.DockerManifestDigest, manifestDigest)
+	}
+
+	return signer, nil
+}
+
+// verifySignature verifies the signature the way cosign creates it. ECDSA and
+// RSA keys sign the SHA-256 digest of the payload while Ed25519 keys sign the
+// payload itself.
+func verifySignature(key crypto.PublicKey, data, signature []byte) bool {
+	digest := sha256.Sum256(data)
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, digest[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, data, signature)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,169 @@
+package cosign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func Test_Verify(t *testing.T) {
+	manifestDigest := "sha256:" + fmt.Sprintf("%064x", 1)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	ed25519PublicKey, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	data := append(pemPublicKey(t, ecdsaKey.Public()), pemPublicKey(t, ed25519PublicKey)...)
+
+	keys, err := ReadPublicKeys(data)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("keys == %d, want %d", len(keys), 2)
+	}
+
+	testCases := []struct {
+		name           string
+		payload        []byte
+		signer         crypto.Signer
+		expectedSigner string
+		errorMatcher   func(error) bool
+	}{
+		{
+			name:           "case 0: signed with ecdsa key",
+			payload:        newTestPayload(manifestDigest),
+			signer:         ecdsaKey,
+			expectedSigner: keys[0].Fingerprint,
+		},
+		{
+			name:           "case 1: signed with ed25519 key",
+			payload:        newTestPayload(manifestDigest),
+			signer:         ed25519Key,
+			expectedSigner: keys[1].Fingerprint,
+		},
+		{
+			name:         "case 2: signed with other key",
+			payload:      newTestPayload(manifestDigest),
+			signer:       otherKey,
+			errorMatcher: IsInvalidSignature,
+		},
+		{
+			name:         "case 3: signature for other manifest",
+			payload:      newTestPayload("sha256:" + fmt.Sprintf("%064x", 2)),
+			signer:       ecdsaKey,
+			errorMatcher: IsInvalidSignature,
+		},
+		{
+			name:         "case 4: payload of other type",
+			payload:      []byte(fmt.Sprintf(`{"critical":{"image":{"docker-manifest-digest":%q},"type":"other"}}`, manifestDigest)),
+			signer:       ecdsaKey,
+			errorMatcher: IsInvalidSignature,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			signature := sign(t, tc.signer, tc.payload)
+
+			result, err := Verify(keys, manifestDigest, tc.payload, signature)
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if result != tc.expectedSigner {
+				t.Fatalf("signer == %#q, want %#q", result, tc.expectedSigner)
+			}
+		})
+	}
+}
+
+func Test_ReadPublicKeys(t *testing.T) {
+	testCases := []struct {
+		name         string
+		data         []byte
+		errorMatcher func(error) bool
+	}{
+		{
+			name:         "case 0: no keys",
+			data:         []byte("cosign.pub"),
+			errorMatcher: IsInvalidKey,
+		},
+		{
+			name:         "case 1: invalid key",
+			data:         pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("key")}),
+			errorMatcher: IsInvalidKey,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			_, err := ReadPublicKeys(tc.data)
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+		})
+	}
+}
+
+func newTestPayload(manifestDigest string) []byte {
+	return []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"quay.io/giantswarm/prometheus"},"image":{"docker-manifest-digest":%q},"type":%q},"optional":null}`, manifestDigest, payloadType))
+}
+
+func pemPublicKey(t *testing.T, key crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func sign(t *testing.T, signer crypto.Signer, data []byte) []byte {
+	var signature []byte
+	var err error
+
+	switch k := signer.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, data)
+	default:
+		digest := sha256.Sum256(data)
+		signature, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	return signature
+}
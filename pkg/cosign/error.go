@@ -0,0 +1,23 @@
+package cosign
+
+import (
+	"github.com/giantswarm/microerror"
+)
+
+var invalidKeyError = &microerror.Error{
+	Kind: "invalidKeyError",
+}
+
+// IsInvalidKey asserts invalidKeyError.
+func IsInvalidKey(err error) bool {
+	return microerror.Cause(err) == invalidKeyError
+}
+
+var invalidSignatureError = &microerror.Error{
+	Kind: "invalidSignatureError",
+}
+
+// IsInvalidSignature asserts invalidSignatureError.
+func IsInvalidSignature(err error) bool {
+	return microerror.Cause(err) == invalidSignatureError
+}
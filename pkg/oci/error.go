@@ -0,0 +1,50 @@
+package oci
+
+import (
+	"github.com/giantswarm/microerror"
+)
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var invalidReferenceError = &microerror.Error{
+	Kind: "invalidReferenceError",
+}
+
+// IsInvalidReference asserts invalidReferenceError.
+func IsInvalidReference(err error) bool {
+	return microerror.Cause(err) == invalidReferenceError
+}
+
+var notFoundError = &microerror.Error{
+	Kind: "notFoundError",
+}
+
+// IsNotFound asserts notFoundError.
+func IsNotFound(err error) bool {
+	return microerror.Cause(err) == notFoundError
+}
+
+var pullFailedError = &microerror.Error{
+	Kind: "pullFailedError",
+}
+
+// IsPullFailed asserts pullFailedError.
+func IsPullFailed(err error) bool {
+	return microerror.Cause(err) == pullFailedError
+}
+
+var unauthorizedError = &microerror.Error{
+	Kind: "unauthorizedError",
+}
+
+// IsUnauthorized asserts unauthorizedError.
+func IsUnauthorized(err error) bool {
+	return microerror.Cause(err) == unauthorizedError
+}
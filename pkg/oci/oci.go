@@ -0,0 +1,559 @@
+// Package oci pulls Helm charts published as OCI artifacts from container
+// registries using the OCI distribution API.
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/spf13/afero"
+)
+
+const (
+	// Scheme is the prefix of chart references pointing to OCI registries.
+	Scheme = "oci://"
+
+	chartLayerMediaType       = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	legacyChartLayerMediaType = "application/tar+gzip"
+	manifestMediaType         = "application/vnd.oci.image.manifest.v1+json"
+	provenanceLayerMediaType  = "application/vnd.cncf.helm.chart.provenance.v1.prov"
+	signatureLayerMediaType   = "application/vnd.dev.cosign.simplesigning.v1+json"
+
+	// signatureAnnotation is the annotation of the signature layers storing
+	// the base64 encoded signature of the layer content.
+	signatureAnnotation = "dev.cosignproject.cosign/signature"
+	// signatureManifestMediaTypes are accepted for the manifests of the
+	// signatures as cosign pushes them with the media type of the registry.
+	signatureManifestMediaTypes = manifestMediaType + ", application/vnd.docker.distribution.manifest.v2+json"
+
+	maxProvenanceSize = 1024 * 1024
+	maxSignatureSize  = 1024 * 1024
+
+	defaultHTTPClientTimeout = 30 * time.Second
+)
+
+var (
+	digestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+	tagRegexp    = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.+-]{0,127}$`)
+)
+
+// Reference locates a chart in an OCI registry e.g.
+// oci://quay.io/giantswarm/chart-operator:2.18.0 or
+// oci://quay.io/giantswarm/chart-operator@sha256:<hex>.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// Credentials are used to authenticate with the registry. They are empty for
+// anonymous pulls.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Chart is a chart resolved from a reference.
+type Chart struct {
+	// ManifestDigest is the digest of the manifest the reference resolved
+	// to. Pulling the reference with this digest returns the same chart.
+	ManifestDigest string
+	// LayerDigest is the digest of the chart tarball.
+	LayerDigest string
+	// ProvenanceDigest is the digest of the provenance file. It is empty when
+	// the chart was pushed without one.
+	ProvenanceDigest string
+}
+
+// Signature is a cosign signature of a chart manifest. The payload has the
+// manifest digest and the signature is created for the payload.
+type Signature struct {
+	Payload   []byte
+	Signature []byte
+}
+
+type Config struct {
+	Fs afero.Fs
+
+	// HTTPClient is used for requests to the registry. A client with
+	// HTTPClientTimeout is used when it is not set.
+	HTTPClient        *http.Client
+	HTTPClientTimeout time.Duration
+}
+
+type Client struct {
+	fs         afero.Fs
+	httpClient *http.Client
+}
+
+type manifest struct {
+	Layers []struct {
+		Annotations map[string]string `json:"annotations"`
+		Digest      string            `json:"digest"`
+		MediaType   string            `json:"mediaType"`
+	} `json:"layers"`
+}
+
+// IsReference returns true when the chart location is an OCI reference.
+func IsReference(s string) bool {
+	return strings.HasPrefix(s, Scheme)
+}
+
+// ParseReference parses an oci:// chart reference. It must have either a tag
+// or a digest.
+func ParseReference(s string) (Reference, error) {
+	if !IsReference(s) {
+		return Reference{}, microerror.Maskf(invalidReferenceError, "reference %#q must start with %#q", s, Scheme)
+	}
+
+	rest := strings.TrimPrefix(s, Scheme)
+
+	i := strings.Index(rest, "/")
+	if i <= 0 || i == len(rest)-1 {
+		return Reference{}, microerror.Maskf(invalidReferenceError, "reference %#q must have a registry and repository", s)
+	}
+
+	ref := Reference{
+		Registry: rest[:i],
+	}
+	rest = rest[i+1:]
+
+	if i := strings.Index(rest, "@"); i >= 0 {
+		ref.Repository, ref.Digest = rest[:i], rest[i+1:]
+		if !digestRegexp.MatchString(ref.Digest) {
+			return Reference{}, microerror.Maskf(invalidReferenceError, "reference %#q must have a sha256 digest", s)
+		}
+	} else if i := strings.LastIndex(rest, ":"); i >= 0 {
+		ref.Repository, ref.Tag = rest[:i], rest[i+1:]
+		if !tagRegexp.MatchString(ref.Tag) {
+			return Reference{}, microerror.Maskf(invalidReferenceError, "reference %#q has invalid tag %#q", s, ref.Tag)
+		}
+	} else {
+		return Reference{}, microerror.Maskf(invalidReferenceError, "reference %#q must have a tag or digest", s)
+	}
+
+	if ref.Repository == "" || strings.ToLower(ref.Repository) != ref.Repository {
+		return Reference{}, microerror.Maskf(invalidReferenceError, "reference %#q has invalid repository %#q", s, ref.Repository)
+	}
+
+	return ref, nil
+}
+
+func (r Reference) String() string {
+	if r.Digest != "" {
+		return fmt.Sprintf("%s%s/%s@%s", Scheme, r.Registry, r.Repository, r.Digest)
+	}
+
+	return fmt.Sprintf("%s%s/%s:%s", Scheme, r.Registry, r.Repository, r.Tag)
+}
+
+// CredentialsFromDockerConfig returns the credentials for the registry from
+// the content of a kubernetes.io/dockerconfigjson secret.
+func CredentialsFromDockerConfig(data []byte, registry string) (Credentials, error) {
+	var config struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Password string `json:"password"`
+			Username string `json:"username"`
+		} `json:"auths"`
+	}
+
+	err := json.Unmarshal(data, &config)
+	if err != nil {
+		return Credentials{}, microerror.Maskf(invalidConfigError, "cannot parse docker config: %s", err)
+	}
+
+	for host, auth := range config.Auths {
+		// Hosts may be stored as URLs e.g. https://index.docker.io/v1/.
+		if u, err := url.Parse(host); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		if host != registry {
+			continue
+		}
+
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return Credentials{}, microerror.Maskf(invalidConfigError, "cannot decode auth for registry %#q", registry)
+			}
+
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) != 2 {
+				return Credentials{}, microerror.Maskf(invalidConfigError, "auth for registry %#q must be username:password", registry)
+			}
+
+			return Credentials{Username: parts[0], Password: parts[1]}, nil
+		}
+
+		return Credentials{Username: auth.Username, Password: auth.Password}, nil
+	}
+
+	return Credentials{}, nil
+}
+
+func New(config Config) (*Client, error) {
+	if config.Fs == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Fs must not be empty", config)
+	}
+
+	if config.HTTPClientTimeout == 0 {
+		config.HTTPClientTimeout = defaultHTTPClientTimeout
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: config.HTTPClientTimeout}
+	}
+
+	c := &Client{
+		fs:         config.Fs,
+		httpClient: config.HTTPClient,
+	}
+
+	return c, nil
+}
+
+// Resolve fetches the manifest of the reference and returns its digest and the
+// digest of the chart tarball.
+func (c *Client) Resolve(ctx context.Context, ref Reference, credentials Credentials) (Chart, error) {
+	reference := ref.Tag
+	if ref.Digest != "" {
+		reference = ref.Digest
+	}
+
+	u := fmt.Sprintf("https://%s/v2/%s/manifests/%s", ref.Registry, ref.Repository, reference)
+
+	resp, err := c.get(ctx, u, manifestMediaType, ref, credentials)
+	if err != nil {
+		return Chart{}, microerror.Mask(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 4*1024*1024))
+	if err != nil {
+		return Chart{}, microerror.Maskf(pullFailedError, "reading manifest of %#q: %s", ref, err)
+	}
+
+	sum := sha256.Sum256(body)
+	manifestDigest := "sha256:" + hex.EncodeToString(sum[:])
+	if ref.Digest != "" && ref.Digest != manifestDigest {
+		return Chart{}, microerror.Maskf(pullFailedError, "manifest of %#q has digest %#q", ref, manifestDigest)
+	}
+
+	var m manifest
+	err = json.Unmarshal(body, &m)
+	if err != nil {
+		return Chart{}, microerror.Maskf(pullFailedError, "cannot parse manifest of %#q: %s", ref, err)
+	}
+
+	chart := Chart{
+		ManifestDigest: manifestDigest,
+	}
+
+	for _, l := range m.Layers {
+		if !digestRegexp.MatchString(l.Digest) {
+			return Chart{}, microerror.Maskf(pullFailedError, "layer of %#q has invalid digest %#q", ref, l.Digest)
+		}
+
+		switch l.MediaType {
+		case chartLayerMediaType, legacyChartLayerMediaType:
+			chart.LayerDigest = l.Digest
+		case provenanceLayerMediaType:
+			chart.ProvenanceDigest = l.Digest
+		}
+	}
+
+	if chart.LayerDigest == "" {
+		return Chart{}, microerror.Maskf(pullFailedError, "manifest of %#q has no chart layer", ref)
+	}
+
+	return chart, nil
+}
+
+// Pull downloads the chart tarball of the resolved chart to a temporary file
+// and returns its path. The content is verified against the layer digest.
+func (c *Client) Pull(ctx context.Context, ref Reference, chart Chart, credentials Credentials) (string, error) {
+	u := fmt.Sprintf("https://%s/v2/%s/blobs/%s", ref.Registry, ref.Repository, chart.LayerDigest)
+
+	resp, err := c.get(ctx, u, "", ref, credentials)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+	defer resp.Body.Close()
+
+	f, err := afero.TempFile(c.fs, "", "chart-operator-oci")
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	if err != nil {
+		_ = c.fs.Remove(f.Name())
+		return "", microerror.Maskf(pullFailedError, "downloading chart %#q: %s", ref, err)
+	}
+
+	digest := "sha256:" + hex.EncodeToString(h.Sum(nil))
+	if digest != chart.LayerDigest {
+		_ = c.fs.Remove(f.Name())
+		return "", microerror.Maskf(pullFailedError, "chart %#q has digest %#q, expected %#q", ref, digest, chart.LayerDigest)
+	}
+
+	return f.Name(), nil
+}
+
+// PullProvenance downloads the provenance file of the resolved chart. The
+// content is verified against the provenance layer digest.
+func (c *Client) PullProvenance(ctx context.Context, ref Reference, chart Chart, credentials Credentials) ([]byte, error) {
+	if chart.ProvenanceDigest == "" {
+		return nil, microerror.Maskf(notFoundError, "chart %#q has no provenance", ref)
+	}
+
+	body, err := c.getBlob(ctx, ref, chart.ProvenanceDigest, maxProvenanceSize, credentials)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return body, nil
+}
+
+// PullSignatures downloads the cosign signatures of the resolved chart. They
+// are stored in the repository with the sha256-<hex>.sig tag of the manifest
+// digest. The payloads are verified against their layer digests but the
+// signatures are not verified.
+func (c *Client) PullSignatures(ctx context.Context, ref Reference, chart Chart, credentials Credentials) ([]Signature, error) {
+	tag := strings.Replace(chart.ManifestDigest, ":", "-", 1) + ".sig"
+	u := fmt.Sprintf("https://%s/v2/%s/manifests/%s", ref.Registry, ref.Repository, tag)
+
+	resp, err := c.get(ctx, u, signatureManifestMediaTypes, ref, credentials)
+	if IsNotFound(err) {
+		return nil, microerror.Maskf(notFoundError, "chart %#q has no signatures", ref)
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 4*1024*1024))
+	if err != nil {
+		return nil, microerror.Maskf(pullFailedError, "reading signatures of %#q: %s", ref, err)
+	}
+
+	var m manifest
+	err = json.Unmarshal(body, &m)
+	if err != nil {
+		return nil, microerror.Maskf(pullFailedError, "cannot parse signatures of %#q: %s", ref, err)
+	}
+
+	var signatures []Signature
+	for _, l := range m.Layers {
+		if l.MediaType != signatureLayerMediaType {
+			continue
+		}
+		if !digestRegexp.MatchString(l.Digest) {
+			return nil, microerror.Maskf(pullFailedError, "signature of %#q has invalid digest %#q", ref, l.Digest)
+		}
+
+		signature, err := base64.StdEncoding.DecodeString(l.Annotations[signatureAnnotation])
+		if err != nil || len(signature) == 0 {
+			// Layers without a valid signature cannot be verified so they
+			// are skipped like other layers.
+			continue
+		}
+
+		payload, err := c.getBlob(ctx, ref, l.Digest, maxSignatureSize, credentials)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		signatures = append(signatures, Signature{
+			Payload:   payload,
+			Signature: signature,
+		})
+	}
+
+	if len(signatures) == 0 {
+		return nil, microerror.Maskf(notFoundError, "chart %#q has no signatures", ref)
+	}
+
+	return signatures, nil
+}
+
+// getBlob downloads a blob of the repository of the reference up to the
+// maximum size. The content is verified against the digest.
+func (c *Client) getBlob(ctx context.Context, ref Reference, digest string, maxSize int64, credentials Credentials) ([]byte, error) {
+	u := fmt.Sprintf("https://%s/v2/%s/blobs/%s", ref.Registry, ref.Repository, digest)
+
+	resp, err := c.get(ctx, u, "", ref, credentials)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize))
+	if err != nil {
+		return nil, microerror.Maskf(pullFailedError, "downloading blob %#q of %#q: %s", digest, ref, err)
+	}
+
+	sum := sha256.Sum256(body)
+	if d := "sha256:" + hex.EncodeToString(sum[:]); d != digest {
+		return nil, microerror.Maskf(pullFailedError, "blob of %#q has digest %#q, expected %#q", ref, d, digest)
+	}
+
+	return body, nil
+}
+
+// get sends a GET request to the registry. When the registry asks for
+// authentication a token is requested with the credentials and the request is
+// sent again.
+func (c *Client) get(ctx context.Context, u, accept string, ref Reference, credentials Credentials) (*http.Response, error) {
+	resp, err := c.do(ctx, u, accept, "")
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		authorization, err := c.authorize(ctx, challenge, ref, credentials)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		resp, err = c.do(ctx, u, accept, authorization)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return resp, nil
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, microerror.Maskf(notFoundError, "chart %#q not found", ref)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		resp.Body.Close()
+		return nil, microerror.Maskf(unauthorizedError, "pulling chart %#q is not allowed with http status %d", ref, resp.StatusCode)
+	default:
+		resp.Body.Close()
+		return nil, microerror.Maskf(pullFailedError, "pulling chart %#q failed with http status %d", ref, resp.StatusCode)
+	}
+}
+
+func (c *Client) do(ctx context.Context, u, accept, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, microerror.Maskf(pullFailedError, "%s", err)
+	}
+
+	return resp, nil
+}
+
+// authorize returns the authorization header for the challenge of the
+// registry. Basic challenges use the credentials directly. Bearer challenges
+// exchange them for a token scoped to pulling the repository.
+func (c *Client) authorize(ctx context.Context, challenge string, ref Reference, credentials Credentials) (string, error) {
+	scheme, params := parseChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if credentials.Username == "" {
+			return "", microerror.Maskf(unauthorizedError, "registry %#q requires credentials", ref.Registry)
+		}
+
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials.Username+":"+credentials.Password)), nil
+	case "bearer":
+		realm, err := url.Parse(params["realm"])
+		if err != nil || realm.Host == "" {
+			return "", microerror.Maskf(unauthorizedError, "registry %#q has invalid token realm %#q", ref.Registry, params["realm"])
+		}
+
+		q := realm.Query()
+		if params["service"] != "" {
+			q.Set("service", params["service"])
+		}
+		q.Set("scope", fmt.Sprintf("repository:%s:pull", ref.Repository))
+		realm.RawQuery = q.Encode()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+		if err != nil {
+			return "", microerror.Mask(err)
+		}
+		if credentials.Username != "" {
+			req.SetBasicAuth(credentials.Username, credentials.Password)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return "", microerror.Maskf(pullFailedError, "requesting token from %#q: %s", realm.Host, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return "", microerror.Maskf(unauthorizedError, "requesting token from %#q failed with http status %d", realm.Host, resp.StatusCode)
+		}
+
+		var token struct {
+			AccessToken string `json:"access_token"`
+			Token       string `json:"token"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&token)
+		if err != nil {
+			return "", microerror.Maskf(unauthorizedError, "cannot parse token from %#q: %s", realm.Host, err)
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+
+		return "Bearer " + token.Token, nil
+	default:
+		return "", microerror.Maskf(unauthorizedError, "registry %#q requires unsupported authentication %#q", ref.Registry, scheme)
+	}
+}
+
+// parseChallenge parses a WWW-Authenticate header e.g.
+// Bearer realm="https://auth.example.com/token",service="registry".
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+
+	for _, p := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+	}
+
+	return parts[0], params
+}
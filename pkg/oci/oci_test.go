@@ -0,0 +1,339 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func Test_ParseReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+
+	testCases := []struct {
+		name              string
+		reference         string
+		expectedReference Reference
+		errorMatcher      func(error) bool
+	}{
+		{
+			name:      "case 0: tag",
+			reference: "oci://quay.io/giantswarm/prometheus:1.0.0",
+			expectedReference: Reference{
+				Registry:   "quay.io",
+				Repository: "giantswarm/prometheus",
+				Tag:        "1.0.0",
+			},
+		},
+		{
+			name:      "case 1: digest",
+			reference: "oci://localhost:5000/prometheus@" + digest,
+			expectedReference: Reference{
+				Registry:   "localhost:5000",
+				Repository: "prometheus",
+				Digest:     digest,
+			},
+		},
+		{
+			name:         "case 2: no tag or digest",
+			reference:    "oci://quay.io/giantswarm/prometheus",
+			errorMatcher: IsInvalidReference,
+		},
+		{
+			name:         "case 3: no repository",
+			reference:    "oci://quay.io",
+			errorMatcher: IsInvalidReference,
+		},
+		{
+			name:         "case 4: invalid digest",
+			reference:    "oci://quay.io/giantswarm/prometheus@sha256:abc",
+			errorMatcher: IsInvalidReference,
+		},
+		{
+			name:         "case 5: not an oci reference",
+			reference:    "https://example.com/prometheus-1.0.0.tgz",
+			errorMatcher: IsInvalidReference,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			result, err := ParseReference(tc.reference)
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if !reflect.DeepEqual(result, tc.expectedReference) {
+				t.Fatalf("reference == %#v, want %#v", result, tc.expectedReference)
+			}
+			if err == nil && result.String() != tc.reference {
+				t.Fatalf("String() == %#q, want %#q", result.String(), tc.reference)
+			}
+		})
+	}
+}
+
+func Test_CredentialsFromDockerConfig(t *testing.T) {
+	auth := base64.StdEncoding.EncodeToString([]byte("robot:secret"))
+
+	testCases := []struct {
+		name                string
+		config              string
+		registry            string
+		expectedCredentials Credentials
+		errorMatcher        func(error) bool
+	}{
+		{
+			name:                "case 0: auth",
+			config:              fmt.Sprintf(`{"auths":{"quay.io":{"auth":%q}}}`, auth),
+			registry:            "quay.io",
+			expectedCredentials: Credentials{Username: "robot", Password: "secret"},
+		},
+		{
+			name:                "case 1: username and password with url key",
+			config:              `{"auths":{"https://quay.io/v1/":{"username":"robot","password":"secret"}}}`,
+			registry:            "quay.io",
+			expectedCredentials: Credentials{Username: "robot", Password: "secret"},
+		},
+		{
+			name:     "case 2: other registry",
+			config:   fmt.Sprintf(`{"auths":{"quay.io":{"auth":%q}}}`, auth),
+			registry: "docker.io",
+		},
+		{
+			name:         "case 3: invalid json",
+			config:       `{`,
+			registry:     "quay.io",
+			errorMatcher: IsInvalidConfig,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			result, err := CredentialsFromDockerConfig([]byte(tc.config), tc.registry)
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if result != tc.expectedCredentials {
+				t.Fatalf("credentials == %#v, want %#v", result, tc.expectedCredentials)
+			}
+		})
+	}
+}
+
+func Test_Client(t *testing.T) {
+	ctx := context.Background()
+
+	chart := []byte("chart tarball")
+	chartSum := sha256.Sum256(chart)
+	layerDigest := "sha256:" + hex.EncodeToString(chartSum[:])
+
+	provenance := []byte("provenance")
+	provenanceSum := sha256.Sum256(provenance)
+	provenanceDigest := "sha256:" + hex.EncodeToString(provenanceSum[:])
+
+	m, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"layers": []map[string]string{
+			{"mediaType": provenanceLayerMediaType, "digest": provenanceDigest},
+			{"mediaType": chartLayerMediaType, "digest": layerDigest},
+		},
+	})
+	manifestSum := sha256.Sum256(m)
+	manifestDigest := "sha256:" + hex.EncodeToString(manifestSum[:])
+
+	payload := []byte(fmt.Sprintf(`{"critical":{"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"}}`, manifestDigest))
+	payloadSum := sha256.Sum256(payload)
+	payloadDigest := "sha256:" + hex.EncodeToString(payloadSum[:])
+
+	signatureManifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"layers": []map[string]interface{}{
+			{
+				"mediaType": signatureLayerMediaType,
+				"digest":    payloadDigest,
+				"annotations": map[string]string{
+					signatureAnnotation: base64.StdEncoding.EncodeToString([]byte("signature")),
+				},
+			},
+		},
+	})
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			username, password, _ := r.BasicAuth()
+			if username != "robot" || password != "secret" || r.URL.Query().Get("scope") != "repository:giantswarm/prometheus:pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"token":"registry-token"}`))
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer registry-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/giantswarm/prometheus/manifests/1.0.0", "/v2/giantswarm/prometheus/manifests/" + manifestDigest:
+			_, _ = w.Write(m)
+		case "/v2/giantswarm/prometheus/blobs/" + layerDigest:
+			_, _ = w.Write(chart)
+		case "/v2/giantswarm/prometheus/blobs/" + provenanceDigest:
+			_, _ = w.Write(provenance)
+		case "/v2/giantswarm/prometheus/manifests/sha256-" + hex.EncodeToString(manifestSum[:]) + ".sig":
+			_, _ = w.Write(signatureManifest)
+		case "/v2/giantswarm/prometheus/blobs/" + payloadDigest:
+			_, _ = w.Write(payload)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	fs := afero.NewMemMapFs()
+
+	c, err := New(Config{
+		Fs:         fs,
+		HTTPClient: server.Client(),
+	})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	registry := server.Listener.Addr().String()
+	credentials := Credentials{Username: "robot", Password: "secret"}
+
+	testCases := []struct {
+		name          string
+		reference     string
+		credentials   Credentials
+		expectedChart Chart
+		errorMatcher  func(error) bool
+	}{
+		{
+			name:        "case 0: pull by tag",
+			reference:   "oci://" + registry + "/giantswarm/prometheus:1.0.0",
+			credentials: credentials,
+			expectedChart: Chart{
+				ManifestDigest:   manifestDigest,
+				LayerDigest:      layerDigest,
+				ProvenanceDigest: provenanceDigest,
+			},
+		},
+		{
+			name:        "case 1: pull by digest",
+			reference:   "oci://" + registry + "/giantswarm/prometheus@" + manifestDigest,
+			credentials: credentials,
+			expectedChart: Chart{
+				ManifestDigest:   manifestDigest,
+				LayerDigest:      layerDigest,
+				ProvenanceDigest: provenanceDigest,
+			},
+		},
+		{
+			name:         "case 2: wrong credentials",
+			reference:    "oci://" + registry + "/giantswarm/prometheus:1.0.0",
+			credentials:  Credentials{Username: "robot", Password: "wrong"},
+			errorMatcher: IsUnauthorized,
+		},
+		{
+			name:         "case 3: tag not found",
+			reference:    "oci://" + registry + "/giantswarm/prometheus:2.0.0",
+			credentials:  credentials,
+			errorMatcher: IsNotFound,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			ref, err := ParseReference(tc.reference)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			result, err := c.Resolve(ctx, ref, tc.credentials)
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+			if err != nil {
+				return
+			}
+
+			if result != tc.expectedChart {
+				t.Fatalf("chart == %#v, want %#v", result, tc.expectedChart)
+			}
+
+			path, err := c.Pull(ctx, ref, result, tc.credentials)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			content, err := afero.ReadFile(fs, path)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+			if string(content) != string(chart) {
+				t.Fatalf("content == %#q, want %#q", content, chart)
+			}
+
+			content, err = c.PullProvenance(ctx, ref, result, tc.credentials)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+			if string(content) != string(provenance) {
+				t.Fatalf("provenance == %#q, want %#q", content, provenance)
+			}
+
+			expectedSignatures := []Signature{
+				{
+					Payload:   payload,
+					Signature: []byte("signature"),
+				},
+			}
+
+			signatures, err := c.PullSignatures(ctx, ref, result, tc.credentials)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+			if !reflect.DeepEqual(signatures, expectedSignatures) {
+				t.Fatalf("signatures == %#v, want %#v", signatures, expectedSignatures)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package provenance
+
+import (
+	"github.com/giantswarm/microerror"
+)
+
+var invalidKeyringError = &microerror.Error{
+	Kind: "invalidKeyringError",
+}
+
+// IsInvalidKeyring asserts invalidKeyringError.
+func IsInvalidKeyring(err error) bool {
+	return microerror.Cause(err) == invalidKeyringError
+}
+
+var invalidSignatureError = &microerror.Error{
+	Kind: "invalidSignatureError",
+}
+
+// IsInvalidSignature asserts invalidSignatureError.
+func IsInvalidSignature(err error) bool {
+	return microerror.Cause(err) == invalidSignatureError
+}
@@ -0,0 +1,104 @@
+// Package provenance verifies Helm chart provenance files. A provenance file
+// is a clearsigned document with the chart metadata and the SHA-256 digests of
+// the chart tarballs it was created for.
+package provenance
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"sigs.k8s.io/yaml"
+)
+
+// ReadKeyring parses an armored or binary OpenPGP keyring with the public keys
+// trusted to sign charts.
+func ReadKeyring(data []byte) (openpgp.EntityList, error) {
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, microerror.Maskf(invalidKeyringError, "%s", err)
+	}
+	if len(keyring) == 0 {
+		return nil, microerror.Maskf(invalidKeyringError, "keyring has no keys")
+	}
+
+	return keyring, nil
+}
+
+// Verify checks the provenance file is signed by a key in the keyring and
+// lists the digest of the chart tarball. It returns the identity of the
+// signer.
+func Verify(keyring openpgp.EntityList, provenance []byte, tarball io.Reader) (string, error) {
+	block, _ := clearsign.Decode(provenance)
+	if block == nil {
+		return "", microerror.Maskf(invalidSignatureError, "provenance has no signature block")
+	}
+
+	signer, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body)
+	if err != nil {
+		return "", microerror.Maskf(invalidSignatureError, "provenance signature is not valid: %s", err)
+	}
+
+	files, err := parseFiles(block.Plaintext)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	h := sha256.New()
+	_, err = io.Copy(h, tarball)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+	digest := "sha256:" + hex.EncodeToString(h.Sum(nil))
+
+	// The file names of the signed tarballs are not compared as cached
+	// tarballs are stored by digest. The signed digest is sufficient to
+	// identify the content.
+	for _, d := range files {
+		if d == digest {
+			return signerName(signer), nil
+		}
+	}
+
+	return "", microerror.Maskf(invalidSignatureError, "provenance has no file with digest %#q", digest)
+}
+
+// parseFiles returns the digests of the chart tarballs by file name from the
+// plaintext of the provenance file. The chart metadata and the files are
+// separate YAML documents.
+func parseFiles(plaintext []byte) (map[string]string, error) {
+	parts := strings.SplitN(string(plaintext), "\n...\n", 2)
+	if len(parts) != 2 {
+		return nil, microerror.Maskf(invalidSignatureError, "provenance has no files")
+	}
+
+	var sums struct {
+		Files map[string]string `json:"files"`
+	}
+	err := yaml.Unmarshal([]byte(parts[1]), &sums)
+	if err != nil {
+		return nil, microerror.Maskf(invalidSignatureError, "cannot parse provenance files: %s", err)
+	}
+	if len(sums.Files) == 0 {
+		return nil, microerror.Maskf(invalidSignatureError, "provenance has no files")
+	}
+
+	return sums.Files, nil
+}
+
+func signerName(signer *openpgp.Entity) string {
+	for name := range signer.Identities {
+		return name
+	}
+
+	return fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint)
+}
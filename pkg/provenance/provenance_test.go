@@ -0,0 +1,132 @@
+package provenance
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+func Test_Verify(t *testing.T) {
+	signer := newTestEntity(t, "Giant Swarm", "dev@giantswarm.io")
+	other := newTestEntity(t, "Other", "other@example.com")
+
+	keyring, err := ReadKeyring(armoredPublicKey(t, signer))
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	tarball := []byte("chart tarball")
+
+	testCases := []struct {
+		name           string
+		provenance     []byte
+		tarball        []byte
+		expectedSigner string
+		errorMatcher   func(error) bool
+	}{
+		{
+			name:           "case 0: valid provenance",
+			provenance:     newTestProvenance(t, signer, tarball),
+			tarball:        tarball,
+			expectedSigner: "Giant Swarm <dev@giantswarm.io>",
+		},
+		{
+			name:         "case 1: tarball was modified",
+			provenance:   newTestProvenance(t, signer, tarball),
+			tarball:      []byte("modified chart tarball"),
+			errorMatcher: IsInvalidSignature,
+		},
+		{
+			name:         "case 2: signed by key not in keyring",
+			provenance:   newTestProvenance(t, other, tarball),
+			tarball:      tarball,
+			errorMatcher: IsInvalidSignature,
+		},
+		{
+			name:         "case 3: not signed",
+			provenance:   []byte("name: prometheus\n"),
+			tarball:      tarball,
+			errorMatcher: IsInvalidSignature,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			result, err := Verify(keyring, tc.provenance, bytes.NewReader(tc.tarball))
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if result != tc.expectedSigner {
+				t.Fatalf("signer == %#q, want %#q", result, tc.expectedSigner)
+			}
+		})
+	}
+}
+
+func Test_ReadKeyring_invalid(t *testing.T) {
+	_, err := ReadKeyring([]byte("invalid"))
+	if !IsInvalidKeyring(err) {
+		t.Fatalf("error == %#v, want invalidKeyringError", err)
+	}
+}
+
+func newTestEntity(t *testing.T, name, email string) *openpgp.Entity {
+	e, err := openpgp.NewEntity(name, "", email, nil)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	return e
+}
+
+func armoredPublicKey(t *testing.T, e *openpgp.Entity) []byte {
+	var buf bytes.Buffer
+
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	err = e.Serialize(w)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	w.Close()
+
+	return buf.Bytes()
+}
+
+// newTestProvenance returns a provenance file in the format created by helm
+// package --sign.
+func newTestProvenance(t *testing.T, e *openpgp.Entity, tarball []byte) []byte {
+	sum := sha256.Sum256(tarball)
+	message := fmt.Sprintf("apiVersion: v2\nname: prometheus\nversion: 1.0.0\n\n...\nfiles:\n  prometheus-1.0.0.tgz: sha256:%s\n", hex.EncodeToString(sum[:]))
+
+	var buf bytes.Buffer
+
+	w, err := clearsign.Encode(&buf, e.PrivateKey, nil)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	_, err = w.Write([]byte(message))
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	w.Close()
+
+	return buf.Bytes()
+}
@@ -0,0 +1,23 @@
+package webhook
+
+import (
+	"github.com/giantswarm/microerror"
+)
+
+var expiredSignatureError = &microerror.Error{
+	Kind: "expiredSignatureError",
+}
+
+// IsExpiredSignature asserts expiredSignatureError.
+func IsExpiredSignature(err error) bool {
+	return microerror.Cause(err) == expiredSignatureError
+}
+
+var invalidSignatureError = &microerror.Error{
+	Kind: "invalidSignatureError",
+}
+
+// IsInvalidSignature asserts invalidSignatureError.
+func IsInvalidSignature(err error) bool {
+	return microerror.Cause(err) == invalidSignatureError
+}
@@ -0,0 +1,66 @@
+// Package webhook contains the signing of the status webhooks sent by
+// chart-operator. Receivers can use Verify to check the signature.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/microerror"
+)
+
+const (
+	// NonceHeader is the header with a random value unique to each request.
+	// Receivers should reject nonces they have already seen within the
+	// tolerance of the timestamp to prevent replays.
+	NonceHeader = "X-Chart-Operator-Nonce"
+
+	// SignatureHeader is the header with the HMAC-SHA256 signature of the
+	// timestamp, nonce and payload e.g. sha256=<hex>.
+	SignatureHeader = "X-Chart-Operator-Signature"
+
+	// TimestampHeader is the header with the unix time the request was
+	// signed.
+	TimestampHeader = "X-Chart-Operator-Timestamp"
+
+	signaturePrefix = "sha256="
+)
+
+// Sign returns the signature of the payload. The timestamp and nonce are
+// signed too so they can not be changed to replay a request.
+func Sign(key []byte, timestamp int64, nonce string, payload []byte) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(fmt.Sprintf("%d.%s.", timestamp, nonce)))
+	_, _ = mac.Write(payload)
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of the payload and that the timestamp is within
+// the tolerance of now.
+func Verify(key []byte, timestamp, nonce, signature string, payload []byte, now time.Time, tolerance time.Duration) error {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return microerror.Maskf(invalidSignatureError, "signature must start with %#q", signaturePrefix)
+	}
+
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return microerror.Maskf(invalidSignatureError, "timestamp %#q is not a unix time", timestamp)
+	}
+
+	signedAt := time.Unix(t, 0)
+	if now.Sub(signedAt) > tolerance || signedAt.Sub(now) > tolerance {
+		return microerror.Maskf(expiredSignatureError, "timestamp %s is not within %s of %s", signedAt.UTC(), tolerance, now.UTC())
+	}
+
+	if !hmac.Equal([]byte(Sign(key, t, nonce, payload)), []byte(signature)) {
+		return microerror.Maskf(invalidSignatureError, "signature does not match payload")
+	}
+
+	return nil
+}
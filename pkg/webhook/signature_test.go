@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_Verify(t *testing.T) {
+	key := []byte("secret")
+	payload := []byte(`{"status":"deployed"}`)
+	now := time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+	signature := Sign(key, now.Unix(), "abc", payload)
+
+	testCases := []struct {
+		name         string
+		key          []byte
+		timestamp    string
+		nonce        string
+		signature    string
+		payload      []byte
+		errorMatcher func(error) bool
+	}{
+		{
+			name:      "case 0: valid signature",
+			key:       key,
+			timestamp: strconv.FormatInt(now.Unix(), 10),
+			nonce:     "abc",
+			signature: signature,
+			payload:   payload,
+		},
+		{
+			name:         "case 1: changed payload",
+			key:          key,
+			timestamp:    strconv.FormatInt(now.Unix(), 10),
+			nonce:        "abc",
+			signature:    signature,
+			payload:      []byte(`{"status":"failed"}`),
+			errorMatcher: IsInvalidSignature,
+		},
+		{
+			name:         "case 2: changed nonce",
+			key:          key,
+			timestamp:    strconv.FormatInt(now.Unix(), 10),
+			nonce:        "def",
+			signature:    signature,
+			payload:      payload,
+			errorMatcher: IsInvalidSignature,
+		},
+		{
+			name:         "case 3: wrong key",
+			key:          []byte("other"),
+			timestamp:    strconv.FormatInt(now.Unix(), 10),
+			nonce:        "abc",
+			signature:    signature,
+			payload:      payload,
+			errorMatcher: IsInvalidSignature,
+		},
+		{
+			name:         "case 4: expired timestamp",
+			key:          key,
+			timestamp:    strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10),
+			nonce:        "abc",
+			signature:    Sign(key, now.Add(-10*time.Minute).Unix(), "abc", payload),
+			payload:      payload,
+			errorMatcher: IsExpiredSignature,
+		},
+		{
+			name:         "case 5: missing prefix",
+			key:          key,
+			timestamp:    strconv.FormatInt(now.Unix(), 10),
+			nonce:        "abc",
+			signature:    signature[len(signaturePrefix):],
+			payload:      payload,
+			errorMatcher: IsInvalidSignature,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			err := Verify(tc.key, tc.timestamp, tc.nonce, tc.signature, tc.payload, now, 5*time.Minute)
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+		})
+	}
+}
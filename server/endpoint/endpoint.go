@@ -6,6 +6,8 @@ import (
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/micrologger"
 
+	"github.com/giantswarm/chart-operator/v2/server/endpoint/releaseoperations"
+	"github.com/giantswarm/chart-operator/v2/server/endpoint/shutdown"
 	"github.com/giantswarm/chart-operator/v2/service"
 )
 
@@ -17,8 +19,10 @@ type Config struct {
 
 // Endpoint is the endpoint collection.
 type Endpoint struct {
-	Healthz *healthz.Endpoint
-	Version *version.Endpoint
+	Healthz           *healthz.Endpoint
+	ReleaseOperations *releaseoperations.Endpoint
+	Shutdown          *shutdown.Endpoint
+	Version           *version.Endpoint
 }
 
 // New creates a new endpoint with given configuration.
@@ -44,6 +48,32 @@ func New(config Config) (*Endpoint, error) {
 		}
 	}
 
+	var releaseOperationsEndpoint *releaseoperations.Endpoint
+	{
+		c := releaseoperations.Config{
+			Logger:            config.Logger,
+			ReleaseOperations: config.Service.ReleaseOperations,
+		}
+
+		releaseOperationsEndpoint, err = releaseoperations.New(c)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	}
+
+	var shutdownEndpoint *shutdown.Endpoint
+	{
+		c := shutdown.Config{
+			Logger:  config.Logger,
+			Service: config.Service,
+		}
+
+		shutdownEndpoint, err = shutdown.New(c)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	}
+
 	var versionEndpoint *version.Endpoint
 	{
 		c := version.Config{
@@ -58,8 +88,10 @@ func New(config Config) (*Endpoint, error) {
 	}
 
 	endpoint := &Endpoint{
-		Healthz: healthzEndpoint,
-		Version: versionEndpoint,
+		Healthz:           healthzEndpoint,
+		ReleaseOperations: releaseOperationsEndpoint,
+		Shutdown:          shutdownEndpoint,
+		Version:           versionEndpoint,
 	}
 
 	return endpoint, nil
@@ -0,0 +1,95 @@
+// Package releaseoperations provides a debug endpoint listing the Helm
+// operations in progress.
+package releaseoperations
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	kitendpoint "github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+
+	"github.com/giantswarm/chart-operator/v2/service/releaseoperation"
+)
+
+const (
+	// Method is the HTTP method this endpoint is registered for.
+	Method = "GET"
+	// Name identifies the endpoint. It is aligned to the package path.
+	Name = "releaseoperations"
+	// Path is the HTTP request path this endpoint is registered for.
+	Path = "/debug/release-operations"
+)
+
+// Config represents the configuration used to create a release operations
+// endpoint.
+type Config struct {
+	Logger            micrologger.Logger
+	ReleaseOperations *releaseoperation.Manager
+}
+
+type Endpoint struct {
+	logger            micrologger.Logger
+	releaseOperations *releaseoperation.Manager
+}
+
+// New creates a new configured release operations endpoint.
+func New(config Config) (*Endpoint, error) {
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
+	}
+	if config.ReleaseOperations == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.ReleaseOperations must not be empty", config)
+	}
+
+	e := &Endpoint{
+		logger:            config.Logger,
+		releaseOperations: config.ReleaseOperations,
+	}
+
+	return e, nil
+}
+
+func (e *Endpoint) Decoder() kithttp.DecodeRequestFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+}
+
+func (e *Endpoint) Encoder() kithttp.EncodeResponseFunc {
+	return func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+		operations, ok := response.([]releaseoperation.Operation)
+		if !ok {
+			return microerror.Maskf(wrongTypeError, "expected '%T' got '%T'", []releaseoperation.Operation{}, response)
+		}
+
+		return json.NewEncoder(w).Encode(operations)
+	}
+}
+
+func (e *Endpoint) Endpoint() kitendpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return e.releaseOperations.List(), nil
+	}
+}
+
+func (e *Endpoint) Method() string {
+	return Method
+}
+
+func (e *Endpoint) Middlewares() []kitendpoint.Middleware {
+	return []kitendpoint.Middleware{}
+}
+
+func (e *Endpoint) Name() string {
+	return Name
+}
+
+func (e *Endpoint) Path() string {
+	return Path
+}
@@ -0,0 +1,109 @@
+// Package shutdown provides the endpoint called by the preStop hook of the
+// pod. It waits for the Helm operations in progress before the pod receives
+// SIGTERM as microkit exits 3 seconds after the signal.
+package shutdown
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	kitendpoint "github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+const (
+	// Method is the HTTP method this endpoint is registered for.
+	Method = "POST"
+	// Name identifies the endpoint. It is aligned to the package path.
+	Name = "shutdown"
+	// Path is the HTTP request path this endpoint is registered for.
+	Path = "/shutdown"
+)
+
+// Service is shut down by the endpoint.
+type Service interface {
+	Shutdown(ctx context.Context)
+}
+
+// Config represents the configuration used to create a shutdown endpoint.
+type Config struct {
+	Logger  micrologger.Logger
+	Service Service
+}
+
+type Endpoint struct {
+	logger  micrologger.Logger
+	service Service
+}
+
+// New creates a new configured shutdown endpoint.
+func New(config Config) (*Endpoint, error) {
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
+	}
+	if config.Service == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Service must not be empty", config)
+	}
+
+	e := &Endpoint{
+		logger:  config.Logger,
+		service: config.Service,
+	}
+
+	return e, nil
+}
+
+// Decoder only accepts requests from the loopback interface. The preStop hook
+// runs in the container so the operator cannot be stopped from outside the
+// pod.
+func (e *Endpoint) Decoder() kithttp.DecodeRequestFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		ip := net.ParseIP(host)
+		if ip == nil || !ip.IsLoopback() {
+			return nil, microerror.Maskf(notLoopbackError, "request from %#q", r.RemoteAddr)
+		}
+
+		return nil, nil
+	}
+}
+
+func (e *Endpoint) Encoder() kithttp.EncodeResponseFunc {
+	return func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+}
+
+func (e *Endpoint) Endpoint() kitendpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		e.logger.Debugf(ctx, "shutting down")
+		e.service.Shutdown(ctx)
+		e.logger.Debugf(ctx, "shut down")
+
+		return nil, nil
+	}
+}
+
+func (e *Endpoint) Method() string {
+	return Method
+}
+
+func (e *Endpoint) Middlewares() []kitendpoint.Middleware {
+	return []kitendpoint.Middleware{}
+}
+
+func (e *Endpoint) Name() string {
+	return Name
+}
+
+func (e *Endpoint) Path() string {
+	return Path
+}
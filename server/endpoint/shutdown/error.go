@@ -0,0 +1,23 @@
+package shutdown
+
+import (
+	"github.com/giantswarm/microerror"
+)
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var notLoopbackError = &microerror.Error{
+	Kind: "notLoopbackError",
+}
+
+// IsNotLoopback asserts notLoopbackError.
+func IsNotLoopback(err error) bool {
+	return microerror.Cause(err) == notLoopbackError
+}
@@ -63,6 +63,8 @@ func New(config Config) (microserver.Server, error) {
 			Viper:       config.Viper,
 			Endpoints: []microserver.Endpoint{
 				endpointCollection.Healthz,
+				endpointCollection.ReleaseOperations,
+				endpointCollection.Shutdown,
 				endpointCollection.Version,
 			},
 			ErrorEncoder: errorEncoder,
@@ -0,0 +1,200 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/apiextensions/v3/pkg/clientset/versioned"
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	"github.com/giantswarm/to"
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+)
+
+const (
+	chartSubsystem = "chart"
+)
+
+var chartLabels = []string{"namespace", "name", "release", "release_namespace"}
+
+var (
+	chartInfoDesc *prometheus.Desc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, chartSubsystem, "info"),
+		"Chart and app version of the release of the chart CR.",
+		append(chartLabels, "version", "app_version"),
+		nil,
+	)
+	chartStatusDesc *prometheus.Desc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, chartSubsystem, "status"),
+		"Status of the release of the chart CR. The value is always 1.",
+		append(chartLabels, "status"),
+		nil,
+	)
+	chartRevisionDesc *prometheus.Desc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, chartSubsystem, "revision"),
+		"Revision of the release of the chart CR.",
+		chartLabels,
+		nil,
+	)
+	chartLastDeployedDesc *prometheus.Desc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, chartSubsystem, "last_deployed_timestamp_seconds"),
+		"Unix time the release of the chart CR was last deployed.",
+		chartLabels,
+		nil,
+	)
+	chartRollbackCountDesc *prometheus.Desc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, chartSubsystem, "rollback_count"),
+		"Rollbacks of the release of the chart CR from a pending status.",
+		chartLabels,
+		nil,
+	)
+	chartFailedMaxAttemptsDesc *prometheus.Desc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, chartSubsystem, "failed_max_attempts"),
+		"Whether the release of the chart CR failed the maximum number of attempts in a row.",
+		chartLabels,
+		nil,
+	)
+)
+
+type ChartConfig struct {
+	G8sClient versioned.Interface
+	Logger    micrologger.Logger
+}
+
+// Chart exports the status of the release of each chart CR. The chart CRs are
+// read from an informer cache so scrapes do not list them.
+type Chart struct {
+	logger micrologger.Logger
+
+	chartInformer cache.SharedIndexInformer
+}
+
+func NewChart(config ChartConfig) (*Chart, error) {
+	if config.G8sClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.G8sClient must not be empty", config)
+	}
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
+	}
+
+	chartInformer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return config.G8sClient.ApplicationV1alpha1().Charts(metav1.NamespaceAll).List(context.Background(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return config.G8sClient.ApplicationV1alpha1().Charts(metav1.NamespaceAll).Watch(context.Background(), options)
+			},
+		},
+		&v1alpha1.Chart{},
+		0,
+		cache.Indexers{},
+	)
+
+	c := &Chart{
+		logger: config.Logger,
+
+		chartInformer: chartInformer,
+	}
+
+	return c, nil
+}
+
+// Run starts the informer and blocks until the context is done.
+func (c *Chart) Run(ctx context.Context) {
+	c.chartInformer.Run(ctx.Done())
+}
+
+func (c *Chart) Collect(ch chan<- prometheus.Metric) error {
+	if !c.chartInformer.HasSynced() {
+		c.logger.Log("level", "debug", "message", "chart CR cache not synced yet, not collecting chart metrics")
+		return nil
+	}
+
+	for _, obj := range c.chartInformer.GetStore().List() {
+		cr, ok := obj.(*v1alpha1.Chart)
+		if !ok {
+			continue
+		}
+
+		collectChart(ch, *cr)
+	}
+
+	return nil
+}
+
+// Describe emits the description for the metrics collected here.
+func (c *Chart) Describe(ch chan<- *prometheus.Desc) error {
+	ch <- chartInfoDesc
+	ch <- chartStatusDesc
+	ch <- chartRevisionDesc
+	ch <- chartLastDeployedDesc
+	ch <- chartRollbackCountDesc
+	ch <- chartFailedMaxAttemptsDesc
+	return nil
+}
+
+func collectChart(ch chan<- prometheus.Metric, cr v1alpha1.Chart) {
+	status := key.ChartStatus(cr)
+	labels := []string{cr.Namespace, cr.Name, key.ReleaseName(cr), key.Namespace(cr)}
+
+	ch <- prometheus.MustNewConstMetric(
+		chartInfoDesc,
+		prometheus.GaugeValue,
+		1,
+		append(labels, status.Version, status.AppVersion)...,
+	)
+
+	if status.Release.Status != "" {
+		ch <- prometheus.MustNewConstMetric(
+			chartStatusDesc,
+			prometheus.GaugeValue,
+			1,
+			append(labels, status.Release.Status)...,
+		)
+	}
+
+	if status.Release.Revision != nil {
+		ch <- prometheus.MustNewConstMetric(
+			chartRevisionDesc,
+			prometheus.GaugeValue,
+			float64(to.Int(status.Release.Revision)),
+			labels...,
+		)
+	}
+
+	if status.Release.LastDeployed != nil {
+		ch <- prometheus.MustNewConstMetric(
+			chartLastDeployedDesc,
+			prometheus.GaugeValue,
+			float64(status.Release.LastDeployed.Unix()),
+			labels...,
+		)
+	}
+
+	// Invalid rollback counts are reported by the release resource.
+	rollbackCount, _ := key.RollbackCount(cr)
+	ch <- prometheus.MustNewConstMetric(
+		chartRollbackCountDesc,
+		prometheus.GaugeValue,
+		float64(rollbackCount),
+		labels...,
+	)
+
+	var failedMaxAttempts float64
+	if key.IsFailedMaxAttempts(cr) {
+		failedMaxAttempts = 1
+	}
+	ch <- prometheus.MustNewConstMetric(
+		chartFailedMaxAttemptsDesc,
+		prometheus.GaugeValue,
+		failedMaxAttempts,
+		labels...,
+	)
+}
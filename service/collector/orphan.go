@@ -0,0 +1,67 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/micrologger"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/giantswarm/chart-operator/v2/service/orphan"
+)
+
+// orphanAgeBuckets are the upper bounds in seconds of the orphan age
+// histogram buckets from one hour to 30 days.
+var orphanAgeBuckets = []float64{
+	(1 * time.Hour).Seconds(),
+	(6 * time.Hour).Seconds(),
+	(24 * time.Hour).Seconds(),
+	(7 * 24 * time.Hour).Seconds(),
+	(30 * 24 * time.Hour).Seconds(),
+}
+
+// collectOrphans emits the number of orphaned objects per namespace and the
+// histogram of their age since they were created.
+func collectOrphans(ch chan<- prometheus.Metric, logger micrologger.Logger, countDesc, ageDesc *prometheus.Desc, orphans []orphan.Object) {
+	now := time.Now()
+
+	perNamespace := map[string]int{}
+	buckets := map[float64]uint64{}
+	var sum float64
+	var names []string
+
+	for _, o := range orphans {
+		perNamespace[o.Namespace]++
+
+		age := now.Sub(o.CreationTimestamp.Time).Seconds()
+		sum += age
+		for _, b := range orphanAgeBuckets {
+			if age <= b {
+				buckets[b]++
+			}
+		}
+
+		names = append(names, fmt.Sprintf("%s.%s", o.Namespace, o.Name))
+	}
+
+	for namespace, count := range perNamespace {
+		ch <- prometheus.MustNewConstMetric(
+			countDesc,
+			prometheus.GaugeValue,
+			float64(count),
+			namespace,
+		)
+	}
+
+	ch <- prometheus.MustNewConstHistogram(
+		ageDesc,
+		uint64(len(orphans)),
+		sum,
+		buckets,
+	)
+
+	if len(orphans) > 0 {
+		logger.Log("level", "debug", "message", fmt.Sprintf("found %d orphan %ss %s", len(orphans), strings.ToLower(orphans[0].Kind), strings.Join(names, " ")))
+	}
+}
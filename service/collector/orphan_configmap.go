@@ -2,24 +2,26 @@ package collector
 
 import (
 	"context"
-	"fmt"
-	"strings"
 
 	"github.com/giantswarm/apiextensions/v3/pkg/clientset/versioned"
-	"github.com/giantswarm/apiextensions/v3/pkg/label"
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/micrologger"
 	"github.com/prometheus/client_golang/prometheus"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 
-	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+	"github.com/giantswarm/chart-operator/v2/service/orphan"
 )
 
 var (
 	orphanConfigMapDesc *prometheus.Desc = prometheus.NewDesc(
 		prometheus.BuildFQName(Namespace, "configmap", "orphan"),
-		"Configmaps without a chart CR.",
+		"Configmaps without a chart CR by namespace.",
+		[]string{"namespace"},
+		nil,
+	)
+	orphanConfigMapAgeDesc *prometheus.Desc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "configmap", "orphan_age_seconds"),
+		"Age of the configmaps without a chart CR since they were created.",
 		[]string{},
 		nil,
 	)
@@ -60,42 +62,12 @@ func NewOrphanConfigMap(config OrphanConfigMapConfig) (*OrphanConfigMap, error)
 func (oc *OrphanConfigMap) Collect(ch chan<- prometheus.Metric) error {
 	ctx := context.Background()
 
-	charts, err := oc.g8sClient.ApplicationV1alpha1().Charts("").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return microerror.Mask(err)
-	}
-
-	desiredConfigMaps := make(map[[2]string]bool)
-
-	for _, chart := range charts.Items {
-		desiredConfigMaps[[2]string{key.ConfigMapNamespace(chart), key.ConfigMapName(chart)}] = true
-	}
-
-	lo := metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("%s=%s", label.ManagedBy, "app-operator"),
-	}
-	configMaps, err := oc.k8sClient.CoreV1().ConfigMaps("").List(ctx, lo)
+	orphans, err := orphan.ConfigMaps(ctx, oc.g8sClient, oc.k8sClient)
 	if err != nil {
 		return microerror.Mask(err)
 	}
 
-	var orphanConfigMaps []string
-
-	for _, cm := range configMaps.Items {
-		if !desiredConfigMaps[[2]string{cm.Namespace, cm.Name}] {
-			orphanConfigMaps = append(orphanConfigMaps, fmt.Sprintf("%s.%s", cm.Namespace, cm.Name))
-		}
-	}
-
-	ch <- prometheus.MustNewConstMetric(
-		orphanConfigMapDesc,
-		prometheus.GaugeValue,
-		float64(len(orphanConfigMaps)),
-	)
-
-	if len(orphanConfigMaps) > 0 {
-		oc.logger.Log("level", "debug", "message", fmt.Sprintf("found %d orphan configmaps %s", len(orphanConfigMaps), strings.Join(orphanConfigMaps, " ")))
-	}
+	collectOrphans(ch, oc.logger, orphanConfigMapDesc, orphanConfigMapAgeDesc, orphans)
 
 	return nil
 }
@@ -103,5 +75,6 @@ func (oc *OrphanConfigMap) Collect(ch chan<- prometheus.Metric) error {
 // Describe emits the description for the metrics collected here.
 func (oc *OrphanConfigMap) Describe(ch chan<- *prometheus.Desc) error {
 	ch <- orphanConfigMapDesc
+	ch <- orphanConfigMapAgeDesc
 	return nil
 }
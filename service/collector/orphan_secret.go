@@ -2,24 +2,26 @@ package collector
 
 import (
 	"context"
-	"fmt"
-	"strings"
 
 	"github.com/giantswarm/apiextensions/v3/pkg/clientset/versioned"
-	"github.com/giantswarm/apiextensions/v3/pkg/label"
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/micrologger"
 	"github.com/prometheus/client_golang/prometheus"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 
-	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+	"github.com/giantswarm/chart-operator/v2/service/orphan"
 )
 
 var (
 	orphanSecretDesc *prometheus.Desc = prometheus.NewDesc(
 		prometheus.BuildFQName(Namespace, "secret", "orphan"),
-		"Secrets without a chart CR.",
+		"Secrets without a chart CR by namespace.",
+		[]string{"namespace"},
+		nil,
+	)
+	orphanSecretAgeDesc *prometheus.Desc = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "secret", "orphan_age_seconds"),
+		"Age of the secrets without a chart CR since they were created.",
 		[]string{},
 		nil,
 	)
@@ -60,42 +62,12 @@ func NewOrphanSecret(config OrphanSecretConfig) (*OrphanSecret, error) {
 func (oc *OrphanSecret) Collect(ch chan<- prometheus.Metric) error {
 	ctx := context.Background()
 
-	charts, err := oc.g8sClient.ApplicationV1alpha1().Charts("").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return microerror.Mask(err)
-	}
-
-	desiredSecrets := make(map[[2]string]bool)
-
-	for _, chart := range charts.Items {
-		desiredSecrets[[2]string{key.SecretNamespace(chart), key.SecretName(chart)}] = true
-	}
-
-	lo := metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("%s=%s", label.ManagedBy, "app-operator"),
-	}
-	secrets, err := oc.k8sClient.CoreV1().Secrets("").List(ctx, lo)
+	orphans, err := orphan.Secrets(ctx, oc.g8sClient, oc.k8sClient)
 	if err != nil {
 		return microerror.Mask(err)
 	}
 
-	var orphanSecrets []string
-
-	for _, cm := range secrets.Items {
-		if !desiredSecrets[[2]string{cm.Namespace, cm.Name}] {
-			orphanSecrets = append(orphanSecrets, fmt.Sprintf("%s.%s", cm.Namespace, cm.Name))
-		}
-	}
-
-	ch <- prometheus.MustNewConstMetric(
-		orphanSecretDesc,
-		prometheus.GaugeValue,
-		float64(len(orphanSecrets)),
-	)
-
-	if len(orphanSecrets) > 0 {
-		oc.logger.Log("level", "debug", "message", fmt.Sprintf("found %d orphan secrets %s", len(orphanSecrets), strings.Join(orphanSecrets, " ")))
-	}
+	collectOrphans(ch, oc.logger, orphanSecretDesc, orphanSecretAgeDesc, orphans)
 
 	return nil
 }
@@ -103,5 +75,6 @@ func (oc *OrphanSecret) Collect(ch chan<- prometheus.Metric) error {
 // Describe emits the description for the metrics collected here.
 func (oc *OrphanSecret) Describe(ch chan<- *prometheus.Desc) error {
 	ch <- orphanSecretDesc
+	ch <- orphanSecretAgeDesc
 	return nil
 }
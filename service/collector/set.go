@@ -1,6 +1,8 @@
 package collector
 
 import (
+	"context"
+
 	"github.com/giantswarm/exporterkit/collector"
 	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
 	"github.com/giantswarm/k8sclient/v5/pkg/k8sclient"
@@ -21,6 +23,8 @@ type SetConfig struct {
 // have to alias packages.
 type Set struct {
 	*collector.Set
+
+	chartCollector *Chart
 }
 
 func NewSet(config SetConfig) (*Set, error) {
@@ -40,6 +44,19 @@ func NewSet(config SetConfig) (*Set, error) {
 
 	var err error
 
+	var chartCollector *Chart
+	{
+		c := ChartConfig{
+			G8sClient: config.K8sClient.G8sClient(),
+			Logger:    config.Logger,
+		}
+
+		chartCollector, err = NewChart(c)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	}
+
 	var helmV2ReleaseCollector *HelmV2Release
 	{
 		c := HelmV2ReleaseConfig{
@@ -87,6 +104,7 @@ func NewSet(config SetConfig) (*Set, error) {
 	{
 		c := collector.SetConfig{
 			Collectors: []collector.Interface{
+				chartCollector,
 				helmV2ReleaseCollector,
 				orphanConfigMapCollector,
 				orphanSecretCollector,
@@ -102,7 +120,22 @@ func NewSet(config SetConfig) (*Set, error) {
 
 	s := &Set{
 		Set: collectorSet,
+
+		chartCollector: chartCollector,
 	}
 
 	return s, nil
 }
+
+// Boot starts the chart CR informer of the chart collector and registers the
+// collectors.
+func (s *Set) Boot(ctx context.Context) error {
+	go s.chartCollector.Run(ctx)
+
+	err := s.Set.Boot(ctx)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
@@ -12,25 +12,41 @@ import (
 	"github.com/giantswarm/operatorkit/v4/pkg/controller"
 	"github.com/giantswarm/operatorkit/v4/pkg/resource"
 	"github.com/spf13/afero"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
 	"github.com/giantswarm/chart-operator/v2/pkg/project"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
+	"github.com/giantswarm/chart-operator/v2/service/helmstorage"
+	"github.com/giantswarm/chart-operator/v2/service/releaseoperation"
+	"github.com/giantswarm/chart-operator/v2/service/webhookoutbox"
 )
 
 const chartControllerSuffix = "-chart"
 
 type Config struct {
-	Fs         afero.Fs
-	HelmClient helmclient.Interface
-	K8sClient  k8sclient.Interface
-	Logger     micrologger.Logger
-
-	HTTPClientTimeout time.Duration
-	K8sWaitTimeout    time.Duration
-	MaxRollback       int
-	TillerNamespace   string
+	Fs                afero.Fs
+	HelmClient        helmclient.Interface
+	HelmStorage       *helmstorage.Storage
+	K8sClient         k8sclient.Interface
+	Logger            micrologger.Logger
+	ReleaseOperations *releaseoperation.Manager
+	RESTMapper        meta.RESTMapper
+	WebhookOutbox     *webhookoutbox.Outbox
+
+	DriftCheckInterval  time.Duration
+	HTTPClientTimeout   time.Duration
+	K8sWaitTimeout      time.Duration
+	MaxRollback         int
+	SecretNamespaces    []string
+	SelfHealInterval    time.Duration
+	TarballCacheMaxSize int64
+	TillerNamespace     string
+	VerifyPolicy        string
 }
 
 type Chart struct {
@@ -43,12 +59,24 @@ func NewChart(config Config) (*Chart, error) {
 	if config.Fs == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.Fs must not be empty", config)
 	}
+	if config.HelmStorage == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.HelmStorage must not be empty", config)
+	}
 	if config.K8sClient == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.K8sClient must not be empty", config)
 	}
 	if config.Logger == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
 	}
+	if config.ReleaseOperations == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.ReleaseOperations must not be empty", config)
+	}
+	if config.RESTMapper == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.RESTMapper must not be empty", config)
+	}
+	if config.WebhookOutbox == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.WebhookOutbox must not be empty", config)
+	}
 
 	if config.TillerNamespace == "" {
 		return nil, microerror.Maskf(invalidConfigError, "%T.TillerNamespace must not be empty", config)
@@ -65,19 +93,43 @@ func NewChart(config Config) (*Chart, error) {
 		return ctx, nil
 	}
 
+	// eventRecorder emits Kubernetes events for chart CRs.
+	var eventRecorder record.EventRecorder
+	{
+		eventBroadcaster := record.NewBroadcaster()
+		eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+			Interface: config.K8sClient.K8sClient().CoreV1().Events(""),
+		})
+
+		eventRecorder = eventBroadcaster.NewRecorder(config.K8sClient.Scheme(), corev1.EventSource{
+			Component: project.Name(),
+		})
+	}
+
 	var resources []resource.Interface
 	{
 		c := chartResourcesConfig{
-			Fs:         config.Fs,
-			G8sClient:  config.K8sClient.G8sClient(),
-			HelmClient: config.HelmClient,
-			K8sClient:  config.K8sClient.K8sClient(),
-			Logger:     config.Logger,
-
-			HTTPClientTimeout: config.HTTPClientTimeout,
-			K8sWaitTimeout:    config.K8sWaitTimeout,
-			MaxRollback:       config.MaxRollback,
-			TillerNamespace:   config.TillerNamespace,
+			DynamicClient:     config.K8sClient.DynClient(),
+			EventRecorder:     eventRecorder,
+			Fs:                config.Fs,
+			G8sClient:         config.K8sClient.G8sClient(),
+			HelmClient:        config.HelmClient,
+			HelmStorage:       config.HelmStorage,
+			K8sClient:         config.K8sClient.K8sClient(),
+			Logger:            config.Logger,
+			ReleaseOperations: config.ReleaseOperations,
+			RESTMapper:        config.RESTMapper,
+			WebhookOutbox:     config.WebhookOutbox,
+
+			DriftCheckInterval:  config.DriftCheckInterval,
+			HTTPClientTimeout:   config.HTTPClientTimeout,
+			K8sWaitTimeout:      config.K8sWaitTimeout,
+			MaxRollback:         config.MaxRollback,
+			SecretNamespaces:    config.SecretNamespaces,
+			SelfHealInterval:    config.SelfHealInterval,
+			TarballCacheMaxSize: config.TarballCacheMaxSize,
+			TillerNamespace:     config.TillerNamespace,
+			VerifyPolicy:        config.VerifyPolicy,
 		}
 
 		resources, err = newChartResources(c)
@@ -15,13 +15,27 @@ type Context struct {
 }
 
 type Status struct {
-	Reason  string
-	Release Release
+	// ChartPullFailed is true when the chart tarball could not be pulled.
+	ChartPullFailed bool
+	Reason          string
+	Release         Release
+	// ValuesProvenance lists the configmaps and secrets setting each
+	// top-level key of the values.
+	ValuesProvenance string
+	// ValuesResolveFailed is true when the configmaps and secrets providing
+	// the values could not be read.
+	ValuesResolveFailed bool
 }
 
 type Release struct {
+	// DriftedObjects are the objects of the deployed release that were
+	// changed or deleted in the cluster.
+	DriftedObjects    []string
 	FailedMaxAttempts bool
 	Status            string
+	// UnhealthyWorkloads are the workloads of the deployed release that are
+	// not ready when the health check is enabled.
+	UnhealthyWorkloads []string
 }
 
 func NewContext(ctx context.Context, c Context) context.Context {
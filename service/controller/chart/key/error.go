@@ -11,6 +11,42 @@ func IsEmptyValueError(err error) bool {
 	return microerror.Cause(err) == emptyValueError
 }
 
+var invalidChartDigestError = &microerror.Error{
+	Kind: "invalidChartDigestError",
+}
+
+// IsInvalidChartDigestError asserts invalidChartDigestError.
+func IsInvalidChartDigestError(err error) bool {
+	return microerror.Cause(err) == invalidChartDigestError
+}
+
+var invalidCordonUntilError = &microerror.Error{
+	Kind: "invalidCordonUntilError",
+}
+
+// IsInvalidCordonUntilError asserts invalidCordonUntilError.
+func IsInvalidCordonUntilError(err error) bool {
+	return microerror.Cause(err) == invalidCordonUntilError
+}
+
+var invalidHealthCheckDeadlineError = &microerror.Error{
+	Kind: "invalidHealthCheckDeadlineError",
+}
+
+// IsInvalidHealthCheckDeadlineError asserts invalidHealthCheckDeadlineError.
+func IsInvalidHealthCheckDeadlineError(err error) bool {
+	return microerror.Cause(err) == invalidHealthCheckDeadlineError
+}
+
+var invalidValuesSourcesError = &microerror.Error{
+	Kind: "invalidValuesSourcesError",
+}
+
+// IsInvalidValuesSourcesError asserts invalidValuesSourcesError.
+func IsInvalidValuesSourcesError(err error) bool {
+	return microerror.Cause(err) == invalidValuesSourcesError
+}
+
 var wrongTypeError = &microerror.Error{
 	Kind: "wrongTypeError",
 }
@@ -19,3 +55,21 @@ var wrongTypeError = &microerror.Error{
 func IsWrongTypeError(err error) bool {
 	return microerror.Cause(err) == wrongTypeError
 }
+
+var invalidMaxHistoryError = &microerror.Error{
+	Kind: "invalidMaxHistoryError",
+}
+
+// IsInvalidMaxHistoryError asserts invalidMaxHistoryError.
+func IsInvalidMaxHistoryError(err error) bool {
+	return microerror.Cause(err) == invalidMaxHistoryError
+}
+
+var invalidPriorityError = &microerror.Error{
+	Kind: "invalidPriorityError",
+}
+
+// IsInvalidPriorityError asserts invalidPriorityError.
+func IsInvalidPriorityError(err error) bool {
+	return microerror.Cause(err) == invalidPriorityError
+}
@@ -1,15 +1,40 @@
 package key
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
 	"github.com/giantswarm/apiextensions/v3/pkg/label"
+	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
 	"github.com/giantswarm/microerror"
 
 	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/pkg/project"
 )
 
+// ChartDigest parses the chart digest annotation and returns the hex encoded
+// SHA-256 digest. It returns an empty string when the annotation is not set.
+func ChartDigest(customResource v1alpha1.Chart) (string, error) {
+	val, ok := customResource.GetAnnotations()[annotation.ChartDigest]
+	if !ok {
+		return "", nil
+	}
+
+	digest := strings.ToLower(strings.TrimPrefix(val, "sha256:"))
+
+	b, err := hex.DecodeString(digest)
+	if err != nil || len(b) != 32 {
+		return "", microerror.Maskf(invalidChartDigestError, "cannot parse %#q as SHA-256 digest", val)
+	}
+
+	return digest, nil
+}
+
 func ChartStatus(customResource v1alpha1.Chart) v1alpha1.ChartStatus {
 	return customResource.Status
 }
@@ -34,6 +59,80 @@ func CordonUntil(customResource v1alpha1.Chart) string {
 	return customResource.GetAnnotations()[annotation.CordonUntilDate]
 }
 
+// CordonUntilDate parses the cordon-until annotation. The date must be in
+// RFC 3339 format e.g. 2019-12-31T23:59:59Z.
+func CordonUntilDate(customResource v1alpha1.Chart) (time.Time, error) {
+	cordonUntil := CordonUntil(customResource)
+
+	t, err := time.Parse(time.RFC3339, cordonUntil)
+	if err != nil {
+		return time.Time{}, microerror.Maskf(invalidCordonUntilError, "cannot parse %#q as RFC 3339 date", cordonUntil)
+	}
+
+	return t, nil
+}
+
+// CredentialsSecret returns the namespace and name of the secret with the
+// credentials for pulling the chart tarball. The namespace defaults to the
+// chart CR namespace. The name is empty when the annotation is not set.
+func CredentialsSecret(customResource v1alpha1.Chart) (string, string) {
+	return secretReference(customResource, annotation.CredentialsSecret)
+}
+
+// DependsOn returns the names of the chart CRs in the same namespace the
+// release depends on. Duplicate and empty names are ignored.
+func DependsOn(customResource v1alpha1.Chart) []string {
+	val, ok := customResource.GetAnnotations()[annotation.DependsOn]
+	if !ok {
+		return nil
+	}
+
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(val, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// DriftIgnore returns the field paths of the drift ignore annotation which are
+// not compared by the drift check. Empty paths are ignored.
+func DriftIgnore(customResource v1alpha1.Chart) []string {
+	val, ok := customResource.GetAnnotations()[annotation.DriftIgnore]
+	if !ok {
+		return nil
+	}
+
+	var paths []string
+	for _, path := range strings.Split(val, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		paths = append(paths, path)
+	}
+
+	return paths
+}
+
+// DryRunConfigMapName returns the name of the configmap storing the changes
+// rendered when the dry run annotation is set.
+func DryRunConfigMapName(customResource v1alpha1.Chart) string {
+	return fmt.Sprintf("%s-dry-run", customResource.GetName())
+}
+
+// FailedMaxAttemptsReason returns the status reason of releases which failed
+// project.ReleaseFailedMaxAttempts times in a row.
+func FailedMaxAttemptsReason(description string) string {
+	return fmt.Sprintf("%s\nReason: %s", failedMaxAttemptsPrefix(), description)
+}
+
 func HasForceUpgradeAnnotation(customResource v1alpha1.Chart) bool {
 	val, ok := customResource.Annotations[annotation.ForceHelmUpgrade]
 	if !ok {
@@ -50,6 +149,38 @@ func HasForceUpgradeAnnotation(customResource v1alpha1.Chart) bool {
 	return result
 }
 
+// HealthCheckDeadline parses the health check deadline annotation. It returns
+// zero when the annotation is not set.
+func HealthCheckDeadline(customResource v1alpha1.Chart) (time.Duration, error) {
+	val, ok := customResource.GetAnnotations()[annotation.HealthCheckDeadline]
+	if !ok {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, microerror.Maskf(invalidHealthCheckDeadlineError, "cannot parse %#q as duration", val)
+	}
+
+	return d, nil
+}
+
+// HealthCheckStarted parses the health check started annotation. It returns
+// false when the annotation is not set or invalid.
+func HealthCheckStarted(customResource v1alpha1.Chart) (time.Time, bool) {
+	val, ok := customResource.GetAnnotations()[annotation.HealthCheckStarted]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
 func IsCordoned(customResource v1alpha1.Chart) bool {
 	_, reasonOk := customResource.Annotations[annotation.CordonReason]
 	_, untilOk := customResource.Annotations[annotation.CordonUntilDate]
@@ -62,10 +193,110 @@ func IsCordoned(customResource v1alpha1.Chart) bool {
 
 }
 
+// IsCordonExpired returns true when the cordon-until date has passed. An
+// invalid date is never considered expired.
+func IsCordonExpired(customResource v1alpha1.Chart) bool {
+	cordonUntil, err := CordonUntilDate(customResource)
+	if err != nil {
+		return false
+	}
+
+	return time.Now().After(cordonUntil)
+}
+
+func IsDryRun(customResource v1alpha1.Chart) bool {
+	val, ok := customResource.Annotations[annotation.DryRun]
+	if !ok {
+		return false
+	}
+
+	result, err := strconv.ParseBool(val)
+	if err != nil {
+		return false
+	}
+
+	return result
+}
+
 func IsDeleted(customResource v1alpha1.Chart) bool {
 	return customResource.GetDeletionTimestamp() != nil
 }
 
+// IsFailedMaxAttempts returns true when the chart CR status shows the release
+// failed project.ReleaseFailedMaxAttempts times in a row.
+func IsFailedMaxAttempts(customResource v1alpha1.Chart) bool {
+	status := ChartStatus(customResource)
+
+	return status.Release.Status == helmclient.StatusFailed && strings.HasPrefix(status.Reason, failedMaxAttemptsPrefix())
+}
+
+func IsHealthCheck(customResource v1alpha1.Chart) bool {
+	val, ok := customResource.Annotations[annotation.HealthCheck]
+	if !ok {
+		return false
+	}
+
+	result, err := strconv.ParseBool(val)
+	if err != nil {
+		return false
+	}
+
+	return result
+}
+
+func IsRollbackOnFailure(customResource v1alpha1.Chart) bool {
+	val, ok := customResource.Annotations[annotation.RollbackOnFailure]
+	if !ok {
+		return false
+	}
+
+	result, err := strconv.ParseBool(val)
+	if err != nil {
+		return false
+	}
+
+	return result
+}
+
+func IsSelfHeal(customResource v1alpha1.Chart) bool {
+	val, ok := customResource.Annotations[annotation.SelfHeal]
+	if !ok {
+		return false
+	}
+
+	result, err := strconv.ParseBool(val)
+	if err != nil {
+		return false
+	}
+
+	return result
+}
+
+// IsOCI checks if the chart CR references a chart in an OCI registry e.g.
+// oci://quay.io/giantswarm/prometheus:1.0.0 instead of a tarball URL.
+func IsOCI(customResource v1alpha1.Chart) bool {
+	return strings.HasPrefix(TarballURL(customResource), "oci://")
+}
+
+// MaxHistory parses the max history annotation. It returns 0 when the
+// annotation is not set.
+func MaxHistory(customResource v1alpha1.Chart) (int, error) {
+	val, ok := customResource.GetAnnotations()[annotation.MaxHistory]
+	if !ok {
+		return 0, nil
+	}
+
+	maxHistory, err := strconv.Atoi(strings.TrimSpace(val))
+	if err != nil {
+		return 0, microerror.Maskf(invalidMaxHistoryError, "cannot parse %#q as integer", val)
+	}
+	if maxHistory < 1 {
+		return 0, microerror.Maskf(invalidMaxHistoryError, "%d must be positive", maxHistory)
+	}
+
+	return maxHistory, nil
+}
+
 func Namespace(customResource v1alpha1.Chart) string {
 	return customResource.Spec.Namespace
 }
@@ -78,10 +309,72 @@ func NamespaceLabels(customResource v1alpha1.Chart) map[string]string {
 	return customResource.Spec.NamespaceConfig.Labels
 }
 
+func OCIDigest(customResource v1alpha1.Chart) string {
+	return customResource.GetAnnotations()[annotation.OCIDigest]
+}
+
+// OCIPullSecret returns the namespace and name of the pull secret for OCI
+// registries. The namespace defaults to the chart CR namespace. The name is
+// empty when the annotation is not set.
+func OCIPullSecret(customResource v1alpha1.Chart) (string, string) {
+	return secretReference(customResource, annotation.OCIPullSecret)
+}
+
+// Priority parses the priority annotation. It returns 0 when the annotation is
+// not set.
+func Priority(customResource v1alpha1.Chart) (int, error) {
+	val, ok := customResource.GetAnnotations()[annotation.Priority]
+	if !ok {
+		return 0, nil
+	}
+
+	priority, err := strconv.Atoi(strings.TrimSpace(val))
+	if err != nil {
+		return 0, microerror.Maskf(invalidPriorityError, "cannot parse %#q as integer", val)
+	}
+
+	return priority, nil
+}
+
 func ReleaseName(customResource v1alpha1.Chart) string {
 	return customResource.Spec.Name
 }
 
+// RolledBackFrom returns the upgrade stored in the rolled back from
+// annotation. It returns false if the annotation is not set or cannot be
+// parsed.
+func RolledBackFrom(customResource v1alpha1.Chart) (RolledBack, bool) {
+	val, ok := customResource.GetAnnotations()[annotation.RolledBackFrom]
+	if !ok {
+		return RolledBack{}, false
+	}
+
+	var rolledBack RolledBack
+
+	err := json.Unmarshal([]byte(val), &rolledBack)
+	if err != nil {
+		return RolledBack{}, false
+	}
+
+	return rolledBack, true
+}
+
+// RollbackCount parses the rollback count annotation. It returns 0 when the
+// annotation is not set.
+func RollbackCount(customResource v1alpha1.Chart) (int, error) {
+	val, ok := customResource.GetAnnotations()[annotation.RollbackCount]
+	if !ok {
+		return 0, nil
+	}
+
+	count, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, microerror.Mask(err)
+	}
+
+	return count, nil
+}
+
 func SecretName(customResource v1alpha1.Chart) string {
 	return customResource.Spec.Config.Secret.Name
 }
@@ -109,6 +402,43 @@ func ToCustomResource(v interface{}) (v1alpha1.Chart, error) {
 	return *customResourcePointer, nil
 }
 
+// ValuesChecksumAnnotation returns the annotation value to determine if the
+// Helm release values have changed.
+func ValuesChecksumAnnotation(customResource v1alpha1.Chart) string {
+	if val, ok := customResource.ObjectMeta.Annotations[annotation.ValuesChecksum]; ok {
+		return val
+	} else {
+		return ""
+	}
+}
+
+// ValuesSources parses the values sources annotation. Every source must have
+// a kind of ConfigMap or Secret and a name.
+func ValuesSources(customResource v1alpha1.Chart) ([]ValuesSource, error) {
+	val, ok := customResource.GetAnnotations()[annotation.ValuesSources]
+	if !ok || val == "" {
+		return nil, nil
+	}
+
+	var sources []ValuesSource
+
+	err := json.Unmarshal([]byte(val), &sources)
+	if err != nil {
+		return nil, microerror.Maskf(invalidValuesSourcesError, "cannot parse %#q as JSON list", val)
+	}
+
+	for _, s := range sources {
+		if s.Kind != ValuesSourceKindConfigMap && s.Kind != ValuesSourceKindSecret {
+			return nil, microerror.Maskf(invalidValuesSourcesError, "kind %#q must be %#q or %#q", s.Kind, ValuesSourceKindConfigMap, ValuesSourceKindSecret)
+		}
+		if s.Name == "" {
+			return nil, microerror.Maskf(invalidValuesSourcesError, "name must not be empty")
+		}
+	}
+
+	return sources, nil
+}
+
 // ValuesMD5ChecksumAnnotation returns the annotation value to determine if the
 // Helm release values have changed.
 func ValuesMD5ChecksumAnnotation(customResource v1alpha1.Chart) string {
@@ -123,6 +453,12 @@ func Version(customResource v1alpha1.Chart) string {
 	return customResource.Spec.Version
 }
 
+// VerifyPolicy returns the verify policy annotation of the chart CR. It is
+// empty when it is not set.
+func VerifyPolicy(customResource v1alpha1.Chart) string {
+	return customResource.GetAnnotations()[annotation.VerifyPolicy]
+}
+
 // VersionLabel returns the label value to determine if the custom resource is
 // supported by this version of the operatorkit resource.
 func VersionLabel(customResource v1alpha1.Chart) string {
@@ -132,3 +468,24 @@ func VersionLabel(customResource v1alpha1.Chart) string {
 		return ""
 	}
 }
+
+func failedMaxAttemptsPrefix() string {
+	return fmt.Sprintf("Release has failed %d times.", project.ReleaseFailedMaxAttempts)
+}
+
+// secretReference parses an annotation referencing a secret by name in the
+// chart CR namespace or by namespace/name. Secrets in other namespaces are only
+// read when the operator allows their namespace.
+func secretReference(customResource v1alpha1.Chart, key string) (string, string) {
+	val := customResource.GetAnnotations()[key]
+	if val == "" {
+		return "", ""
+	}
+
+	parts := strings.SplitN(val, "/", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+
+	return customResource.Namespace, val
+}
@@ -2,7 +2,9 @@ package key
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -10,6 +12,85 @@ import (
 	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
 )
 
+func Test_ChartDigest(t *testing.T) {
+	digest := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	testCases := []struct {
+		name           string
+		input          v1alpha1.Chart
+		expectedResult string
+		errorMatcher   func(error) bool
+	}{
+		{
+			name:           "case 0: no annotations",
+			input:          v1alpha1.Chart{},
+			expectedResult: "",
+		},
+		{
+			name: "case 1: digest with algorithm",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.ChartDigest: "sha256:" + digest,
+					},
+				},
+			},
+			expectedResult: digest,
+		},
+		{
+			name: "case 2: upper case digest without algorithm",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.ChartDigest: strings.ToUpper(digest),
+					},
+				},
+			},
+			expectedResult: digest,
+		},
+		{
+			name: "case 3: truncated digest",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.ChartDigest: "sha256:9f86d081",
+					},
+				},
+			},
+			errorMatcher: IsInvalidChartDigestError,
+		},
+		{
+			name: "case 4: other algorithm",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.ChartDigest: "md5:098f6bcd4621d373cade4e832627b4f6",
+					},
+				},
+			},
+			errorMatcher: IsInvalidChartDigestError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ChartDigest(tc.input)
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if result != tc.expectedResult {
+				t.Fatalf("ChartDigest == %#q, want %#q", result, tc.expectedResult)
+			}
+		})
+	}
+}
+
 func Test_ConfigMapName(t *testing.T) {
 	expectedConfigMapName := "prometheus-values"
 
@@ -75,109 +156,587 @@ func Test_CordonUntil(t *testing.T) {
 		},
 	}
 
-	if CordonUntil(obj) != expectedCordonUntil {
-		t.Fatalf("cordon until %s, want %s", CordonUntil(obj), expectedCordonUntil)
+	if CordonUntil(obj) != expectedCordonUntil {
+		t.Fatalf("cordon until %s, want %s", CordonUntil(obj), expectedCordonUntil)
+	}
+}
+
+func Test_CordonUntilDate(t *testing.T) {
+	testCases := []struct {
+		name         string
+		input        v1alpha1.Chart
+		expectedDate time.Time
+		errorMatcher func(error) bool
+	}{
+		{
+			name: "case 0: valid date",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.CordonUntilDate: "2019-12-31T23:59:59Z",
+					},
+				},
+			},
+			expectedDate: time.Date(2019, 12, 31, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name: "case 1: invalid date",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.CordonUntilDate: "31/12/2019",
+					},
+				},
+			},
+			errorMatcher: IsInvalidCordonUntilError,
+		},
+		{
+			name:         "case 2: missing annotation",
+			input:        v1alpha1.Chart{},
+			errorMatcher: IsInvalidCordonUntilError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := CordonUntilDate(tc.input)
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if !result.Equal(tc.expectedDate) {
+				t.Fatalf("cordon until date %s, want %s", result, tc.expectedDate)
+			}
+		})
+	}
+}
+
+func Test_DependsOn(t *testing.T) {
+	testCases := []struct {
+		name           string
+		input          v1alpha1.Chart
+		expectedResult []string
+	}{
+		{
+			name:           "case 0: no annotations",
+			input:          v1alpha1.Chart{},
+			expectedResult: nil,
+		},
+		{
+			name: "case 1: single dependency",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.DependsOn: "cilium",
+					},
+				},
+			},
+			expectedResult: []string{"cilium"},
+		},
+		{
+			name: "case 2: dependencies with spaces, duplicates and empty names",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.DependsOn: "cilium, coredns,,cilium ",
+					},
+				},
+			},
+			expectedResult: []string{"cilium", "coredns"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := DependsOn(tc.input)
+			if !reflect.DeepEqual(result, tc.expectedResult) {
+				t.Fatalf("DependsOn == %#v, want %#v", result, tc.expectedResult)
+			}
+		})
+	}
+}
+
+func Test_HasForceUpgradeAnnotation(t *testing.T) {
+	testCases := []struct {
+		name           string
+		input          v1alpha1.Chart
+		expectedResult bool
+	}{
+		{
+			name: "case 0: no annotations",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{},
+			},
+			expectedResult: false,
+		},
+		{
+			name: "case 1: other annotations",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"test": "test",
+					},
+				},
+			},
+			expectedResult: false,
+		},
+		{
+			name: "case 2: annotation present",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"chart-operator.giantswarm.io/force-helm-upgrade": "true",
+					},
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name: "case 3: annotation present but false",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"chart-operator.giantswarm.io/force-helm-upgrade": "false",
+					},
+				},
+			},
+			expectedResult: false,
+		},
+		{
+			name: "case 4: annotation present but invalid value",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"chart-operator.giantswarm.io/force-helm-upgrade": "invalid",
+					},
+				},
+			},
+			expectedResult: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := HasForceUpgradeAnnotation(tc.input)
+
+			if result != tc.expectedResult {
+				t.Fatalf("HasForceUpgradeAnnotation == %t, want %t", result, tc.expectedResult)
+			}
+		})
+	}
+}
+
+func Test_HealthCheckDeadline(t *testing.T) {
+	testCases := []struct {
+		name           string
+		input          v1alpha1.Chart
+		expectedResult time.Duration
+		errorMatcher   func(error) bool
+	}{
+		{
+			name:           "case 0: no annotations",
+			input:          v1alpha1.Chart{},
+			expectedResult: 0,
+		},
+		{
+			name: "case 1: valid duration",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.HealthCheckDeadline: "10m",
+					},
+				},
+			},
+			expectedResult: 10 * time.Minute,
+		},
+		{
+			name: "case 2: invalid duration",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.HealthCheckDeadline: "ten minutes",
+					},
+				},
+			},
+			errorMatcher: IsInvalidHealthCheckDeadlineError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := HealthCheckDeadline(tc.input)
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if result != tc.expectedResult {
+				t.Fatalf("HealthCheckDeadline == %s, want %s", result, tc.expectedResult)
+			}
+		})
+	}
+}
+
+func Test_IsCordoned(t *testing.T) {
+	tests := []struct {
+		name           string
+		chart          v1alpha1.Chart
+		expectedResult bool
+	}{
+		{
+			name: "case 0: chart cordoned",
+			chart: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.CordonReason:    "testing manual upgrade",
+						annotation.CordonUntilDate: "2019-12-31T23:59:59Z",
+					},
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name:           "case 1: chart did not cordon",
+			chart:          v1alpha1.Chart{},
+			expectedResult: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsCordoned(tt.chart); got != tt.expectedResult {
+				t.Errorf("IsCordoned() = %v, want %v", got, tt.expectedResult)
+			}
+		})
+	}
+}
+
+func Test_IsCordonExpired(t *testing.T) {
+	testCases := []struct {
+		name           string
+		chart          v1alpha1.Chart
+		expectedResult bool
+	}{
+		{
+			name: "case 0: cordon expired",
+			chart: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.CordonReason:    "testing manual upgrade",
+						annotation.CordonUntilDate: "2019-12-31T23:59:59Z",
+					},
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name: "case 1: cordon not expired",
+			chart: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.CordonReason:    "testing manual upgrade",
+						annotation.CordonUntilDate: time.Now().Add(time.Hour).Format(time.RFC3339),
+					},
+				},
+			},
+			expectedResult: false,
+		},
+		{
+			name: "case 2: invalid cordon date",
+			chart: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.CordonReason:    "testing manual upgrade",
+						annotation.CordonUntilDate: "tomorrow",
+					},
+				},
+			},
+			expectedResult: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if result := IsCordonExpired(tc.chart); result != tc.expectedResult {
+				t.Fatalf("IsCordonExpired == %t, want %t", result, tc.expectedResult)
+			}
+		})
+	}
+}
+
+func Test_IsDryRun(t *testing.T) {
+	testCases := []struct {
+		name           string
+		input          v1alpha1.Chart
+		expectedResult bool
+	}{
+		{
+			name:           "case 0: no annotations",
+			input:          v1alpha1.Chart{},
+			expectedResult: false,
+		},
+		{
+			name: "case 1: annotation present",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.DryRun: "true",
+					},
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name: "case 2: annotation present but invalid value",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.DryRun: "invalid",
+					},
+				},
+			},
+			expectedResult: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := IsDryRun(tc.input)
+
+			if result != tc.expectedResult {
+				t.Fatalf("IsDryRun == %t, want %t", result, tc.expectedResult)
+			}
+		})
+	}
+}
+
+func Test_IsFailedMaxAttempts(t *testing.T) {
+	testCases := []struct {
+		name           string
+		status         v1alpha1.ChartStatus
+		expectedResult bool
+	}{
+		{
+			name:           "case 0: no status",
+			status:         v1alpha1.ChartStatus{},
+			expectedResult: false,
+		},
+		{
+			name: "case 1: failed max attempts",
+			status: v1alpha1.ChartStatus{
+				Reason: FailedMaxAttemptsReason("timed out waiting for the condition"),
+				Release: v1alpha1.ChartStatusRelease{
+					Status: "failed",
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name: "case 2: failed once",
+			status: v1alpha1.ChartStatus{
+				Reason: "timed out waiting for the condition",
+				Release: v1alpha1.ChartStatusRelease{
+					Status: "failed",
+				},
+			},
+			expectedResult: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := IsFailedMaxAttempts(v1alpha1.Chart{Status: tc.status})
+			if result != tc.expectedResult {
+				t.Fatalf("IsFailedMaxAttempts == %t, want %t", result, tc.expectedResult)
+			}
+		})
 	}
 }
 
-func Test_HasForceUpgradeAnnotation(t *testing.T) {
+func Test_MaxHistory(t *testing.T) {
 	testCases := []struct {
 		name           string
 		input          v1alpha1.Chart
-		expectedResult bool
+		expectedResult int
+		errorMatcher   func(error) bool
 	}{
 		{
-			name: "case 0: no annotations",
+			name:           "case 0: no annotations",
+			input:          v1alpha1.Chart{},
+			expectedResult: 0,
+		},
+		{
+			name: "case 1: valid max history",
 			input: v1alpha1.Chart{
-				ObjectMeta: metav1.ObjectMeta{},
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.MaxHistory: "5",
+					},
+				},
 			},
-			expectedResult: false,
+			expectedResult: 5,
 		},
 		{
-			name: "case 1: other annotations",
+			name: "case 2: zero max history",
 			input: v1alpha1.Chart{
 				ObjectMeta: metav1.ObjectMeta{
 					Annotations: map[string]string{
-						"test": "test",
+						annotation.MaxHistory: "0",
 					},
 				},
 			},
-			expectedResult: false,
+			errorMatcher: IsInvalidMaxHistoryError,
 		},
 		{
-			name: "case 2: annotation present",
+			name: "case 3: invalid max history",
 			input: v1alpha1.Chart{
 				ObjectMeta: metav1.ObjectMeta{
 					Annotations: map[string]string{
-						"chart-operator.giantswarm.io/force-helm-upgrade": "true",
+						annotation.MaxHistory: "ten",
 					},
 				},
 			},
-			expectedResult: true,
+			errorMatcher: IsInvalidMaxHistoryError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := MaxHistory(tc.input)
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if result != tc.expectedResult {
+				t.Fatalf("MaxHistory == %d, want %d", result, tc.expectedResult)
+			}
+		})
+	}
+}
+
+func Test_OCIPullSecret(t *testing.T) {
+	testCases := []struct {
+		name              string
+		input             v1alpha1.Chart
+		expectedNamespace string
+		expectedName      string
+	}{
+		{
+			name:  "case 0: no annotations",
+			input: v1alpha1.Chart{},
 		},
 		{
-			name: "case 3: annotation present but false",
+			name: "case 1: name in chart CR namespace",
 			input: v1alpha1.Chart{
 				ObjectMeta: metav1.ObjectMeta{
 					Annotations: map[string]string{
-						"chart-operator.giantswarm.io/force-helm-upgrade": "false",
+						annotation.OCIPullSecret: "quay-pull-secret",
 					},
+					Namespace: "giantswarm",
 				},
 			},
-			expectedResult: false,
+			expectedNamespace: "giantswarm",
+			expectedName:      "quay-pull-secret",
 		},
 		{
-			name: "case 4: annotation present but invalid value",
+			name: "case 2: namespace and name",
 			input: v1alpha1.Chart{
 				ObjectMeta: metav1.ObjectMeta{
 					Annotations: map[string]string{
-						"chart-operator.giantswarm.io/force-helm-upgrade": "invalid",
+						annotation.OCIPullSecret: "default/quay-pull-secret",
 					},
+					Namespace: "giantswarm",
 				},
 			},
-			expectedResult: false,
+			expectedNamespace: "default",
+			expectedName:      "quay-pull-secret",
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			result := HasForceUpgradeAnnotation(tc.input)
-
-			if result != tc.expectedResult {
-				t.Fatalf("HasForceUpgradeAnnotation == %t, want %t", result, tc.expectedResult)
+			namespace, name := OCIPullSecret(tc.input)
+			if namespace != tc.expectedNamespace || name != tc.expectedName {
+				t.Fatalf("OCIPullSecret == %#q, %#q, want %#q, %#q", namespace, name, tc.expectedNamespace, tc.expectedName)
 			}
 		})
 	}
 }
 
-func Test_IsCordoned(t *testing.T) {
-	tests := []struct {
+func Test_Priority(t *testing.T) {
+	testCases := []struct {
 		name           string
-		chart          v1alpha1.Chart
-		expectedResult bool
+		input          v1alpha1.Chart
+		expectedResult int
+		errorMatcher   func(error) bool
 	}{
 		{
-			name: "case 0: chart cordoned",
-			chart: v1alpha1.Chart{
+			name:           "case 0: no annotations",
+			input:          v1alpha1.Chart{},
+			expectedResult: 0,
+		},
+		{
+			name: "case 1: valid priority",
+			input: v1alpha1.Chart{
 				ObjectMeta: metav1.ObjectMeta{
 					Annotations: map[string]string{
-						annotation.CordonReason:    "testing manual upgrade",
-						annotation.CordonUntilDate: "2019-12-31T23:59:59Z",
+						annotation.Priority: "100",
 					},
 				},
 			},
-			expectedResult: true,
+			expectedResult: 100,
 		},
 		{
-			name:           "case 1: chart did not cordon",
-			chart:          v1alpha1.Chart{},
-			expectedResult: false,
+			name: "case 2: negative priority",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.Priority: "-1",
+					},
+				},
+			},
+			expectedResult: -1,
+		},
+		{
+			name: "case 3: invalid priority",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.Priority: "high",
+					},
+				},
+			},
+			errorMatcher: IsInvalidPriorityError,
 		},
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := IsCordoned(tt.chart); got != tt.expectedResult {
-				t.Errorf("IsCordoned() = %v, want %v", got, tt.expectedResult)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Priority(tc.input)
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if result != tc.expectedResult {
+				t.Fatalf("Priority == %d, want %d", result, tc.expectedResult)
 			}
 		})
 	}
@@ -197,6 +756,109 @@ func Test_ReleaseName(t *testing.T) {
 	}
 }
 
+func Test_RolledBackFrom(t *testing.T) {
+	testCases := []struct {
+		name           string
+		input          v1alpha1.Chart
+		expectedResult RolledBack
+		expectedOk     bool
+	}{
+		{
+			name:  "case 0: no annotations",
+			input: v1alpha1.Chart{},
+		},
+		{
+			name: "case 1: annotation present",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.RolledBackFrom: `{"version":"1.1.0","valuesChecksum":"checksum","reason":"upgrade failed"}`,
+					},
+				},
+			},
+			expectedResult: RolledBack{
+				Version:        "1.1.0",
+				ValuesChecksum: "checksum",
+				Reason:         "upgrade failed",
+			},
+			expectedOk: true,
+		},
+		{
+			name: "case 2: annotation present but invalid value",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.RolledBackFrom: "1.1.0",
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, ok := RolledBackFrom(tc.input)
+
+			if ok != tc.expectedOk {
+				t.Fatalf("ok == %t, want %t", ok, tc.expectedOk)
+			}
+			if result != tc.expectedResult {
+				t.Fatalf("RolledBackFrom == %#v, want %#v", result, tc.expectedResult)
+			}
+		})
+	}
+}
+
+func Test_RollbackCount(t *testing.T) {
+	testCases := []struct {
+		name           string
+		input          v1alpha1.Chart
+		expectedResult int
+		expectedError  bool
+	}{
+		{
+			name:           "case 0: no annotations",
+			input:          v1alpha1.Chart{},
+			expectedResult: 0,
+		},
+		{
+			name: "case 1: rollback count",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.RollbackCount: "2",
+					},
+				},
+			},
+			expectedResult: 2,
+		},
+		{
+			name: "case 2: invalid rollback count",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.RollbackCount: "two",
+					},
+				},
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := RollbackCount(tc.input)
+			if (err != nil) != tc.expectedError {
+				t.Fatalf("error == %#v, want error %t", err, tc.expectedError)
+			}
+
+			if result != tc.expectedResult {
+				t.Fatalf("RollbackCount == %d, want %d", result, tc.expectedResult)
+			}
+		})
+	}
+}
+
 func Test_SecretName(t *testing.T) {
 	expectedSecretName := "prometheus-secret-values"
 
@@ -299,6 +961,22 @@ func Test_ToCustomResource(t *testing.T) {
 	}
 }
 
+func Test_ValuesChecksumAnnotation(t *testing.T) {
+	expectedChecksum := "3e80b3778b3b03766e7be993131c0af2ad05630c5d96fb7fa132d05b77336e04"
+
+	obj := v1alpha1.Chart{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				annotation.ValuesChecksum: "3e80b3778b3b03766e7be993131c0af2ad05630c5d96fb7fa132d05b77336e04",
+			},
+		},
+	}
+
+	if ValuesChecksumAnnotation(obj) != expectedChecksum {
+		t.Fatalf("values checksum %#q, want %#q", ValuesChecksumAnnotation(obj), expectedChecksum)
+	}
+}
+
 func Test_ValuesMD5ChecksumAnnotation(t *testing.T) {
 	expectedMD5Checksum := "1ee001c5286ca00fdf64d9660c04bde2"
 
@@ -315,6 +993,93 @@ func Test_ValuesMD5ChecksumAnnotation(t *testing.T) {
 	}
 }
 
+func Test_ValuesSources(t *testing.T) {
+	testCases := []struct {
+		name           string
+		input          v1alpha1.Chart
+		expectedResult []ValuesSource
+		errorMatcher   func(error) bool
+	}{
+		{
+			name:  "case 0: no annotations",
+			input: v1alpha1.Chart{},
+		},
+		{
+			name: "case 1: configmap and secret",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.ValuesSources: `[{"kind":"ConfigMap","name":"catalog-values"},{"kind":"Secret","name":"cluster-secrets","namespace":"giantswarm","keys":["values"]}]`,
+					},
+				},
+			},
+			expectedResult: []ValuesSource{
+				{
+					Kind: "ConfigMap",
+					Name: "catalog-values",
+				},
+				{
+					Kind:      "Secret",
+					Name:      "cluster-secrets",
+					Namespace: "giantswarm",
+					Keys:      []string{"values"},
+				},
+			},
+		},
+		{
+			name: "case 2: invalid JSON",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.ValuesSources: `catalog-values`,
+					},
+				},
+			},
+			errorMatcher: IsInvalidValuesSourcesError,
+		},
+		{
+			name: "case 3: invalid kind",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.ValuesSources: `[{"kind":"Pod","name":"catalog-values"}]`,
+					},
+				},
+			},
+			errorMatcher: IsInvalidValuesSourcesError,
+		},
+		{
+			name: "case 4: missing name",
+			input: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.ValuesSources: `[{"kind":"Secret"}]`,
+					},
+				},
+			},
+			errorMatcher: IsInvalidValuesSourcesError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ValuesSources(tc.input)
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if !reflect.DeepEqual(result, tc.expectedResult) {
+				t.Fatalf("ValuesSources == %#v, want %#v", result, tc.expectedResult)
+			}
+		})
+	}
+}
+
 func Test_VersionLabel(t *testing.T) {
 	testCases := []struct {
 		name            string
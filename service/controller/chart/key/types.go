@@ -0,0 +1,31 @@
+package key
+
+const (
+	ValuesSourceKindConfigMap = "ConfigMap"
+	ValuesSourceKindSecret    = "Secret"
+)
+
+// ValuesSource is a configmap or secret listed in the values sources
+// annotation.
+type ValuesSource struct {
+	// Kind is either ConfigMap or Secret.
+	Kind string `json:"kind"`
+	// Name is the name of the configmap or secret.
+	Name string `json:"name"`
+	// Namespace is the namespace of the configmap or secret. It defaults to
+	// the namespace of the chart CR.
+	Namespace string `json:"namespace,omitempty"`
+	// Keys are the data keys used as values in the order they are merged.
+	// All keys are merged in alphabetical order when empty.
+	Keys []string `json:"keys,omitempty"`
+}
+
+// RolledBack is the upgrade stored in the rolled back from annotation.
+type RolledBack struct {
+	// Version is the chart version of the failed upgrade.
+	Version string `json:"version"`
+	// ValuesChecksum is the values checksum of the failed upgrade.
+	ValuesChecksum string `json:"valuesChecksum"`
+	// Reason is why the upgrade failed.
+	Reason string `json:"reason"`
+}
@@ -67,6 +67,7 @@ func (r *Resource) EnsureCreated(ctx context.Context, obj interface{}) error {
 	}
 
 	r.logger.Debugf(ctx, "created namespace %#q", key.Namespace(cr))
+	r.eventRecorder.Eventf(&cr, corev1.EventTypeNormal, "NamespaceCreated", "created namespace %#q", key.Namespace(cr))
 
 	return nil
 }
@@ -114,6 +115,7 @@ func (r *Resource) ensureNamespaceUpdated(ctx context.Context, cr v1alpha1.Chart
 	}
 
 	r.logger.Debugf(ctx, "updated namespace %#q", namespace.Name)
+	r.eventRecorder.Eventf(&cr, corev1.EventTypeNormal, "NamespaceUpdated", "updated labels and annotations of namespace %#q", namespace.Name)
 
 	return nil
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/micrologger"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
@@ -18,8 +19,9 @@ const (
 
 type Config struct {
 	// Dependencies.
-	K8sClient kubernetes.Interface
-	Logger    micrologger.Logger
+	EventRecorder record.EventRecorder
+	K8sClient     kubernetes.Interface
+	Logger        micrologger.Logger
 
 	// Settings.
 	K8sWaitTimeout time.Duration
@@ -27,8 +29,9 @@ type Config struct {
 
 type Resource struct {
 	// Dependencies.
-	k8sClient kubernetes.Interface
-	logger    micrologger.Logger
+	eventRecorder record.EventRecorder
+	k8sClient     kubernetes.Interface
+	logger        micrologger.Logger
 
 	// Settings.
 	k8sWaitTimeout time.Duration
@@ -37,6 +40,9 @@ type Resource struct {
 // New creates a new configured namespace resource.
 func New(config Config) (*Resource, error) {
 	// Dependencies.
+	if config.EventRecorder == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.EventRecorder must not be empty", config)
+	}
 	if config.K8sClient == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.K8sClient must not be empty", config)
 	}
@@ -50,8 +56,9 @@ func New(config Config) (*Resource, error) {
 	}
 
 	r := &Resource{
-		k8sClient: config.K8sClient,
-		logger:    config.Logger,
+		eventRecorder: config.EventRecorder,
+		k8sClient:     config.K8sClient,
+		logger:        config.Logger,
 
 		k8sWaitTimeout: config.K8sWaitTimeout,
 	}
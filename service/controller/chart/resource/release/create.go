@@ -8,9 +8,11 @@ import (
 	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/operatorkit/v4/pkg/controller/context/resourcecanceledcontext"
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+	"github.com/giantswarm/chart-operator/v2/service/releaseoperation"
 )
 
 func (r *Resource) ApplyCreateChange(ctx context.Context, obj, createChange interface{}) error {
@@ -33,49 +35,67 @@ func (r *Resource) ApplyCreateChange(ctx context.Context, obj, createChange inte
 		return nil
 	}
 
+	ok, err := r.checkDependencies(ctx, cr)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if !ok {
+		r.logger.Debugf(ctx, "canceling resource")
+		resourcecanceledcontext.SetCanceled(ctx)
+		return nil
+	}
+
 	r.logger.Debugf(ctx, "creating release %#q in namespace %#q", releaseState.Name, key.Namespace(cr))
 
 	ns := key.Namespace(cr)
-	tarballURL := key.TarballURL(cr)
 	skipCRDs := key.SkipCRDs(cr)
 
-	tarballPath, err := r.helmClient.PullChartTarball(ctx, tarballURL)
-	if helmclient.IsPullChartFailedError(err) {
-		reason := fmt.Sprintf("pulling chart %#q failed", tarballURL)
-		addStatusToContext(cc, reason, releaseNotInstalledStatus)
+	tarballPath, unpinTarball, err := r.pullChartTarball(ctx, cr)
+	if reason, status, ok := pullFailedStatus(cr, err); ok {
+		addStatusToContext(cc, reason, status)
+		cc.Status.ChartPullFailed = true
 
 		r.logger.LogCtx(ctx, "level", "warning", "message", reason, "stack", microerror.JSON(err))
 		r.logger.Debugf(ctx, "canceling resource")
 		resourcecanceledcontext.SetCanceled(ctx)
 		return nil
-	} else if helmclient.IsPullChartNotFound(err) {
-		reason := fmt.Sprintf("chart %#q not found", tarballURL)
-		addStatusToContext(cc, reason, releaseNotInstalledStatus)
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+	defer unpinTarball()
+
+	err = r.verifyChart(ctx, cr, tarballPath)
+	if IsSignatureInvalid(err) {
+		reason := err.Error()
+		addStatusToContext(cc, reason, signatureInvalidStatus)
 
+		r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "SignatureInvalid", reason)
 		r.logger.LogCtx(ctx, "level", "warning", "message", reason, "stack", microerror.JSON(err))
 		r.logger.Debugf(ctx, "canceling resource")
 		resourcecanceledcontext.SetCanceled(ctx)
 		return nil
-	} else if helmclient.IsPullChartTimeout(err) {
-		reason := fmt.Sprintf("timeout pulling %#q", tarballURL)
-		addStatusToContext(cc, reason, releaseNotInstalledStatus)
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
 
-		r.logger.LogCtx(ctx, "level", "warning", "message", reason, "stack", microerror.JSON(err))
+	done, ok, err := r.startOperation(ctx, ns, releaseState.Name, releaseoperation.Install)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if !ok {
 		r.logger.Debugf(ctx, "canceling resource")
 		resourcecanceledcontext.SetCanceled(ctx)
 		return nil
-	} else if err != nil {
-		return microerror.Mask(err)
 	}
 
-	defer func() {
-		err := r.fs.Remove(tarballPath)
-		if err != nil {
-			r.logger.Errorf(ctx, err, "deletion of %#q failed", tarballPath)
-		}
-	}()
+	ch := make(chan error, 1)
+	start := time.Now()
 
-	ch := make(chan error)
+	// The operation keeps running in the background once the reconciliation
+	// finished. So it must not use the context of the reconciliation.
+	operationCtx := r.releaseOperations.Context(ctx)
+	// The tarball stays pinned in the cache until the operation finished.
+	unpinOperationTarball := r.tarballCache.pinPath(tarballPath)
 
 	// We create the helm release but with a wait timeout so we don't
 	// block reconciling other CRs.
@@ -83,8 +103,11 @@ func (r *Resource) ApplyCreateChange(ctx context.Context, obj, createChange inte
 	// If we do timeout the install will continue in the background.
 	// We will check the progress in the next reconciliation loop.
 	go func() {
+		defer done()
+		defer unpinOperationTarball()
+
 		if skipCRDs {
-			r.logger.Debugf(ctx, "helm release %#q has SkipCRDs set to true, not installing CRDs", releaseState.Name)
+			r.logger.Debugf(operationCtx, "helm release %#q has SkipCRDs set to true, not installing CRDs", releaseState.Name)
 		}
 		opts := helmclient.InstallOptions{
 			ReleaseName: releaseState.Name,
@@ -92,15 +115,17 @@ func (r *Resource) ApplyCreateChange(ctx context.Context, obj, createChange inte
 		}
 		// We need to pass the ValueOverrides option to make the install process
 		// use the default values and prevent errors on nested values.
-		err = r.helmClient.InstallReleaseFromTarball(ctx, tarballPath, ns, releaseState.Values, opts)
-		close(ch)
+		err := r.helmClient.InstallReleaseFromTarball(operationCtx, tarballPath, ns, releaseState.Values, opts)
+		observeOperation(releaseoperation.Install, start, err)
+		ch <- err
 	}()
 
 	select {
-	case <-ch:
+	case err = <-ch:
 		// Fall through.
 	case <-time.After(r.k8sWaitTimeout):
 		r.logger.Debugf(ctx, "waited for %d secs. release still being created", int64(r.k8sWaitTimeout.Seconds()))
+		observeBackgroundOperation(releaseoperation.Install)
 
 		// We set the hash annotation so the update state calculation is accurate
 		// when we check in the next reconciliation loop.
@@ -117,6 +142,7 @@ func (r *Resource) ApplyCreateChange(ctx context.Context, obj, createChange inte
 		reason = fmt.Sprintf("object already exists: (%s)", reason)
 		r.logger.Debugf(ctx, "helm release %#q failed, %s", releaseState.Name, reason)
 		addStatusToContext(cc, reason, alreadyExistsStatus)
+		r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "AlreadyExists", reason)
 
 		r.logger.Debugf(ctx, "canceling resource")
 		resourcecanceledcontext.SetCanceled(ctx)
@@ -126,6 +152,7 @@ func (r *Resource) ApplyCreateChange(ctx context.Context, obj, createChange inte
 		reason = fmt.Sprintf("helm validation error: (%s)", reason)
 		r.logger.Debugf(ctx, "helm release %#q failed, %s", releaseState.Name, reason)
 		addStatusToContext(cc, reason, validationFailedStatus)
+		r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "ValidationFailed", reason)
 
 		r.logger.Debugf(ctx, "canceling resource")
 		resourcecanceledcontext.SetCanceled(ctx)
@@ -135,6 +162,7 @@ func (r *Resource) ApplyCreateChange(ctx context.Context, obj, createChange inte
 		reason = fmt.Sprintf("invalid manifest error: (%s)", reason)
 		r.logger.Debugf(ctx, "helm release %#q failed, %s", releaseState.Name, reason)
 		addStatusToContext(cc, reason, invalidManifestStatus)
+		r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "InvalidManifest", reason)
 
 		r.logger.Debugf(ctx, "canceling resource")
 		resourcecanceledcontext.SetCanceled(ctx)
@@ -145,6 +173,7 @@ func (r *Resource) ApplyCreateChange(ctx context.Context, obj, createChange inte
 		releaseContent, relErr := r.helmClient.GetReleaseContent(ctx, ns, releaseState.Name)
 		if helmclient.IsReleaseNotFound(relErr) {
 			addStatusToContext(cc, err.Error(), releaseNotInstalledStatus)
+			r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "InstallFailed", err.Error())
 
 			r.logger.Debugf(ctx, "canceling resource")
 			resourcecanceledcontext.SetCanceled(ctx)
@@ -156,6 +185,7 @@ func (r *Resource) ApplyCreateChange(ctx context.Context, obj, createChange inte
 		// Release is failed so the status resource will check the Helm release.
 		if releaseContent.Status == helmclient.StatusFailed {
 			addStatusToContext(cc, releaseContent.Description, helmclient.StatusFailed)
+			r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "InstallFailed", releaseContent.Description)
 
 			r.logger.Debugf(ctx, "failed to create release %#q", releaseContent.Name)
 			r.logger.Debugf(ctx, "canceling resource")
@@ -164,6 +194,7 @@ func (r *Resource) ApplyCreateChange(ctx context.Context, obj, createChange inte
 		}
 
 		addStatusToContext(cc, err.Error(), unknownError)
+		r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "InstallFailed", err.Error())
 
 		r.logger.Debugf(ctx, "canceling resource")
 		resourcecanceledcontext.SetCanceled(ctx)
@@ -171,6 +202,7 @@ func (r *Resource) ApplyCreateChange(ctx context.Context, obj, createChange inte
 	}
 
 	r.logger.Debugf(ctx, "created release %#q in namespace %#q", releaseState.Name, key.Namespace(cr))
+	r.eventRecorder.Eventf(&cr, corev1.EventTypeNormal, "Installed", "installed release %#q version %#q", releaseState.Name, releaseState.Version)
 
 	// We set the hash annotation so the update state calculation
 	// is accurate when we check in the next reconciliation loop.
@@ -183,6 +215,11 @@ func (r *Resource) ApplyCreateChange(ctx context.Context, obj, createChange inte
 }
 
 func (r *Resource) newCreateChange(ctx context.Context, obj, currentState, desiredState interface{}) (interface{}, error) {
+	cr, err := key.ToCustomResource(obj)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
 	currentReleaseState, err := toReleaseState(currentState)
 	if err != nil {
 		return nil, microerror.Mask(err)
@@ -196,7 +233,9 @@ func (r *Resource) newCreateChange(ctx context.Context, obj, currentState, desir
 
 	createState := &ReleaseState{}
 
-	if isEmpty(currentReleaseState) {
+	if r.isOperationInProgress(ctx, key.Namespace(cr), desiredReleaseState.Name) {
+		r.logger.Debugf(ctx, "the %#q release does not need to be created", desiredReleaseState.Name)
+	} else if isEmpty(currentReleaseState) {
 		r.logger.Debugf(ctx, "the %#q release needs to be created", desiredReleaseState.Name)
 
 		createState = &desiredReleaseState
@@ -11,6 +11,7 @@ import (
 	"github.com/giantswarm/micrologger/microloggertest"
 	"github.com/spf13/afero"
 	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 )
 
 func Test_Resource_Release_newCreate(t *testing.T) {
@@ -70,11 +71,16 @@ func Test_Resource_Release_newCreate(t *testing.T) {
 	var err error
 	{
 		c := Config{
-			Fs:         afero.NewMemMapFs(),
-			G8sClient:  fake.NewSimpleClientset(),
-			HelmClient: helmclienttest.New(helmclienttest.Config{}),
-			K8sClient:  k8sfake.NewSimpleClientset(),
-			Logger:     microloggertest.New(),
+			DynamicClient:     newTestDynamicClient(),
+			EventRecorder:     &record.FakeRecorder{},
+			Fs:                afero.NewMemMapFs(),
+			G8sClient:         fake.NewSimpleClientset(),
+			HelmClient:        helmclienttest.New(helmclienttest.Config{}),
+			HelmStorage:       newTestHelmStorage(t, k8sfake.NewSimpleClientset()),
+			K8sClient:         k8sfake.NewSimpleClientset(),
+			Logger:            microloggertest.New(),
+			ReleaseOperations: newReleaseOperations(t),
+			RESTMapper:        newTestRESTMapper(),
 
 			TillerNamespace: "giantswarm",
 		}
@@ -87,7 +93,7 @@ func Test_Resource_Release_newCreate(t *testing.T) {
 
 	for i, tc := range testCases {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			result, err := newResource.newCreateChange(context.TODO(), tc.obj, tc.currentState, tc.desiredState)
+			result, err := newResource.newCreateChange(context.TODO(), &tc.obj, tc.currentState, tc.desiredState)
 			if err != nil {
 				t.Fatal("expected", nil, "got", err)
 			}
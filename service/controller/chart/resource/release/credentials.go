@@ -0,0 +1,191 @@
+package release
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/microerror"
+	"github.com/spf13/afero"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+)
+
+const (
+	// Keys of the secret referenced by the credentials secret annotation.
+	credentialsCAKey       = "ca.crt"
+	credentialsCertKey     = "tls.crt"
+	credentialsKeyKey      = "tls.key"
+	credentialsPasswordKey = "password"
+	credentialsTokenKey    = "token"
+	credentialsUsernameKey = "username"
+)
+
+// chartCredentials are used to pull the chart tarball of a single chart CR.
+type chartCredentials struct {
+	httpClient *http.Client
+	password   string
+	token      string
+	username   string
+}
+
+// getChartCredentials returns the credentials from the secret referenced by
+// the chart CR. It returns nil when no secret is referenced.
+func (r *Resource) getChartCredentials(ctx context.Context, cr v1alpha1.Chart) (*chartCredentials, error) {
+	namespace, name := key.CredentialsSecret(cr)
+	if name == "" {
+		return nil, nil
+	}
+	if !r.isSecretNamespaceAllowed(cr, namespace) {
+		return nil, microerror.Maskf(invalidCredentialsSecretError, "credentials secret %#q must be in namespace %#q or an allowed secret namespace, not %#q", name, cr.Namespace, namespace)
+	}
+
+	secret, err := r.k8sClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, microerror.Maskf(invalidCredentialsSecretError, "credentials secret %#q in namespace %#q not found", name, namespace)
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	credentials := &chartCredentials{
+		password: string(secret.Data[credentialsPasswordKey]),
+		token:    string(secret.Data[credentialsTokenKey]),
+		username: string(secret.Data[credentialsUsernameKey]),
+	}
+
+	if credentials.token != "" && credentials.username != "" {
+		return nil, microerror.Maskf(invalidCredentialsSecretError, "credentials secret %#q in namespace %#q must not have both a token and a username", name, namespace)
+	}
+
+	credentials.httpClient = &http.Client{Timeout: r.httpClientTimeout}
+
+	cert, certKey, ca := secret.Data[credentialsCertKey], secret.Data[credentialsKeyKey], secret.Data[credentialsCAKey]
+	if len(cert) == 0 && len(certKey) == 0 && len(ca) == 0 {
+		return credentials, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if len(cert) > 0 || len(certKey) > 0 {
+		certificate, err := tls.X509KeyPair(cert, certKey)
+		if err != nil {
+			return nil, microerror.Maskf(invalidCredentialsSecretError, "credentials secret %#q in namespace %#q has invalid client certificate", name, namespace)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if len(ca) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, microerror.Maskf(invalidCredentialsSecretError, "credentials secret %#q in namespace %#q has invalid CA", name, namespace)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	credentials.httpClient.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+
+	return credentials, nil
+}
+
+// pullChartTarballWithCredentials downloads the chart tarball to a temporary
+// file using the credentials and returns its path.
+func (r *Resource) pullChartTarballWithCredentials(ctx context.Context, tarballURL string, credentials *chartCredentials) (string, error) {
+	resp, err := r.getChartFile(ctx, tarballURL, credentials)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+	defer resp.Body.Close()
+
+	f, err := afero.TempFile(r.fs, "", "chart-operator-chart")
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, resp.Body)
+	if err != nil {
+		_ = r.fs.Remove(f.Name())
+		return "", microerror.Maskf(pullChartFailedError, "downloading %#q: %s", tarballURL, err)
+	}
+
+	return f.Name(), nil
+}
+
+// getChartFile sends a GET request for a file in the chart repository. The
+// credentials are optional. The caller must close the response body.
+func (r *Resource) getChartFile(ctx context.Context, u string, credentials *chartCredentials) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, microerror.Maskf(pullChartFailedError, "invalid URL %#q", u)
+	}
+
+	httpClient := &http.Client{Timeout: r.httpClientTimeout}
+	if credentials != nil {
+		httpClient = credentials.httpClient
+
+		if credentials.token != "" {
+			req.Header.Set("Authorization", "Bearer "+credentials.token)
+		} else if credentials.username != "" {
+			req.SetBasicAuth(credentials.username, credentials.password)
+		}
+	}
+
+	resp, err := httpClient.Do(req)
+	if os.IsTimeout(err) {
+		return nil, microerror.Maskf(pullChartTimeoutError, "timeout pulling %#q", u)
+	} else if err != nil {
+		return nil, microerror.Maskf(pullChartFailedError, "pulling %#q: %s", u, err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		resp.Body.Close()
+		return nil, microerror.Maskf(pullChartUnauthorizedError, "pulling %#q failed with http status %d", u, resp.StatusCode)
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, microerror.Maskf(pullChartNotFoundError, "%#q not found", u)
+	default:
+		resp.Body.Close()
+		return nil, microerror.Maskf(pullChartFailedError, "pulling %#q failed with http status %d", u, resp.StatusCode)
+	}
+}
+
+// credentialsCacheKey is the key of tarballs pulled with credentials in the
+// tarball cache. It includes the secret so chart CRs without access to the
+// repository do not get the tarball from the cache by its URL.
+func credentialsCacheKey(cr v1alpha1.Chart) string {
+	namespace, name := key.CredentialsSecret(cr)
+	return fmt.Sprintf("%s/%s@%s", namespace, name, key.TarballURL(cr))
+}
+
+// isSecretNamespaceAllowed returns true when the secret or values source
+// referenced by the chart CR is in its own namespace or in one of the secret
+// namespaces of the operator. Otherwise chart CRs could use the secrets of any
+// namespace.
+func (r *Resource) isSecretNamespaceAllowed(cr v1alpha1.Chart, namespace string) bool {
+	if namespace == cr.Namespace {
+		return true
+	}
+
+	for _, n := range r.secretNamespaces {
+		if namespace == n {
+			return true
+		}
+	}
+
+	return false
+}
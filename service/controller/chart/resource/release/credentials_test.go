@@ -0,0 +1,243 @@
+package release
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/spf13/afero"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+)
+
+func Test_pullChartTarballWithCredentials(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		switch {
+		case ok && username == "catalog" && password == "secret":
+		case r.Header.Get("Authorization") == "Bearer catalog-token":
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Path != "/prometheus-1.0.0.tgz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write([]byte("chart tarball"))
+	}))
+	defer server.Close()
+
+	serverCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	testCases := []struct {
+		name         string
+		tarballURL   string
+		data         map[string][]byte
+		errorMatcher func(error) bool
+	}{
+		{
+			name:       "case 0: basic auth",
+			tarballURL: server.URL + "/prometheus-1.0.0.tgz",
+			data: map[string][]byte{
+				"ca.crt":   serverCA,
+				"password": []byte("secret"),
+				"username": []byte("catalog"),
+			},
+		},
+		{
+			name:       "case 1: token",
+			tarballURL: server.URL + "/prometheus-1.0.0.tgz",
+			data: map[string][]byte{
+				"ca.crt": serverCA,
+				"token":  []byte("catalog-token"),
+			},
+		},
+		{
+			name:       "case 2: wrong password",
+			tarballURL: server.URL + "/prometheus-1.0.0.tgz",
+			data: map[string][]byte{
+				"ca.crt":   serverCA,
+				"password": []byte("wrong"),
+				"username": []byte("catalog"),
+			},
+			errorMatcher: IsPullChartUnauthorized,
+		},
+		{
+			name:       "case 3: chart not found",
+			tarballURL: server.URL + "/prometheus-2.0.0.tgz",
+			data: map[string][]byte{
+				"ca.crt": serverCA,
+				"token":  []byte("catalog-token"),
+			},
+			errorMatcher: IsPullChartNotFound,
+		},
+		{
+			name:       "case 4: server CA not trusted",
+			tarballURL: server.URL + "/prometheus-1.0.0.tgz",
+			data: map[string][]byte{
+				"token": []byte("catalog-token"),
+			},
+			errorMatcher: IsPullChartFailed,
+		},
+		{
+			name:       "case 5: invalid CA",
+			tarballURL: server.URL + "/prometheus-1.0.0.tgz",
+			data: map[string][]byte{
+				"ca.crt": []byte("invalid"),
+			},
+			errorMatcher: IsInvalidCredentialsSecret,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			ctx := context.Background()
+			fs := afero.NewMemMapFs()
+
+			cr := v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.CredentialsSecret: "catalog-credentials",
+					},
+					Name:      "prometheus",
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					TarballURL: tc.tarballURL,
+				},
+			}
+
+			r := &Resource{
+				fs: fs,
+				k8sClient: fake.NewSimpleClientset(&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "catalog-credentials",
+						Namespace: "giantswarm",
+					},
+					Data: tc.data,
+				}),
+				logger: microloggertest.New(),
+
+				httpClientTimeout: 5 * time.Second,
+			}
+
+			var path string
+			credentials, err := r.getChartCredentials(ctx, cr)
+			if err == nil {
+				path, err = r.pullChartTarballWithCredentials(ctx, tc.tarballURL, credentials)
+			}
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if err == nil {
+				content, err := afero.ReadFile(fs, path)
+				if err != nil {
+					t.Fatalf("error == %#v, want nil", err)
+				}
+				if string(content) != "chart tarball" {
+					t.Fatalf("content == %#q, want %#q", content, "chart tarball")
+				}
+			}
+
+			if _, _, ok := pullFailedStatus(cr, err); err != nil && !ok {
+				t.Fatalf("pullFailedStatus == false, want true for %#v", err)
+			}
+		})
+	}
+}
+
+func Test_getChartCredentials_secretNamespace(t *testing.T) {
+	testCases := []struct {
+		name             string
+		secret           string
+		secretNamespaces []string
+		errorMatcher     func(error) bool
+	}{
+		{
+			name:   "case 0: secret in chart CR namespace",
+			secret: "catalog-credentials",
+		},
+		{
+			name:         "case 1: secret in other namespace",
+			secret:       "kube-system/catalog-credentials",
+			errorMatcher: IsInvalidCredentialsSecret,
+		},
+		{
+			name:             "case 2: secret in allowed namespace",
+			secret:           "kube-system/catalog-credentials",
+			secretNamespaces: []string{"kube-system"},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			cr := v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.CredentialsSecret: tc.secret,
+					},
+					Name:      "prometheus",
+					Namespace: "giantswarm",
+				},
+			}
+
+			r := &Resource{
+				k8sClient: fake.NewSimpleClientset(
+					&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "catalog-credentials",
+							Namespace: "giantswarm",
+						},
+						Data: map[string][]byte{
+							"token": []byte("catalog-token"),
+						},
+					},
+					&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "catalog-credentials",
+							Namespace: "kube-system",
+						},
+						Data: map[string][]byte{
+							"token": []byte("catalog-token"),
+						},
+					},
+				),
+				logger: microloggertest.New(),
+
+				secretNamespaces: tc.secretNamespaces,
+			}
+
+			_, err := r.getChartCredentials(context.Background(), cr)
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+		})
+	}
+}
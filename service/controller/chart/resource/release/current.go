@@ -7,6 +7,7 @@ import (
 	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/operatorkit/v4/pkg/controller/context/resourcecanceledcontext"
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/giantswarm/chart-operator/v2/pkg/project"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
@@ -24,10 +25,30 @@ func (r *Resource) GetCurrentState(ctx context.Context, obj interface{}) (interf
 	}
 
 	if key.IsCordoned(cr) {
-		r.logger.Debugf(ctx, "release %#q has been cordoned until %#q due to reason %#q ", key.ReleaseName(cr), key.CordonUntil(cr), key.CordonReason(cr))
-		r.logger.Debugf(ctx, "canceling resource")
-		resourcecanceledcontext.SetCanceled(ctx)
-		return nil, nil
+		_, err := key.CordonUntilDate(cr)
+		if key.IsInvalidCordonUntilError(err) {
+			reason := fmt.Sprintf("cordon-until date %#q is invalid, it must be in RFC 3339 format", key.CordonUntil(cr))
+			addStatusToContext(cc, reason, invalidCordonUntilStatus)
+
+			r.logger.LogCtx(ctx, "level", "warning", "message", reason, "stack", microerror.JSON(err))
+			r.logger.Debugf(ctx, "canceling resource")
+			resourcecanceledcontext.SetCanceled(ctx)
+			return nil, nil
+		} else if key.IsCordonExpired(cr) {
+			r.logger.Debugf(ctx, "cordon for release %#q expired at %#q", key.ReleaseName(cr), key.CordonUntil(cr))
+
+			err = r.uncordon(ctx, cr)
+			if err != nil {
+				return nil, microerror.Mask(err)
+			}
+
+			r.eventRecorder.Eventf(&cr, corev1.EventTypeNormal, "Uncordoned", "cordon expired at %s", key.CordonUntil(cr))
+		} else {
+			r.logger.Debugf(ctx, "release %#q has been cordoned until %#q due to reason %#q ", key.ReleaseName(cr), key.CordonUntil(cr), key.CordonReason(cr))
+			r.logger.Debugf(ctx, "canceling resource")
+			resourcecanceledcontext.SetCanceled(ctx)
+			return nil, nil
+		}
 	}
 
 	hasConfigmap, err := r.findHelmV2ConfigMaps(ctx, key.ReleaseName(cr))
@@ -72,6 +93,7 @@ func (r *Resource) GetCurrentState(ctx context.Context, obj interface{}) (interf
 	releaseState := &ReleaseState{
 		Name:              releaseName,
 		Status:            releaseContent.Status,
+		ValuesChecksum:    key.ValuesChecksumAnnotation(cr),
 		ValuesMD5Checksum: key.ValuesMD5ChecksumAnnotation(cr),
 		Version:           releaseContent.Version,
 	}
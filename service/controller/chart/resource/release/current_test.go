@@ -15,6 +15,7 @@ import (
 	"github.com/spf13/afero"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
 )
@@ -27,6 +28,8 @@ func Test_CurrentState(t *testing.T) {
 		returnedError  error
 		expectedState  ReleaseState
 		expectedError  bool
+		expectedEvent  string
+		expectedStatus string
 	}{
 		{
 			name: "case 0: basic match",
@@ -111,7 +114,7 @@ func Test_CurrentState(t *testing.T) {
 				ObjectMeta: metav1.ObjectMeta{
 					Annotations: map[string]string{
 						"chart-operator.giantswarm.io/cordon-reason": "testing upgrade",
-						"chart-operator.giantswarm.io/cordon-until":  "2019-12-31T23:59:59Z",
+						"chart-operator.giantswarm.io/cordon-until":  "2999-12-31T23:59:59Z",
 					},
 				},
 				Spec: v1alpha1.ChartSpec{
@@ -120,6 +123,49 @@ func Test_CurrentState(t *testing.T) {
 			},
 			expectedState: ReleaseState{},
 		},
+		{
+			name: "case 5: chart cordon expired",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "prometheus",
+					Namespace: "giantswarm",
+					Annotations: map[string]string{
+						"chart-operator.giantswarm.io/cordon-reason": "testing upgrade",
+						"chart-operator.giantswarm.io/cordon-until":  "2019-12-31T23:59:59Z",
+					},
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name: "prometheus",
+				},
+			},
+			releaseContent: &helmclient.ReleaseContent{
+				Name:    "prometheus",
+				Status:  "DEPLOYED",
+				Version: "0.1.2",
+			},
+			expectedState: ReleaseState{
+				Name:    "prometheus",
+				Status:  "DEPLOYED",
+				Version: "0.1.2",
+			},
+			expectedEvent: "Normal Uncordoned cordon expired at 2019-12-31T23:59:59Z",
+		},
+		{
+			name: "case 6: chart cordon date invalid",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"chart-operator.giantswarm.io/cordon-reason": "testing upgrade",
+						"chart-operator.giantswarm.io/cordon-until":  "31/12/2019",
+					},
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name: "prometheus",
+				},
+			},
+			expectedState:  ReleaseState{},
+			expectedStatus: invalidCordonUntilStatus,
+		},
 	}
 
 	for i, tc := range testCases {
@@ -139,12 +185,19 @@ func Test_CurrentState(t *testing.T) {
 				helmClient = helmclienttest.New(c)
 			}
 
+			eventRecorder := record.NewFakeRecorder(1)
+
 			c := Config{
-				Fs:         afero.NewMemMapFs(),
-				G8sClient:  fake.NewSimpleClientset(),
-				HelmClient: helmClient,
-				K8sClient:  k8sfake.NewSimpleClientset(),
-				Logger:     microloggertest.New(),
+				DynamicClient:     newTestDynamicClient(),
+				EventRecorder:     eventRecorder,
+				Fs:                afero.NewMemMapFs(),
+				G8sClient:         fake.NewSimpleClientset(tc.obj),
+				HelmClient:        helmClient,
+				HelmStorage:       newTestHelmStorage(t, k8sfake.NewSimpleClientset()),
+				K8sClient:         k8sfake.NewSimpleClientset(),
+				Logger:            microloggertest.New(),
+				ReleaseOperations: newReleaseOperations(t),
+				RESTMapper:        newTestRESTMapper(),
 
 				TillerNamespace: "giantswarm",
 			}
@@ -170,6 +223,23 @@ func Test_CurrentState(t *testing.T) {
 			if !cmp.Equal(ReleaseState, tc.expectedState) {
 				t.Fatalf("want matching ReleaseState \n %s", cmp.Diff(ReleaseState, tc.expectedState))
 			}
+
+			cc, err := controllercontext.FromContext(ctx)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+			if cc.Status.Release.Status != tc.expectedStatus {
+				t.Fatalf("status == %#q, want %#q", cc.Status.Release.Status, tc.expectedStatus)
+			}
+
+			var event string
+			select {
+			case event = <-eventRecorder.Events:
+			default:
+			}
+			if event != tc.expectedEvent {
+				t.Fatalf("event == %#q, want %#q", event, tc.expectedEvent)
+			}
 		})
 	}
 
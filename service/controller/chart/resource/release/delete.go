@@ -2,14 +2,17 @@ package release
 
 import (
 	"context"
+	"time"
 
 	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/operatorkit/v4/pkg/controller/context/finalizerskeptcontext"
 	"github.com/giantswarm/operatorkit/v4/pkg/controller/context/resourcecanceledcontext"
 	"github.com/giantswarm/operatorkit/v4/pkg/resource/crud"
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+	"github.com/giantswarm/chart-operator/v2/service/releaseoperation"
 )
 
 func (r *Resource) ApplyDeleteChange(ctx context.Context, obj, deleteChange interface{}) error {
@@ -23,12 +26,35 @@ func (r *Resource) ApplyDeleteChange(ctx context.Context, obj, deleteChange inte
 		return microerror.Mask(err)
 	}
 
+	driftedObjectsGauge.DeleteLabelValues(cr.Namespace, cr.Name)
+	r.deleteDriftState(cr)
+
 	if releaseState.Name != "" {
+		done, ok, err := r.startOperation(ctx, key.Namespace(cr), releaseState.Name, releaseoperation.Delete)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		if !ok {
+			// We keep the finalizer and retry the delete in the next
+			// reconciliation loop.
+			finalizerskeptcontext.SetKept(ctx)
+			r.logger.Debugf(ctx, "keeping finalizers")
+
+			resourcecanceledcontext.SetCanceled(ctx)
+			r.logger.Debugf(ctx, "canceling resource")
+
+			return nil
+		}
+
 		r.logger.Debugf(ctx, "deleting release %#q", releaseState.Name)
 
+		start := time.Now()
 		err = r.helmClient.DeleteRelease(ctx, key.Namespace(cr), releaseState.Name)
+		observeOperation(releaseoperation.Delete, start, err)
+		done()
 		if helmclient.IsReleaseNotFound(err) {
 			r.logger.Debugf(ctx, "release %#q already deleted", releaseState.Name)
+			r.releaseOperations.Recovered(ctx, key.Namespace(cr), releaseState.Name)
 			return nil
 		} else if err != nil {
 			return microerror.Mask(err)
@@ -49,6 +75,8 @@ func (r *Resource) ApplyDeleteChange(ctx context.Context, obj, deleteChange inte
 			return nil
 		} else if helmclient.IsReleaseNotFound(err) {
 			r.logger.Debugf(ctx, "deleted release %#q", releaseState.Name)
+			r.releaseOperations.Recovered(ctx, key.Namespace(cr), releaseState.Name)
+			r.eventRecorder.Eventf(&cr, corev1.EventTypeNormal, "Deleted", "deleted release %#q", releaseState.Name)
 		} else if err != nil {
 			return microerror.Mask(err)
 		}
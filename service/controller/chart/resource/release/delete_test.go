@@ -11,6 +11,7 @@ import (
 	"github.com/giantswarm/micrologger/microloggertest"
 	"github.com/spf13/afero"
 	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 )
 
 func Test_Resource_Release_newDeleteChange(t *testing.T) {
@@ -72,11 +73,16 @@ func Test_Resource_Release_newDeleteChange(t *testing.T) {
 	var err error
 	{
 		c := Config{
-			Fs:         afero.NewMemMapFs(),
-			G8sClient:  fake.NewSimpleClientset(),
-			HelmClient: helmclienttest.New(helmclienttest.Config{}),
-			K8sClient:  k8sfake.NewSimpleClientset(),
-			Logger:     microloggertest.New(),
+			DynamicClient:     newTestDynamicClient(),
+			EventRecorder:     &record.FakeRecorder{},
+			Fs:                afero.NewMemMapFs(),
+			G8sClient:         fake.NewSimpleClientset(),
+			HelmClient:        helmclienttest.New(helmclienttest.Config{}),
+			HelmStorage:       newTestHelmStorage(t, k8sfake.NewSimpleClientset()),
+			K8sClient:         k8sfake.NewSimpleClientset(),
+			Logger:            microloggertest.New(),
+			ReleaseOperations: newReleaseOperations(t),
+			RESTMapper:        newTestRESTMapper(),
 
 			TillerNamespace: "giantswarm",
 		}
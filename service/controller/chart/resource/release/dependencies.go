@@ -0,0 +1,264 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
+	"github.com/giantswarm/microerror"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+)
+
+// checkDependencies returns true when the release of the chart CR may be
+// installed or upgraded. The release depends on the chart CRs listed in the
+// depends-on annotation and on the chart CRs in the same namespace with a
+// higher priority which do not depend on it. All of them must be deployed. Otherwise the status is
+// added to the controller context and false is returned.
+func (r *Resource) checkDependencies(ctx context.Context, cr v1alpha1.Chart) (bool, error) {
+	cc, err := controllercontext.FromContext(ctx)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	_, err = key.Priority(cr)
+	if key.IsInvalidPriorityError(err) {
+		addStatusToContext(cc, err.Error(), invalidPriorityStatus)
+
+		r.logger.Debugf(ctx, "chart CR %#q has an invalid priority", cr.Name)
+		return false, nil
+	} else if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	charts, err := r.listCharts(ctx, cr.Namespace)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	graph := newDependencyGraph(charts)
+
+	cycle := graph.cycle(cr.Name)
+	if len(cycle) > 0 {
+		reason := fmt.Sprintf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		addStatusToContext(cc, reason, dependencyCycleStatus)
+
+		r.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("chart CR %#q has a %s", cr.Name, reason))
+		return false, nil
+	}
+
+	var notDeployed []string
+	for _, name := range graph.dependencies(cr.Name) {
+		dependency, ok := graph.charts[name]
+		if !ok {
+			notDeployed = append(notDeployed, fmt.Sprintf("%#q not found", name))
+		} else if status := key.ChartStatus(dependency).Release.Status; status != helmclient.StatusDeployed {
+			if status == "" {
+				status = "unknown"
+			}
+			notDeployed = append(notDeployed, fmt.Sprintf("%#q in status %#q", name, status))
+		}
+	}
+
+	if len(notDeployed) > 0 {
+		reason := fmt.Sprintf("waiting for dependencies: %s", strings.Join(notDeployed, ", "))
+		addStatusToContext(cc, reason, waitingForDependenciesStatus)
+
+		r.logger.Debugf(ctx, "release %#q is %s", key.ReleaseName(cr), reason)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// listCharts returns the chart CRs in the namespace from the informer cache so
+// the chart CRs are not listed from the API server on every reconciliation.
+// The informer is started on first use and runs until the operator stops.
+func (r *Resource) listCharts(ctx context.Context, namespace string) ([]v1alpha1.Chart, error) {
+	r.chartInformerOnce.Do(func() {
+		go r.chartInformer.Run(r.releaseOperations.Context(ctx).Done())
+	})
+
+	if !cache.WaitForCacheSync(ctx.Done(), r.chartInformer.HasSynced) {
+		return nil, microerror.Maskf(waitError, "chart CR cache not synced")
+	}
+
+	objs, err := r.chartInformer.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var charts []v1alpha1.Chart
+	for _, obj := range objs {
+		chart, err := key.ToCustomResource(obj)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		charts = append(charts, chart)
+	}
+
+	return charts, nil
+}
+
+// dependencyGraph has the chart CRs of a namespace and the chart CRs each of
+// them depends on.
+type dependencyGraph struct {
+	charts map[string]v1alpha1.Chart
+	edges  map[string][]string
+}
+
+// newDependencyGraph adds the dependencies of the depends-on annotations and
+// the implicit dependencies on the chart CRs with a higher priority. The
+// priority only orders chart CRs which do not depend on each other. So an
+// implicit dependency is skipped when the chart CR with the higher priority
+// already depends on the other one. Cycles are only caused by the depends-on
+// annotations.
+func newDependencyGraph(charts []v1alpha1.Chart) dependencyGraph {
+	g := dependencyGraph{
+		charts: map[string]v1alpha1.Chart{},
+		edges:  map[string][]string{},
+	}
+
+	priorities := map[string]int{}
+	for _, chart := range charts {
+		if key.IsDeleted(chart) {
+			continue
+		}
+
+		// Invalid priorities are reported when the chart CR itself is
+		// reconciled.
+		priority, _ := key.Priority(chart)
+
+		g.charts[chart.Name] = chart
+		priorities[chart.Name] = priority
+	}
+
+	var names []string
+	for name, chart := range g.charts {
+		g.edges[name] = key.DependsOn(chart)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Higher priorities are added first so the result does not depend on
+	// the order of the chart CRs.
+	byPriority := append([]string{}, names...)
+	sort.SliceStable(byPriority, func(i, j int) bool {
+		return priorities[byPriority[i]] > priorities[byPriority[j]]
+	})
+
+	for _, name := range names {
+		for _, other := range byPriority {
+			if priorities[other] <= priorities[name] {
+				break
+			}
+			if contains(g.edges[name], other) || g.reaches(other, name) {
+				continue
+			}
+
+			g.edges[name] = append(g.edges[name], other)
+		}
+	}
+
+	return g
+}
+
+// reaches returns true when the chart CR from depends directly or transitively
+// on the chart CR to.
+func (g dependencyGraph) reaches(from, to string) bool {
+	visited := map[string]bool{}
+
+	var visit func(n string) bool
+	visit = func(n string) bool {
+		if n == to {
+			return true
+		}
+		if visited[n] {
+			return false
+		}
+		visited[n] = true
+
+		for _, dependency := range g.edges[n] {
+			if visit(dependency) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return visit(from)
+}
+
+// dependencies returns the chart CRs the chart CR directly depends on.
+func (g dependencyGraph) dependencies(name string) []string {
+	return g.edges[name]
+}
+
+// cycle returns the first dependency cycle reachable from the chart CR as a
+// path starting and ending with the same chart CR. It returns nil when there
+// is no cycle.
+func (g dependencyGraph) cycle(name string) []string {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := map[string]int{}
+	var path []string
+
+	var visit func(n string) []string
+	visit = func(n string) []string {
+		state[n] = visiting
+		path = append(path, n)
+
+		for _, dependency := range g.edges[n] {
+			switch state[dependency] {
+			case visiting:
+				for i, p := range path {
+					if p == dependency {
+						cycle := append([]string{}, path[i:]...)
+						return append(cycle, dependency)
+					}
+				}
+			case visited:
+				continue
+			default:
+				if _, ok := g.edges[dependency]; !ok {
+					// Missing chart CRs have no dependencies.
+					continue
+				}
+				if cycle := visit(dependency); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[n] = visited
+
+		return nil
+	}
+
+	if _, ok := g.edges[name]; !ok {
+		return nil
+	}
+
+	return visit(name)
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,206 @@
+package release
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/apiextensions/v3/pkg/clientset/versioned/fake"
+	"github.com/giantswarm/helmclient/v4/pkg/helmclienttest"
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
+)
+
+func Test_checkDependencies(t *testing.T) {
+	testCases := []struct {
+		name           string
+		charts         []v1alpha1.Chart
+		expectedOK     bool
+		expectedStatus controllercontext.Status
+	}{
+		{
+			name: "case 0: no dependencies",
+			charts: []v1alpha1.Chart{
+				newDependencyChart("prometheus", "", "", ""),
+				newDependencyChart("grafana", "", "", "pending-install"),
+			},
+			expectedOK: true,
+		},
+		{
+			name: "case 1: dependencies deployed",
+			charts: []v1alpha1.Chart{
+				newDependencyChart("prometheus", "cilium,coredns", "", ""),
+				newDependencyChart("cilium", "", "", "deployed"),
+				newDependencyChart("coredns", "cilium", "", "deployed"),
+			},
+			expectedOK: true,
+		},
+		{
+			name: "case 2: dependencies not deployed or not found",
+			charts: []v1alpha1.Chart{
+				newDependencyChart("prometheus", "cilium,coredns,kiam", "", ""),
+				newDependencyChart("cilium", "", "", "deployed"),
+				newDependencyChart("coredns", "", "", "pending-install"),
+			},
+			expectedStatus: controllercontext.Status{
+				Reason: "waiting for dependencies: `coredns` in status `pending-install`, `kiam` not found",
+				Release: controllercontext.Release{
+					Status: waitingForDependenciesStatus,
+				},
+			},
+		},
+		{
+			name: "case 3: chart with higher priority not deployed",
+			charts: []v1alpha1.Chart{
+				newDependencyChart("prometheus", "", "", ""),
+				newDependencyChart("cilium", "", "10", ""),
+				newDependencyChart("grafana", "", "-1", "failed"),
+			},
+			expectedStatus: controllercontext.Status{
+				Reason: "waiting for dependencies: `cilium` in status `unknown`",
+				Release: controllercontext.Release{
+					Status: waitingForDependenciesStatus,
+				},
+			},
+		},
+		{
+			name: "case 4: dependency cycle",
+			charts: []v1alpha1.Chart{
+				newDependencyChart("prometheus", "grafana", "", ""),
+				newDependencyChart("grafana", "loki", "", ""),
+				newDependencyChart("loki", "prometheus", "", ""),
+			},
+			expectedStatus: controllercontext.Status{
+				Reason: "dependency cycle: prometheus -> grafana -> loki -> prometheus",
+				Release: controllercontext.Release{
+					Status: dependencyCycleStatus,
+				},
+			},
+		},
+		{
+			name: "case 5: chart with higher priority depending on the chart CR",
+			charts: []v1alpha1.Chart{
+				newDependencyChart("prometheus", "", "", ""),
+				newDependencyChart("cilium", "prometheus", "10", ""),
+			},
+			expectedOK: true,
+		},
+		{
+			name: "case 6: dependency cycle not including the chart CR",
+			charts: []v1alpha1.Chart{
+				newDependencyChart("prometheus", "grafana", "", ""),
+				newDependencyChart("grafana", "loki", "", ""),
+				newDependencyChart("loki", "grafana", "", ""),
+			},
+			expectedStatus: controllercontext.Status{
+				Reason: "dependency cycle: grafana -> loki -> grafana",
+				Release: controllercontext.Release{
+					Status: dependencyCycleStatus,
+				},
+			},
+		},
+		{
+			name: "case 7: chart with higher priority depending on the chart CR transitively",
+			charts: []v1alpha1.Chart{
+				newDependencyChart("prometheus", "", "", ""),
+				newDependencyChart("cilium", "coredns", "10", ""),
+				newDependencyChart("coredns", "prometheus", "", "deployed"),
+				newDependencyChart("grafana", "", "5", "deployed"),
+			},
+			expectedOK: true,
+		},
+		{
+			name: "case 8: invalid priority",
+			charts: []v1alpha1.Chart{
+				newDependencyChart("prometheus", "", "high", ""),
+			},
+			expectedStatus: controllercontext.Status{
+				Reason: "invalid priority error: cannot parse `high` as integer",
+				Release: controllercontext.Release{
+					Status: invalidPriorityStatus,
+				},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			var objs []runtime.Object
+			for i := range tc.charts {
+				objs = append(objs, &tc.charts[i])
+			}
+
+			c := Config{
+				DynamicClient:     newTestDynamicClient(),
+				EventRecorder:     &record.FakeRecorder{},
+				Fs:                afero.NewMemMapFs(),
+				G8sClient:         fake.NewSimpleClientset(objs...),
+				HelmClient:        helmclienttest.New(helmclienttest.Config{}),
+				HelmStorage:       newTestHelmStorage(t, k8sfake.NewSimpleClientset()),
+				K8sClient:         k8sfake.NewSimpleClientset(),
+				Logger:            microloggertest.New(),
+				ReleaseOperations: newReleaseOperations(t),
+				RESTMapper:        newTestRESTMapper(),
+
+				TillerNamespace: "giantswarm",
+			}
+
+			r, err := New(c)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			ctx := controllercontext.NewContext(context.Background(), controllercontext.Context{})
+
+			ok, err := r.checkDependencies(ctx, tc.charts[0])
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+			if ok != tc.expectedOK {
+				t.Fatalf("ok == %t, want %t", ok, tc.expectedOK)
+			}
+
+			cc, err := controllercontext.FromContext(ctx)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+			if !cmp.Equal(cc.Status, tc.expectedStatus) {
+				t.Fatalf("want matching status \n %s", cmp.Diff(cc.Status, tc.expectedStatus))
+			}
+		})
+	}
+}
+
+func newDependencyChart(name, dependsOn, priority, status string) v1alpha1.Chart {
+	cr := v1alpha1.Chart{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "giantswarm",
+			Annotations: map[string]string{},
+		},
+		Status: v1alpha1.ChartStatus{
+			Release: v1alpha1.ChartStatusRelease{
+				Status: status,
+			},
+		},
+	}
+	if dependsOn != "" {
+		cr.Annotations[annotation.DependsOn] = dependsOn
+	}
+	if priority != "" {
+		cr.Annotations[annotation.Priority] = priority
+	}
+
+	return cr
+}
@@ -3,69 +3,187 @@ package release
 import (
 	"context"
 	"crypto/md5" // #nosec
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
 	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
 	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/operatorkit/v4/pkg/controller/context/resourcecanceledcontext"
 	"github.com/imdario/mergo"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/yaml"
 
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
 )
 
+const (
+	// maxValuesProvenanceLength is the maximum length of the sources of the
+	// values reported in the message of the values resolved condition.
+	maxValuesProvenanceLength = 1024
+)
+
 func (r *Resource) GetDesiredState(ctx context.Context, obj interface{}) (interface{}, error) {
 	cr, err := key.ToCustomResource(obj)
 	if err != nil {
 		return nil, microerror.Mask(err)
 	}
 
-	configMapData, err := r.getConfigMapData(ctx, cr)
+	cc, err := controllercontext.FromContext(ctx)
 	if err != nil {
 		return nil, microerror.Mask(err)
 	}
 
-	secretData, err := r.getSecretData(ctx, cr)
-	if err != nil {
+	values, provenance, err := r.getValues(ctx, cr)
+	if IsNotFound(err) || IsWrongType(err) || IsInvalidValuesSource(err) || key.IsInvalidValuesSourcesError(err) {
+		reason := fmt.Sprintf("values not resolved: %s", err.Error())
+		addStatusToContext(cc, reason, valuesNotResolvedStatus)
+		cc.Status.ValuesResolveFailed = true
+
+		r.logger.LogCtx(ctx, "level", "warning", "message", reason, "stack", microerror.JSON(err))
+		r.logger.Debugf(ctx, "canceling resource")
+		resourcecanceledcontext.SetCanceled(ctx)
+		return &ReleaseState{}, nil
+	} else if err != nil {
 		return nil, microerror.Mask(err)
 	}
 
-	// Merge configmap and secret to provide a single set of values to Helm.
-	err = mergo.Merge(&configMapData, secretData, mergo.WithOverride)
-	if err != nil {
-		return nil, microerror.Mask(err)
+	if len(provenance) > 0 {
+		// The sources of the values are reported in the message of the
+		// values resolved condition.
+		cc.Status.ValuesProvenance = fmt.Sprintf("values set by %s", formatValuesProvenance(provenance))
+		r.logger.Debugf(ctx, "values for release %#q set by %s", key.ReleaseName(cr), formatValuesProvenance(provenance))
 	}
 
-	// Convert all floats to integers if they have the same value to return the same md5 hash.
-	convertFloat(configMapData)
+	// Convert all floats to integers if they have the same value so Helm
+	// renders them as integers.
+	convertFloat(values)
 
-	var valuesMD5Checksum string
+	var valuesChecksum, valuesMD5Checksum string
 
-	if len(configMapData) > 0 {
-		// MD5 is only used for comparison but we need to turn off gosec or
-		// linting errors will occur.
-		h := md5.New() // #nosec
-		_, err := h.Write([]byte(fmt.Sprintf("%v", configMapData)))
+	if len(values) > 0 {
+		valuesChecksum, err = getValuesChecksum(values)
 		if err != nil {
 			return nil, microerror.Mask(err)
 		}
 
-		valuesMD5Checksum = fmt.Sprintf("%x", h.Sum(nil))
+		valuesMD5Checksum, err = getValuesMD5Checksum(values)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
 	}
 
 	releaseState := &ReleaseState{
 		Name:              key.ReleaseName(cr),
 		Status:            helmclient.StatusDeployed,
+		ValuesChecksum:    valuesChecksum,
 		ValuesMD5Checksum: valuesMD5Checksum,
-		Values:            configMapData,
+		Values:            values,
 		Version:           key.Version(cr),
 	}
 
 	return releaseState, nil
 }
 
+// getValues returns the values of the configmap and secret in the chart CR
+// spec and the values sources merged in order. It also returns the sources
+// setting each top-level key.
+func (r *Resource) getValues(ctx context.Context, cr v1alpha1.Chart) (map[string]interface{}, map[string][]string, error) {
+	configMapData, err := r.getConfigMapData(ctx, cr)
+	if err != nil {
+		return nil, nil, microerror.Mask(err)
+	}
+
+	secretData, err := r.getSecretData(ctx, cr)
+	if err != nil {
+		return nil, nil, microerror.Mask(err)
+	}
+
+	sourcesLayers, err := r.getValuesSourcesLayers(ctx, cr)
+	if err != nil {
+		return nil, nil, microerror.Mask(err)
+	}
+
+	layers := []valuesLayer{
+		{
+			Source: fmt.Sprintf("configmap %s/%s", key.ConfigMapNamespace(cr), key.ConfigMapName(cr)),
+			Values: configMapData,
+		},
+		{
+			Source: fmt.Sprintf("secret %s/%s", key.SecretNamespace(cr), key.SecretName(cr)),
+			Values: secretData,
+		},
+	}
+	layers = append(layers, sourcesLayers...)
+
+	// Merge the layers in order to provide a single set of values to Helm.
+	values, provenance, err := mergeValuesLayers(layers)
+	if err != nil {
+		return nil, nil, microerror.Mask(err)
+	}
+
+	return values, provenance, nil
+}
+
+// formatValuesProvenance returns the sources of each top-level values key
+// sorted by key. Keys beyond maxValuesProvenanceLength are omitted so the
+// condition message stays readable.
+func formatValuesProvenance(provenance map[string][]string) string {
+	var keys []string
+	for k := range provenance {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var entries []string
+	var length int
+	for i, k := range keys {
+		entry := fmt.Sprintf("%s=[%s]", k, strings.Join(provenance[k], ", "))
+		if length+len(entry) > maxValuesProvenanceLength {
+			entries = append(entries, fmt.Sprintf("and %d more", len(keys)-i))
+			break
+		}
+
+		entries = append(entries, entry)
+		length += len(entry) + 1
+	}
+
+	return strings.Join(entries, " ")
+}
+
+// getValuesChecksum returns the SHA-256 checksum of the values. The values
+// are encoded as JSON which sorts map keys and encodes integers and floats
+// with the same value identically. So equal values always have the same
+// checksum.
+func getValuesChecksum(values map[string]interface{}) (string, error) {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+// getValuesMD5Checksum returns the legacy MD5 checksum of the values. It is
+// only used to migrate chart CRs that still have the MD5 checksum annotation.
+func getValuesMD5Checksum(values map[string]interface{}) (string, error) {
+	// MD5 is only used for comparison but we need to turn off gosec or
+	// linting errors will occur.
+	h := md5.New() // #nosec
+	_, err := h.Write([]byte(fmt.Sprintf("%v", values)))
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
 func (r *Resource) getConfigMapData(ctx context.Context, cr v1alpha1.Chart) (map[string]interface{}, error) {
 	configMapData := map[string]interface{}{}
 
@@ -89,11 +207,30 @@ func (r *Resource) getConfigMapData(ctx context.Context, cr v1alpha1.Chart) (map
 			return nil, microerror.Mask(err)
 		}
 
-		for _, str := range configMap.Data {
-			err := yaml.Unmarshal([]byte(str), &configMapData)
+		// Keys are merged in alphabetical order so the values are the same
+		// on every reconciliation when several keys set the same value.
+		var keys []string
+		for k := range configMap.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			var values map[string]interface{}
+
+			err := yaml.Unmarshal([]byte(configMap.Data[k]), &values)
 			if err != nil {
 				return nil, microerror.Mask(err)
 			}
+
+			overridden, err := mergeValues(configMapData, values)
+			if err != nil {
+				return nil, microerror.Mask(err)
+			}
+
+			if len(overridden) > 0 {
+				r.logger.Debugf(ctx, "key %#q of config map %#q in namespace %#q overrides values %s", k, configMapName, configMapNamespace, strings.Join(overridden, ", "))
+			}
 		}
 	}
 
@@ -137,3 +274,168 @@ func (r *Resource) getSecretData(ctx context.Context, cr v1alpha1.Chart) (map[st
 
 	return secretData, nil
 }
+
+// getValuesSourcesLayers returns the values of the configmaps and secrets
+// listed in the values sources annotation in the order they are listed.
+func (r *Resource) getValuesSourcesLayers(ctx context.Context, cr v1alpha1.Chart) ([]valuesLayer, error) {
+	// TODO: Improve desired state generation by removing call to key.IsDeleted.
+	//
+	//	See https://github.com/giantswarm/giantswarm/issues/5719
+	//
+	if key.IsDeleted(cr) {
+		// Return early as the sources may have already been deleted.
+		return nil, nil
+	}
+
+	sources, err := key.ValuesSources(cr)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var layers []valuesLayer
+
+	for _, source := range sources {
+		namespace := source.Namespace
+		if namespace == "" {
+			namespace = cr.Namespace
+		}
+		if !r.isSecretNamespaceAllowed(cr, namespace) {
+			return nil, microerror.Maskf(invalidValuesSourceError, "values source %s %#q must be in namespace %#q or an allowed secret namespace, not %#q", strings.ToLower(source.Kind), source.Name, cr.Namespace, namespace)
+		}
+
+		var data map[string][]byte
+
+		switch source.Kind {
+		case key.ValuesSourceKindConfigMap:
+			configMap, err := r.k8sClient.CoreV1().ConfigMaps(namespace).Get(ctx, source.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return nil, microerror.Maskf(notFoundError, "config map %#q in namespace %#q not found", source.Name, namespace)
+			} else if err != nil {
+				return nil, microerror.Mask(err)
+			}
+
+			data = map[string][]byte{}
+			for k, v := range configMap.Data {
+				data[k] = []byte(v)
+			}
+		case key.ValuesSourceKindSecret:
+			secret, err := r.k8sClient.CoreV1().Secrets(namespace).Get(ctx, source.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return nil, microerror.Maskf(notFoundError, "secret %#q in namespace %#q not found", source.Name, namespace)
+			} else if err != nil {
+				return nil, microerror.Mask(err)
+			}
+
+			data = secret.Data
+		}
+
+		keys := source.Keys
+		if len(keys) == 0 {
+			for k := range data {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+		}
+
+		layer := valuesLayer{
+			Source: fmt.Sprintf("%s %s/%s", strings.ToLower(source.Kind), namespace, source.Name),
+			Values: map[string]interface{}{},
+		}
+
+		for _, k := range keys {
+			bytes, ok := data[k]
+			if !ok {
+				return nil, microerror.Maskf(notFoundError, "key %#q not found in %s", k, layer.Source)
+			}
+
+			var values map[string]interface{}
+
+			err := yaml.Unmarshal(bytes, &values)
+			if err != nil {
+				return nil, microerror.Mask(err)
+			}
+
+			overridden, err := mergeValues(layer.Values, values)
+			if err != nil {
+				return nil, microerror.Mask(err)
+			}
+
+			if len(overridden) > 0 {
+				r.logger.Debugf(ctx, "key %#q of %s overrides values %s", k, layer.Source, strings.Join(overridden, ", "))
+			}
+		}
+
+		layers = append(layers, layer)
+	}
+
+	return layers, nil
+}
+
+// mergeValues deep merges src into dst so values in src override values in
+// dst. It returns the sorted paths of the values in dst that were overridden
+// with a different value.
+func mergeValues(dst, src map[string]interface{}) ([]string, error) {
+	overridden := overriddenValues(dst, src, "")
+	sort.Strings(overridden)
+
+	err := mergo.Merge(&dst, src, mergo.WithOverride)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return overridden, nil
+}
+
+// overriddenValues returns the paths of the values in dst that are set to a
+// different value in src. Nested maps are compared recursively and their
+// paths are joined with dots.
+func overriddenValues(dst, src map[string]interface{}, prefix string) []string {
+	var paths []string
+
+	for k, srcValue := range src {
+		dstValue, ok := dst[k]
+		if !ok {
+			continue
+		}
+
+		path := prefix + k
+
+		dstMap, dstIsMap := dstValue.(map[string]interface{})
+		srcMap, srcIsMap := srcValue.(map[string]interface{})
+		if dstIsMap && srcIsMap {
+			paths = append(paths, overriddenValues(dstMap, srcMap, path+".")...)
+			continue
+		}
+
+		if !reflect.DeepEqual(dstValue, srcValue) {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
+
+// mergeValuesLayers deep merges the values layers in order so later layers
+// override earlier ones. It also returns the sources that set each top-level
+// key.
+func mergeValuesLayers(layers []valuesLayer) (map[string]interface{}, map[string][]string, error) {
+	values := map[string]interface{}{}
+	provenance := map[string][]string{}
+
+	for _, l := range layers {
+		if len(l.Values) == 0 {
+			continue
+		}
+
+		err := mergo.Merge(&values, l.Values, mergo.WithOverride)
+		if err != nil {
+			return nil, nil, microerror.Mask(err)
+		}
+
+		for k := range l.Values {
+			provenance[k] = append(provenance[k], l.Source)
+		}
+	}
+
+	return values, provenance, nil
+}
@@ -2,7 +2,9 @@ package release
 
 import (
 	"context"
+	"fmt"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
@@ -16,6 +18,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/yaml"
 
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
@@ -23,12 +26,14 @@ import (
 
 func Test_DesiredState(t *testing.T) {
 	testCases := []struct {
-		name          string
-		obj           *v1alpha1.Chart
-		configMap     *apiv1.ConfigMap
-		secret        *apiv1.Secret
-		expectedState ReleaseState
-		errorMatcher  func(error) bool
+		name           string
+		obj            *v1alpha1.Chart
+		configMap      *apiv1.ConfigMap
+		secret         *apiv1.Secret
+		valuesSources  []runtime.Object
+		expectedState  ReleaseState
+		expectedStatus string
+		errorMatcher   func(error) bool
 	}{
 		{
 			name: "case 0: basic match",
@@ -41,6 +46,7 @@ func Test_DesiredState(t *testing.T) {
 			expectedState: ReleaseState{
 				Name:              "chart-operator-chart",
 				Status:            helmclient.StatusDeployed,
+				ValuesChecksum:    "",
 				ValuesMD5Checksum: "",
 				Values:            map[string]interface{}{},
 				Version:           "0.1.2",
@@ -70,6 +76,7 @@ func Test_DesiredState(t *testing.T) {
 			expectedState: ReleaseState{
 				Name:              "chart-operator-chart",
 				Status:            helmclient.StatusDeployed,
+				ValuesChecksum:    "",
 				ValuesMD5Checksum: "",
 				Values:            map[string]interface{}{},
 				Version:           "1.2.3",
@@ -101,6 +108,7 @@ func Test_DesiredState(t *testing.T) {
 			expectedState: ReleaseState{
 				Name:              "chart-operator-chart",
 				Status:            helmclient.StatusDeployed,
+				ValuesChecksum:    "3e80b3778b3b03766e7be993131c0af2ad05630c5d96fb7fa132d05b77336e04",
 				ValuesMD5Checksum: "6e5ae9a10fd227006b0f938c51cb300b",
 				Values: map[string]interface{}{
 					"test": "test",
@@ -134,6 +142,7 @@ func Test_DesiredState(t *testing.T) {
 			expectedState: ReleaseState{
 				Name:              "chart-operator-chart",
 				Status:            helmclient.StatusDeployed,
+				ValuesChecksum:    "2365f1f0952eed971e36c8fb95b0221f03cdd8b1a60d6133999917b6e709d8ce",
 				ValuesMD5Checksum: "4845bfb2cf922d7527886ac13599ea3b",
 				Values: map[string]interface{}{
 					"provider": "azure",
@@ -162,7 +171,7 @@ func Test_DesiredState(t *testing.T) {
 					Namespace: "giantswarm",
 				},
 			},
-			errorMatcher: IsNotFound,
+			expectedStatus: valuesNotResolvedStatus,
 		},
 		{
 			name: "case 5: basic match with secret value",
@@ -190,6 +199,7 @@ func Test_DesiredState(t *testing.T) {
 			expectedState: ReleaseState{
 				Name:              "chart-operator-chart",
 				Status:            helmclient.StatusDeployed,
+				ValuesChecksum:    "3e80b3778b3b03766e7be993131c0af2ad05630c5d96fb7fa132d05b77336e04",
 				ValuesMD5Checksum: "6e5ae9a10fd227006b0f938c51cb300b",
 				Values: map[string]interface{}{
 					"test": "test",
@@ -224,6 +234,7 @@ func Test_DesiredState(t *testing.T) {
 			expectedState: ReleaseState{
 				Name:              "chart-operator-chart",
 				Status:            helmclient.StatusDeployed,
+				ValuesChecksum:    "cd09a11ebd3548dfae41a46aeec52bd92975ddbb2521d04df62a25ddec480b75",
 				ValuesMD5Checksum: "2187a8fce91c3765a74d462062af7526",
 				Values: map[string]interface{}{
 					"secretnumber":   2,
@@ -252,7 +263,7 @@ func Test_DesiredState(t *testing.T) {
 					Namespace: "giantswarm",
 				},
 			},
-			errorMatcher: IsNotFound,
+			expectedStatus: valuesNotResolvedStatus,
 		},
 		{
 			name: "case 8: secret and configmap clash",
@@ -296,6 +307,7 @@ func Test_DesiredState(t *testing.T) {
 			expectedState: ReleaseState{
 				Name:              "chart-operator-chart",
 				Status:            helmclient.StatusDeployed,
+				ValuesChecksum:    "a9bdb30833cef67249f23339c6f979379c1f87e86dc54d310eb6dd7ea5a4cddb",
 				ValuesMD5Checksum: "3b8440387b1462ecdceb25c4cb9ff065",
 				Values: map[string]interface{}{
 					"replicas":     2,
@@ -306,6 +318,246 @@ func Test_DesiredState(t *testing.T) {
 				Version: "0.1.2",
 			},
 		},
+		{
+			name: "case 9: values sources merged in order",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"chart-operator.giantswarm.io/values-sources": `[{"kind":"ConfigMap","name":"catalog-values","namespace":"giantswarm"},{"kind":"Secret","name":"cluster-secrets","keys":["override","values"]}]`,
+					},
+					Namespace: "default",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name: "chart-operator-chart",
+					Config: v1alpha1.ChartSpecConfig{
+						ConfigMap: v1alpha1.ChartSpecConfigConfigMap{
+							Name:      "chart-operator-values-configmap",
+							Namespace: "giantswarm",
+						},
+					},
+					Version: "0.1.2",
+				},
+			},
+			configMap: &apiv1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "chart-operator-values-configmap",
+					Namespace: "giantswarm",
+				},
+				Data: map[string]string{
+					"values": `"image":
+  "registry": "quay.io"
+  "tag": "1.0.0"
+"replicas": 1`,
+				},
+			},
+			valuesSources: []runtime.Object{
+				&apiv1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "catalog-values",
+						Namespace: "giantswarm",
+					},
+					Data: map[string]string{
+						"a": `"image":
+  "tag": "1.1.0"`,
+						"b": `"replicas": 2`,
+					},
+				},
+				&apiv1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "cluster-secrets",
+						Namespace: "default",
+					},
+					Data: map[string][]byte{
+						"override": []byte(`"replicas": 3`),
+						"values": []byte(`"replicas": 4
+"password": "secret"`),
+						"unused": []byte(`"unused": true`),
+					},
+				},
+			},
+			expectedState: ReleaseState{
+				Name:              "chart-operator-chart",
+				Status:            helmclient.StatusDeployed,
+				ValuesChecksum:    "7880dc5b082334277ca247aacb89f34170ec1a80084048f36581f5dba0522d26",
+				ValuesMD5Checksum: "58da37393df2e858d5deb3fdf666dfab",
+				Values: map[string]interface{}{
+					"image": map[string]interface{}{
+						"registry": "quay.io",
+						"tag":      "1.1.0",
+					},
+					"password": "secret",
+					"replicas": 4,
+				},
+				Version: "0.1.2",
+			},
+		},
+		{
+			name: "case 10: values source key not found",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"chart-operator.giantswarm.io/values-sources": `[{"kind":"ConfigMap","name":"catalog-values","keys":["missing"]}]`,
+					},
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name:    "chart-operator-chart",
+					Version: "0.1.2",
+				},
+			},
+			valuesSources: []runtime.Object{
+				&apiv1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "catalog-values",
+						Namespace: "giantswarm",
+					},
+					Data: map[string]string{
+						"values": `"replicas": 2`,
+					},
+				},
+			},
+			expectedStatus: valuesNotResolvedStatus,
+		},
+		{
+			name: "case 11: values source not found",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"chart-operator.giantswarm.io/values-sources": `[{"kind":"Secret","name":"missing-secret"}]`,
+					},
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name:    "chart-operator-chart",
+					Version: "0.1.2",
+				},
+			},
+			expectedStatus: valuesNotResolvedStatus,
+		},
+		{
+			name: "case 12: values source with invalid kind",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"chart-operator.giantswarm.io/values-sources": `[{"kind":"Pod","name":"catalog-values"}]`,
+					},
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name:    "chart-operator-chart",
+					Version: "0.1.2",
+				},
+			},
+			expectedStatus: valuesNotResolvedStatus,
+		},
+		{
+			name: "case 13: config map keys deep merged in alphabetical order",
+			obj: &v1alpha1.Chart{
+				Spec: v1alpha1.ChartSpec{
+					Name: "chart-operator-chart",
+					Config: v1alpha1.ChartSpecConfig{
+						ConfigMap: v1alpha1.ChartSpecConfigConfigMap{
+							Name:      "chart-operator-values-configmap",
+							Namespace: "giantswarm",
+						},
+					},
+					Version: "0.1.2",
+				},
+			},
+			configMap: &apiv1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "chart-operator-values-configmap",
+					Namespace: "giantswarm",
+				},
+				Data: map[string]string{
+					"c-overrides": `"image":
+  "tag": "1.1.0"
+"replicas": 3`,
+					"a-defaults": `"image":
+  "registry": "quay.io"
+  "tag": "1.0.0"
+"replicas": 1`,
+					"b-cluster": `"replicas": 2`,
+				},
+			},
+			expectedState: ReleaseState{
+				Name:              "chart-operator-chart",
+				Status:            helmclient.StatusDeployed,
+				ValuesChecksum:    "89185b07a160603ab14e5b640614c8eb22325bfd0c7a529e4a1798eccc87e4a6",
+				ValuesMD5Checksum: "290dd45c249f9554fe32844eb4392b5f",
+				Values: map[string]interface{}{
+					"image": map[string]interface{}{
+						"registry": "quay.io",
+						"tag":      "1.1.0",
+					},
+					"replicas": 3,
+				},
+				Version: "0.1.2",
+			},
+		},
+		{
+			name: "case 14: values source secret outside allowed namespaces",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"chart-operator.giantswarm.io/values-sources": `[{"kind":"Secret","name":"cluster-secrets","namespace":"kube-system"}]`,
+					},
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name:    "chart-operator-chart",
+					Version: "0.1.2",
+				},
+			},
+			valuesSources: []runtime.Object{
+				&apiv1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "cluster-secrets",
+						Namespace: "kube-system",
+					},
+					Data: map[string][]byte{
+						"values": []byte(`"token": "secret"`),
+					},
+				},
+			},
+			expectedStatus: valuesNotResolvedStatus,
+		},
+		{
+			name: "case 15: values source secret in allowed namespace",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"chart-operator.giantswarm.io/values-sources": `[{"kind":"Secret","name":"cluster-secrets","namespace":"giantswarm"}]`,
+					},
+					Namespace: "default",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name:    "chart-operator-chart",
+					Version: "0.1.2",
+				},
+			},
+			valuesSources: []runtime.Object{
+				&apiv1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "cluster-secrets",
+						Namespace: "giantswarm",
+					},
+					Data: map[string][]byte{
+						"values": []byte(`"token": "secret"`),
+					},
+				},
+			},
+			expectedState: ReleaseState{
+				Name:              "chart-operator-chart",
+				Status:            helmclient.StatusDeployed,
+				ValuesChecksum:    "632df890ac256889a1e442b454b933de1d699eca8110bbbccc230f5d49ba35a4",
+				ValuesMD5Checksum: "0ca889323329f36e245380b8a85a0851",
+				Values: map[string]interface{}{
+					"token": "secret",
+				},
+				Version: "0.1.2",
+			},
+		},
 	}
 
 	for i, tc := range testCases {
@@ -317,6 +569,7 @@ func Test_DesiredState(t *testing.T) {
 			if tc.secret != nil {
 				objs = append(objs, tc.secret)
 			}
+			objs = append(objs, tc.valuesSources...)
 
 			var ctx context.Context
 			{
@@ -325,13 +578,19 @@ func Test_DesiredState(t *testing.T) {
 			}
 
 			c := Config{
-				Fs:         afero.NewMemMapFs(),
-				G8sClient:  fake.NewSimpleClientset(),
-				HelmClient: helmclienttest.New(helmclienttest.Config{}),
-				K8sClient:  k8sfake.NewSimpleClientset(objs...),
-				Logger:     microloggertest.New(),
+				DynamicClient:     newTestDynamicClient(),
+				EventRecorder:     &record.FakeRecorder{},
+				Fs:                afero.NewMemMapFs(),
+				G8sClient:         fake.NewSimpleClientset(),
+				HelmClient:        helmclienttest.New(helmclienttest.Config{}),
+				HelmStorage:       newTestHelmStorage(t, k8sfake.NewSimpleClientset()),
+				K8sClient:         k8sfake.NewSimpleClientset(objs...),
+				Logger:            microloggertest.New(),
+				ReleaseOperations: newReleaseOperations(t),
+				RESTMapper:        newTestRESTMapper(),
 
-				TillerNamespace: "giantswarm",
+				SecretNamespaces: []string{"giantswarm"},
+				TillerNamespace:  "giantswarm",
 			}
 			r, err := New(c)
 			if err != nil {
@@ -370,6 +629,213 @@ func Test_DesiredState(t *testing.T) {
 			if !cmp.Equal(releaseState, tc.expectedState) {
 				t.Fatalf("want matching ReleaseState \n %s", cmp.Diff(releaseState, tc.expectedState))
 			}
+
+			cc, err := controllercontext.FromContext(ctx)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+			if cc.Status.Release.Status != tc.expectedStatus {
+				t.Fatalf("status == %#q, want %#q", cc.Status.Release.Status, tc.expectedStatus)
+			}
+			if cc.Status.ValuesResolveFailed != (tc.expectedStatus == valuesNotResolvedStatus) {
+				t.Fatalf("values resolve failed == %t, want %t", cc.Status.ValuesResolveFailed, tc.expectedStatus == valuesNotResolvedStatus)
+			}
+		})
+	}
+}
+
+func Test_getValuesChecksum(t *testing.T) {
+	testCases := []struct {
+		name    string
+		valuesA map[string]interface{}
+		valuesB map[string]interface{}
+		equal   bool
+	}{
+		{
+			name: "case 0: equal values with different key order",
+			valuesA: map[string]interface{}{
+				"a": "1",
+				"b": "2",
+			},
+			valuesB: map[string]interface{}{
+				"b": "2",
+				"a": "1",
+			},
+			equal: true,
+		},
+		{
+			name: "case 1: float and int values in nested lists of maps",
+			valuesA: map[string]interface{}{
+				"ports": []interface{}{
+					map[string]interface{}{
+						"port": float64(8080),
+					},
+				},
+			},
+			valuesB: map[string]interface{}{
+				"ports": []interface{}{
+					map[string]interface{}{
+						"port": 8080,
+					},
+				},
+			},
+			equal: true,
+		},
+		{
+			name: "case 2: different values",
+			valuesA: map[string]interface{}{
+				"replicas": 1,
+			},
+			valuesB: map[string]interface{}{
+				"replicas": 2,
+			},
+			equal: false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			checksumA, err := getValuesChecksum(tc.valuesA)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+			checksumB, err := getValuesChecksum(tc.valuesB)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if (checksumA == checksumB) != tc.equal {
+				t.Fatalf("checksums %#q and %#q, want equal %t", checksumA, checksumB, tc.equal)
+			}
+		})
+	}
+}
+
+func Test_mergeValues(t *testing.T) {
+	testCases := []struct {
+		name               string
+		dst                map[string]interface{}
+		src                map[string]interface{}
+		expectedValues     map[string]interface{}
+		expectedOverridden []string
+	}{
+		{
+			name: "case 0: no overlapping values",
+			dst: map[string]interface{}{
+				"replicas": 1,
+			},
+			src: map[string]interface{}{
+				"provider": "aws",
+			},
+			expectedValues: map[string]interface{}{
+				"provider": "aws",
+				"replicas": 1,
+			},
+		},
+		{
+			name: "case 1: nested values deep merged",
+			dst: map[string]interface{}{
+				"image": map[string]interface{}{
+					"registry": "quay.io",
+					"tag":      "1.0.0",
+				},
+				"replicas": 1,
+			},
+			src: map[string]interface{}{
+				"image": map[string]interface{}{
+					"tag": "1.1.0",
+				},
+				"replicas": 2,
+			},
+			expectedValues: map[string]interface{}{
+				"image": map[string]interface{}{
+					"registry": "quay.io",
+					"tag":      "1.1.0",
+				},
+				"replicas": 2,
+			},
+			expectedOverridden: []string{
+				"image.tag",
+				"replicas",
+			},
+		},
+		{
+			name: "case 2: equal values not overridden",
+			dst: map[string]interface{}{
+				"replicas": 1,
+			},
+			src: map[string]interface{}{
+				"replicas": 1,
+			},
+			expectedValues: map[string]interface{}{
+				"replicas": 1,
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			overridden, err := mergeValues(tc.dst, tc.src)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if !cmp.Equal(tc.dst, tc.expectedValues) {
+				t.Fatalf("want matching values \n %s", cmp.Diff(tc.dst, tc.expectedValues))
+			}
+			if !cmp.Equal(overridden, tc.expectedOverridden) {
+				t.Fatalf("want matching overridden values \n %s", cmp.Diff(overridden, tc.expectedOverridden))
+			}
+		})
+	}
+}
+
+func Test_formatValuesProvenance(t *testing.T) {
+	manyKeys := map[string][]string{}
+	for i := 0; i < 100; i++ {
+		manyKeys[fmt.Sprintf("key%02d", i)] = []string{"configmap giantswarm/prometheus-values"}
+	}
+
+	testCases := []struct {
+		name           string
+		provenance     map[string][]string
+		expectedPrefix string
+		expectedSuffix string
+	}{
+		{
+			name: "case 0: keys sorted",
+			provenance: map[string][]string{
+				"replicas": {"configmap giantswarm/prometheus-values"},
+				"image":    {"configmap giantswarm/prometheus-values", "secret giantswarm/prometheus-secrets"},
+			},
+			expectedPrefix: "image=[configmap giantswarm/prometheus-values, secret giantswarm/prometheus-secrets] replicas=[configmap giantswarm/prometheus-values]",
+		},
+		{
+			name:           "case 1: keys beyond max length omitted",
+			provenance:     manyKeys,
+			expectedPrefix: "key00=[configmap giantswarm/prometheus-values] key01=",
+			expectedSuffix: " more",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			result := formatValuesProvenance(tc.provenance)
+			if len(result) > maxValuesProvenanceLength+len(" and 100 more") {
+				t.Fatalf("length == %d, want at most %d", len(result), maxValuesProvenanceLength)
+			}
+			if !strings.HasPrefix(result, tc.expectedPrefix) {
+				t.Fatalf("provenance == %#q, want prefix %#q", result, tc.expectedPrefix)
+			}
+			if !strings.HasSuffix(result, tc.expectedSuffix) {
+				t.Fatalf("provenance == %#q, want suffix %#q", result, tc.expectedSuffix)
+			}
 		})
 	}
 }
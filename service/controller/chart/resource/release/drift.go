@@ -0,0 +1,360 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/microerror"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+)
+
+// driftState is the result of the last drift check of a chart CR and when its
+// release was last upgraded to revert drifted objects.
+type driftState struct {
+	checked    time.Time
+	drifted    []string
+	selfHealed time.Time
+}
+
+// checkDrift compares the objects in the manifest of the deployed release
+// with the live objects in the cluster. Objects which were deleted or whose
+// fields set in the manifest were changed are added to the controller
+// context so the status resource can report them. It returns true if any
+// object drifted. The objects are compared at most once per drift check
+// interval. In between the result of the last check is used.
+func (r *Resource) checkDrift(ctx context.Context, cr v1alpha1.Chart, releaseName string) (bool, error) {
+	cc, err := controllercontext.FromContext(ctx)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	state := r.getDriftState(cr)
+	if next := state.checked.Add(r.driftCheckInterval); time.Now().Before(next) {
+		r.logger.Debugf(ctx, "release %#q was checked for drift at %s, not checking drift until %s", releaseName, state.checked.Format(time.RFC3339), next.Format(time.RFC3339))
+		cc.Status.Release.DriftedObjects = state.drifted
+		return len(state.drifted) > 0, nil
+	}
+
+	r.logger.Debugf(ctx, "checking drift of release %#q", releaseName)
+
+	rel, err := r.getDeployedRelease(key.Namespace(cr), releaseName)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	if rel == nil {
+		r.logger.Debugf(ctx, "release %#q not deployed, not checking drift", releaseName)
+		return false, nil
+	}
+
+	var drifted []string
+
+	for id, o := range parseManifest(rel.Manifest) {
+		reason, err := r.getObjectDriftReason(ctx, cr, o)
+		if err != nil {
+			return false, microerror.Mask(err)
+		}
+
+		if reason != "" {
+			drifted = append(drifted, fmt.Sprintf("%s (%s)", id, reason))
+		}
+	}
+
+	// Sort the objects so the status is the same on every reconciliation.
+	sort.Strings(drifted)
+
+	state.checked = time.Now()
+	state.drifted = drifted
+	r.setDriftState(cr, state)
+
+	driftedObjectsGauge.WithLabelValues(cr.Namespace, cr.Name).Set(float64(len(drifted)))
+
+	if len(drifted) == 0 {
+		r.logger.Debugf(ctx, "release %#q has not drifted", releaseName)
+		return false, nil
+	}
+
+	cc.Status.Release.DriftedObjects = drifted
+
+	r.eventRecorder.Eventf(&cr, corev1.EventTypeWarning, "Drifted", "release %#q drifted: %s", releaseName, strings.Join(drifted, ", "))
+	r.logger.Debugf(ctx, "release %#q drifted", releaseName)
+
+	return true, nil
+}
+
+// getObjectDriftReason returns why the live object differs from the manifest
+// object. It is empty when the live object matches.
+func (r *Resource) getObjectDriftReason(ctx context.Context, cr v1alpha1.Chart, o manifestObject) (string, error) {
+	apiVersion, _ := o.Content["apiVersion"].(string)
+
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	mapping, err := r.restMapper.RESTMapping(schema.GroupKind{Group: gv.Group, Kind: o.Kind}, gv.Version)
+	if meta.IsNoMatchError(err) {
+		return "resource type not found", nil
+	} else if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	var client dynamic.ResourceInterface = r.dynamicClient.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		namespace := o.Namespace
+		if namespace == "" {
+			namespace = key.Namespace(cr)
+		}
+
+		client = r.dynamicClient.Resource(mapping.Resource).Namespace(namespace)
+	}
+
+	live, err := client.Get(ctx, o.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "not found", nil
+	} else if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	if live.GetDeletionTimestamp() != nil {
+		return "being deleted", nil
+	}
+
+	path := driftedField(o.Content, live.Object, ignoredFields(cr, o.Kind))
+	if path != "" {
+		return fmt.Sprintf("%s changed", path), nil
+	}
+
+	return "", nil
+}
+
+// canSelfHeal returns whether the release of the chart CR may be upgraded to
+// revert drifted objects and otherwise when it may be upgraded next. Other
+// controllers changing the objects would otherwise make the release be
+// upgraded on every drift check.
+func (r *Resource) canSelfHeal(cr v1alpha1.Chart) (time.Time, bool) {
+	next := r.getDriftState(cr).selfHealed.Add(r.selfHealInterval)
+
+	return next, !time.Now().Before(next)
+}
+
+// setSelfHealed records the release of the chart CR was upgraded to revert
+// drifted objects. The last drift check is reset so the next reconciliation
+// checks whether the upgrade reverted them.
+func (r *Resource) setSelfHealed(cr v1alpha1.Chart) {
+	state := r.getDriftState(cr)
+	state.checked = time.Time{}
+	state.selfHealed = time.Now()
+	r.setDriftState(cr, state)
+}
+
+func (r *Resource) getDriftState(cr v1alpha1.Chart) driftState {
+	r.driftStatesMutex.Lock()
+	defer r.driftStatesMutex.Unlock()
+
+	return r.driftStates[driftStateKey(cr)]
+}
+
+func (r *Resource) setDriftState(cr v1alpha1.Chart, state driftState) {
+	r.driftStatesMutex.Lock()
+	defer r.driftStatesMutex.Unlock()
+
+	r.driftStates[driftStateKey(cr)] = state
+}
+
+func (r *Resource) deleteDriftState(cr v1alpha1.Chart) {
+	r.driftStatesMutex.Lock()
+	defer r.driftStatesMutex.Unlock()
+
+	delete(r.driftStates, driftStateKey(cr))
+}
+
+func driftStateKey(cr v1alpha1.Chart) string {
+	return fmt.Sprintf("%s/%s", cr.Namespace, cr.Name)
+}
+
+// ignoredFields returns the field paths of the drift ignore annotation which
+// apply to objects of the given kind. Paths prefixed by another kind are
+// dropped.
+func ignoredFields(cr v1alpha1.Chart, kind string) []string {
+	var paths []string
+	for _, path := range key.DriftIgnore(cr) {
+		if i := strings.Index(path, ":"); i >= 0 {
+			if path[:i] != kind {
+				continue
+			}
+			path = path[i+1:]
+		}
+		paths = append(paths, path)
+	}
+
+	return paths
+}
+
+// driftedField returns the path of the first field set in the manifest object
+// which differs in the live object. Fields only set in the live object e.g.
+// defaults are ignored. Only the labels and annotations of the metadata are
+// compared as the other fields are managed by the API server. The status is
+// never compared and the stringData of secrets is write only. Ignored fields
+// and the fields below them are not compared.
+func driftedField(desired, live map[string]interface{}, ignored []string) string {
+	for _, k := range sortedKeys(desired) {
+		switch k {
+		case "apiVersion", "kind", "status", "stringData":
+			continue
+		case "metadata":
+			desiredMetadata, _ := desired[k].(map[string]interface{})
+			liveMetadata, _ := live[k].(map[string]interface{})
+
+			for _, f := range []string{"annotations", "labels"} {
+				path := diffField("metadata."+f, desiredMetadata[f], liveMetadata[f], ignored)
+				if path != "" {
+					return path
+				}
+			}
+		default:
+			path := diffField(k, desired[k], live[k], ignored)
+			if path != "" {
+				return path
+			}
+		}
+	}
+
+	return ""
+}
+
+func diffField(path string, desired, live interface{}, ignored []string) string {
+	if isIgnoredField(path, ignored) {
+		return ""
+	}
+
+	switch d := desired.(type) {
+	case nil:
+		return ""
+	case map[string]interface{}:
+		// Empty maps are dropped by the API server.
+		if len(d) == 0 {
+			return ""
+		}
+
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return path
+		}
+
+		for _, k := range sortedKeys(d) {
+			p := diffField(path+"."+k, d[k], l[k], ignored)
+			if p != "" {
+				return p
+			}
+		}
+
+		return ""
+	case []interface{}:
+		l, _ := live.([]interface{})
+		if len(d) != len(l) {
+			return path
+		}
+
+		for i := range d {
+			p := diffField(fmt.Sprintf("%s[%d]", path, i), d[i], l[i], ignored)
+			if p != "" {
+				return p
+			}
+		}
+
+		return ""
+	default:
+		if !scalarEquals(d, live) {
+			return path
+		}
+
+		return ""
+	}
+}
+
+func isIgnoredField(path string, ignored []string) bool {
+	for _, i := range ignored {
+		if path == i || strings.HasPrefix(path, i+".") || strings.HasPrefix(path, i+"[") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scalarEquals compares the manifest value with the live value. Numbers
+// decoded from YAML are floats while the API server returns integers. Zero
+// values are dropped by the API server and quantities are normalized e.g.
+// 1000m becomes 1.
+func scalarEquals(desired, live interface{}) bool {
+	if live == nil {
+		switch d := desired.(type) {
+		case bool:
+			return !d
+		case float64:
+			return d == 0
+		case string:
+			return d == ""
+		}
+
+		return false
+	}
+
+	desiredNumber, desiredOK := toFloat(desired)
+	liveNumber, liveOK := toFloat(live)
+	if desiredOK && liveOK {
+		return desiredNumber == liveNumber
+	}
+
+	if fmt.Sprint(desired) == fmt.Sprint(live) {
+		return true
+	}
+
+	desiredQuantity, err := resource.ParseQuantity(fmt.Sprint(desired))
+	if err != nil {
+		return false
+	}
+	liveQuantity, err := resource.ParseQuantity(fmt.Sprint(live))
+	if err != nil {
+		return false
+	}
+
+	return desiredQuantity.Cmp(liveQuantity) == 0
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	}
+
+	return 0, false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,587 @@
+package release
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/apiextensions/v3/pkg/clientset/versioned/fake"
+	"github.com/giantswarm/helmclient/v4/pkg/helmclienttest"
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+	helmrelease "helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	helmtime "helm.sh/helm/v3/pkg/time"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
+	"github.com/giantswarm/chart-operator/v2/service/helmstorage"
+)
+
+func Test_Resource_Release_checkDrift(t *testing.T) {
+	manifest := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test-app
+  labels:
+    app: test-app
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: test-app
+        image: test-app:1.0.0
+        resources:
+          requests:
+            cpu: 0.5
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-app
+data:
+  key: value
+`
+
+	testCases := []struct {
+		name                   string
+		driftIgnore            string
+		objects                []runtime.Object
+		expectedDrifted        bool
+		expectedDriftedObjects []string
+	}{
+		{
+			name: "case 0: no drift",
+			objects: []runtime.Object{
+				newUnstructuredDeployment(2, "test-app:1.0.0"),
+				newUnstructuredConfigMap("value"),
+			},
+			expectedDrifted: false,
+		},
+		{
+			name: "case 1: deployment replicas changed",
+			objects: []runtime.Object{
+				newUnstructuredDeployment(3, "test-app:1.0.0"),
+				newUnstructuredConfigMap("value"),
+			},
+			expectedDrifted: true,
+			expectedDriftedObjects: []string{
+				"apps/v1 Deployment test-app (spec.replicas changed)",
+			},
+		},
+		{
+			name: "case 2: deployment image changed and configmap deleted",
+			objects: []runtime.Object{
+				newUnstructuredDeployment(2, "test-app:2.0.0"),
+			},
+			expectedDrifted: true,
+			expectedDriftedObjects: []string{
+				"apps/v1 Deployment test-app (spec.template.spec.containers[0].image changed)",
+				"v1 ConfigMap test-app (not found)",
+			},
+		},
+		{
+			name:        "case 3: ignored deployment replicas changed",
+			driftIgnore: "Deployment:spec.replicas",
+			objects: []runtime.Object{
+				newUnstructuredDeployment(3, "test-app:1.0.0"),
+				newUnstructuredConfigMap("value"),
+			},
+			expectedDrifted: false,
+		},
+		{
+			name:        "case 4: replicas ignored for other kind",
+			driftIgnore: "StatefulSet:spec.replicas, spec.template.spec.containers[0].resources",
+			objects: []runtime.Object{
+				newUnstructuredDeployment(3, "test-app:1.0.0"),
+				newUnstructuredConfigMap("value"),
+			},
+			expectedDrifted: true,
+			expectedDriftedObjects: []string{
+				"apps/v1 Deployment test-app (spec.replicas changed)",
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			var ctx context.Context
+			{
+				c := controllercontext.Context{}
+				ctx = controllercontext.NewContext(context.Background(), c)
+			}
+
+			k8sClient := k8sfake.NewSimpleClientset()
+
+			{
+				s := storage.Init(driver.NewSecrets(k8sClient.CoreV1().Secrets("default")))
+				rel := &helmrelease.Release{
+					Name: "test-app",
+					Info: &helmrelease.Info{
+						LastDeployed: helmtime.Time{Time: time.Now()},
+						Status:       helmrelease.StatusDeployed,
+					},
+					Manifest:  manifest,
+					Namespace: "default",
+					Version:   1,
+				}
+
+				err := s.Create(rel)
+				if err != nil {
+					t.Fatalf("error == %#v, want nil", err)
+				}
+			}
+
+			c := Config{
+				DynamicClient:     newTestDynamicClient(tc.objects...),
+				EventRecorder:     &record.FakeRecorder{},
+				Fs:                afero.NewMemMapFs(),
+				G8sClient:         fake.NewSimpleClientset(),
+				HelmClient:        helmclienttest.New(helmclienttest.Config{}),
+				HelmStorage:       newTestHelmStorage(t, k8sClient),
+				K8sClient:         k8sClient,
+				Logger:            microloggertest.New(),
+				ReleaseOperations: newReleaseOperations(t),
+				RESTMapper:        newTestRESTMapper(),
+
+				TillerNamespace: "giantswarm",
+			}
+
+			r, err := New(c)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			cr := v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-app",
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name:      "test-app",
+					Namespace: "default",
+				},
+			}
+			if tc.driftIgnore != "" {
+				cr.Annotations = map[string]string{
+					annotation.DriftIgnore: tc.driftIgnore,
+				}
+			}
+
+			drifted, err := r.checkDrift(ctx, cr, "test-app")
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if drifted != tc.expectedDrifted {
+				t.Fatalf("drifted == %t, want %t", drifted, tc.expectedDrifted)
+			}
+
+			cc, err := controllercontext.FromContext(ctx)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if !cmp.Equal(cc.Status.Release.DriftedObjects, tc.expectedDriftedObjects) {
+				t.Fatalf("want matching drifted objects \n %s", cmp.Diff(cc.Status.Release.DriftedObjects, tc.expectedDriftedObjects))
+			}
+		})
+	}
+}
+
+func Test_Resource_Release_driftedField(t *testing.T) {
+	testCases := []struct {
+		name         string
+		desired      map[string]interface{}
+		live         map[string]interface{}
+		ignored      []string
+		expectedPath string
+	}{
+		{
+			name: "case 0: defaults and server managed metadata are ignored",
+			desired: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name": "test-app",
+				},
+				"spec": map[string]interface{}{
+					"ports": []interface{}{
+						map[string]interface{}{
+							"port": float64(80),
+						},
+					},
+				},
+			},
+			live: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name":            "test-app",
+					"resourceVersion": "123",
+				},
+				"spec": map[string]interface{}{
+					"ports": []interface{}{
+						map[string]interface{}{
+							"port":     int64(80),
+							"protocol": "TCP",
+						},
+					},
+					"type": "ClusterIP",
+				},
+			},
+		},
+		{
+			name: "case 1: zero values and empty maps dropped by the API server",
+			desired: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"hostNetwork": false,
+					"resources":   map[string]interface{}{},
+				},
+			},
+			live: map[string]interface{}{
+				"spec": map[string]interface{}{},
+			},
+		},
+		{
+			name: "case 2: normalized quantities",
+			desired: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"cpu":    float64(1),
+					"memory": "1024Mi",
+				},
+			},
+			live: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"cpu":    "1000m",
+					"memory": "1Gi",
+				},
+			},
+		},
+		{
+			name: "case 3: label changed",
+			desired: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{
+						"app": "test-app",
+					},
+				},
+			},
+			live: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{
+						"app": "other-app",
+					},
+				},
+			},
+			expectedPath: "metadata.labels.app",
+		},
+		{
+			name: "case 4: list element removed",
+			desired: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"args": []interface{}{"--debug", "--verbose"},
+				},
+			},
+			live: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"args": []interface{}{"--debug"},
+				},
+			},
+			expectedPath: "spec.args",
+		},
+		{
+			name: "case 5: status and secret string data are ignored",
+			desired: map[string]interface{}{
+				"status": map[string]interface{}{
+					"phase": "Active",
+				},
+				"stringData": map[string]interface{}{
+					"password": "secret",
+				},
+			},
+			live: map[string]interface{}{
+				"data": map[string]interface{}{
+					"password": "c2VjcmV0",
+				},
+			},
+		},
+		{
+			name: "case 6: ignored fields and the fields below them",
+			desired: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"replicas": float64(2),
+					"template": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{
+								"resources": map[string]interface{}{
+									"cpu": "500m",
+								},
+							},
+						},
+					},
+				},
+			},
+			live: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"replicas": int64(5),
+					"template": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{
+								"resources": map[string]interface{}{
+									"cpu": "1",
+								},
+							},
+						},
+					},
+				},
+			},
+			ignored: []string{
+				"spec.replicas",
+				"spec.template.containers",
+			},
+		},
+		{
+			name: "case 7: ignored path is not a prefix of other fields",
+			desired: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"replicasMax": float64(2),
+				},
+			},
+			live: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"replicasMax": int64(5),
+				},
+			},
+			ignored: []string{
+				"spec.replicas",
+			},
+			expectedPath: "spec.replicasMax",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			path := driftedField(tc.desired, tc.live, tc.ignored)
+			if path != tc.expectedPath {
+				t.Fatalf("path == %#q, want %#q", path, tc.expectedPath)
+			}
+		})
+	}
+}
+
+func Test_Resource_Release_checkDrift_interval(t *testing.T) {
+	manifest := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-app
+data:
+  key: value
+`
+
+	k8sClient := k8sfake.NewSimpleClientset()
+
+	{
+		s := storage.Init(driver.NewSecrets(k8sClient.CoreV1().Secrets("default")))
+		rel := &helmrelease.Release{
+			Name: "test-app",
+			Info: &helmrelease.Info{
+				LastDeployed: helmtime.Time{Time: time.Now()},
+				Status:       helmrelease.StatusDeployed,
+			},
+			Manifest:  manifest,
+			Namespace: "default",
+			Version:   1,
+		}
+
+		err := s.Create(rel)
+		if err != nil {
+			t.Fatalf("error == %#v, want nil", err)
+		}
+	}
+
+	dynamicClient := newTestDynamicClient(newUnstructuredConfigMap("other"))
+
+	c := Config{
+		DynamicClient:     dynamicClient,
+		EventRecorder:     &record.FakeRecorder{},
+		Fs:                afero.NewMemMapFs(),
+		G8sClient:         fake.NewSimpleClientset(),
+		HelmClient:        helmclienttest.New(helmclienttest.Config{}),
+		HelmStorage:       newTestHelmStorage(t, k8sClient),
+		K8sClient:         k8sClient,
+		Logger:            microloggertest.New(),
+		ReleaseOperations: newReleaseOperations(t),
+		RESTMapper:        newTestRESTMapper(),
+
+		DriftCheckInterval: time.Hour,
+		SelfHealInterval:   time.Hour,
+		TillerNamespace:    "giantswarm",
+	}
+
+	r, err := New(c)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	cr := v1alpha1.Chart{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-app",
+			Namespace: "giantswarm",
+		},
+		Spec: v1alpha1.ChartSpec{
+			Name:      "test-app",
+			Namespace: "default",
+		},
+	}
+
+	expectedDriftedObjects := []string{
+		"v1 ConfigMap test-app (data.key changed)",
+	}
+
+	checkDrift := func() {
+		t.Helper()
+
+		ctx := controllercontext.NewContext(context.Background(), controllercontext.Context{})
+
+		drifted, err := r.checkDrift(ctx, cr, "test-app")
+		if err != nil {
+			t.Fatalf("error == %#v, want nil", err)
+		}
+		if !drifted {
+			t.Fatalf("drifted == %t, want %t", drifted, true)
+		}
+
+		cc, err := controllercontext.FromContext(ctx)
+		if err != nil {
+			t.Fatalf("error == %#v, want nil", err)
+		}
+		if !cmp.Equal(cc.Status.Release.DriftedObjects, expectedDriftedObjects) {
+			t.Fatalf("want matching drifted objects \n %s", cmp.Diff(cc.Status.Release.DriftedObjects, expectedDriftedObjects))
+		}
+	}
+
+	checkDrift()
+
+	_, ok := r.canSelfHeal(cr)
+	if !ok {
+		t.Fatalf("can self heal == %t, want %t", ok, true)
+	}
+
+	// The live object is deleted but the result of the last check is used
+	// until the drift check interval passed.
+	err = dynamicClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).Namespace("default").Delete(context.Background(), "test-app", metav1.DeleteOptions{})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	checkDrift()
+
+	// Self healing resets the last check so the next reconciliation checks
+	// whether the upgrade reverted the objects. It is not self healed again
+	// until the self heal interval passed.
+	r.setSelfHealed(cr)
+
+	_, ok = r.canSelfHeal(cr)
+	if ok {
+		t.Fatalf("can self heal == %t, want %t", ok, false)
+	}
+
+	expectedDriftedObjects = []string{
+		"v1 ConfigMap test-app (not found)",
+	}
+
+	checkDrift()
+}
+
+func newTestDynamicClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+}
+
+func newTestHelmStorage(t *testing.T, k8sClient kubernetes.Interface) *helmstorage.Storage {
+	helmStorage, err := helmstorage.New(helmstorage.Config{
+		K8sClient: k8sClient,
+	})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	return helmStorage
+}
+
+func newTestRESTMapper() meta.RESTMapper {
+	m := meta.NewDefaultRESTMapper(nil)
+	m.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	m.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	m.Add(schema.GroupVersionKind{Version: "v1", Kind: "Service"}, meta.RESTScopeNamespace)
+
+	return m
+}
+
+func newUnstructuredDeployment(replicas int64, image string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":      "test-app",
+				"namespace": "default",
+				"labels": map[string]interface{}{
+					"app":                          "test-app",
+					"app.kubernetes.io/managed-by": "Helm",
+				},
+			},
+			"spec": map[string]interface{}{
+				"replicas": replicas,
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{
+								"name":            "test-app",
+								"image":           image,
+								"imagePullPolicy": "IfNotPresent",
+								"resources": map[string]interface{}{
+									"requests": map[string]interface{}{
+										"cpu": "500m",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func newUnstructuredConfigMap(value string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]interface{}{
+				"name":      "test-app",
+				"namespace": "default",
+			},
+			"data": map[string]interface{}{
+				"key": value,
+			},
+		},
+	}
+}
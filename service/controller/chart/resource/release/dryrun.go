@@ -0,0 +1,492 @@
+package release
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/apiextensions/v3/pkg/label"
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/operatorkit/v4/pkg/controller/context/resourcecanceledcontext"
+	"github.com/google/go-cmp/cmp"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	helmrelease "helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/pkg/project"
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+	"github.com/giantswarm/chart-operator/v2/service/releaseoperation"
+)
+
+const (
+	// dryRunDiffKey is the configmap data key storing the dry run summary.
+	dryRunDiffKey = "diff"
+
+	// maxDryRunDiffSize is the maximum size of the dry run summary. It is
+	// well below the 1 MiB limit for configmaps.
+	maxDryRunDiffSize = 512 * 1024
+)
+
+// manifestObject is a single Kubernetes object of a rendered manifest.
+type manifestObject struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Content   map[string]interface{}
+}
+
+// ensureDryRun renders the dry run of the desired release unless the dry run
+// configmap was already rendered for it. The hash of the current and desired
+// release stored on the configmap is used to find out whether anything
+// changed. So the chart is only pulled and rendered again on changes.
+func (r *Resource) ensureDryRun(ctx context.Context, cr v1alpha1.Chart, currentState, desiredState interface{}) error {
+	cc, err := controllercontext.FromContext(ctx)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	currentReleaseState, err := toReleaseState(currentState)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	desiredReleaseState, err := toReleaseState(desiredState)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	if desiredReleaseState.Name == "" {
+		// no-op
+		return nil
+	}
+
+	hash, err := dryRunHash(cr, currentReleaseState, desiredReleaseState)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	r.logger.Debugf(ctx, "finding out if the dry run for release %#q has to be rendered", desiredReleaseState.Name)
+
+	cm, err := r.k8sClient.CoreV1().ConfigMaps(cr.Namespace).Get(ctx, key.DryRunConfigMapName(cr), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// fall through
+	} else if err != nil {
+		return microerror.Mask(err)
+	} else if isDryRunConfigMapOwned(cm, cr) && cm.Annotations[annotation.DryRunHash] == hash {
+		r.logger.Debugf(ctx, "the dry run for release %#q does not need to be rendered", desiredReleaseState.Name)
+		return nil
+	}
+
+	r.logger.Debugf(ctx, "the dry run for release %#q needs to be rendered", desiredReleaseState.Name)
+
+	tarballPath, unpinTarball, err := r.pullChartTarball(ctx, cr)
+	if reason, status, ok := pullFailedStatus(cr, err); ok {
+		addStatusToContext(cc, reason, status)
+		cc.Status.ChartPullFailed = true
+
+		r.logger.LogCtx(ctx, "level", "warning", "message", reason, "stack", microerror.JSON(err))
+		r.logger.Debugf(ctx, "canceling resource")
+		resourcecanceledcontext.SetCanceled(ctx)
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+	defer unpinTarball()
+
+	err = r.verifyChart(ctx, cr, tarballPath)
+	if IsSignatureInvalid(err) {
+		reason := err.Error()
+		addStatusToContext(cc, reason, signatureInvalidStatus)
+
+		r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "SignatureInvalid", reason)
+		r.logger.LogCtx(ctx, "level", "warning", "message", reason, "stack", microerror.JSON(err))
+		r.logger.Debugf(ctx, "canceling resource")
+		resourcecanceledcontext.SetCanceled(ctx)
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	operation := releaseoperation.Upgrade
+	if isEmpty(currentReleaseState) {
+		operation = releaseoperation.Install
+	}
+
+	err = r.dryRun(ctx, cr, tarballPath, desiredReleaseState, operation, hash)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// dryRun renders the chart with the desired values and compares it with the
+// manifest of the deployed release. A summary of the changes is stored in a
+// configmap next to the chart CR so it can be reviewed before the release is
+// installed or updated. The operation is the Helm operation the dry run
+// replaces. It is either install or upgrade. The hash identifies the release
+// the dry run is rendered for.
+func (r *Resource) dryRun(ctx context.Context, cr v1alpha1.Chart, tarballPath string, releaseState ReleaseState, operation, hash string) error {
+	r.logger.Debugf(ctx, "rendering dry run for release %#q", releaseState.Name)
+
+	var summary string
+
+	capabilities, err := r.getCapabilities()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	desired, err := r.renderManifest(cr, tarballPath, releaseState, capabilities, operation)
+	if err != nil {
+		// Rendering errors are caused by the chart or its values. So we
+		// include them in the summary rather than retrying.
+		r.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("rendering release %#q failed", releaseState.Name), "stack", microerror.JSON(err))
+		summary = fmt.Sprintf("rendering release %#q failed: %s\n", releaseState.Name, err.Error())
+	} else {
+		current, err := r.getDeployedManifest(key.Namespace(cr), releaseState.Name)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		summary = diffManifests(current, desired)
+	}
+
+	if len(summary) > maxDryRunDiffSize {
+		summary = truncateString(summary, maxDryRunDiffSize) + "\n... truncated\n"
+	}
+
+	err = r.ensureDryRunConfigMap(ctx, cr, summary, hash)
+	if IsNotOwned(err) {
+		// The configmap was not created by chart-operator for this chart CR
+		// so it is not overwritten.
+		r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "DryRunFailed", err.Error())
+		r.logger.LogCtx(ctx, "level", "warning", "message", err.Error())
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	r.logger.Debugf(ctx, "rendered dry run for release %#q to configmap %#q in namespace %#q", releaseState.Name, key.DryRunConfigMapName(cr), cr.Namespace)
+
+	return nil
+}
+
+func (r *Resource) ensureDryRunConfigMap(ctx context.Context, cr v1alpha1.Chart, summary, hash string) error {
+	name := key.DryRunConfigMapName(cr)
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cr.Namespace,
+			Annotations: map[string]string{
+				annotation.DryRunHash: hash,
+			},
+			Labels: map[string]string{
+				label.ManagedBy: project.Name(),
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(&cr, v1alpha1.SchemeGroupVersion.WithKind("Chart")),
+			},
+		},
+		Data: map[string]string{
+			dryRunDiffKey: summary,
+		},
+	}
+
+	current, err := r.k8sClient.CoreV1().ConfigMaps(cr.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = r.k8sClient.CoreV1().ConfigMaps(cr.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	if !isDryRunConfigMapOwned(current, cr) {
+		return microerror.Maskf(notOwnedError, "configmap %#q in namespace %#q is not managed by %#q for chart CR %#q", name, cr.Namespace, project.Name(), cr.Name)
+	}
+
+	cm.ResourceVersion = current.ResourceVersion
+
+	_, err = r.k8sClient.CoreV1().ConfigMaps(cr.Namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// dryRunHash returns the hash of the current and desired release. The dry
+// run depends on both since the desired manifest is compared with the
+// deployed one.
+func dryRunHash(cr v1alpha1.Chart, current, desired ReleaseState) (string, error) {
+	input := struct {
+		CurrentStatus         string `json:"currentStatus"`
+		CurrentValuesChecksum string `json:"currentValuesChecksum"`
+		CurrentVersion        string `json:"currentVersion"`
+		Name                  string `json:"name"`
+		Namespace             string `json:"namespace"`
+		TarballURL            string `json:"tarballURL"`
+		ValuesChecksum        string `json:"valuesChecksum"`
+		Version               string `json:"version"`
+	}{
+		CurrentStatus:         current.Status,
+		CurrentValuesChecksum: current.ValuesChecksum,
+		CurrentVersion:        current.Version,
+		Name:                  desired.Name,
+		Namespace:             key.Namespace(cr),
+		TarballURL:            key.TarballURL(cr),
+		ValuesChecksum:        desired.ValuesChecksum,
+		Version:               desired.Version,
+	}
+
+	b, err := json.Marshal(input)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+// isDryRunConfigMapOwned returns true if the dry run configmap was created by
+// chart-operator for the chart CR.
+func isDryRunConfigMapOwned(cm *corev1.ConfigMap, cr v1alpha1.Chart) bool {
+	return cm.Labels[label.ManagedBy] == project.Name() && metav1.IsControlledBy(cm, &cr)
+}
+
+// getDeployedManifest returns the manifest of the deployed release. It is
+// empty if the release has not been deployed yet.
+func (r *Resource) getDeployedManifest(namespace, releaseName string) (string, error) {
+	rel, err := r.getDeployedRelease(namespace, releaseName)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	if rel == nil {
+		return "", nil
+	}
+
+	return rel.Manifest, nil
+}
+
+// getDeployedRelease returns the deployed release from the Helm storage. It
+// is nil if the release has not been deployed yet.
+func (r *Resource) getDeployedRelease(namespace, releaseName string) (*helmrelease.Release, error) {
+	s, err := r.helmStorage.Releases(namespace)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	rel, err := s.Deployed(releaseName)
+	if errors.Is(err, driver.ErrNoDeployedReleases) || errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return rel, nil
+}
+
+// getCapabilities returns the Kubernetes version and API versions of the
+// cluster the same way Helm discovers them so templates using .Capabilities
+// render as they would when installing or upgrading the release.
+func (r *Resource) getCapabilities() (*chartutil.Capabilities, error) {
+	dc := r.k8sClient.Discovery()
+
+	kubeVersion, err := dc.ServerVersion()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	// Errors for API services which are registered but unavailable are
+	// ignored by Helm as the other API versions are still discovered.
+	apiVersions, err := action.GetVersionSet(dc)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	capabilities := &chartutil.Capabilities{
+		APIVersions: apiVersions,
+		HelmVersion: chartutil.DefaultCapabilities.HelmVersion,
+		KubeVersion: chartutil.KubeVersion{
+			Version: kubeVersion.GitVersion,
+			Major:   kubeVersion.Major,
+			Minor:   kubeVersion.Minor,
+		},
+	}
+
+	return capabilities, nil
+}
+
+// renderManifest renders the chart templates locally the same way Helm does
+// when installing or upgrading a release.
+func (r *Resource) renderManifest(cr v1alpha1.Chart, tarballPath string, releaseState ReleaseState, capabilities *chartutil.Capabilities, operation string) (string, error) {
+	f, err := r.fs.Open(tarballPath)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+	defer f.Close()
+
+	chart, err := loader.LoadArchive(f)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	options := chartutil.ReleaseOptions{
+		Name:      releaseState.Name,
+		Namespace: key.Namespace(cr),
+		IsInstall: operation == releaseoperation.Install,
+		IsUpgrade: operation == releaseoperation.Upgrade,
+	}
+
+	values, err := chartutil.ToRenderValues(chart, releaseState.Values, options, capabilities)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	files, err := engine.Render(chart, values)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	for name := range files {
+		if strings.HasSuffix(name, "NOTES.txt") {
+			delete(files, name)
+		}
+	}
+
+	_, manifests, err := releaseutil.SortManifests(files, capabilities.APIVersions, releaseutil.InstallOrder)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	var b strings.Builder
+	for _, m := range manifests {
+		fmt.Fprintf(&b, "---\n# Source: %s\n%s\n", m.Name, m.Content)
+	}
+
+	return b.String(), nil
+}
+
+// truncateString returns the longest prefix of s with at most n bytes which
+// does not split a UTF-8 encoded rune.
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
+
+// diffManifests returns a summary of the objects added, changed and removed
+// between the current and desired manifests. The contents of secrets are
+// never included.
+func diffManifests(current, desired string) string {
+	currentObjects := parseManifest(current)
+	desiredObjects := parseManifest(desired)
+
+	var ids []string
+	{
+		seen := map[string]bool{}
+		for id := range currentObjects {
+			seen[id] = true
+		}
+		for id := range desiredObjects {
+			seen[id] = true
+		}
+		for id := range seen {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+	}
+
+	var added, changed, removed, unchanged int
+	var b strings.Builder
+
+	for _, id := range ids {
+		c, inCurrent := currentObjects[id]
+		d, inDesired := desiredObjects[id]
+
+		switch {
+		case !inCurrent:
+			added++
+			fmt.Fprintf(&b, "+ %s\n", id)
+		case !inDesired:
+			removed++
+			fmt.Fprintf(&b, "- %s\n", id)
+		case reflect.DeepEqual(c.Content, d.Content):
+			unchanged++
+		default:
+			changed++
+			fmt.Fprintf(&b, "~ %s\n", id)
+			if d.Kind != "Secret" {
+				fmt.Fprintf(&b, "%s\n", cmp.Diff(c.Content, d.Content))
+			}
+		}
+	}
+
+	header := fmt.Sprintf("%d added, %d changed, %d removed, %d unchanged\n", added, changed, removed, unchanged)
+
+	return header + b.String()
+}
+
+// parseManifest splits a manifest into its objects indexed by kind, namespace
+// and name. Documents that cannot be parsed are ignored.
+func parseManifest(manifest string) map[string]manifestObject {
+	objects := map[string]manifestObject{}
+
+	for _, doc := range releaseutil.SplitManifests(manifest) {
+		var content map[string]interface{}
+
+		err := yaml.Unmarshal([]byte(doc), &content)
+		if err != nil || len(content) == 0 {
+			continue
+		}
+
+		apiVersion, _ := content["apiVersion"].(string)
+		kind, _ := content["kind"].(string)
+
+		var name, namespace string
+		if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+			name, _ = metadata["name"].(string)
+			namespace, _ = metadata["namespace"].(string)
+		}
+
+		id := fmt.Sprintf("%s %s %s", apiVersion, kind, name)
+		if namespace != "" {
+			id = fmt.Sprintf("%s %s %s/%s", apiVersion, kind, namespace, name)
+		}
+
+		objects[id] = manifestObject{
+			Kind:      kind,
+			Name:      name,
+			Namespace: namespace,
+			Content:   content,
+		}
+	}
+
+	return objects
+}
@@ -0,0 +1,562 @@
+package release
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/apiextensions/v3/pkg/label"
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/giantswarm/to"
+	"github.com/spf13/afero"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/pkg/project"
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
+	"github.com/giantswarm/chart-operator/v2/service/releaseoperation"
+)
+
+func Test_Resource_Release_diffManifests(t *testing.T) {
+	testCases := []struct {
+		name            string
+		current         string
+		desired         string
+		expectedHeader  string
+		expectedLines   []string
+		unexpectedLines []string
+	}{
+		{
+			name:    "case 0: release not deployed, all objects added",
+			current: "",
+			desired: `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-app
+  namespace: default
+data:
+  key: value
+`,
+			expectedHeader: "1 added, 0 changed, 0 removed, 0 unchanged",
+			expectedLines: []string{
+				"+ v1 ConfigMap default/test-app",
+			},
+		},
+		{
+			name: "case 1: equal manifests",
+			current: `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-app
+data:
+  key: value
+`,
+			desired: `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-app
+data:
+  key: value
+`,
+			expectedHeader: "0 added, 0 changed, 0 removed, 1 unchanged",
+		},
+		{
+			name: "case 2: object changed and removed",
+			current: `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-app
+data:
+  key: value
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: test-app
+`,
+			desired: `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-app
+data:
+  key: new-value
+`,
+			expectedHeader: "0 added, 1 changed, 1 removed, 0 unchanged",
+			expectedLines: []string{
+				"~ v1 ConfigMap test-app",
+				"- v1 Service test-app",
+				"new-value",
+			},
+		},
+		{
+			name: "case 3: secret changed, data not shown",
+			current: `---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: test-app
+data:
+  password: b2xk
+`,
+			desired: `---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: test-app
+data:
+  password: bmV3
+`,
+			expectedHeader: "0 added, 1 changed, 0 removed, 0 unchanged",
+			expectedLines: []string{
+				"~ v1 Secret test-app",
+			},
+			unexpectedLines: []string{
+				"b2xk",
+				"bmV3",
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			result := diffManifests(tc.current, tc.desired)
+
+			if !strings.HasPrefix(result, tc.expectedHeader) {
+				t.Fatalf("expected header %#q, got %#q", tc.expectedHeader, result)
+			}
+			for _, l := range tc.expectedLines {
+				if !strings.Contains(result, l) {
+					t.Fatalf("expected %#q to contain %#q", result, l)
+				}
+			}
+			for _, l := range tc.unexpectedLines {
+				if strings.Contains(result, l) {
+					t.Fatalf("expected %#q not to contain %#q", result, l)
+				}
+			}
+		})
+	}
+}
+
+func Test_Resource_Release_renderManifest(t *testing.T) {
+	tarballPath, err := chartutil.Save(&chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion: chart.APIVersionV2,
+			Name:       "test-app",
+			Version:    "1.0.0",
+		},
+		Templates: []*chart.File{
+			{
+				Name: "templates/configmap.yaml",
+				Data: []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-app
+data:
+  install: "{{ .Release.IsInstall }}"
+  upgrade: "{{ .Release.IsUpgrade }}"
+  kubeVersion: "{{ .Capabilities.KubeVersion.Version }}"
+`),
+			},
+		},
+	}, t.TempDir())
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	testCases := []struct {
+		name          string
+		operation     string
+		expectedLines []string
+	}{
+		{
+			name:      "case 0: install",
+			operation: releaseoperation.Install,
+			expectedLines: []string{
+				`install: "true"`,
+				`upgrade: "false"`,
+				`kubeVersion: "v1.20.4"`,
+			},
+		},
+		{
+			name:      "case 1: upgrade",
+			operation: releaseoperation.Upgrade,
+			expectedLines: []string{
+				`install: "false"`,
+				`upgrade: "true"`,
+				`kubeVersion: "v1.20.4"`,
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			k8sClient := k8sfake.NewSimpleClientset()
+			k8sClient.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{
+				GitVersion: "v1.20.4",
+				Major:      "1",
+				Minor:      "20",
+			}
+
+			r := &Resource{
+				fs:        afero.NewOsFs(),
+				k8sClient: k8sClient,
+			}
+
+			capabilities, err := r.getCapabilities()
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			cr := v1alpha1.Chart{
+				Spec: v1alpha1.ChartSpec{
+					Namespace: "default",
+				},
+			}
+
+			result, err := r.renderManifest(cr, tarballPath, ReleaseState{Name: "test-app"}, capabilities, tc.operation)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			for _, l := range tc.expectedLines {
+				if !strings.Contains(result, l) {
+					t.Fatalf("expected %#q to contain %#q", result, l)
+				}
+			}
+		})
+	}
+}
+
+func Test_Resource_Release_ensureDryRunConfigMap(t *testing.T) {
+	cr := v1alpha1.Chart{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-app",
+			Namespace: "giantswarm",
+			UID:       "test-app-uid",
+		},
+	}
+
+	testCases := []struct {
+		name            string
+		labels          map[string]string
+		ownerReferences []metav1.OwnerReference
+		expectedSummary string
+		expectedHash    string
+		errorMatcher    func(error) bool
+	}{
+		{
+			name: "case 0: configmap created by chart-operator is updated",
+			labels: map[string]string{
+				label.ManagedBy: project.Name(),
+			},
+			ownerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(&cr, v1alpha1.SchemeGroupVersion.WithKind("Chart")),
+			},
+			expectedSummary: "1 added, 0 changed, 0 removed, 0 unchanged",
+			expectedHash:    "test-hash",
+		},
+		{
+			name:            "case 1: configmap without managed by label is not overwritten",
+			expectedSummary: "user data",
+			errorMatcher:    IsNotOwned,
+		},
+		{
+			name: "case 2: configmap of other chart CR is not overwritten",
+			labels: map[string]string{
+				label.ManagedBy: project.Name(),
+			},
+			ownerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: v1alpha1.SchemeGroupVersion.String(),
+					Controller: to.BoolP(true),
+					Kind:       "Chart",
+					Name:       "other-app",
+					UID:        "other-app-uid",
+				},
+			},
+			expectedSummary: "user data",
+			errorMatcher:    IsNotOwned,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:          tc.labels,
+					Name:            "test-app-dry-run",
+					Namespace:       "giantswarm",
+					OwnerReferences: tc.ownerReferences,
+				},
+				Data: map[string]string{
+					dryRunDiffKey: "user data",
+				},
+			}
+
+			k8sClient := k8sfake.NewSimpleClientset(cm)
+
+			r := &Resource{
+				eventRecorder: &record.FakeRecorder{},
+				k8sClient:     k8sClient,
+				logger:        microloggertest.New(),
+			}
+
+			err := r.ensureDryRunConfigMap(context.Background(), cr, "1 added, 0 changed, 0 removed, 0 unchanged", "test-hash")
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			result, err := k8sClient.CoreV1().ConfigMaps("giantswarm").Get(context.Background(), "test-app-dry-run", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+			if result.Data[dryRunDiffKey] != tc.expectedSummary {
+				t.Fatalf("summary == %#q, want %#q", result.Data[dryRunDiffKey], tc.expectedSummary)
+			}
+			if result.Annotations[annotation.DryRunHash] != tc.expectedHash {
+				t.Fatalf("hash == %#q, want %#q", result.Annotations[annotation.DryRunHash], tc.expectedHash)
+			}
+		})
+	}
+}
+
+func Test_Resource_Release_dryRunHash(t *testing.T) {
+	cr := v1alpha1.Chart{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-app",
+			Namespace: "giantswarm",
+		},
+		Spec: v1alpha1.ChartSpec{
+			Namespace:  "default",
+			TarballURL: "https://giantswarm.github.io/app-catalog/test-app-1.0.0.tgz",
+		},
+	}
+	current := ReleaseState{
+		Name:           "test-app",
+		Status:         "deployed",
+		ValuesChecksum: "current-checksum",
+		Version:        "0.9.0",
+	}
+	desired := ReleaseState{
+		Name:           "test-app",
+		ValuesChecksum: "desired-checksum",
+		Version:        "1.0.0",
+	}
+
+	hash, err := dryRunHash(cr, current, desired)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	testCases := []struct {
+		name         string
+		cr           func(cr v1alpha1.Chart) v1alpha1.Chart
+		current      func(s ReleaseState) ReleaseState
+		desired      func(s ReleaseState) ReleaseState
+		expectedSame bool
+	}{
+		{
+			name:         "case 0: same releases have the same hash",
+			expectedSame: true,
+		},
+		{
+			name: "case 1: desired values changed",
+			desired: func(s ReleaseState) ReleaseState {
+				s.ValuesChecksum = "other-checksum"
+				return s
+			},
+		},
+		{
+			name: "case 2: desired version changed",
+			desired: func(s ReleaseState) ReleaseState {
+				s.Version = "1.0.1"
+				return s
+			},
+		},
+		{
+			name: "case 3: deployed release changed",
+			current: func(s ReleaseState) ReleaseState {
+				s.Version = "1.0.0"
+				return s
+			},
+		},
+		{
+			name: "case 4: release not deployed anymore",
+			current: func(s ReleaseState) ReleaseState {
+				return ReleaseState{}
+			},
+		},
+		{
+			name: "case 5: tarball URL changed",
+			cr: func(cr v1alpha1.Chart) v1alpha1.Chart {
+				cr.Spec.TarballURL = "https://giantswarm.github.io/app-catalog/test-app-1.0.1.tgz"
+				return cr
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			c, cs, ds := cr, current, desired
+			if tc.cr != nil {
+				c = tc.cr(c)
+			}
+			if tc.current != nil {
+				cs = tc.current(cs)
+			}
+			if tc.desired != nil {
+				ds = tc.desired(ds)
+			}
+
+			result, err := dryRunHash(c, cs, ds)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if (result == hash) != tc.expectedSame {
+				t.Fatalf("hash == %#q, want same == %t", result, tc.expectedSame)
+			}
+		})
+	}
+}
+
+func Test_Resource_Release_ensureDryRun_upToDate(t *testing.T) {
+	cr := v1alpha1.Chart{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-app",
+			Namespace: "giantswarm",
+			UID:       "test-app-uid",
+		},
+	}
+	current := &ReleaseState{
+		Name:    "test-app",
+		Status:  "deployed",
+		Version: "0.9.0",
+	}
+	desired := &ReleaseState{
+		Name:    "test-app",
+		Version: "1.0.0",
+	}
+
+	hash, err := dryRunHash(cr, *current, *desired)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				annotation.DryRunHash: hash,
+			},
+			Labels: map[string]string{
+				label.ManagedBy: project.Name(),
+			},
+			Name:      "test-app-dry-run",
+			Namespace: "giantswarm",
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(&cr, v1alpha1.SchemeGroupVersion.WithKind("Chart")),
+			},
+		},
+		Data: map[string]string{
+			dryRunDiffKey: "1 added, 0 changed, 0 removed, 0 unchanged",
+		},
+	}
+
+	k8sClient := k8sfake.NewSimpleClientset(cm)
+
+	// The resource has no tarball cache. So the test fails if the chart is
+	// pulled to render the dry run again.
+	r := &Resource{
+		eventRecorder: &record.FakeRecorder{},
+		k8sClient:     k8sClient,
+		logger:        microloggertest.New(),
+	}
+
+	ctx := controllercontext.NewContext(context.Background(), controllercontext.Context{})
+
+	err = r.ensureDryRun(ctx, cr, current, desired)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	result, err := k8sClient.CoreV1().ConfigMaps("giantswarm").Get(context.Background(), "test-app-dry-run", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	if result.Data[dryRunDiffKey] != cm.Data[dryRunDiffKey] {
+		t.Fatalf("summary == %#q, want %#q", result.Data[dryRunDiffKey], cm.Data[dryRunDiffKey])
+	}
+}
+
+func Test_Resource_Release_truncateString(t *testing.T) {
+	testCases := []struct {
+		name     string
+		s        string
+		n        int
+		expected string
+	}{
+		{
+			name:     "case 0: shorter than limit",
+			s:        "abc",
+			n:        5,
+			expected: "abc",
+		},
+		{
+			name:     "case 1: ascii",
+			s:        "abcdef",
+			n:        3,
+			expected: "abc",
+		},
+		{
+			name:     "case 2: limit within multi byte rune",
+			s:        "ab\u00e4cd",
+			n:        3,
+			expected: "ab",
+		},
+		{
+			name:     "case 3: limit after multi byte rune",
+			s:        "ab\u00e4cd",
+			n:        4,
+			expected: "ab\u00e4",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			result := truncateString(tc.s, tc.n)
+			if result != tc.expected {
+				t.Fatalf("result == %#q, want %#q", result, tc.expected)
+			}
+		})
+	}
+}
@@ -2,6 +2,15 @@ package release
 
 import "github.com/giantswarm/microerror"
 
+var chartDigestMismatchError = &microerror.Error{
+	Kind: "chartDigestMismatchError",
+}
+
+// IsChartDigestMismatch asserts chartDigestMismatchError.
+func IsChartDigestMismatch(err error) bool {
+	return microerror.Cause(err) == chartDigestMismatchError
+}
+
 var invalidConfigError = &microerror.Error{
 	Kind: "invalidConfigError",
 }
@@ -11,6 +20,33 @@ func IsInvalidConfig(err error) bool {
 	return microerror.Cause(err) == invalidConfigError
 }
 
+var invalidCredentialsSecretError = &microerror.Error{
+	Kind: "invalidCredentialsSecretError",
+}
+
+// IsInvalidCredentialsSecret asserts invalidCredentialsSecretError.
+func IsInvalidCredentialsSecret(err error) bool {
+	return microerror.Cause(err) == invalidCredentialsSecretError
+}
+
+var invalidPullSecretError = &microerror.Error{
+	Kind: "invalidPullSecretError",
+}
+
+// IsInvalidPullSecret asserts invalidPullSecretError.
+func IsInvalidPullSecret(err error) bool {
+	return microerror.Cause(err) == invalidPullSecretError
+}
+
+var invalidValuesSourceError = &microerror.Error{
+	Kind: "invalidValuesSourceError",
+}
+
+// IsInvalidValuesSource asserts invalidValuesSourceError.
+func IsInvalidValuesSource(err error) bool {
+	return microerror.Cause(err) == invalidValuesSourceError
+}
+
 var notFoundError = &microerror.Error{
 	Kind: "notFoundError",
 }
@@ -20,6 +56,60 @@ func IsNotFound(err error) bool {
 	return microerror.Cause(err) == notFoundError
 }
 
+var notOwnedError = &microerror.Error{
+	Kind: "notOwnedError",
+}
+
+// IsNotOwned asserts notOwnedError.
+func IsNotOwned(err error) bool {
+	return microerror.Cause(err) == notOwnedError
+}
+
+var pullChartFailedError = &microerror.Error{
+	Kind: "pullChartFailedError",
+}
+
+// IsPullChartFailed asserts pullChartFailedError.
+func IsPullChartFailed(err error) bool {
+	return microerror.Cause(err) == pullChartFailedError
+}
+
+var pullChartNotFoundError = &microerror.Error{
+	Kind: "pullChartNotFoundError",
+}
+
+// IsPullChartNotFound asserts pullChartNotFoundError.
+func IsPullChartNotFound(err error) bool {
+	return microerror.Cause(err) == pullChartNotFoundError
+}
+
+var pullChartTimeoutError = &microerror.Error{
+	Kind: "pullChartTimeoutError",
+}
+
+// IsPullChartTimeout asserts pullChartTimeoutError.
+func IsPullChartTimeout(err error) bool {
+	return microerror.Cause(err) == pullChartTimeoutError
+}
+
+var pullChartUnauthorizedError = &microerror.Error{
+	Kind: "pullChartUnauthorizedError",
+}
+
+// IsPullChartUnauthorized asserts pullChartUnauthorizedError.
+func IsPullChartUnauthorized(err error) bool {
+	return microerror.Cause(err) == pullChartUnauthorizedError
+}
+
+var signatureInvalidError = &microerror.Error{
+	Kind: "signatureInvalidError",
+}
+
+// IsSignatureInvalid asserts signatureInvalidError.
+func IsSignatureInvalid(err error) bool {
+	return microerror.Cause(err) == signatureInvalidError
+}
+
 var waitError = &microerror.Error{
 	Kind: "waitError",
 }
@@ -0,0 +1,232 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/microerror"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+)
+
+// checkHealth checks the Deployments, StatefulSets and DaemonSets of the
+// deployed release are ready. The unhealthy workloads are added to the
+// controller context so the status resource can report them. When they are
+// still unhealthy after the health check deadline since chart-operator started
+// upgrading the release it is rolled back to the previous deployed revision.
+// Releases in steady state are never rolled back. It returns true if the
+// release is healthy.
+func (r *Resource) checkHealth(ctx context.Context, cr v1alpha1.Chart, desiredReleaseState ReleaseState) (bool, error) {
+	releaseName := desiredReleaseState.Name
+
+	cc, err := controllercontext.FromContext(ctx)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	r.logger.Debugf(ctx, "checking health of release %#q", releaseName)
+
+	rel, err := r.getDeployedRelease(key.Namespace(cr), releaseName)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	if rel == nil {
+		r.logger.Debugf(ctx, "release %#q not deployed, not checking health", releaseName)
+		return true, nil
+	}
+
+	var unhealthy []string
+
+	for id, o := range parseManifest(rel.Manifest) {
+		switch o.Kind {
+		case "Deployment", "StatefulSet", "DaemonSet":
+		default:
+			continue
+		}
+
+		namespace := o.Namespace
+		if namespace == "" {
+			namespace = key.Namespace(cr)
+		}
+
+		reason, err := r.getWorkloadUnhealthyReason(ctx, o.Kind, namespace, o.Name)
+		if err != nil {
+			return false, microerror.Mask(err)
+		}
+
+		if reason != "" {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s (%s)", id, reason))
+		}
+	}
+
+	if len(unhealthy) == 0 {
+		r.logger.Debugf(ctx, "release %#q is healthy", releaseName)
+
+		// The upgrade became healthy so the release is in steady state.
+		err = r.removeAnnotation(ctx, &cr, annotation.HealthCheckStarted)
+		if err != nil {
+			return false, microerror.Mask(err)
+		}
+
+		return true, nil
+	}
+
+	// Sort the workloads so the status is the same on every reconciliation.
+	sort.Strings(unhealthy)
+	cc.Status.Release.UnhealthyWorkloads = unhealthy
+
+	r.logger.Debugf(ctx, "release %#q is unhealthy", releaseName)
+
+	deadline, err := key.HealthCheckDeadline(cr)
+	if key.IsInvalidHealthCheckDeadlineError(err) {
+		r.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("not rolling back release %#q", releaseName), "stack", microerror.JSON(err))
+		return false, nil
+	} else if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	if deadline == 0 || key.IsDryRun(cr) {
+		return false, nil
+	}
+
+	started, ok := key.HealthCheckStarted(cr)
+	if !ok {
+		r.logger.Debugf(ctx, "release %#q was not upgraded by chart-operator, not rolling back", releaseName)
+		return false, nil
+	}
+	// The deployed revision is older than the upgrade e.g. while it is still
+	// pending. Failed upgrades are rolled back by the update resource.
+	if rel.Info.LastDeployed.Time.Before(started) {
+		r.logger.Debugf(ctx, "release %#q was not deployed by the upgrade started at %s, not rolling back", releaseName, started.Format(time.RFC3339))
+		return false, nil
+	}
+	if time.Since(started) < deadline {
+		r.logger.Debugf(ctx, "release %#q has until %s to become healthy", releaseName, started.Add(deadline).Format(time.RFC3339))
+		return false, nil
+	}
+
+	r.logger.Debugf(ctx, "release %#q did not become healthy within %s", releaseName, deadline)
+
+	history, err := r.helmClient.GetReleaseHistory(ctx, key.Namespace(cr), releaseName)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	reason := fmt.Sprintf("workloads not ready within %s: %s", deadline, strings.Join(unhealthy, ", "))
+
+	rolledBack, err := r.rollbackUpgrade(ctx, cr, desiredReleaseState, history, rel.Version, reason)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	if rolledBack {
+		err = r.removeAnnotation(ctx, &cr, annotation.HealthCheckStarted)
+		if err != nil {
+			return false, microerror.Mask(err)
+		}
+	}
+
+	return false, nil
+}
+
+// getWorkloadUnhealthyReason returns why the workload is not ready. It is
+// empty when the workload is ready.
+func (r *Resource) getWorkloadUnhealthyReason(ctx context.Context, kind, namespace, name string) (string, error) {
+	var reason string
+	var err error
+
+	switch kind {
+	case "Deployment":
+		var d *appsv1.Deployment
+		d, err = r.k8sClient.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			reason = deploymentUnhealthyReason(d)
+		}
+	case "StatefulSet":
+		var s *appsv1.StatefulSet
+		s, err = r.k8sClient.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			reason = statefulSetUnhealthyReason(s)
+		}
+	case "DaemonSet":
+		var d *appsv1.DaemonSet
+		d, err = r.k8sClient.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			reason = daemonSetUnhealthyReason(d)
+		}
+	}
+
+	if apierrors.IsNotFound(err) {
+		return "not found", nil
+	} else if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return reason, nil
+}
+
+func deploymentUnhealthyReason(d *appsv1.Deployment) string {
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+
+	if d.Status.ObservedGeneration < d.Generation {
+		return "rollout not observed"
+	}
+	if d.Status.UpdatedReplicas < replicas {
+		return fmt.Sprintf("%d/%d updated", d.Status.UpdatedReplicas, replicas)
+	}
+	if d.Status.AvailableReplicas < replicas {
+		return fmt.Sprintf("%d/%d available", d.Status.AvailableReplicas, replicas)
+	}
+
+	return ""
+}
+
+func statefulSetUnhealthyReason(s *appsv1.StatefulSet) string {
+	replicas := int32(1)
+	if s.Spec.Replicas != nil {
+		replicas = *s.Spec.Replicas
+	}
+
+	if s.Status.ObservedGeneration < s.Generation {
+		return "rollout not observed"
+	}
+	// Pods are only updated when they are deleted with the OnDelete
+	// strategy. So we only check they are ready.
+	if s.Spec.UpdateStrategy.Type != appsv1.OnDeleteStatefulSetStrategyType && s.Status.UpdatedReplicas < replicas {
+		return fmt.Sprintf("%d/%d updated", s.Status.UpdatedReplicas, replicas)
+	}
+	if s.Status.ReadyReplicas < replicas {
+		return fmt.Sprintf("%d/%d ready", s.Status.ReadyReplicas, replicas)
+	}
+
+	return ""
+}
+
+func daemonSetUnhealthyReason(d *appsv1.DaemonSet) string {
+	desired := d.Status.DesiredNumberScheduled
+
+	if d.Status.ObservedGeneration < d.Generation {
+		return "rollout not observed"
+	}
+	if d.Status.UpdatedNumberScheduled < desired {
+		return fmt.Sprintf("%d/%d updated", d.Status.UpdatedNumberScheduled, desired)
+	}
+	if d.Status.NumberAvailable < desired {
+		return fmt.Sprintf("%d/%d available", d.Status.NumberAvailable, desired)
+	}
+
+	return ""
+}
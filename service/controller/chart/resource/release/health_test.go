@@ -0,0 +1,399 @@
+package release
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/apiextensions/v3/pkg/clientset/versioned/fake"
+	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
+	"github.com/giantswarm/helmclient/v4/pkg/helmclienttest"
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+	helmrelease "helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	helmtime "helm.sh/helm/v3/pkg/time"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
+)
+
+func Test_Resource_Release_checkHealth(t *testing.T) {
+	manifest := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test-app
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: test-app
+`
+
+	testCases := []struct {
+		name                       string
+		obj                        *v1alpha1.Chart
+		lastDeployed               time.Time
+		workloads                  []runtime.Object
+		releaseHistory             []helmclient.ReleaseHistory
+		revision                   int
+		expectedHealthy            bool
+		expectedUnhealthyWorkloads []string
+		expectedRolledBackFrom     string
+		expectedHealthCheckStarted bool
+	}{
+		{
+			name: "case 0: deployment ready",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.HealthCheckDeadline: "10m",
+						annotation.HealthCheckStarted:  time.Now().Add(-time.Minute).UTC().Format(time.RFC3339),
+					},
+					Name:      "test-app",
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name:      "test-app",
+					Namespace: "default",
+				},
+			},
+			lastDeployed: time.Now(),
+			workloads: []runtime.Object{
+				newDeployment(2, 2, 2),
+			},
+			expectedHealthy: true,
+		},
+		{
+			name: "case 1: deployment not available",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-app",
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name:      "test-app",
+					Namespace: "default",
+				},
+			},
+			lastDeployed: time.Now(),
+			workloads: []runtime.Object{
+				newDeployment(2, 2, 1),
+			},
+			expectedHealthy: false,
+			expectedUnhealthyWorkloads: []string{
+				"apps/v1 Deployment test-app (1/2 available)",
+			},
+		},
+		{
+			name: "case 2: deployment not found",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-app",
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name:      "test-app",
+					Namespace: "default",
+				},
+			},
+			lastDeployed:    time.Now(),
+			expectedHealthy: false,
+			expectedUnhealthyWorkloads: []string{
+				"apps/v1 Deployment test-app (not found)",
+			},
+		},
+		{
+			name: "case 3: deployment not available within deadline",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.HealthCheckDeadline: "10m",
+						annotation.HealthCheckStarted:  time.Now().Add(-6 * time.Minute).UTC().Format(time.RFC3339),
+					},
+					Name:      "test-app",
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name:      "test-app",
+					Namespace: "default",
+				},
+			},
+			lastDeployed: time.Now().Add(-5 * time.Minute),
+			workloads: []runtime.Object{
+				newDeployment(2, 1, 1),
+			},
+			expectedHealthy: false,
+			expectedUnhealthyWorkloads: []string{
+				"apps/v1 Deployment test-app (1/2 updated)",
+			},
+			expectedHealthCheckStarted: true,
+		},
+		{
+			name: "case 4: deployment not available after deadline, rolled back",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.HealthCheckDeadline: "10m",
+						annotation.HealthCheckStarted:  time.Now().Add(-16 * time.Minute).UTC().Format(time.RFC3339),
+					},
+					Name:      "test-app",
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name:      "test-app",
+					Namespace: "default",
+				},
+			},
+			lastDeployed: time.Now().Add(-15 * time.Minute),
+			workloads: []runtime.Object{
+				newDeployment(2, 2, 0),
+			},
+			releaseHistory: []helmclient.ReleaseHistory{
+				{
+					Revision: 1,
+					Status:   helmclient.StatusSuperseded,
+				},
+				{
+					Revision: 2,
+					Status:   helmclient.StatusDeployed,
+				},
+			},
+			revision:        2,
+			expectedHealthy: false,
+			// The status of the rolled back release replaces the
+			// unhealthy workloads.
+			expectedUnhealthyWorkloads: nil,
+			expectedRolledBackFrom:     `{"version":"1.1.0","valuesChecksum":"checksum","reason":"workloads not ready within 10m0s: apps/v1 Deployment test-app (0/2 available)"}`,
+		},
+		{
+			name: "case 5: first install not available after deadline, not rolled back",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.HealthCheckDeadline: "10m",
+					},
+					Name:      "test-app",
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name:      "test-app",
+					Namespace: "default",
+				},
+			},
+			lastDeployed: time.Now().Add(-15 * time.Minute),
+			workloads: []runtime.Object{
+				newDeployment(2, 2, 0),
+			},
+			releaseHistory: []helmclient.ReleaseHistory{
+				{
+					Revision: 1,
+					Status:   helmclient.StatusDeployed,
+				},
+			},
+			revision:        1,
+			expectedHealthy: false,
+			expectedUnhealthyWorkloads: []string{
+				"apps/v1 Deployment test-app (0/2 available)",
+			},
+		},
+		{
+			name: "case 6: steady state deployment not available, not rolled back",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.HealthCheckDeadline: "10m",
+					},
+					Name:      "test-app",
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name:      "test-app",
+					Namespace: "default",
+				},
+			},
+			lastDeployed: time.Now().Add(-14 * 24 * time.Hour),
+			workloads: []runtime.Object{
+				newDeployment(2, 2, 0),
+			},
+			releaseHistory: []helmclient.ReleaseHistory{
+				{
+					Revision: 1,
+					Status:   helmclient.StatusSuperseded,
+				},
+				{
+					Revision: 2,
+					Status:   helmclient.StatusDeployed,
+				},
+			},
+			revision:        2,
+			expectedHealthy: false,
+			expectedUnhealthyWorkloads: []string{
+				"apps/v1 Deployment test-app (0/2 available)",
+			},
+		},
+		{
+			name: "case 7: revision deployed before upgrade started, not rolled back",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.HealthCheckDeadline: "10m",
+						annotation.HealthCheckStarted:  time.Now().Add(-15 * time.Minute).UTC().Format(time.RFC3339),
+					},
+					Name:      "test-app",
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name:      "test-app",
+					Namespace: "default",
+				},
+			},
+			lastDeployed: time.Now().Add(-14 * 24 * time.Hour),
+			workloads: []runtime.Object{
+				newDeployment(2, 2, 0),
+			},
+			releaseHistory: []helmclient.ReleaseHistory{
+				{
+					Revision: 1,
+					Status:   helmclient.StatusSuperseded,
+				},
+				{
+					Revision: 2,
+					Status:   helmclient.StatusDeployed,
+				},
+			},
+			revision:        2,
+			expectedHealthy: false,
+			expectedUnhealthyWorkloads: []string{
+				"apps/v1 Deployment test-app (0/2 available)",
+			},
+			expectedHealthCheckStarted: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			var ctx context.Context
+			{
+				c := controllercontext.Context{}
+				ctx = controllercontext.NewContext(context.Background(), c)
+			}
+
+			k8sClient := k8sfake.NewSimpleClientset(tc.workloads...)
+			g8sClient := fake.NewSimpleClientset(tc.obj)
+
+			{
+				revision := tc.revision
+				if revision == 0 {
+					revision = 1
+				}
+
+				s := storage.Init(driver.NewSecrets(k8sClient.CoreV1().Secrets("default")))
+				rel := &helmrelease.Release{
+					Name: "test-app",
+					Info: &helmrelease.Info{
+						LastDeployed: helmtime.Time{Time: tc.lastDeployed},
+						Status:       helmrelease.StatusDeployed,
+					},
+					Manifest:  manifest,
+					Namespace: "default",
+					Version:   revision,
+				}
+
+				err := s.Create(rel)
+				if err != nil {
+					t.Fatalf("error == %#v, want nil", err)
+				}
+			}
+
+			c := Config{
+				DynamicClient: newTestDynamicClient(),
+				EventRecorder: &record.FakeRecorder{},
+				Fs:            afero.NewMemMapFs(),
+				G8sClient:     g8sClient,
+				HelmClient: helmclienttest.New(helmclienttest.Config{
+					DefaultReleaseHistory: tc.releaseHistory,
+				}),
+				HelmStorage:       newTestHelmStorage(t, k8sClient),
+				K8sClient:         k8sClient,
+				Logger:            microloggertest.New(),
+				ReleaseOperations: newReleaseOperations(t),
+				RESTMapper:        newTestRESTMapper(),
+
+				TillerNamespace: "giantswarm",
+			}
+
+			r, err := New(c)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			desiredState := ReleaseState{
+				Name:           "test-app",
+				ValuesChecksum: "checksum",
+				Version:        "1.1.0",
+			}
+
+			healthy, err := r.checkHealth(ctx, *tc.obj, desiredState)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if healthy != tc.expectedHealthy {
+				t.Fatalf("healthy == %t, want %t", healthy, tc.expectedHealthy)
+			}
+
+			cc, err := controllercontext.FromContext(ctx)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if !cmp.Equal(cc.Status.Release.UnhealthyWorkloads, tc.expectedUnhealthyWorkloads) {
+				t.Fatalf("want matching unhealthy workloads \n %s", cmp.Diff(cc.Status.Release.UnhealthyWorkloads, tc.expectedUnhealthyWorkloads))
+			}
+
+			cr, err := g8sClient.ApplicationV1alpha1().Charts(tc.obj.Namespace).Get(ctx, tc.obj.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			rolledBackFrom := cr.GetAnnotations()[annotation.RolledBackFrom]
+			if rolledBackFrom != tc.expectedRolledBackFrom {
+				t.Fatalf("rolled back from == %#q, want %#q", rolledBackFrom, tc.expectedRolledBackFrom)
+			}
+
+			_, healthCheckStarted := cr.GetAnnotations()[annotation.HealthCheckStarted]
+			if healthCheckStarted != tc.expectedHealthCheckStarted {
+				t.Fatalf("health check started == %t, want %t", healthCheckStarted, tc.expectedHealthCheckStarted)
+			}
+		})
+	}
+}
+
+func newDeployment(replicas, updated, available int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-app",
+			Namespace: "default",
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+		},
+		Status: appsv1.DeploymentStatus{
+			AvailableReplicas: available,
+			UpdatedReplicas:   updated,
+		},
+	}
+}
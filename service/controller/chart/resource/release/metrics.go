@@ -0,0 +1,130 @@
+package release
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/giantswarm/chart-operator/v2/service/collector"
+)
+
+const (
+	metricsSubsystem      = "helm_operation"
+	driftMetricsSubsystem = "release_drift"
+
+	// pullOperation is the operation label of chart pulls. Helm operations
+	// are labelled with their release operation type.
+	pullOperation = "pull"
+
+	outcomeAlreadyExists    = "already-exists"
+	outcomeInvalidManifest  = "invalid-manifest"
+	outcomeSuccess          = "success"
+	outcomeTimeout          = "timeout"
+	outcomeUnknown          = "unknown"
+	outcomeValidationFailed = "validation-failed"
+)
+
+var (
+	operationDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: collector.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "duration_seconds",
+			Help:      "Duration of chart pulls and Helm operations by outcome.",
+			Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+		},
+		[]string{"operation", "outcome"},
+	)
+	operationCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: collector.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "total",
+			Help:      "Number of chart pulls and Helm operations by outcome.",
+		},
+		[]string{"operation", "outcome"},
+	)
+	operationBackgroundCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: collector.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "background_total",
+			Help:      "Number of Helm operations which outlived the Kubernetes wait timeout and continued in the background.",
+		},
+		[]string{"operation"},
+	)
+	driftedObjectsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: collector.Namespace,
+			Subsystem: driftMetricsSubsystem,
+			Name:      "objects",
+			Help:      "Number of objects of the deployed release of the chart CR which were changed or deleted in the cluster.",
+		},
+		[]string{"namespace", "name"},
+	)
+	selfHealCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: collector.Namespace,
+			Subsystem: driftMetricsSubsystem,
+			Name:      "self_heal_total",
+			Help:      "Number of upgrades of the release of the chart CR to revert drifted objects.",
+		},
+		[]string{"namespace", "name"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(operationDurationHistogram)
+	prometheus.MustRegister(operationCounter)
+	prometheus.MustRegister(operationBackgroundCounter)
+	prometheus.MustRegister(driftedObjectsGauge)
+	prometheus.MustRegister(selfHealCounter)
+}
+
+// observeOperation records the duration and outcome of the chart pull or Helm
+// operation started at the given time.
+func observeOperation(operation string, start time.Time, err error) {
+	outcome := operationOutcome(err)
+
+	operationDurationHistogram.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+	operationCounter.WithLabelValues(operation, outcome).Inc()
+}
+
+// observeBackgroundOperation records a Helm operation continuing in the
+// background after the wait timeout.
+func observeBackgroundOperation(operation string) {
+	operationBackgroundCounter.WithLabelValues(operation).Inc()
+}
+
+func operationOutcome(err error) string {
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case helmclient.IsResourceAlreadyExists(err), helmclient.IsReleaseAlreadyExists(err):
+		return outcomeAlreadyExists
+	case helmclient.IsValidationFailedError(err):
+		return outcomeValidationFailed
+	case helmclient.IsInvalidManifest(err):
+		return outcomeInvalidManifest
+	case helmclient.IsPullChartTimeout(err), isTimeout(err):
+		return outcomeTimeout
+	default:
+		return outcomeUnknown
+	}
+}
+
+// isTimeout returns true for network timeouts and for Helm waiting for the
+// release resources longer than its timeout.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return strings.Contains(err.Error(), wait.ErrWaitTimeout.Error())
+}
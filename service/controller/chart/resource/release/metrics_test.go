@@ -0,0 +1,72 @@
+package release
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/microerror"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func Test_operationOutcome(t *testing.T) {
+	testCases := []struct {
+		name            string
+		err             error
+		expectedOutcome string
+	}{
+		{
+			name:            "case 0: success",
+			err:             nil,
+			expectedOutcome: outcomeSuccess,
+		},
+		{
+			name:            "case 1: resource already exists",
+			err:             errors.New("rendered manifests contain a resource that already exists"),
+			expectedOutcome: outcomeAlreadyExists,
+		},
+		{
+			name:            "case 2: validation failed",
+			err:             errors.New("error validating data: unknown field"),
+			expectedOutcome: outcomeValidationFailed,
+		},
+		{
+			name:            "case 3: invalid manifest",
+			err:             errors.New("unable to build kubernetes objects from release manifest: error"),
+			expectedOutcome: outcomeInvalidManifest,
+		},
+		{
+			name:            "case 4: helm wait timeout",
+			err:             microerror.Mask(fmt.Errorf("release failed: %w", wait.ErrWaitTimeout)),
+			expectedOutcome: outcomeTimeout,
+		},
+		{
+			name:            "case 5: network timeout",
+			err:             microerror.Mask(timeoutError{}),
+			expectedOutcome: outcomeTimeout,
+		},
+		{
+			name:            "case 6: unknown error",
+			err:             errors.New("something went wrong"),
+			expectedOutcome: outcomeUnknown,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			outcome := operationOutcome(tc.err)
+			if outcome != tc.expectedOutcome {
+				t.Fatalf("outcome == %#q, want %#q", outcome, tc.expectedOutcome)
+			}
+		})
+	}
+}
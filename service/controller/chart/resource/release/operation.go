@@ -0,0 +1,108 @@
+package release
+
+import (
+	"context"
+	"time"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
+	"github.com/giantswarm/microerror"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+	"github.com/giantswarm/chart-operator/v2/service/releaseoperation"
+)
+
+// startOperation registers the Helm operation for the release. It returns
+// false when the operation is not started because another operation is in
+// progress for the release, the concurrency limit is reached or the operator
+// is shutting down. The returned function must be called once the operation
+// finished.
+func (r *Resource) startOperation(ctx context.Context, namespace, releaseName, operationType string) (func(), bool, error) {
+	done, err := r.releaseOperations.Start(ctx, namespace, releaseName, operationType)
+	if releaseoperation.IsOperationInProgress(err) || releaseoperation.IsConcurrencyLimit(err) || releaseoperation.IsShuttingDown(err) {
+		r.logger.Debugf(ctx, "not starting %s of release %#q: %s", operationType, releaseName, err.Error())
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, microerror.Mask(err)
+	}
+
+	return done, true, nil
+}
+
+// isOperationInProgress returns true when a Helm operation for the release is
+// still running, e.g. an install or upgrade which exceeded the wait timeout.
+func (r *Resource) isOperationInProgress(ctx context.Context, namespace, releaseName string) bool {
+	op, ok := r.releaseOperations.InProgress(namespace, releaseName)
+	if ok {
+		r.logger.Debugf(ctx, "%s of release %#q is in progress since %s", op.Type, releaseName, op.Started.Format(time.RFC3339))
+	}
+
+	return ok
+}
+
+// recoverInterrupted recovers the release when its last Helm operation was
+// interrupted by an operator restart. Helm leaves these releases in a pending
+// status which blocks further operations. Pending installs are deleted so
+// they are installed again and pending upgrades and rollbacks are rolled back
+// to the previous revision. It returns true when the release was recovered
+// or still needs to be recovered.
+func (r *Resource) recoverInterrupted(ctx context.Context, cr v1alpha1.Chart, releaseName, status string) (bool, error) {
+	ns := key.Namespace(cr)
+
+	op, ok := r.releaseOperations.Interrupted(ns, releaseName)
+	if !ok {
+		return false, nil
+	}
+
+	var operationType string
+	switch status {
+	case helmclient.StatusPendingInstall, helmclient.StatusUninstalling:
+		operationType = releaseoperation.Delete
+	case helmclient.StatusPendingRollback, helmclient.StatusPendingUpgrade:
+		operationType = releaseoperation.Rollback
+	default:
+		// The operation finished before the operator stopped or the
+		// release was never created.
+		r.logger.Debugf(ctx, "release %#q is in status %#q after interrupted %s, no need to recover it", releaseName, status, op.Type)
+		r.releaseOperations.Recovered(ctx, ns, releaseName)
+		return false, nil
+	}
+
+	done, ok, err := r.startOperation(ctx, ns, releaseName, operationType)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+	if !ok {
+		return true, nil
+	}
+	defer done()
+
+	r.logger.Debugf(ctx, "recovering release %#q in %#q status after interrupted %s", releaseName, status, op.Type)
+
+	if operationType == releaseoperation.Delete {
+		start := time.Now()
+		err = r.helmClient.DeleteRelease(ctx, ns, releaseName)
+		observeOperation(releaseoperation.Delete, start, err)
+		if helmclient.IsReleaseNotFound(err) {
+			// fall through
+		} else if err != nil {
+			return false, microerror.Mask(err)
+		}
+	} else {
+		// Rollback to revision 0 restores a release to the previous revision.
+		start := time.Now()
+		err = r.helmClient.Rollback(ctx, ns, releaseName, 0, helmclient.RollbackOptions{})
+		observeOperation(releaseoperation.Rollback, start, err)
+		if err != nil {
+			return false, microerror.Mask(err)
+		}
+	}
+
+	r.releaseOperations.Recovered(ctx, ns, releaseName)
+
+	r.logger.Debugf(ctx, "recovered release %#q", releaseName)
+	r.eventRecorder.Eventf(&cr, corev1.EventTypeNormal, "Recovered", "recovered release %#q in %#q status after interrupted %s", releaseName, status, op.Type)
+
+	return true, nil
+}
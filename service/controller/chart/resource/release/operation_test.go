@@ -0,0 +1,196 @@
+package release
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
+	"github.com/giantswarm/helmclient/v4/pkg/helmclienttest"
+	"github.com/giantswarm/micrologger/microloggertest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/giantswarm/chart-operator/v2/service/releaseoperation"
+)
+
+func Test_startOperation(t *testing.T) {
+	testCases := []struct {
+		name          string
+		inProgress    []string
+		releaseName   string
+		expectedStart bool
+	}{
+		{
+			name:          "case 0: no operation in progress",
+			releaseName:   "prometheus",
+			expectedStart: true,
+		},
+		{
+			name:          "case 1: operation in progress for another release",
+			inProgress:    []string{"grafana"},
+			releaseName:   "prometheus",
+			expectedStart: true,
+		},
+		{
+			name:          "case 2: operation in progress for the release",
+			inProgress:    []string{"prometheus"},
+			releaseName:   "prometheus",
+			expectedStart: false,
+		},
+		{
+			name:          "case 3: concurrency limit reached",
+			inProgress:    []string{"grafana", "loki"},
+			releaseName:   "prometheus",
+			expectedStart: false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			releaseOperations, err := releaseoperation.New(releaseoperation.Config{
+				K8sClient: k8sfake.NewSimpleClientset(),
+				Logger:    microloggertest.New(),
+
+				MaxConcurrent: 2,
+			})
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			for _, releaseName := range tc.inProgress {
+				done, err := releaseOperations.Start(context.Background(), "monitoring", releaseName, releaseoperation.Upgrade)
+				if err != nil {
+					t.Fatalf("error == %#v, want nil", err)
+				}
+				defer done()
+			}
+
+			r := &Resource{
+				logger: microloggertest.New(),
+
+				releaseOperations: releaseOperations,
+			}
+
+			done, ok, err := r.startOperation(context.Background(), "monitoring", tc.releaseName, releaseoperation.Install)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+			if ok != tc.expectedStart {
+				t.Fatalf("started == %t, want %t", ok, tc.expectedStart)
+			}
+			if ok {
+				if !r.isOperationInProgress(context.Background(), "monitoring", tc.releaseName) {
+					t.Fatalf("operation not in progress after start")
+				}
+				done()
+			}
+		})
+	}
+}
+
+func Test_recoverInterrupted(t *testing.T) {
+	testCases := []struct {
+		name              string
+		status            string
+		expectedRecovered bool
+	}{
+		{
+			name:              "case 0: interrupted install is deleted",
+			status:            helmclient.StatusPendingInstall,
+			expectedRecovered: true,
+		},
+		{
+			name:              "case 1: interrupted upgrade is rolled back",
+			status:            helmclient.StatusPendingUpgrade,
+			expectedRecovered: true,
+		},
+		{
+			name:              "case 2: upgrade finished before the restart",
+			status:            helmclient.StatusDeployed,
+			expectedRecovered: false,
+		},
+		{
+			name:              "case 3: install never created the release",
+			status:            "",
+			expectedRecovered: false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			ctx := context.Background()
+
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "chart-operator-release-operations",
+					Namespace: "giantswarm",
+				},
+				Data: map[string]string{
+					"operations": `{"monitoring/prometheus":{"namespace":"monitoring","release":"prometheus","type":"upgrade"}}`,
+				},
+			}
+
+			releaseOperations, err := releaseoperation.New(releaseoperation.Config{
+				K8sClient: k8sfake.NewSimpleClientset(cm),
+				Logger:    microloggertest.New(),
+			})
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			err = releaseOperations.Load(ctx)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			r := &Resource{
+				eventRecorder: record.NewFakeRecorder(10),
+				helmClient:    helmclienttest.New(helmclienttest.Config{}),
+				logger:        microloggertest.New(),
+
+				releaseOperations: releaseOperations,
+			}
+
+			cr := v1alpha1.Chart{
+				Spec: v1alpha1.ChartSpec{
+					Name:      "prometheus",
+					Namespace: "monitoring",
+				},
+			}
+
+			recovered, err := r.recoverInterrupted(ctx, cr, "prometheus", tc.status)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+			if recovered != tc.expectedRecovered {
+				t.Fatalf("recovered == %t, want %t", recovered, tc.expectedRecovered)
+			}
+			if _, ok := releaseOperations.Interrupted("monitoring", "prometheus"); ok {
+				t.Fatalf("operation still interrupted")
+			}
+			if _, ok := releaseOperations.InProgress("monitoring", "prometheus"); ok {
+				t.Fatalf("operation still in progress")
+			}
+		})
+	}
+}
+
+func newReleaseOperations(t *testing.T) *releaseoperation.Manager {
+	releaseOperations, err := releaseoperation.New(releaseoperation.Config{
+		K8sClient: k8sfake.NewSimpleClientset(),
+		Logger:    microloggertest.New(),
+	})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	return releaseOperations
+}
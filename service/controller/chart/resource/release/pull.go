@@ -0,0 +1,218 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
+	"github.com/giantswarm/microerror"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/pkg/oci"
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+)
+
+// pullChartTarball returns the path of the chart tarball for the chart CR. It
+// is pulled only when it is not cached. The tarball must not be removed by the
+// caller as it is owned by the cache. It is pinned in the cache until the
+// returned function is called.
+func (r *Resource) pullChartTarball(ctx context.Context, cr v1alpha1.Chart) (string, func(), error) {
+	start := time.Now()
+
+	path, unpin, err := r.pullChart(ctx, cr)
+	observeOperation(pullOperation, start, err)
+	if err != nil {
+		return "", nil, microerror.Mask(err)
+	}
+
+	return path, unpin, nil
+}
+
+func (r *Resource) pullChart(ctx context.Context, cr v1alpha1.Chart) (string, func(), error) {
+	if key.IsOCI(cr) {
+		path, unpin, err := r.pullOCIChart(ctx, cr)
+		if err != nil {
+			return "", nil, microerror.Mask(err)
+		}
+
+		return path, unpin, nil
+	}
+
+	tarballURL := key.TarballURL(cr)
+
+	digest, err := key.ChartDigest(cr)
+	if err != nil {
+		return "", nil, microerror.Mask(err)
+	}
+
+	credentials, err := r.getChartCredentials(ctx, cr)
+	if err != nil {
+		return "", nil, microerror.Mask(err)
+	}
+
+	cacheKey := tarballURL
+	if credentials != nil {
+		cacheKey = credentialsCacheKey(cr)
+	}
+
+	if path, unpin, ok := r.tarballCache.get(cacheKey, digest); ok {
+		r.logger.Debugf(ctx, "using cached chart tarball %#q", tarballURL)
+		return path, unpin, nil
+	}
+
+	var tarballPath string
+	if credentials != nil {
+		tarballPath, err = r.pullChartTarballWithCredentials(ctx, tarballURL, credentials)
+	} else {
+		tarballPath, err = r.helmClient.PullChartTarball(ctx, tarballURL)
+	}
+	if err != nil {
+		return "", nil, microerror.Mask(err)
+	}
+
+	path, unpin, err := r.tarballCache.add(cacheKey, tarballPath, digest)
+	if err != nil {
+		return "", nil, microerror.Mask(err)
+	}
+
+	r.eventRecorder.Eventf(&cr, corev1.EventTypeNormal, "Pulled", "pulled chart %s", tarballURL)
+
+	return path, unpin, nil
+}
+
+// pullOCIChart resolves the OCI reference of the chart CR and pulls the chart
+// layer unless it is cached. The resolved manifest digest is stored in the
+// OCI digest annotation.
+func (r *Resource) pullOCIChart(ctx context.Context, cr v1alpha1.Chart) (string, func(), error) {
+	ref, err := oci.ParseReference(key.TarballURL(cr))
+	if err != nil {
+		return "", nil, microerror.Mask(err)
+	}
+
+	credentials, err := r.getOCICredentials(ctx, cr, ref.Registry)
+	if err != nil {
+		return "", nil, microerror.Mask(err)
+	}
+
+	chart, err := r.ociClient.Resolve(ctx, ref, credentials)
+	if err != nil {
+		return "", nil, microerror.Mask(err)
+	}
+
+	r.logger.Debugf(ctx, "resolved chart %#q to %#q", ref, chart.ManifestDigest)
+
+	if key.OCIDigest(cr) != chart.ManifestDigest {
+		err = r.addOCIDigestAnnotation(ctx, cr, chart.ManifestDigest)
+		if err != nil {
+			return "", nil, microerror.Mask(err)
+		}
+	}
+
+	layerDigest := strings.TrimPrefix(chart.LayerDigest, "sha256:")
+
+	digest, err := key.ChartDigest(cr)
+	if err != nil {
+		return "", nil, microerror.Mask(err)
+	}
+	if digest != "" && digest != layerDigest {
+		return "", nil, microerror.Maskf(chartDigestMismatchError, "chart %#q has digest %s, expected sha256:%s", ref, chart.LayerDigest, digest)
+	}
+
+	if path, unpin, ok := r.tarballCache.get(ref.String(), layerDigest); ok {
+		r.logger.Debugf(ctx, "using cached chart tarball %#q", ref)
+		return path, unpin, nil
+	}
+
+	tarballPath, err := r.ociClient.Pull(ctx, ref, chart, credentials)
+	if err != nil {
+		return "", nil, microerror.Mask(err)
+	}
+
+	path, unpin, err := r.tarballCache.add(ref.String(), tarballPath, layerDigest)
+	if err != nil {
+		return "", nil, microerror.Mask(err)
+	}
+
+	r.eventRecorder.Eventf(&cr, corev1.EventTypeNormal, "Pulled", "pulled chart %s", ref)
+
+	return path, unpin, nil
+}
+
+// getOCICredentials returns the credentials for the registry from the pull
+// secret of the chart CR. They are empty when no pull secret is set.
+func (r *Resource) getOCICredentials(ctx context.Context, cr v1alpha1.Chart, registry string) (oci.Credentials, error) {
+	namespace, name := key.OCIPullSecret(cr)
+	if name == "" {
+		return oci.Credentials{}, nil
+	}
+	if !r.isSecretNamespaceAllowed(cr, namespace) {
+		return oci.Credentials{}, microerror.Maskf(invalidPullSecretError, "pull secret %#q must be in namespace %#q or an allowed secret namespace, not %#q", name, cr.Namespace, namespace)
+	}
+
+	secret, err := r.k8sClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return oci.Credentials{}, microerror.Maskf(invalidPullSecretError, "pull secret %#q in namespace %#q not found", name, namespace)
+	} else if err != nil {
+		return oci.Credentials{}, microerror.Mask(err)
+	}
+
+	data, ok := secret.Data[corev1.DockerConfigJsonKey]
+	if !ok {
+		return oci.Credentials{}, microerror.Maskf(invalidPullSecretError, "pull secret %#q in namespace %#q has no key %#q", name, namespace, corev1.DockerConfigJsonKey)
+	}
+
+	credentials, err := oci.CredentialsFromDockerConfig(data, registry)
+	if oci.IsInvalidConfig(err) {
+		return oci.Credentials{}, microerror.Maskf(invalidPullSecretError, "pull secret %#q in namespace %#q is invalid", name, namespace)
+	} else if err != nil {
+		return oci.Credentials{}, microerror.Mask(err)
+	}
+
+	return credentials, nil
+}
+
+func (r *Resource) addOCIDigestAnnotation(ctx context.Context, cr v1alpha1.Chart, digest string) error {
+	// Get chart CR again to ensure the annotations are correct.
+	currentCR, err := r.g8sClient.ApplicationV1alpha1().Charts(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = r.addAnnotation(ctx, currentCR, annotation.OCIDigest, digest)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// pullFailedStatus returns the reason and status set in the CR status when
+// pulling the chart failed with an expected error.
+func pullFailedStatus(cr v1alpha1.Chart, err error) (string, string, bool) {
+	tarballURL := key.TarballURL(cr)
+
+	switch {
+	case err == nil:
+		return "", "", false
+	case IsChartDigestMismatch(err) || key.IsInvalidChartDigestError(err):
+		return err.Error(), chartDigestMismatchStatus, true
+	case helmclient.IsPullChartFailedError(err) || IsPullChartFailed(err) || oci.IsPullFailed(err):
+		return fmt.Sprintf("pulling chart %#q failed", tarballURL), releaseNotInstalledStatus, true
+	case helmclient.IsPullChartNotFound(err) || IsPullChartNotFound(err) || oci.IsNotFound(err):
+		return fmt.Sprintf("chart %#q not found", tarballURL), releaseNotInstalledStatus, true
+	case helmclient.IsPullChartTimeout(err) || IsPullChartTimeout(err):
+		return fmt.Sprintf("timeout pulling %#q", tarballURL), releaseNotInstalledStatus, true
+	case IsPullChartUnauthorized(err) || oci.IsUnauthorized(err):
+		return fmt.Sprintf("authentication for pulling chart %#q failed", tarballURL), releaseNotInstalledStatus, true
+	case IsInvalidCredentialsSecret(err) || IsInvalidPullSecret(err) || oci.IsInvalidReference(err):
+		return err.Error(), releaseNotInstalledStatus, true
+	default:
+		return "", "", false
+	}
+}
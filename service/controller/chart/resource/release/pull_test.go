@@ -0,0 +1,202 @@
+package release
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	g8sfake "github.com/giantswarm/apiextensions/v3/pkg/clientset/versioned/fake"
+	"github.com/giantswarm/helmclient/v4/pkg/helmclienttest"
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/afero"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/pkg/oci"
+)
+
+func Test_getOCICredentials(t *testing.T) {
+	auth := base64.StdEncoding.EncodeToString([]byte("robot:secret"))
+
+	testCases := []struct {
+		name                string
+		obj                 v1alpha1.Chart
+		secret              *corev1.Secret
+		expectedCredentials oci.Credentials
+		errorMatcher        func(error) bool
+	}{
+		{
+			name: "case 0: no pull secret",
+			obj: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "prometheus",
+					Namespace: "giantswarm",
+				},
+			},
+		},
+		{
+			name: "case 1: pull secret with credentials for registry",
+			obj: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.OCIPullSecret: "quay-pull-secret",
+					},
+					Name:      "prometheus",
+					Namespace: "giantswarm",
+				},
+			},
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "quay-pull-secret",
+					Namespace: "giantswarm",
+				},
+				Data: map[string][]byte{
+					corev1.DockerConfigJsonKey: []byte(fmt.Sprintf(`{"auths":{"quay.io":{"auth":%q}}}`, auth)),
+				},
+				Type: corev1.SecretTypeDockerConfigJson,
+			},
+			expectedCredentials: oci.Credentials{
+				Username: "robot",
+				Password: "secret",
+			},
+		},
+		{
+			name: "case 2: pull secret not found",
+			obj: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.OCIPullSecret: "default/quay-pull-secret",
+					},
+					Name:      "prometheus",
+					Namespace: "giantswarm",
+				},
+			},
+			errorMatcher: IsInvalidPullSecret,
+		},
+		{
+			name: "case 3: pull secret without docker config",
+			obj: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.OCIPullSecret: "quay-pull-secret",
+					},
+					Name:      "prometheus",
+					Namespace: "giantswarm",
+				},
+			},
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "quay-pull-secret",
+					Namespace: "giantswarm",
+				},
+				Data: map[string][]byte{
+					"password": []byte("secret"),
+				},
+			},
+			errorMatcher: IsInvalidPullSecret,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			k8sClient := fake.NewSimpleClientset()
+			if tc.secret != nil {
+				k8sClient = fake.NewSimpleClientset(tc.secret)
+			}
+
+			r := &Resource{
+				k8sClient: k8sClient,
+				logger:    microloggertest.New(),
+			}
+
+			result, err := r.getOCICredentials(context.Background(), tc.obj, "quay.io")
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if result != tc.expectedCredentials {
+				t.Fatalf("credentials == %#v, want %#v", result, tc.expectedCredentials)
+			}
+		})
+	}
+}
+
+func Test_pullChartTarball_pulledEvent(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	err := afero.WriteFile(fs, "/tmp/prometheus-1.0.0.tgz", []byte("chart"), 0644)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	eventRecorder := record.NewFakeRecorder(10)
+
+	c := Config{
+		DynamicClient: newTestDynamicClient(),
+		EventRecorder: eventRecorder,
+		Fs:            fs,
+		G8sClient:     g8sfake.NewSimpleClientset(),
+		HelmClient: helmclienttest.New(helmclienttest.Config{
+			PullChartTarballPath: "/tmp/prometheus-1.0.0.tgz",
+		}),
+		HelmStorage:       newTestHelmStorage(t, fake.NewSimpleClientset()),
+		K8sClient:         fake.NewSimpleClientset(),
+		Logger:            microloggertest.New(),
+		ReleaseOperations: newReleaseOperations(t),
+		RESTMapper:        newTestRESTMapper(),
+
+		TillerNamespace: "giantswarm",
+	}
+
+	r, err := New(c)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	cr := v1alpha1.Chart{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "prometheus",
+			Namespace: "giantswarm",
+		},
+		Spec: v1alpha1.ChartSpec{
+			Name:       "prometheus",
+			TarballURL: "https://giantswarm.github.io/giantswarm-catalog/prometheus-1.0.0.tgz",
+		},
+	}
+
+	// The second pull uses the cached tarball so only the first one emits
+	// an event.
+	for i := 0; i < 2; i++ {
+		_, unpin, err := r.pullChartTarball(context.Background(), cr)
+		if err != nil {
+			t.Fatalf("error == %#v, want nil", err)
+		}
+		unpin()
+	}
+
+	var events []string
+	for len(eventRecorder.Events) > 0 {
+		events = append(events, <-eventRecorder.Events)
+	}
+
+	expectedEvents := []string{
+		"Normal Pulled pulled chart https://giantswarm.github.io/giantswarm-catalog/prometheus-1.0.0.tgz",
+	}
+	if !cmp.Equal(events, expectedEvents) {
+		t.Fatalf("want matching events \n %s", cmp.Diff(events, expectedEvents))
+	}
+}
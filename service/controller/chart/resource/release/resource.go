@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
@@ -13,76 +16,186 @@ import (
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/micrologger"
 	"github.com/spf13/afero"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/pkg/oci"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+	"github.com/giantswarm/chart-operator/v2/service/helmstorage"
+	"github.com/giantswarm/chart-operator/v2/service/releaseoperation"
 )
 
 const (
 	// Name is the identifier of the resource.
 	Name = "release"
 
+	// defaultDriftCheckInterval is how often the objects of a deployed
+	// release are compared with the live objects in the cluster.
+	defaultDriftCheckInterval = 5 * time.Minute
+
+	// defaultHTTPClientTimeout is the timeout when pulling charts that are
+	// not pulled by the Helm client.
+	defaultHTTPClientTimeout = 30 * time.Second
+
 	// defaultK8sWaitTimeout is how long to wait for the Kubernetes API when
 	// installing or updating a release before moving to process the next CR.
 	defaultK8sWaitTimeout = 10 * time.Second
 
+	// defaultSelfHealInterval is the minimum time between upgrades of a
+	// release to revert drifted objects.
+	defaultSelfHealInterval = 30 * time.Minute
+
+	// defaultTarballCacheMaxSize is the maximum size in bytes of the chart
+	// tarballs kept in the cache.
+	defaultTarballCacheMaxSize = 100 * 1024 * 1024
+
+	// tarballCacheDir is the directory in the temp dir where the chart
+	// tarballs are cached.
+	tarballCacheDir = "chart-operator-tarballs"
+	// tarballCacheURLTTL is how long a cached chart tarball is used for its
+	// URL when the chart CR has no chart digest. The tarball at the URL may
+	// change so it is pulled again afterwards.
+	tarballCacheURLTTL = 10 * time.Minute
+
 	// alreadyExistsStatus is set in the CR status when it failed to create
 	// a manifest object because it exists already.
 	alreadyExistsStatus = "already-exists"
 
+	// chartDigestMismatchStatus is set in the CR status when the digest of
+	// the chart tarball does not match the chart digest annotation.
+	chartDigestMismatchStatus = "chart-digest-mismatch"
+
+	// dependencyCycleStatus is set in the CR status when the chart CRs it
+	// depends on directly or indirectly depend on it.
+	dependencyCycleStatus = "dependency-cycle"
+
+	// invalidCordonUntilStatus is set in the CR status when the cordon-until
+	// annotation cannot be parsed.
+	invalidCordonUntilStatus = "invalid-cordon-until"
+
 	// invalidManifestStatus is set in the CR status when it failed to create
 	// manifest objects with helm resources.
 	invalidManifestStatus = "invalid-manifest"
 
+	// invalidPriorityStatus is set in the CR status when the priority
+	// annotation cannot be parsed.
+	invalidPriorityStatus = "invalid-priority"
+
 	// releaseNotInstalledStatus is set in the CR status when there is no Helm
 	// Release to check.
 	releaseNotInstalledStatus = "not-installed"
 
+	// rolledBackStatus is set in the CR status when a failed upgrade was
+	// rolled back to the last deployed revision.
+	rolledBackStatus = "rolled-back"
+
+	// signatureInvalidStatus is set in the CR status when the verify policy
+	// is enforce and the chart provenance cannot be verified.
+	signatureInvalidStatus = "signature-invalid"
+
 	// unknownError when a release fails for unknown reasons.
 	unknownError = "unknown-error"
 
+	// valuesNotResolvedStatus is set in the CR status when the configmaps
+	// and secrets providing the values cannot be read.
+	valuesNotResolvedStatus = "values-not-resolved"
+
 	// validationFailedStatus is set in the CR status when it failed to pass
 	// OpenAPI validation on release manifest.
 	validationFailedStatus = "validation-failed"
+
+	// waitingForDependenciesStatus is set in the CR status while the chart
+	// CRs the release depends on are not deployed.
+	waitingForDependenciesStatus = "waiting-for-dependencies"
 )
 
 // Config represents the configuration used to create a new release resource.
 type Config struct {
 	// Dependencies.
-	Fs         afero.Fs
-	G8sClient  versioned.Interface
-	HelmClient helmclient.Interface
-	K8sClient  kubernetes.Interface
-	Logger     micrologger.Logger
+	DynamicClient dynamic.Interface
+	EventRecorder record.EventRecorder
+	Fs            afero.Fs
+	G8sClient     versioned.Interface
+	HelmClient    helmclient.Interface
+	// HelmStorage reads the release revisions stored by the Helm client.
+	HelmStorage *helmstorage.Storage
+	K8sClient   kubernetes.Interface
+	Logger      micrologger.Logger
+	// ReleaseOperations tracks the Helm operations in progress. It is shared
+	// with the operations running in the background after the resource
+	// stopped waiting for them.
+	ReleaseOperations *releaseoperation.Manager
+	// RESTMapper maps the objects of the release manifests to their
+	// resources for the drift check.
+	RESTMapper meta.RESTMapper
 
 	// Settings.
-	K8sWaitTimeout  time.Duration
-	MaxRollback     int
-	TillerNamespace string
+	DriftCheckInterval  time.Duration
+	HTTPClientTimeout   time.Duration
+	K8sWaitTimeout      time.Duration
+	MaxRollback         int
+	SecretNamespaces    []string
+	SelfHealInterval    time.Duration
+	TarballCacheMaxSize int64
+	TillerNamespace     string
+	// VerifyPolicy is the default verify policy for chart CRs whose
+	// release namespace has no policy either. It defaults to off.
+	VerifyPolicy string
 }
 
 // Resource implements the chart resource.
 type Resource struct {
 	// Dependencies.
-	fs         afero.Fs
-	g8sClient  versioned.Interface
-	helmClient helmclient.Interface
-	k8sClient  kubernetes.Interface
-	logger     micrologger.Logger
+	dynamicClient dynamic.Interface
+	eventRecorder record.EventRecorder
+	fs            afero.Fs
+	g8sClient     versioned.Interface
+	helmClient    helmclient.Interface
+	helmStorage   *helmstorage.Storage
+	k8sClient     kubernetes.Interface
+	logger        micrologger.Logger
+
+	releaseOperations *releaseoperation.Manager
+	restMapper        meta.RESTMapper
 
 	// Settings.
-	k8sWaitTimeout  time.Duration
-	maxRollback     int
-	tillerNamespace string
+	driftCheckInterval time.Duration
+	httpClientTimeout  time.Duration
+	k8sWaitTimeout     time.Duration
+	maxRollback        int
+	secretNamespaces   []string
+	selfHealInterval   time.Duration
+	tillerNamespace    string
+	verifyPolicy       string
+
+	// chartInformer caches the chart CRs for checking the dependencies.
+	chartInformer     cache.SharedIndexInformer
+	chartInformerOnce sync.Once
+	// driftStates stores the last drift check and self heal per chart CR.
+	driftStates      map[string]driftState
+	driftStatesMutex sync.Mutex
+	ociClient        *oci.Client
+	tarballCache     *tarballCache
 }
 
 // New creates a new configured chart resource.
 func New(config Config) (*Resource, error) {
 	// Dependencies.
+	if config.DynamicClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.DynamicClient must not be empty", config)
+	}
+	if config.EventRecorder == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.EventRecorder must not be empty", config)
+	}
 	if config.Fs == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.Fs must not be empty", config)
 	}
@@ -92,33 +205,106 @@ func New(config Config) (*Resource, error) {
 	if config.HelmClient == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.HelmClient must not be empty", config)
 	}
+	if config.HelmStorage == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.HelmStorage must not be empty", config)
+	}
 	if config.K8sClient == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.K8sClient must not be empty", config)
 	}
 	if config.Logger == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
 	}
+	if config.ReleaseOperations == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.ReleaseOperations must not be empty", config)
+	}
+	if config.RESTMapper == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.RESTMapper must not be empty", config)
+	}
 
 	// Settings.
+	if config.DriftCheckInterval == 0 {
+		config.DriftCheckInterval = defaultDriftCheckInterval
+	}
+	if config.HTTPClientTimeout == 0 {
+		config.HTTPClientTimeout = defaultHTTPClientTimeout
+	}
 	if config.K8sWaitTimeout == 0 {
 		config.K8sWaitTimeout = defaultK8sWaitTimeout
 	}
+	if config.SelfHealInterval == 0 {
+		config.SelfHealInterval = defaultSelfHealInterval
+	}
+	if config.TarballCacheMaxSize == 0 {
+		config.TarballCacheMaxSize = defaultTarballCacheMaxSize
+	}
 	if config.TillerNamespace == "" {
 		return nil, microerror.Maskf(invalidConfigError, "%T.TillerNamespace must not be empty", config)
 	}
+	if config.VerifyPolicy == "" {
+		config.VerifyPolicy = VerifyPolicyOff
+	}
+	if !isValidVerifyPolicy(config.VerifyPolicy) {
+		return nil, microerror.Maskf(invalidConfigError, "%T.VerifyPolicy must be one of %#q, %#q or %#q", config, VerifyPolicyEnforce, VerifyPolicyWarn, VerifyPolicyOff)
+	}
+
+	ociClient, err := oci.New(oci.Config{
+		Fs: config.Fs,
+
+		HTTPClientTimeout: config.HTTPClientTimeout,
+	})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	tarballCache, err := newTarballCache(config.Fs, filepath.Join(os.TempDir(), tarballCacheDir), config.TarballCacheMaxSize, tarballCacheURLTTL)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	chartInformer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return config.G8sClient.ApplicationV1alpha1().Charts(metav1.NamespaceAll).List(context.Background(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return config.G8sClient.ApplicationV1alpha1().Charts(metav1.NamespaceAll).Watch(context.Background(), options)
+			},
+		},
+		&v1alpha1.Chart{},
+		0,
+		cache.Indexers{
+			cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+		},
+	)
 
 	r := &Resource{
 		// Dependencies.
-		fs:         config.Fs,
-		g8sClient:  config.G8sClient,
-		helmClient: config.HelmClient,
-		k8sClient:  config.K8sClient,
-		logger:     config.Logger,
+		dynamicClient: config.DynamicClient,
+		eventRecorder: config.EventRecorder,
+		fs:            config.Fs,
+		g8sClient:     config.G8sClient,
+		helmClient:    config.HelmClient,
+		helmStorage:   config.HelmStorage,
+		k8sClient:     config.K8sClient,
+		logger:        config.Logger,
+
+		releaseOperations: config.ReleaseOperations,
+		restMapper:        config.RESTMapper,
 
 		// Settings.
-		k8sWaitTimeout:  config.K8sWaitTimeout,
-		maxRollback:     config.MaxRollback,
-		tillerNamespace: config.TillerNamespace,
+		driftCheckInterval: config.DriftCheckInterval,
+		httpClientTimeout:  config.HTTPClientTimeout,
+		k8sWaitTimeout:     config.K8sWaitTimeout,
+		maxRollback:        config.MaxRollback,
+		secretNamespaces:   config.SecretNamespaces,
+		selfHealInterval:   config.SelfHealInterval,
+		tillerNamespace:    config.TillerNamespace,
+		verifyPolicy:       config.VerifyPolicy,
+
+		chartInformer: chartInformer,
+		driftStates:   map[string]driftState{},
+		ociClient:     ociClient,
+		tarballCache:  tarballCache,
 	}
 
 	return r, nil
@@ -198,6 +384,31 @@ func (r *Resource) removeAnnotation(ctx context.Context, cr *v1alpha1.Chart, key
 	return nil
 }
 
+// uncordon removes the cordon annotations from the chart CR once the
+// cordon-until date has passed so the release is reconciled again.
+func (r *Resource) uncordon(ctx context.Context, cr v1alpha1.Chart) error {
+	r.logger.Debugf(ctx, "removing cordon annotations from chart CR %#q in namespace %#q", cr.Name, cr.Namespace)
+
+	// Get chart CR again to ensure the annotations are correct.
+	currentCR, err := r.g8sClient.ApplicationV1alpha1().Charts(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = r.removeAnnotation(ctx, currentCR, annotation.CordonReason)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	err = r.removeAnnotation(ctx, currentCR, annotation.CordonUntilDate)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	r.logger.Debugf(ctx, "removed cordon annotations from chart CR %#q in namespace %#q", cr.Name, cr.Namespace)
+
+	return nil
+}
+
 // addHashAnnotation updates the chart CR annotations if they have changed.
 // A patch operation is used because app-operator also sets annotations for
 // chart CRs.
@@ -211,10 +422,10 @@ func (r *Resource) addHashAnnotation(ctx context.Context, cr v1alpha1.Chart, rel
 		return microerror.Mask(err)
 	}
 
-	currentChecksum := key.ValuesMD5ChecksumAnnotation(*currentCR)
+	currentChecksum := key.ValuesChecksumAnnotation(*currentCR)
 
-	if releaseState.ValuesMD5Checksum != currentChecksum {
-		err := r.addAnnotation(ctx, currentCR, annotation.ValuesMD5Checksum, releaseState.ValuesMD5Checksum)
+	if releaseState.ValuesChecksum != currentChecksum {
+		err := r.addAnnotation(ctx, currentCR, annotation.ValuesChecksum, releaseState.ValuesChecksum)
 		if err != nil {
 			return microerror.Mask(err)
 		}
@@ -225,6 +436,13 @@ func (r *Resource) addHashAnnotation(ctx context.Context, cr v1alpha1.Chart, rel
 		r.logger.Debugf(ctx, "no need to patch annotations for chart CR %#q in namespace %#q", cr.Name, cr.Namespace)
 	}
 
+	// The MD5 checksum annotation is replaced by the SHA-256 checksum
+	// annotation.
+	err = r.removeAnnotation(ctx, currentCR, annotation.ValuesMD5Checksum)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
 	return nil
 }
 
@@ -247,6 +465,9 @@ func equals(a, b ReleaseState) bool {
 	if a.Status != b.Status {
 		return false
 	}
+	if a.ValuesChecksum != b.ValuesChecksum {
+		return false
+	}
 	if a.ValuesMD5Checksum != b.ValuesMD5Checksum {
 		return false
 	}
@@ -269,7 +490,7 @@ func isReleaseModified(a, b ReleaseState) bool {
 	result := false
 
 	if !isEmpty(a) {
-		if a.ValuesMD5Checksum != b.ValuesMD5Checksum {
+		if isValuesModified(a, b) {
 			result = true
 		}
 
@@ -285,6 +506,24 @@ func isReleaseModified(a, b ReleaseState) bool {
 	return result
 }
 
+// isValuesModified compares the values checksums of the current and desired
+// release states. Chart CRs last reconciled by older chart-operator versions
+// only have the MD5 checksum annotation. For these the MD5 checksums are
+// compared so releases are not upgraded only because the checksum changed.
+func isValuesModified(current, desired ReleaseState) bool {
+	if current.ValuesChecksum == "" && current.ValuesMD5Checksum != "" {
+		return current.ValuesMD5Checksum != desired.ValuesMD5Checksum
+	}
+
+	return current.ValuesChecksum != desired.ValuesChecksum
+}
+
+// isValuesChecksumMigrated checks if the chart CR has the SHA-256 values
+// checksum annotation and not only the legacy MD5 one.
+func isValuesChecksumMigrated(current ReleaseState) bool {
+	return current.ValuesChecksum != "" || current.ValuesMD5Checksum == ""
+}
+
 func replaceToEscape(from string) string {
 	return strings.Replace(from, "/", "~1", -1)
 }
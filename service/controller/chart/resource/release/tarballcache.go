@@ -0,0 +1,236 @@
+package release
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/spf13/afero"
+)
+
+// tarballCache stores pulled chart tarballs by the SHA-256 digest of their
+// content so the same chart is not downloaded again for other chart CRs or
+// retries. The least recently used tarballs are removed once the total size
+// exceeds the maximum size. Tarballs are pinned while they are used so they
+// are not removed meanwhile.
+type tarballCache struct {
+	dir     string
+	fs      afero.Fs
+	maxSize int64
+	// urlTTL is how long a tarball is returned for its URL when no digest
+	// is expected. Tarballs may be replaced at the same URL so they are
+	// pulled again afterwards.
+	urlTTL time.Duration
+
+	// digests are the digests of the cached tarballs by URL.
+	digests map[string]tarballCacheURL
+	// entries are the elements of lru by digest.
+	entries map[string]*list.Element
+	lru     *list.List
+	mutex   sync.Mutex
+	size    int64
+}
+
+type tarballCacheEntry struct {
+	digest string
+	// pins is the number of users of the tarball.
+	pins int
+	size int64
+}
+
+type tarballCacheURL struct {
+	digest  string
+	expires time.Time
+}
+
+func newTarballCache(fs afero.Fs, dir string, maxSize int64, urlTTL time.Duration) (*tarballCache, error) {
+	// Tarballs left by a previous run are not in the index so they are
+	// removed.
+	err := fs.RemoveAll(dir)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	err = fs.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	c := &tarballCache{
+		dir:     dir,
+		fs:      fs,
+		maxSize: maxSize,
+		urlTTL:  urlTTL,
+
+		digests: map[string]tarballCacheURL{},
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+
+	return c, nil
+}
+
+// get returns the path of the cached tarball with the digest. When the digest
+// is empty the tarball last pulled from the URL is returned until the URL TTL
+// is over. Tarballs whose content no longer matches their digest are removed.
+// The tarball is pinned until the returned function is called.
+func (c *tarballCache) get(url, digest string) (string, func(), bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if digest == "" {
+		u, ok := c.digests[url]
+		if !ok || time.Now().After(u.expires) {
+			return "", nil, false
+		}
+		digest = u.digest
+	}
+	e, ok := c.entries[digest]
+	if !ok {
+		return "", nil, false
+	}
+
+	path := c.path(digest)
+
+	actual, _, err := fileDigest(c.fs, path)
+	if err != nil || actual != digest {
+		// Pinned tarballs are replaced once they are pulled again.
+		if e.Value.(*tarballCacheEntry).pins == 0 {
+			c.remove(e)
+		}
+		return "", nil, false
+	}
+
+	if _, ok := c.digests[url]; !ok {
+		c.digests[url] = tarballCacheURL{digest: digest, expires: time.Now().Add(c.urlTTL)}
+	}
+	c.lru.MoveToFront(e)
+
+	return path, c.pin(e), true
+}
+
+// add moves the pulled tarball into the cache and returns its new path. If the
+// expected digest is set and does not match the tarball is removed and an
+// error is returned. The tarball is pinned until the returned function is
+// called.
+func (c *tarballCache) add(url, tarballPath, expectedDigest string) (string, func(), error) {
+	digest, size, err := fileDigest(c.fs, tarballPath)
+	if err != nil {
+		return "", nil, microerror.Mask(err)
+	}
+
+	if expectedDigest != "" && digest != expectedDigest {
+		_ = c.fs.Remove(tarballPath)
+		return "", nil, microerror.Maskf(chartDigestMismatchError, "chart %#q has digest sha256:%s, expected sha256:%s", url, digest, expectedDigest)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	path := c.path(digest)
+	c.digests[url] = tarballCacheURL{digest: digest, expires: time.Now().Add(c.urlTTL)}
+
+	// The cached tarball is replaced in case it was changed. Its users keep
+	// reading the file they opened.
+	err = c.fs.Rename(tarballPath, path)
+	if err != nil {
+		return "", nil, microerror.Mask(err)
+	}
+
+	if e, ok := c.entries[digest]; ok {
+		c.lru.MoveToFront(e)
+		return path, c.pin(e), nil
+	}
+
+	e := c.lru.PushFront(&tarballCacheEntry{
+		digest: digest,
+		size:   size,
+	})
+	c.entries[digest] = e
+	c.size += size
+
+	unpin := c.pin(e)
+
+	// Pinned tarballs are kept even if the cache exceeds the maximum size.
+	// This includes the tarball just added as it is about to be used.
+	for o := c.lru.Back(); o != nil && c.size > c.maxSize; {
+		prev := o.Prev()
+		if o.Value.(*tarballCacheEntry).pins == 0 {
+			c.remove(o)
+		}
+		o = prev
+	}
+
+	return path, unpin, nil
+}
+
+// pinPath keeps the cached tarball at the path until the returned function is
+// called. It is used by operations which keep running in the background. The
+// returned function does nothing when the tarball is not cached.
+func (c *tarballCache) pinPath(path string) func() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	digest := strings.TrimSuffix(filepath.Base(path), ".tgz")
+	e, ok := c.entries[digest]
+	if !ok {
+		return func() {}
+	}
+
+	return c.pin(e)
+}
+
+// pin must be called with the mutex locked.
+func (c *tarballCache) pin(e *list.Element) func() {
+	entry := e.Value.(*tarballCacheEntry)
+	entry.pins++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mutex.Lock()
+			entry.pins--
+			c.mutex.Unlock()
+		})
+	}
+}
+
+func (c *tarballCache) path(digest string) string {
+	return filepath.Join(c.dir, digest+".tgz")
+}
+
+func (c *tarballCache) remove(e *list.Element) {
+	entry := e.Value.(*tarballCacheEntry)
+
+	_ = c.fs.Remove(c.path(entry.digest))
+
+	c.lru.Remove(e)
+	delete(c.entries, entry.digest)
+	for url, u := range c.digests {
+		if u.digest == entry.digest {
+			delete(c.digests, url)
+		}
+	}
+	c.size -= entry.size
+}
+
+func fileDigest(fs afero.Fs, path string) (string, int64, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return "", 0, microerror.Mask(err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, microerror.Mask(err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
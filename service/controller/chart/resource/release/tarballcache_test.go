@@ -0,0 +1,187 @@
+package release
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func Test_tarballCache(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	c, err := newTarballCache(fs, "/cache", 10, time.Hour)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	writeTarball := func(path, content string) {
+		err := afero.WriteFile(fs, path, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("error == %#v, want nil", err)
+		}
+	}
+
+	// Tarballs are cached by URL and by digest.
+	writeTarball("/tmp/a", "aaaaaa")
+	pathA, unpin, err := c.add("https://example.com/a-1.0.0.tgz", "/tmp/a", "")
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	unpin()
+	if path, unpin, ok := c.get("https://example.com/a-1.0.0.tgz", ""); !ok || path != pathA {
+		t.Fatalf("get == %#q, %t, want %#q, true", path, ok, pathA)
+	} else {
+		unpin()
+	}
+	if path, unpin, ok := c.get("https://mirror.example.com/a-1.0.0.tgz", testDigest("aaaaaa")); !ok || path != pathA {
+		t.Fatalf("get == %#q, %t, want %#q, true", path, ok, pathA)
+	} else {
+		unpin()
+	}
+	if _, _, ok := c.get("https://example.com/b-1.0.0.tgz", ""); ok {
+		t.Fatalf("get == true, want false")
+	}
+
+	// Tarballs not matching the expected digest are rejected.
+	writeTarball("/tmp/b", "bbbb")
+	_, _, err = c.add("https://example.com/b-1.0.0.tgz", "/tmp/b", testDigest("tampered"))
+	if !IsChartDigestMismatch(err) {
+		t.Fatalf("error == %#v, want chartDigestMismatchError", err)
+	}
+	if ok, _ := afero.Exists(fs, "/tmp/b"); ok {
+		t.Fatalf("rejected tarball was not removed")
+	}
+
+	// The least recently used tarball is evicted when the cache is full.
+	writeTarball("/tmp/b", "bbbb")
+	_, unpin, err = c.add("https://example.com/b-1.0.0.tgz", "/tmp/b", testDigest("bbbb"))
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	unpin()
+	if _, unpin, ok := c.get("https://example.com/a-1.0.0.tgz", ""); ok {
+		unpin()
+	}
+
+	writeTarball("/tmp/c", "cccc")
+	_, unpin, err = c.add("https://example.com/c-1.0.0.tgz", "/tmp/c", "")
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	unpin()
+	if _, _, ok := c.get("https://example.com/b-1.0.0.tgz", ""); ok {
+		t.Fatalf("least recently used tarball was not evicted")
+	}
+	if _, unpin, ok := c.get("https://example.com/a-1.0.0.tgz", ""); !ok {
+		t.Fatalf("recently used tarball was evicted")
+	} else {
+		unpin()
+	}
+	if c.size != 10 {
+		t.Fatalf("size == %d, want %d", c.size, 10)
+	}
+
+	// Tampered tarballs in the cache are removed.
+	writeTarball(pathA, "tampered")
+	if _, _, ok := c.get("https://example.com/a-1.0.0.tgz", ""); ok {
+		t.Fatalf("get == true, want false for tampered tarball")
+	}
+	if ok, _ := afero.Exists(fs, pathA); ok {
+		t.Fatalf("tampered tarball was not removed")
+	}
+}
+
+func Test_tarballCache_pinned(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	c, err := newTarballCache(fs, "/cache", 4, time.Hour)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	err = afero.WriteFile(fs, "/tmp/a", []byte("aaaa"), 0600)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	pathA, unpinA, err := c.add("https://example.com/a-1.0.0.tgz", "/tmp/a", "")
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	// The background operation keeps the tarball pinned after the
+	// reconciliation released it.
+	unpinOperation := c.pinPath(pathA)
+	unpinA()
+
+	err = afero.WriteFile(fs, "/tmp/b", []byte("bbbb"), 0600)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	_, unpinB, err := c.add("https://example.com/b-1.0.0.tgz", "/tmp/b", "")
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	unpinB()
+
+	if ok, _ := afero.Exists(fs, pathA); !ok {
+		t.Fatalf("pinned tarball was evicted")
+	}
+
+	unpinOperation()
+
+	err = afero.WriteFile(fs, "/tmp/c", []byte("cccc"), 0600)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	_, unpinC, err := c.add("https://example.com/c-1.0.0.tgz", "/tmp/c", "")
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	unpinC()
+
+	if ok, _ := afero.Exists(fs, pathA); ok {
+		t.Fatalf("unpinned tarball was not evicted")
+	}
+	if c.size != 4 {
+		t.Fatalf("size == %d, want %d", c.size, 4)
+	}
+}
+
+func Test_tarballCache_urlTTL(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	c, err := newTarballCache(fs, "/cache", 10, time.Millisecond)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	err = afero.WriteFile(fs, "/tmp/a", []byte("aaaa"), 0600)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	_, unpin, err := c.add("https://example.com/a-1.0.0.tgz", "/tmp/a", "")
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	unpin()
+
+	time.Sleep(2 * time.Millisecond)
+
+	// The tarball may have changed at the URL so it is pulled again.
+	if _, _, ok := c.get("https://example.com/a-1.0.0.tgz", ""); ok {
+		t.Fatalf("get == true, want false after URL TTL")
+	}
+	// It is still used for its digest.
+	if _, unpin, ok := c.get("https://example.com/a-1.0.0.tgz", testDigest("aaaa")); !ok {
+		t.Fatalf("get == false, want true for digest")
+	} else {
+		unpin()
+	}
+}
+
+func testDigest(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
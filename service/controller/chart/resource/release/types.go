@@ -14,9 +14,13 @@ type ReleaseState struct {
 	// Status is the status of the Helm release when the chart is deployed.
 	// e.g. DEPLOYED
 	Status string
-	// ValuesMD5Checksum is the MD5 checksum of the values YAML. It is used for
-	// comparison since it is more reliable than using the values returned by
-	// helmclient.GetReleaseContent.
+	// ValuesChecksum is the SHA-256 checksum of the values encoded as JSON
+	// with sorted keys. It is used for comparison since it is more reliable
+	// than using the values returned by helmclient.GetReleaseContent.
+	ValuesChecksum string
+	// ValuesMD5Checksum is the legacy MD5 checksum of the values. It is only
+	// used to migrate chart CRs that do not have the ValuesChecksum
+	// annotation yet without upgrading their releases.
 	ValuesMD5Checksum string
 	// Values are any values that have been set when the Helm Chart was
 	// installed.
@@ -25,3 +29,13 @@ type ReleaseState struct {
 	// e.g. 0.1.2
 	Version string
 }
+
+// valuesLayer is a set of values from a single source. Layers are merged in
+// order to provide a single set of values to Helm.
+type valuesLayer struct {
+	// Source describes where the values come from.
+	// e.g. configmap giantswarm/chart-operator-values
+	Source string
+	// Values are the values parsed from the source.
+	Values map[string]interface{}
+}
@@ -2,20 +2,23 @@ package release
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"strconv"
 	"time"
 
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
 	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/operatorkit/v4/pkg/controller/context/resourcecanceledcontext"
 	"github.com/giantswarm/operatorkit/v4/pkg/resource/crud"
 	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
 	"github.com/giantswarm/chart-operator/v2/pkg/project"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+	"github.com/giantswarm/chart-operator/v2/service/releaseoperation"
 )
 
 func (r *Resource) ApplyUpdateChange(ctx context.Context, obj, updateChange interface{}) error {
@@ -38,30 +41,38 @@ func (r *Resource) ApplyUpdateChange(ctx context.Context, obj, updateChange inte
 		return nil
 	}
 
-	r.logger.Debugf(ctx, "updating release %#q in namespace %#q", releaseState.Name, key.Namespace(cr))
-
-	tarballURL := key.TarballURL(cr)
-	tarballPath, err := r.helmClient.PullChartTarball(ctx, tarballURL)
-	if helmclient.IsPullChartFailedError(err) {
-		reason := fmt.Sprintf("pulling chart %#q failed", tarballURL)
-		addStatusToContext(cc, reason, releaseNotInstalledStatus)
-
-		r.logger.LogCtx(ctx, "level", "warning", "message", reason, "stack", microerror.JSON(err))
+	ok, err := r.checkDependencies(ctx, cr)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if !ok {
 		r.logger.Debugf(ctx, "canceling resource")
 		resourcecanceledcontext.SetCanceled(ctx)
 		return nil
-	} else if helmclient.IsPullChartNotFound(err) {
-		reason := fmt.Sprintf("chart %#q not found", tarballURL)
-		addStatusToContext(cc, reason, releaseNotInstalledStatus)
+	}
+
+	r.logger.Debugf(ctx, "updating release %#q in namespace %#q", releaseState.Name, key.Namespace(cr))
+
+	tarballPath, unpinTarball, err := r.pullChartTarball(ctx, cr)
+	if reason, status, ok := pullFailedStatus(cr, err); ok {
+		addStatusToContext(cc, reason, status)
+		cc.Status.ChartPullFailed = true
 
 		r.logger.LogCtx(ctx, "level", "warning", "message", reason, "stack", microerror.JSON(err))
 		r.logger.Debugf(ctx, "canceling resource")
 		resourcecanceledcontext.SetCanceled(ctx)
 		return nil
-	} else if helmclient.IsPullChartTimeout(err) {
-		reason := fmt.Sprintf("timeout pulling %#q", tarballURL)
-		addStatusToContext(cc, reason, releaseNotInstalledStatus)
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+	defer unpinTarball()
 
+	err = r.verifyChart(ctx, cr, tarballPath)
+	if IsSignatureInvalid(err) {
+		reason := err.Error()
+		addStatusToContext(cc, reason, signatureInvalidStatus)
+
+		r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "SignatureInvalid", reason)
 		r.logger.LogCtx(ctx, "level", "warning", "message", reason, "stack", microerror.JSON(err))
 		r.logger.Debugf(ctx, "canceling resource")
 		resourcecanceledcontext.SetCanceled(ctx)
@@ -70,13 +81,6 @@ func (r *Resource) ApplyUpdateChange(ctx context.Context, obj, updateChange inte
 		return microerror.Mask(err)
 	}
 
-	defer func() {
-		err := r.fs.Remove(tarballPath)
-		if err != nil {
-			r.logger.Errorf(ctx, err, "deletion of %#q failed", tarballPath)
-		}
-	}()
-
 	// TODO: Disabling helm upgrade --force from chart-operator since recreate
 	// is not supported.
 	//
@@ -87,7 +91,35 @@ func (r *Resource) ApplyUpdateChange(ctx context.Context, obj, updateChange inte
 		r.logger.Debugf(ctx, "helm upgrade force is disabled for %#q", releaseState.Name)
 	}
 
-	ch := make(chan error)
+	done, ok, err := r.startOperation(ctx, key.Namespace(cr), releaseState.Name, releaseoperation.Upgrade)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if !ok {
+		r.logger.Debugf(ctx, "canceling resource")
+		resourcecanceledcontext.SetCanceled(ctx)
+		return nil
+	}
+
+	if key.IsHealthCheck(cr) {
+		// The health check deadline is measured from the start of the
+		// upgrade so only releases upgraded by chart-operator are rolled
+		// back.
+		err = r.addAnnotation(ctx, &cr, annotation.HealthCheckStarted, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			done()
+			return microerror.Mask(err)
+		}
+	}
+
+	ch := make(chan error, 1)
+	start := time.Now()
+
+	// The operation keeps running in the background once the reconciliation
+	// finished. So it must not use the context of the reconciliation.
+	operationCtx := r.releaseOperations.Context(ctx)
+	// The tarball stays pinned in the cache until the operation finished.
+	unpinOperationTarball := r.tarballCache.pinPath(tarballPath)
 
 	// We update the helm release but with a wait timeout so we don't
 	// block reconciling other CRs.
@@ -95,26 +127,31 @@ func (r *Resource) ApplyUpdateChange(ctx context.Context, obj, updateChange inte
 	// If we do timeout the update will continue in the background.
 	// We will check the progress in the next reconciliation loop.
 	go func() {
+		defer done()
+		defer unpinOperationTarball()
+
 		opts := helmclient.UpdateOptions{
 			Force: false,
 		}
 
 		// We need to pass the ValueOverrides option to make the update process
 		// use the default values and prevent errors on nested values.
-		err = r.helmClient.UpdateReleaseFromTarball(ctx,
+		err := r.helmClient.UpdateReleaseFromTarball(operationCtx,
 			tarballPath,
 			key.Namespace(cr),
 			releaseState.Name,
 			releaseState.Values,
 			opts)
-		close(ch)
+		observeOperation(releaseoperation.Upgrade, start, err)
+		ch <- err
 	}()
 
 	select {
-	case <-ch:
+	case err = <-ch:
 		// Fall through.
 	case <-time.After(r.k8sWaitTimeout):
 		r.logger.Debugf(ctx, "waited for %d secs. release still being updated", int64(r.k8sWaitTimeout.Seconds()))
+		observeBackgroundOperation(releaseoperation.Upgrade)
 
 		// The update will continue in the background. We set the checksum
 		// annotation so the update state calculation is accurate when we check
@@ -133,6 +170,7 @@ func (r *Resource) ApplyUpdateChange(ctx context.Context, obj, updateChange inte
 		reason = fmt.Sprintf("resource already exists: (%s)", reason)
 		r.logger.Debugf(ctx, "helm release %#q failed, %s", releaseState.Name, reason)
 		addStatusToContext(cc, reason, alreadyExistsStatus)
+		r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "AlreadyExists", reason)
 
 		r.logger.Debugf(ctx, "canceling resource")
 		resourcecanceledcontext.SetCanceled(ctx)
@@ -142,6 +180,7 @@ func (r *Resource) ApplyUpdateChange(ctx context.Context, obj, updateChange inte
 		reason = fmt.Sprintf("helm validation error: (%s)", reason)
 		r.logger.Debugf(ctx, "helm release %#q failed, %s", releaseState.Name, reason)
 		addStatusToContext(cc, reason, validationFailedStatus)
+		r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "ValidationFailed", reason)
 
 		r.logger.Debugf(ctx, "canceling resource")
 		resourcecanceledcontext.SetCanceled(ctx)
@@ -151,6 +190,7 @@ func (r *Resource) ApplyUpdateChange(ctx context.Context, obj, updateChange inte
 		reason = fmt.Sprintf("invalid manifest error: (%s)", reason)
 		r.logger.Debugf(ctx, "helm release %#q failed, %s", releaseState.Name, reason)
 		addStatusToContext(cc, reason, invalidManifestStatus)
+		r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "InvalidManifest", reason)
 
 		r.logger.Debugf(ctx, "canceling resource")
 		resourcecanceledcontext.SetCanceled(ctx)
@@ -162,6 +202,7 @@ func (r *Resource) ApplyUpdateChange(ctx context.Context, obj, updateChange inte
 		if helmclient.IsReleaseNotFound(relErr) {
 			reason := fmt.Sprintf("release %#q not found", releaseState.Name)
 			addStatusToContext(cc, reason, releaseNotInstalledStatus)
+			r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "UpgradeFailed", reason)
 
 			r.logger.Debugf(ctx, "canceling resource")
 			resourcecanceledcontext.SetCanceled(ctx)
@@ -173,6 +214,7 @@ func (r *Resource) ApplyUpdateChange(ctx context.Context, obj, updateChange inte
 		// Release is failed so the status resource will check the Helm release.
 		if releaseContent.Status == helmclient.StatusFailed {
 			addStatusToContext(cc, releaseContent.Description, helmclient.StatusFailed)
+			r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "UpgradeFailed", releaseContent.Description)
 
 			r.logger.Debugf(ctx, "failed to update release %#q", releaseContent.Name)
 			r.logger.Debugf(ctx, "canceling resource")
@@ -181,6 +223,7 @@ func (r *Resource) ApplyUpdateChange(ctx context.Context, obj, updateChange inte
 		}
 
 		addStatusToContext(cc, err.Error(), unknownError)
+		r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "UpgradeFailed", err.Error())
 
 		r.logger.Debugf(ctx, "canceling resource")
 		resourcecanceledcontext.SetCanceled(ctx)
@@ -188,6 +231,7 @@ func (r *Resource) ApplyUpdateChange(ctx context.Context, obj, updateChange inte
 	}
 
 	r.logger.Debugf(ctx, "updated release %#q in namespace %#q", releaseState.Name, key.Namespace(cr))
+	r.eventRecorder.Eventf(&cr, corev1.EventTypeNormal, "Upgraded", "upgraded release %#q to version %#q", releaseState.Name, releaseState.Version)
 
 	// We set the checksum annotation so the update state calculation
 	// is accurate when we check in the next reconciliation loop.
@@ -200,6 +244,11 @@ func (r *Resource) ApplyUpdateChange(ctx context.Context, obj, updateChange inte
 }
 
 func (r *Resource) NewUpdatePatch(ctx context.Context, obj, currentState, desiredState interface{}) (*crud.Patch, error) {
+	cr, err := key.ToCustomResource(obj)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
 	create, err := r.newCreateChange(ctx, obj, currentState, desiredState)
 	if err != nil {
 		return nil, microerror.Mask(err)
@@ -209,6 +258,18 @@ func (r *Resource) NewUpdatePatch(ctx context.Context, obj, currentState, desire
 		return nil, microerror.Mask(err)
 	}
 
+	if key.IsDryRun(cr) {
+		// Dry runs never modify the release. The changes are rendered
+		// whenever the desired release differs from the one the dry run
+		// configmap was rendered for.
+		err = r.ensureDryRun(ctx, cr, currentState, desiredState)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		return crud.NewPatch(), nil
+	}
+
 	patch := crud.NewPatch()
 	patch.SetCreateChange(create)
 	patch.SetUpdateChange(update)
@@ -238,13 +299,34 @@ func (r *Resource) newUpdateChange(ctx context.Context, obj, currentState, desir
 
 	r.logger.Debugf(ctx, "finding out if the %#q release has to be updated", desiredReleaseState.Name)
 
+	// An install or upgrade of the release is still running in the
+	// background so we check again in the next reconciliation loop.
+	if r.isOperationInProgress(ctx, key.Namespace(cr), desiredReleaseState.Name) {
+		r.logger.Debugf(ctx, "the %#q release does not need to be updated", desiredReleaseState.Name)
+		return nil, nil
+	}
+
+	// The last operation of the release was interrupted by an operator
+	// restart so we recover the release first. Dry runs never modify the
+	// release.
+	if !key.IsDryRun(cr) {
+		recovered, err := r.recoverInterrupted(ctx, cr, desiredReleaseState.Name, currentReleaseState.Status)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		if recovered {
+			return nil, nil
+		}
+	}
+
 	// The release is still being updated so we don't update and check again
 	// in the next reconciliation loop.
 	if isReleaseInTransitionState(currentReleaseState) {
 		upgradeForce := key.HasForceUpgradeAnnotation(cr)
 		// Only perform a rollback in case of upgrade force is enabled.
 		// This is to consider critical app's service level and stateful apps.
-		if upgradeForce {
+		// Dry runs never modify the release.
+		if upgradeForce && !key.IsDryRun(cr) {
 			err = r.rollback(ctx, obj, currentReleaseState.Status)
 			if err != nil {
 				return nil, microerror.Mask(err)
@@ -254,6 +336,18 @@ func (r *Resource) newUpdateChange(ctx context.Context, obj, currentState, desir
 		}
 	}
 
+	// Failed upgrades are rolled back to the last deployed revision when
+	// the chart CR opts in. Dry runs never modify the release.
+	if currentReleaseState.Status == helmclient.StatusFailed && key.IsRollbackOnFailure(cr) && !key.IsDryRun(cr) {
+		rolledBack, err := r.rollbackFailedUpgrade(ctx, cr, desiredReleaseState)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		if rolledBack {
+			return nil, nil
+		}
+	}
+
 	// We check the controller context and if the release has failed more
 	// than the max number of attempts we stop updating. Otherwise too many
 	// release secrets will be created.
@@ -266,7 +360,16 @@ func (r *Resource) newUpdateChange(ctx context.Context, obj, currentState, desir
 	}
 
 	if isReleaseModified(currentReleaseState, desiredReleaseState) {
-		// Ignoring `Values` in diff since it could contain secret data and we use MD5 hash for comparison.
+		// The upgrade to this version and values was rolled back. So we
+		// don't retry it until the chart CR changes.
+		if rolledBack, ok := key.RolledBackFrom(cr); ok && isRolledBackUpgrade(rolledBack, desiredReleaseState) {
+			r.logger.Debugf(ctx, "upgrade of release %#q to version %#q was rolled back, not retrying", desiredReleaseState.Name, desiredReleaseState.Version)
+			addStatusToContext(cc, rolledBackReason(rolledBack), rolledBackStatus)
+
+			return nil, nil
+		}
+
+		// Ignoring `Values` in diff since it could contain secret data and we use checksums for comparison.
 		opt := cmp.FilterPath(func(p cmp.Path) bool {
 			return p.String() == "Values"
 		}, cmp.Ignore())
@@ -278,11 +381,61 @@ func (r *Resource) newUpdateChange(ctx context.Context, obj, currentState, desir
 		return &desiredReleaseState, nil
 	}
 
+	if !isValuesChecksumMigrated(currentReleaseState) {
+		// The values have not changed but the chart CR only has the legacy
+		// MD5 checksum annotation. So we migrate it without upgrading.
+		r.logger.Debugf(ctx, "migrating values checksum annotation for release %#q", desiredReleaseState.Name)
+
+		err = r.addHashAnnotation(ctx, cr, desiredReleaseState)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	}
+
+	if key.IsHealthCheck(cr) && currentReleaseState.Status == helmclient.StatusDeployed {
+		healthy, err := r.checkHealth(ctx, cr, desiredReleaseState)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		// The rolled back from annotation is kept while the release is
+		// unhealthy so the rolled back upgrade is not retried.
+		if !healthy {
+			return nil, nil
+		}
+	}
+
+	if currentReleaseState.Status == helmclient.StatusDeployed {
+		drifted, err := r.checkDrift(ctx, cr, desiredReleaseState.Name)
+		if err != nil {
+			// The drift check is best effort so it does not block the
+			// reconciliation of the release.
+			r.logger.Errorf(ctx, err, "checking drift of release %#q failed", desiredReleaseState.Name)
+		} else if drifted && key.IsSelfHeal(cr) && !key.IsDryRun(cr) {
+			next, ok := r.canSelfHeal(cr)
+			if ok {
+				r.logger.Debugf(ctx, "self heal is enabled, upgrading release %#q to revert drifted objects", desiredReleaseState.Name)
+				r.eventRecorder.Eventf(&cr, corev1.EventTypeNormal, "SelfHealing", "upgrading release %#q to revert drifted objects", desiredReleaseState.Name)
+				selfHealCounter.WithLabelValues(cr.Namespace, cr.Name).Inc()
+				r.setSelfHealed(cr)
+
+				return &desiredReleaseState, nil
+			}
+
+			r.logger.Debugf(ctx, "release %#q was upgraded to revert drifted objects recently, not self healing until %s", desiredReleaseState.Name, next.Format(time.RFC3339))
+		}
+	}
+
 	err = r.removeAnnotation(ctx, &cr, annotation.RollbackCount)
 	if err != nil {
 		return nil, microerror.Mask(err)
 	}
 
+	err = r.removeAnnotation(ctx, &cr, annotation.RolledBackFrom)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
 	return nil, nil
 }
 
@@ -292,17 +445,9 @@ func (r *Resource) rollback(ctx context.Context, obj interface{}, currentStatus
 		return microerror.Mask(err)
 	}
 
-	count, ok := cr.GetAnnotations()[annotation.RollbackCount]
-
-	var rollbackCount int
-
-	if !ok {
-		rollbackCount = 0
-	} else {
-		rollbackCount, err = strconv.Atoi(count)
-		if err != nil {
-			return microerror.Mask(err)
-		}
+	rollbackCount, err := key.RollbackCount(cr)
+	if err != nil {
+		return microerror.Mask(err)
 	}
 
 	if rollbackCount > r.maxRollback {
@@ -310,25 +455,45 @@ func (r *Resource) rollback(ctx context.Context, obj interface{}, currentStatus
 		return nil
 	}
 
+	operationType := releaseoperation.Rollback
+	if currentStatus == helmclient.StatusPendingInstall {
+		operationType = releaseoperation.Delete
+	}
+
+	done, ok, err := r.startOperation(ctx, key.Namespace(cr), key.ReleaseName(cr), operationType)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if !ok {
+		return nil
+	}
+	defer done()
+
 	if currentStatus == helmclient.StatusPendingInstall {
 		r.logger.Debugf(ctx, "deleting release %#q in %#q status", key.ReleaseName(cr), currentStatus)
 
+		start := time.Now()
 		err = r.helmClient.DeleteRelease(ctx, key.Namespace(cr), key.ReleaseName(cr))
+		observeOperation(releaseoperation.Delete, start, err)
 		if err != nil {
 			return microerror.Mask(err)
 		}
 
 		r.logger.Debugf(ctx, "deleted release %#q", key.ReleaseName(cr))
+		r.eventRecorder.Eventf(&cr, corev1.EventTypeNormal, "RolledBack", "deleted release %#q in %#q status", key.ReleaseName(cr), currentStatus)
 	} else {
 		r.logger.Debugf(ctx, "rollback release %#q in %#q status", key.ReleaseName(cr), currentStatus)
 
 		// Rollback to revision 0 restore a release to the previous revision.
+		start := time.Now()
 		err = r.helmClient.Rollback(ctx, key.Namespace(cr), key.ReleaseName(cr), 0, helmclient.RollbackOptions{})
+		observeOperation(releaseoperation.Rollback, start, err)
 		if err != nil {
 			return microerror.Mask(err)
 		}
 
 		r.logger.Debugf(ctx, "rollbacked release %#q", key.ReleaseName(cr))
+		r.eventRecorder.Eventf(&cr, corev1.EventTypeNormal, "RolledBack", "rolled back release %#q in %#q status", key.ReleaseName(cr), currentStatus)
 	}
 
 	err = r.addAnnotation(ctx, &cr, annotation.RollbackCount, fmt.Sprintf("%d", rollbackCount+1))
@@ -338,3 +503,105 @@ func (r *Resource) rollback(ctx context.Context, obj interface{}, currentStatus
 
 	return nil
 }
+
+// rollbackFailedUpgrade rolls back the failed upgrade of the release. It
+// returns false if there is no revision to roll back to.
+func (r *Resource) rollbackFailedUpgrade(ctx context.Context, cr v1alpha1.Chart, desiredReleaseState ReleaseState) (bool, error) {
+	history, err := r.helmClient.GetReleaseHistory(ctx, key.Namespace(cr), desiredReleaseState.Name)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	var failed *helmclient.ReleaseHistory
+	for i, h := range history {
+		if failed == nil || h.Revision > failed.Revision {
+			failed = &history[i]
+		}
+	}
+
+	if failed == nil {
+		return false, nil
+	}
+
+	return r.rollbackUpgrade(ctx, cr, desiredReleaseState, history, failed.Revision, failed.Description)
+}
+
+// rollbackUpgrade rolls back the release to the last revision below the given
+// revision which was deployed. The upgrade is stored in the rolled back from
+// annotation so it is not retried. It returns false if there is no such
+// revision e.g. for the first install.
+func (r *Resource) rollbackUpgrade(ctx context.Context, cr v1alpha1.Chart, desiredReleaseState ReleaseState, history []helmclient.ReleaseHistory, revision int, reason string) (bool, error) {
+	cc, err := controllercontext.FromContext(ctx)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	var deployed *helmclient.ReleaseHistory
+	for i, h := range history {
+		if h.Revision >= revision {
+			continue
+		}
+		if h.Status != helmclient.StatusDeployed && h.Status != helmclient.StatusSuperseded {
+			continue
+		}
+		if deployed == nil || h.Revision > deployed.Revision {
+			deployed = &history[i]
+		}
+	}
+
+	if deployed == nil {
+		r.logger.Debugf(ctx, "release %#q has no deployed revision below revision %d to roll back to", desiredReleaseState.Name, revision)
+		return false, nil
+	}
+
+	done, ok, err := r.startOperation(ctx, key.Namespace(cr), desiredReleaseState.Name, releaseoperation.Rollback)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+	if !ok {
+		return false, nil
+	}
+	defer done()
+
+	r.logger.Debugf(ctx, "rolling back release %#q to revision %d", desiredReleaseState.Name, deployed.Revision)
+
+	start := time.Now()
+	err = r.helmClient.Rollback(ctx, key.Namespace(cr), desiredReleaseState.Name, deployed.Revision, helmclient.RollbackOptions{})
+	observeOperation(releaseoperation.Rollback, start, err)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	r.logger.Debugf(ctx, "rolled back release %#q to revision %d", desiredReleaseState.Name, deployed.Revision)
+	r.eventRecorder.Eventf(&cr, corev1.EventTypeNormal, "RolledBack", "rolled back release %#q to revision %d as upgrade to version %#q failed: %s", desiredReleaseState.Name, deployed.Revision, desiredReleaseState.Version, reason)
+
+	rolledBack := key.RolledBack{
+		Version:        desiredReleaseState.Version,
+		ValuesChecksum: desiredReleaseState.ValuesChecksum,
+		Reason:         reason,
+	}
+
+	b, err := json.Marshal(rolledBack)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	err = r.addAnnotation(ctx, &cr, annotation.RolledBackFrom, string(b))
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	addStatusToContext(cc, rolledBackReason(rolledBack), rolledBackStatus)
+
+	return true, nil
+}
+
+// isRolledBackUpgrade returns true if the desired state is the upgrade that
+// was rolled back.
+func isRolledBackUpgrade(rolledBack key.RolledBack, desiredReleaseState ReleaseState) bool {
+	return rolledBack.Version == desiredReleaseState.Version && rolledBack.ValuesChecksum == desiredReleaseState.ValuesChecksum
+}
+
+func rolledBackReason(rolledBack key.RolledBack) string {
+	return fmt.Sprintf("upgrade to version %#q was rolled back: %s", rolledBack.Version, rolledBack.Reason)
+}
@@ -7,11 +7,16 @@ import (
 
 	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
 	"github.com/giantswarm/apiextensions/v3/pkg/clientset/versioned/fake"
+	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
 	"github.com/giantswarm/helmclient/v4/pkg/helmclienttest"
 	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/google/go-cmp/cmp"
 	"github.com/spf13/afero"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
 )
 
@@ -22,6 +27,7 @@ func Test_Resource_Release_newUpdateChange(t *testing.T) {
 		currentState        *ReleaseState
 		desiredState        *ReleaseState
 		expectedUpdateState *ReleaseState
+		expectedAnnotations map[string]string
 	}{
 		{
 			name:         "case 0: empty current state, empty update change",
@@ -66,64 +72,64 @@ func Test_Resource_Release_newUpdateChange(t *testing.T) {
 				Version: "release-version",
 			},
 			desiredState: &ReleaseState{
-				Name:              "release-name",
-				ValuesMD5Checksum: "checksum",
-				Version:           "release-version",
+				Name:           "release-name",
+				ValuesChecksum: "checksum",
+				Version:        "release-version",
 			},
 			expectedUpdateState: &ReleaseState{
-				Name:              "release-name",
-				ValuesMD5Checksum: "checksum",
-				Version:           "release-version",
+				Name:           "release-name",
+				ValuesChecksum: "checksum",
+				Version:        "release-version",
 			},
 		},
 		{
 			name: "case 4: nonempty current state, desired state has different values, expected desired state",
 			currentState: &ReleaseState{
-				Name:              "release-name",
-				ValuesMD5Checksum: "old-checksum",
-				Version:           "release-version",
+				Name:           "release-name",
+				ValuesChecksum: "old-checksum",
+				Version:        "release-version",
 			},
 			desiredState: &ReleaseState{
-				Name:              "release-name",
-				ValuesMD5Checksum: "new-checksum",
-				Version:           "release-version",
+				Name:           "release-name",
+				ValuesChecksum: "new-checksum",
+				Version:        "release-version",
 			},
 			expectedUpdateState: &ReleaseState{
-				Name:              "release-name",
-				ValuesMD5Checksum: "new-checksum",
-				Version:           "release-version",
+				Name:           "release-name",
+				ValuesChecksum: "new-checksum",
+				Version:        "release-version",
 			},
 		},
 		{
 			name: "case 5: current state has values, desired state has equal values, empty update change",
 			currentState: &ReleaseState{
-				Name:              "release-name",
-				ValuesMD5Checksum: "checksum",
-				Version:           "release-version",
+				Name:           "release-name",
+				ValuesChecksum: "checksum",
+				Version:        "release-version",
 			},
 			desiredState: &ReleaseState{
-				Name:              "release-name",
-				ValuesMD5Checksum: "checksum",
-				Version:           "release-version",
+				Name:           "release-name",
+				ValuesChecksum: "checksum",
+				Version:        "release-version",
 			},
 			expectedUpdateState: nil,
 		},
 		{
 			name: "case 6: current state has values, desired state has new release and equal values, expected desired state",
 			currentState: &ReleaseState{
-				Name:              "release-name",
-				ValuesMD5Checksum: "checksum",
-				Version:           "release-version",
+				Name:           "release-name",
+				ValuesChecksum: "checksum",
+				Version:        "release-version",
 			},
 			desiredState: &ReleaseState{
-				Name:              "release-name",
-				ValuesMD5Checksum: "checksum",
-				Version:           "new-release-version",
+				Name:           "release-name",
+				ValuesChecksum: "checksum",
+				Version:        "new-release-version",
 			},
 			expectedUpdateState: &ReleaseState{
-				Name:              "release-name",
-				ValuesMD5Checksum: "checksum",
-				Version:           "new-release-version",
+				Name:           "release-name",
+				ValuesChecksum: "checksum",
+				Version:        "new-release-version",
 			},
 		},
 		{
@@ -144,16 +150,130 @@ func Test_Resource_Release_newUpdateChange(t *testing.T) {
 				Version: "release-version",
 			},
 		},
+		{
+			name: "case 8: current state has legacy md5 checksum, equal values, checksum annotation migrated",
+			obj: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "my-chart",
+					Namespace: "default",
+					Annotations: map[string]string{
+						annotation.ValuesMD5Checksum: "md5-checksum",
+					},
+				},
+			},
+			currentState: &ReleaseState{
+				Name:              "release-name",
+				ValuesMD5Checksum: "md5-checksum",
+				Version:           "release-version",
+			},
+			desiredState: &ReleaseState{
+				Name:              "release-name",
+				ValuesChecksum:    "checksum",
+				ValuesMD5Checksum: "md5-checksum",
+				Version:           "release-version",
+			},
+			expectedUpdateState: nil,
+			expectedAnnotations: map[string]string{
+				annotation.ValuesChecksum: "checksum",
+			},
+		},
+		{
+			name: "case 9: current state has legacy md5 checksum, different values, expected desired state",
+			currentState: &ReleaseState{
+				Name:              "release-name",
+				ValuesMD5Checksum: "old-md5-checksum",
+				Version:           "release-version",
+			},
+			desiredState: &ReleaseState{
+				Name:              "release-name",
+				ValuesChecksum:    "checksum",
+				ValuesMD5Checksum: "new-md5-checksum",
+				Version:           "release-version",
+			},
+			expectedUpdateState: &ReleaseState{
+				Name:              "release-name",
+				ValuesChecksum:    "checksum",
+				ValuesMD5Checksum: "new-md5-checksum",
+				Version:           "release-version",
+			},
+		},
+		{
+			name: "case 10: rolled back upgrade, empty update change",
+			obj: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.RolledBackFrom: `{"version":"1.1.0","valuesChecksum":"checksum","reason":"upgrade failed"}`,
+					},
+				},
+			},
+			currentState: &ReleaseState{
+				Name:           "release-name",
+				Status:         "deployed",
+				ValuesChecksum: "old-checksum",
+				Version:        "1.0.0",
+			},
+			desiredState: &ReleaseState{
+				Name:           "release-name",
+				Status:         "deployed",
+				ValuesChecksum: "checksum",
+				Version:        "1.1.0",
+			},
+			expectedUpdateState: nil,
+		},
+		{
+			name: "case 11: rolled back upgrade, different version in desired state, expected desired state",
+			obj: v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.RolledBackFrom: `{"version":"1.1.0","valuesChecksum":"checksum","reason":"upgrade failed"}`,
+					},
+				},
+			},
+			currentState: &ReleaseState{
+				Name:           "release-name",
+				Status:         "deployed",
+				ValuesChecksum: "old-checksum",
+				Version:        "1.0.0",
+			},
+			desiredState: &ReleaseState{
+				Name:           "release-name",
+				Status:         "deployed",
+				ValuesChecksum: "checksum",
+				Version:        "1.1.1",
+			},
+			expectedUpdateState: &ReleaseState{
+				Name:           "release-name",
+				Status:         "deployed",
+				ValuesChecksum: "checksum",
+				Version:        "1.1.1",
+			},
+		},
 	}
+
+	g8sClient := fake.NewSimpleClientset(&v1alpha1.Chart{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "my-chart",
+			Namespace: "default",
+			Annotations: map[string]string{
+				annotation.ValuesMD5Checksum: "md5-checksum",
+			},
+		},
+	})
+
 	var newResource *Resource
 	var err error
 	{
 		c := Config{
-			Fs:         afero.NewMemMapFs(),
-			G8sClient:  fake.NewSimpleClientset(),
-			HelmClient: helmclienttest.New(helmclienttest.Config{}),
-			K8sClient:  k8sfake.NewSimpleClientset(),
-			Logger:     microloggertest.New(),
+			DynamicClient:     newTestDynamicClient(),
+			EventRecorder:     &record.FakeRecorder{},
+			Fs:                afero.NewMemMapFs(),
+			G8sClient:         g8sClient,
+			HelmClient:        helmclienttest.New(helmclienttest.Config{}),
+			HelmStorage:       newTestHelmStorage(t, k8sfake.NewSimpleClientset()),
+			K8sClient:         k8sfake.NewSimpleClientset(),
+			Logger:            microloggertest.New(),
+			ReleaseOperations: newReleaseOperations(t),
+			RESTMapper:        newTestRESTMapper(),
 
 			TillerNamespace: "giantswarm",
 		}
@@ -191,6 +311,140 @@ func Test_Resource_Release_newUpdateChange(t *testing.T) {
 					t.Fatalf("expected Status %q, got %q", tc.expectedUpdateState.Status, updateChange.Status)
 				}
 			}
+			if tc.expectedAnnotations != nil {
+				cr, err := g8sClient.ApplicationV1alpha1().Charts(tc.obj.Namespace).Get(ctx, tc.obj.Name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal("expected", nil, "got", err)
+				}
+				if !cmp.Equal(cr.Annotations, tc.expectedAnnotations) {
+					t.Fatalf("want matching annotations \n %s", cmp.Diff(cr.Annotations, tc.expectedAnnotations))
+				}
+			}
+		})
+	}
+}
+
+func Test_Resource_Release_rollbackFailedUpgrade(t *testing.T) {
+	testCases := []struct {
+		name                string
+		releaseHistory      []helmclient.ReleaseHistory
+		expectedRolledBack  bool
+		expectedAnnotations map[string]string
+		expectedStatus      controllercontext.Status
+	}{
+		{
+			name: "case 0: rolled back to last deployed revision",
+			releaseHistory: []helmclient.ReleaseHistory{
+				{
+					Description: "Install complete",
+					Revision:    1,
+					Status:      helmclient.StatusSuperseded,
+				},
+				{
+					Description: "Upgrade complete",
+					Revision:    2,
+					Status:      helmclient.StatusDeployed,
+				},
+				{
+					Description: "Upgrade \"my-chart\" failed: timed out waiting for the condition",
+					Revision:    3,
+					Status:      helmclient.StatusFailed,
+				},
+			},
+			expectedRolledBack: true,
+			expectedAnnotations: map[string]string{
+				annotation.RolledBackFrom: `{"version":"1.1.0","valuesChecksum":"checksum","reason":"Upgrade \"my-chart\" failed: timed out waiting for the condition"}`,
+			},
+			expectedStatus: controllercontext.Status{
+				Reason: "upgrade to version `1.1.0` was rolled back: Upgrade \"my-chart\" failed: timed out waiting for the condition",
+				Release: controllercontext.Release{
+					Status: rolledBackStatus,
+				},
+			},
+		},
+		{
+			name: "case 1: no deployed revision",
+			releaseHistory: []helmclient.ReleaseHistory{
+				{
+					Description: "Install failed",
+					Revision:    1,
+					Status:      helmclient.StatusFailed,
+				},
+			},
+			expectedRolledBack: false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			cr := v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "my-chart",
+					Namespace: "default",
+				},
+			}
+			g8sClient := fake.NewSimpleClientset(&cr)
+
+			c := Config{
+				DynamicClient: newTestDynamicClient(),
+				EventRecorder: &record.FakeRecorder{},
+				Fs:            afero.NewMemMapFs(),
+				G8sClient:     g8sClient,
+				HelmClient: helmclienttest.New(helmclienttest.Config{
+					DefaultReleaseHistory: tc.releaseHistory,
+				}),
+				HelmStorage:       newTestHelmStorage(t, k8sfake.NewSimpleClientset()),
+				K8sClient:         k8sfake.NewSimpleClientset(),
+				Logger:            microloggertest.New(),
+				ReleaseOperations: newReleaseOperations(t),
+				RESTMapper:        newTestRESTMapper(),
+
+				TillerNamespace: "giantswarm",
+			}
+
+			r, err := New(c)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			var ctx context.Context
+			{
+				c := controllercontext.Context{}
+				ctx = controllercontext.NewContext(context.Background(), c)
+			}
+
+			desiredState := ReleaseState{
+				Name:           "my-chart",
+				ValuesChecksum: "checksum",
+				Version:        "1.1.0",
+			}
+
+			rolledBack, err := r.rollbackFailedUpgrade(ctx, cr, desiredState)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if rolledBack != tc.expectedRolledBack {
+				t.Fatalf("rolled back == %t, want %t", rolledBack, tc.expectedRolledBack)
+			}
+
+			result, err := g8sClient.ApplicationV1alpha1().Charts(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+			if !cmp.Equal(result.Annotations, tc.expectedAnnotations) {
+				t.Fatalf("want matching annotations \n %s", cmp.Diff(result.Annotations, tc.expectedAnnotations))
+			}
+
+			cc, err := controllercontext.FromContext(ctx)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+			if !cmp.Equal(cc.Status, tc.expectedStatus) {
+				t.Fatalf("want matching status \n %s", cmp.Diff(cc.Status, tc.expectedStatus))
+			}
 		})
 	}
 }
@@ -0,0 +1,348 @@
+package release
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/microerror"
+	"golang.org/x/crypto/openpgp"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/pkg/cosign"
+	"github.com/giantswarm/chart-operator/v2/pkg/oci"
+	"github.com/giantswarm/chart-operator/v2/pkg/provenance"
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+)
+
+const (
+	// VerifyPolicyEnforce cancels the resource when the chart provenance
+	// cannot be verified.
+	VerifyPolicyEnforce = "enforce"
+	// VerifyPolicyOff disables verifying the chart provenance.
+	VerifyPolicyOff = "off"
+	// VerifyPolicyWarn logs and emits an event when the chart provenance
+	// cannot be verified but still installs the chart.
+	VerifyPolicyWarn = "warn"
+
+	// keyringName is the name of the secret or configmap with the keyring
+	// of the keys trusted to sign charts.
+	keyringName      = "chart-operator-keyring"
+	keyringKey       = "keyring"
+	keyringNamespace = "giantswarm"
+	// cosignKeysKey is the key of the keyring secret or configmap with the
+	// PEM encoded public keys trusted to sign OCI charts with cosign.
+	cosignKeysKey = "cosign.pub"
+
+	// maxProvenanceSize is the maximum size in bytes of provenance files
+	// read from chart repositories.
+	maxProvenanceSize = 1024 * 1024
+
+	// provenanceSuffix is appended to tarball URLs to get the provenance
+	// file as done by helm.
+	provenanceSuffix = ".prov"
+)
+
+// verifyChart verifies the signature of the chart tarball according to the
+// verify policy of the chart CR. It returns signatureInvalidError when the
+// policy is enforce and the provenance cannot be verified.
+func (r *Resource) verifyChart(ctx context.Context, cr v1alpha1.Chart, tarballPath string) error {
+	policy, err := r.getVerifyPolicy(ctx, cr)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	if policy == VerifyPolicyOff {
+		return nil
+	}
+
+	signer, err := r.verifySignature(ctx, cr, tarballPath)
+	if IsSignatureInvalid(err) && policy == VerifyPolicyWarn {
+		r.logger.Debugf(ctx, "verify policy is %#q, installing chart %#q with invalid signature", policy, key.TarballURL(cr))
+		r.logger.LogCtx(ctx, "level", "warning", "message", err.Error())
+		r.eventRecorder.Event(&cr, corev1.EventTypeWarning, "SignatureInvalid", err.Error())
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	r.logger.Debugf(ctx, "verified chart %#q signed by %#q", key.TarballURL(cr), signer)
+	r.eventRecorder.Eventf(&cr, corev1.EventTypeNormal, "Verified", "verified chart %s signed by %s", key.TarballURL(cr), signer)
+
+	return nil
+}
+
+// getVerifyPolicy returns the verify policy of the chart CR. When the chart CR
+// has no policy the policy of the release namespace is used and then the
+// default policy.
+func (r *Resource) getVerifyPolicy(ctx context.Context, cr v1alpha1.Chart) (string, error) {
+	policy := key.VerifyPolicy(cr)
+
+	if policy == "" {
+		ns, err := r.k8sClient.CoreV1().Namespaces().Get(ctx, key.Namespace(cr), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// fall through
+		} else if err != nil {
+			return "", microerror.Mask(err)
+		} else {
+			policy = ns.GetAnnotations()[annotation.VerifyPolicy]
+		}
+	}
+
+	if policy == "" {
+		policy = r.verifyPolicy
+	}
+
+	if !isValidVerifyPolicy(policy) {
+		// An invalid policy fails closed so a typo does not disable
+		// verification.
+		return "", microerror.Maskf(signatureInvalidError, "invalid verify policy %#q", policy)
+	}
+
+	return policy, nil
+}
+
+// verifySignature verifies the chart is signed by a trusted key. Charts from
+// tarball URLs and OCI charts with a provenance layer are verified with their
+// provenance file. Other OCI charts are verified with their cosign signatures.
+// It returns the signer.
+func (r *Resource) verifySignature(ctx context.Context, cr v1alpha1.Chart, tarballPath string) (string, error) {
+	if !key.IsOCI(cr) {
+		prov, err := r.getProvenance(ctx, cr)
+		if err != nil {
+			return "", microerror.Mask(err)
+		}
+
+		signer, err := r.verifyProvenance(ctx, cr, prov, tarballPath)
+		if err != nil {
+			return "", microerror.Mask(err)
+		}
+
+		return signer, nil
+	}
+
+	ref, err := oci.ParseReference(key.TarballURL(cr))
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	credentials, err := r.getOCICredentials(ctx, cr, ref.Registry)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	chart, err := r.ociClient.Resolve(ctx, ref, credentials)
+	if oci.IsNotFound(err) || oci.IsPullFailed(err) || oci.IsUnauthorized(err) {
+		return "", microerror.Maskf(signatureInvalidError, "resolving chart %#q failed", ref)
+	} else if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	if chart.ProvenanceDigest == "" {
+		signer, err := r.verifyCosignSignature(ctx, ref, chart, credentials, tarballPath)
+		if err != nil {
+			return "", microerror.Mask(err)
+		}
+
+		return signer, nil
+	}
+
+	prov, err := r.ociClient.PullProvenance(ctx, ref, chart, credentials)
+	if oci.IsNotFound(err) {
+		return "", microerror.Maskf(signatureInvalidError, "chart %#q has no provenance", ref)
+	} else if oci.IsPullFailed(err) || oci.IsUnauthorized(err) {
+		return "", microerror.Maskf(signatureInvalidError, "pulling provenance of chart %#q failed", ref)
+	} else if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	signer, err := r.verifyProvenance(ctx, cr, prov, tarballPath)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return signer, nil
+}
+
+// verifyProvenance verifies the provenance file of the chart is signed by a
+// key in the keyring and matches the chart tarball. It returns the signer.
+func (r *Resource) verifyProvenance(ctx context.Context, cr v1alpha1.Chart, prov []byte, tarballPath string) (string, error) {
+	keyring, err := r.getKeyring(ctx)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	f, err := r.fs.Open(tarballPath)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+	defer f.Close()
+
+	signer, err := provenance.Verify(keyring, prov, f)
+	if provenance.IsInvalidSignature(err) {
+		return "", microerror.Maskf(signatureInvalidError, "chart %#q: %s", key.TarballURL(cr), err.Error())
+	} else if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return signer, nil
+}
+
+// verifyCosignSignature verifies the manifest of the OCI chart has a cosign
+// signature of a trusted key and the chart tarball is the chart layer of the
+// manifest. It returns the fingerprint of the key.
+func (r *Resource) verifyCosignSignature(ctx context.Context, ref oci.Reference, chart oci.Chart, credentials oci.Credentials, tarballPath string) (string, error) {
+	keys, err := r.getCosignKeys(ctx)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	// The signature covers the manifest so the tarball must be the chart
+	// layer of the signed manifest. The tag may have been moved since the
+	// tarball was pulled.
+	{
+		f, err := r.fs.Open(tarballPath)
+		if err != nil {
+			return "", microerror.Mask(err)
+		}
+		defer f.Close()
+
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		if err != nil {
+			return "", microerror.Mask(err)
+		}
+
+		digest := "sha256:" + hex.EncodeToString(h.Sum(nil))
+		if digest != chart.LayerDigest {
+			return "", microerror.Maskf(signatureInvalidError, "chart %#q has digest %#q, signed manifest has chart layer %#q", ref, digest, chart.LayerDigest)
+		}
+	}
+
+	signatures, err := r.ociClient.PullSignatures(ctx, ref, chart, credentials)
+	if oci.IsNotFound(err) {
+		return "", microerror.Maskf(signatureInvalidError, "chart %#q has no provenance or cosign signature", ref)
+	} else if oci.IsPullFailed(err) || oci.IsUnauthorized(err) {
+		return "", microerror.Maskf(signatureInvalidError, "pulling cosign signatures of chart %#q failed", ref)
+	} else if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	for _, s := range signatures {
+		signer, err := cosign.Verify(keys, chart.ManifestDigest, s.Payload, s.Signature)
+		if cosign.IsInvalidSignature(err) {
+			r.logger.Debugf(ctx, "cosign signature of chart %#q is not valid: %s", ref, err.Error())
+			continue
+		} else if err != nil {
+			return "", microerror.Mask(err)
+		}
+
+		return signer, nil
+	}
+
+	return "", microerror.Maskf(signatureInvalidError, "chart %#q has no valid cosign signature", ref)
+}
+
+// getKeyring returns the keyring from the keyring secret or if it does not
+// exist from the keyring configmap.
+func (r *Resource) getKeyring(ctx context.Context) (openpgp.EntityList, error) {
+	data, err := r.getKeyringData(ctx, keyringKey)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	keyring, err := provenance.ReadKeyring(data)
+	if provenance.IsInvalidKeyring(err) {
+		return nil, microerror.Maskf(signatureInvalidError, "keyring %#q in namespace %#q is invalid: %s", keyringName, keyringNamespace, err.Error())
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return keyring, nil
+}
+
+// getCosignKeys returns the cosign public keys from the keyring secret or if
+// it does not exist from the keyring configmap.
+func (r *Resource) getCosignKeys(ctx context.Context) ([]cosign.PublicKey, error) {
+	data, err := r.getKeyringData(ctx, cosignKeysKey)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	keys, err := cosign.ReadPublicKeys(data)
+	if cosign.IsInvalidKey(err) {
+		return nil, microerror.Maskf(signatureInvalidError, "cosign keys in keyring %#q in namespace %#q are invalid: %s", keyringName, keyringNamespace, err.Error())
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return keys, nil
+}
+
+// getKeyringData returns the data of the key in the keyring secret or if it
+// does not exist in the keyring configmap.
+func (r *Resource) getKeyringData(ctx context.Context, dataKey string) ([]byte, error) {
+	secret, err := r.k8sClient.CoreV1().Secrets(keyringNamespace).Get(ctx, keyringName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// fall through
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	} else {
+		return secret.Data[dataKey], nil
+	}
+
+	cm, err := r.k8sClient.CoreV1().ConfigMaps(keyringNamespace).Get(ctx, keyringName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, microerror.Maskf(signatureInvalidError, "keyring %#q in namespace %#q not found", keyringName, keyringNamespace)
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	data := cm.BinaryData[dataKey]
+	if len(data) == 0 {
+		data = []byte(cm.Data[dataKey])
+	}
+
+	return data, nil
+}
+
+// getProvenance returns the provenance file with the .prov suffix next to the
+// chart tarball.
+func (r *Resource) getProvenance(ctx context.Context, cr v1alpha1.Chart) ([]byte, error) {
+	credentials, err := r.getChartCredentials(ctx, cr)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	resp, err := r.getChartFile(ctx, key.TarballURL(cr)+provenanceSuffix, credentials)
+	if IsPullChartNotFound(err) {
+		return nil, microerror.Maskf(signatureInvalidError, "chart %#q has no provenance", key.TarballURL(cr))
+	} else if IsPullChartFailed(err) || IsPullChartTimeout(err) || IsPullChartUnauthorized(err) {
+		return nil, microerror.Maskf(signatureInvalidError, "pulling provenance of chart %#q failed", key.TarballURL(cr))
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	defer resp.Body.Close()
+
+	prov, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxProvenanceSize))
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return prov, nil
+}
+
+func isValidVerifyPolicy(policy string) bool {
+	switch policy {
+	case VerifyPolicyEnforce, VerifyPolicyOff, VerifyPolicyWarn:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,392 @@
+package release
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/spf13/afero"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/pkg/oci"
+)
+
+func Test_verifyChart(t *testing.T) {
+	tarball := []byte("chart tarball")
+
+	signer, err := openpgp.NewEntity("Giant Swarm", "", "dev@giantswarm.io", nil)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	var keyring bytes.Buffer
+	{
+		w, err := armor.Encode(&keyring, openpgp.PublicKeyType, nil)
+		if err != nil {
+			t.Fatalf("error == %#v, want nil", err)
+		}
+		err = signer.Serialize(w)
+		if err != nil {
+			t.Fatalf("error == %#v, want nil", err)
+		}
+		w.Close()
+	}
+
+	var prov bytes.Buffer
+	{
+		sum := sha256.Sum256(tarball)
+		w, err := clearsign.Encode(&prov, signer.PrivateKey, nil)
+		if err != nil {
+			t.Fatalf("error == %#v, want nil", err)
+		}
+		_, err = fmt.Fprintf(w, "name: prometheus\nversion: 1.0.0\n\n...\nfiles:\n  prometheus-1.0.0.tgz: sha256:%s\n", hex.EncodeToString(sum[:]))
+		if err != nil {
+			t.Fatalf("error == %#v, want nil", err)
+		}
+		w.Close()
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/signed/prometheus-1.0.0.tgz.prov" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(prov.Bytes())
+	}))
+	defer server.Close()
+
+	keyringSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      keyringName,
+			Namespace: keyringNamespace,
+		},
+		Data: map[string][]byte{
+			keyringKey: keyring.Bytes(),
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		tarballURL    string
+		defaultPolicy string
+		objs          []runtime.Object
+		errorMatcher  func(error) bool
+	}{
+		{
+			name:          "case 0: policy off",
+			tarballURL:    server.URL + "/unsigned/prometheus-1.0.0.tgz",
+			defaultPolicy: VerifyPolicyOff,
+		},
+		{
+			name: "case 1: signed chart with enforce policy",
+			annotations: map[string]string{
+				annotation.VerifyPolicy: VerifyPolicyEnforce,
+			},
+			tarballURL:    server.URL + "/signed/prometheus-1.0.0.tgz",
+			defaultPolicy: VerifyPolicyOff,
+			objs:          []runtime.Object{keyringSecret},
+		},
+		{
+			name:          "case 2: unsigned chart with enforce policy",
+			tarballURL:    server.URL + "/unsigned/prometheus-1.0.0.tgz",
+			defaultPolicy: VerifyPolicyEnforce,
+			objs:          []runtime.Object{keyringSecret},
+			errorMatcher:  IsSignatureInvalid,
+		},
+		{
+			name: "case 3: unsigned chart with warn policy",
+			annotations: map[string]string{
+				annotation.VerifyPolicy: VerifyPolicyWarn,
+			},
+			tarballURL:    server.URL + "/unsigned/prometheus-1.0.0.tgz",
+			defaultPolicy: VerifyPolicyEnforce,
+			objs:          []runtime.Object{keyringSecret},
+		},
+		{
+			name:          "case 4: enforce policy of release namespace",
+			tarballURL:    server.URL + "/unsigned/prometheus-1.0.0.tgz",
+			defaultPolicy: VerifyPolicyOff,
+			objs: []runtime.Object{
+				keyringSecret,
+				&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{
+						Annotations: map[string]string{
+							annotation.VerifyPolicy: VerifyPolicyEnforce,
+						},
+						Name: "monitoring",
+					},
+				},
+			},
+			errorMatcher: IsSignatureInvalid,
+		},
+		{
+			name: "case 5: signed chart without keyring",
+			annotations: map[string]string{
+				annotation.VerifyPolicy: VerifyPolicyEnforce,
+			},
+			tarballURL:    server.URL + "/signed/prometheus-1.0.0.tgz",
+			defaultPolicy: VerifyPolicyOff,
+			errorMatcher:  IsSignatureInvalid,
+		},
+		{
+			name: "case 6: invalid policy",
+			annotations: map[string]string{
+				annotation.VerifyPolicy: "enforced",
+			},
+			tarballURL:    server.URL + "/signed/prometheus-1.0.0.tgz",
+			defaultPolicy: VerifyPolicyOff,
+			objs:          []runtime.Object{keyringSecret},
+			errorMatcher:  IsSignatureInvalid,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			fs := afero.NewMemMapFs()
+			err := afero.WriteFile(fs, "/tmp/prometheus.tgz", tarball, 0600)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			cr := v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: tc.annotations,
+					Name:        "prometheus",
+					Namespace:   "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Namespace:  "monitoring",
+					TarballURL: tc.tarballURL,
+				},
+			}
+
+			r := &Resource{
+				eventRecorder: record.NewFakeRecorder(10),
+				fs:            fs,
+				k8sClient:     fake.NewSimpleClientset(tc.objs...),
+				logger:        microloggertest.New(),
+
+				httpClientTimeout: 5 * time.Second,
+				verifyPolicy:      tc.defaultPolicy,
+			}
+
+			err = r.verifyChart(context.Background(), cr, "/tmp/prometheus.tgz")
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+		})
+	}
+}
+
+func Test_verifyChart_cosign(t *testing.T) {
+	tarball := []byte("chart tarball")
+	tarballSum := sha256.Sum256(tarball)
+	layerDigest := "sha256:" + hex.EncodeToString(tarballSum[:])
+
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	var cosignKeys []byte
+	{
+		der, err := x509.MarshalPKIXPublicKey(signer.Public())
+		if err != nil {
+			t.Fatalf("error == %#v, want nil", err)
+		}
+		cosignKeys = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+
+	m, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"layers": []map[string]string{
+			{"mediaType": "application/vnd.cncf.helm.chart.content.v1.tar+gzip", "digest": layerDigest},
+		},
+	})
+	manifestSum := sha256.Sum256(m)
+	manifestDigest := "sha256:" + hex.EncodeToString(manifestSum[:])
+
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"giantswarm/prometheus"},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`, manifestDigest))
+	payloadSum := sha256.Sum256(payload)
+	payloadDigest := "sha256:" + hex.EncodeToString(payloadSum[:])
+
+	newSignatureManifest := func(key *ecdsa.PrivateKey) []byte {
+		signature, err := ecdsa.SignASN1(rand.Reader, key, payloadSum[:])
+		if err != nil {
+			t.Fatalf("error == %#v, want nil", err)
+		}
+
+		m, _ := json.Marshal(map[string]interface{}{
+			"schemaVersion": 2,
+			"layers": []map[string]interface{}{
+				{
+					"mediaType": "application/vnd.dev.cosign.simplesigning.v1+json",
+					"digest":    payloadDigest,
+					"annotations": map[string]string{
+						"dev.cosignproject.cosign/signature": base64.StdEncoding.EncodeToString(signature),
+					},
+				},
+			},
+		})
+
+		return m
+	}
+
+	signatures := map[string][]byte{
+		"signed":       newSignatureManifest(signer),
+		"signed-other": newSignatureManifest(other),
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for repository, signatureManifest := range signatures {
+			switch r.URL.Path {
+			case "/v2/" + repository + "/manifests/1.0.0":
+				_, _ = w.Write(m)
+				return
+			case "/v2/" + repository + "/manifests/sha256-" + hex.EncodeToString(manifestSum[:]) + ".sig":
+				_, _ = w.Write(signatureManifest)
+				return
+			case "/v2/" + repository + "/blobs/" + payloadDigest:
+				_, _ = w.Write(payload)
+				return
+			}
+		}
+		if r.URL.Path == "/v2/unsigned/manifests/1.0.0" {
+			_, _ = w.Write(m)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	keyringSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      keyringName,
+			Namespace: keyringNamespace,
+		},
+		Data: map[string][]byte{
+			cosignKeysKey: cosignKeys,
+		},
+	}
+
+	registry := server.Listener.Addr().String()
+
+	testCases := []struct {
+		name         string
+		repository   string
+		tarball      []byte
+		errorMatcher func(error) bool
+	}{
+		{
+			name:       "case 0: signed with trusted key",
+			repository: "signed",
+			tarball:    tarball,
+		},
+		{
+			name:         "case 1: signed with other key",
+			repository:   "signed-other",
+			tarball:      tarball,
+			errorMatcher: IsSignatureInvalid,
+		},
+		{
+			name:         "case 2: not signed",
+			repository:   "unsigned",
+			tarball:      tarball,
+			errorMatcher: IsSignatureInvalid,
+		},
+		{
+			name:         "case 3: tarball is not the signed chart layer",
+			repository:   "signed",
+			tarball:      []byte("other chart tarball"),
+			errorMatcher: IsSignatureInvalid,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			fs := afero.NewMemMapFs()
+			err := afero.WriteFile(fs, "/tmp/prometheus.tgz", tc.tarball, 0600)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			ociClient, err := oci.New(oci.Config{
+				Fs:         fs,
+				HTTPClient: server.Client(),
+			})
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			cr := v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "prometheus",
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Namespace:  "monitoring",
+					TarballURL: fmt.Sprintf("oci://%s/%s:1.0.0", registry, tc.repository),
+				},
+			}
+
+			r := &Resource{
+				eventRecorder: record.NewFakeRecorder(10),
+				fs:            fs,
+				k8sClient:     fake.NewSimpleClientset(keyringSecret),
+				logger:        microloggertest.New(),
+				ociClient:     ociClient,
+
+				httpClientTimeout: 5 * time.Second,
+				verifyPolicy:      VerifyPolicyEnforce,
+			}
+
+			err = r.verifyChart(context.Background(), cr, "/tmp/prometheus.tgz")
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+		})
+	}
+}
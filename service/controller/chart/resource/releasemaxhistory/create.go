@@ -2,25 +2,28 @@ package releasemaxhistory
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
-	"strings"
 	"time"
 
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
 	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
 	"github.com/giantswarm/microerror"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/giantswarm/chart-operator/v2/pkg/project"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
 )
 
-// EnsureCreated checks if the helm release has failed the max number of
-// attempts. If so we delete the oldest revision if it is over 1 minute old.
-// So we still retry the update but at a reduced rate. This is needed because
-// the max history setting for Helm update does not count failures.
+// EnsureCreated deletes the oldest revisions of the helm release above the
+// max history of the chart CR. It also checks if the helm release has failed
+// the max number of attempts. If so we delete the oldest failed revision if it
+// is over 1 minute old. So we still retry the update but at a reduced rate.
+// This is needed because the max history setting for Helm update does not
+// count failures.
 func (r *Resource) EnsureCreated(ctx context.Context, obj interface{}) error {
 	cr, err := key.ToCustomResource(obj)
 	if err != nil {
@@ -31,19 +34,25 @@ func (r *Resource) EnsureCreated(ctx context.Context, obj interface{}) error {
 		return microerror.Mask(err)
 	}
 
-	r.logger.Debugf(ctx, "finding out if release %#q in namespace %#q has failed max attempts", key.ReleaseName(cr), key.Namespace(cr))
-
 	history, err := r.getReleaseHistory(ctx, key.Namespace(cr), key.ReleaseName(cr))
 	if err != nil {
 		return microerror.Mask(err)
 	}
 
+	err = r.pruneHistory(ctx, cr, history)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	r.logger.Debugf(ctx, "finding out if release %#q in namespace %#q has failed max attempts", key.ReleaseName(cr), key.Namespace(cr))
+
 	failedMaxAttempts, err := isReleaseFailedMaxAttempts(ctx, history)
 	if err != nil {
 		return microerror.Mask(err)
 	}
 
 	cc.Status.Release.FailedMaxAttempts = failedMaxAttempts
+
 	if !failedMaxAttempts {
 		r.logger.Debugf(ctx, "release %#q has not failed max attempts", key.ReleaseName(cr))
 		return nil
@@ -51,13 +60,16 @@ func (r *Resource) EnsureCreated(ctx context.Context, obj interface{}) error {
 
 	r.logger.Debugf(ctx, "release %#q has failed max attempts", key.ReleaseName(cr))
 
-	secretDeleted, err := r.deleteFailedRelease(ctx, key.Namespace(cr), key.ReleaseName(cr), history)
+	revisionDeleted, err := r.deleteFailedRelease(ctx, key.Namespace(cr), key.ReleaseName(cr), history)
 	if err != nil {
 		return microerror.Mask(err)
 	}
-	if secretDeleted {
-		// We deleted a failed release secret. So we can try to update the release again.
+
+	if revisionDeleted {
+		// We deleted a failed release revision. So we can try to update the release again.
 		cc.Status.Release.FailedMaxAttempts = false
+	} else {
+		r.eventRecorder.Eventf(&cr, corev1.EventTypeWarning, "FailedMaxAttempts", "release %#q has failed %d times, retrying at a reduced rate", key.ReleaseName(cr), project.ReleaseFailedMaxAttempts)
 	}
 
 	return nil
@@ -68,36 +80,26 @@ func (r *Resource) deleteFailedRelease(ctx context.Context, namespace, releaseNa
 		// Fall through
 		return false, nil
 	}
+
 	rev := history[project.ReleaseFailedMaxAttempts-1]
+	if rev.Status != helmclient.StatusFailed {
+		return false, microerror.Maskf(executionFailedError, "expected revision %d to be %#q got %#q", rev.Revision, helmclient.StatusFailed, rev.Status)
+	}
 
 	r.logger.Debugf(ctx, "deleting failed revision %d for release %#q", rev.Revision, releaseName)
 
-	selectors := []string{
-		"owner=helm",
-		"status=failed",
-		fmt.Sprintf("%s=%s", "name", releaseName),
-		fmt.Sprintf("%s=%d", "version", rev.Revision),
-	}
-	lo := metav1.ListOptions{
-		LabelSelector: strings.Join(selectors, ","),
+	if time.Since(rev.LastDeployed) < time.Minute {
+		r.logger.Debugf(ctx, "revision %d for release %#q is < 1 minutes old", rev.Revision, releaseName)
+		return false, nil
 	}
-	secrets, err := r.k8sClient.CoreV1().Secrets(namespace).List(ctx, lo)
+
+	s, err := r.helmStorage.Releases(namespace)
 	if err != nil {
 		return false, microerror.Mask(err)
 	}
-	if len(secrets.Items) != 1 {
-		return false, microerror.Maskf(executionFailedError, "expected 1 release secret got %d", len(secrets.Items))
-	}
-
-	secret := secrets.Items[0]
-	diff := time.Since(secret.CreationTimestamp.Time)
-	if diff.Minutes() < 1 {
-		r.logger.Debugf(ctx, "revision %d for release %#q is < 1 minutes old", rev.Revision, releaseName)
-		return false, nil
-	}
 
-	err = r.k8sClient.CoreV1().Secrets(secret.Namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{})
-	if apierrors.IsNotFound(err) {
+	_, err = s.Delete(releaseName, rev.Revision)
+	if errors.Is(err, driver.ErrReleaseNotFound) {
 		r.logger.Debugf(ctx, "already deleted revision %d for release %#q", rev.Revision, releaseName)
 		return true, nil
 	} else if err != nil {
@@ -109,6 +111,61 @@ func (r *Resource) deleteFailedRelease(ctx context.Context, namespace, releaseNa
 	return true, nil
 }
 
+// pruneHistory deletes the oldest revisions of the release above the max
+// history of the chart CR. Failed, superseded and uninstalled revisions are
+// deleted. The deployed revision and pending revisions are kept. At least
+// project.ReleaseFailedMaxAttempts revisions are kept so repeated failures
+// are still detected.
+func (r *Resource) pruneHistory(ctx context.Context, cr v1alpha1.Chart, history []helmclient.ReleaseHistory) error {
+	maxHistory, err := key.MaxHistory(cr)
+	if key.IsInvalidMaxHistoryError(err) {
+		r.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("not pruning history of release %#q", key.ReleaseName(cr)), "stack", microerror.JSON(err))
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	if maxHistory == 0 {
+		return nil
+	}
+	if maxHistory < project.ReleaseFailedMaxAttempts {
+		maxHistory = project.ReleaseFailedMaxAttempts
+	}
+	if len(history) <= maxHistory {
+		r.logger.Debugf(ctx, "release %#q has %d revisions, max history is %d", key.ReleaseName(cr), len(history), maxHistory)
+		return nil
+	}
+
+	s, err := r.helmStorage.Releases(key.Namespace(cr))
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	var deleted int
+
+	for _, rev := range history[maxHistory:] {
+		if rev.Status == helmclient.StatusDeployed || helmclient.ReleaseTransitionStatuses[rev.Status] {
+			continue
+		}
+
+		_, err = s.Delete(key.ReleaseName(cr), rev.Revision)
+		if errors.Is(err, driver.ErrReleaseNotFound) {
+			continue
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+
+		r.logger.Debugf(ctx, "deleted %#q revision %d for release %#q above max history %d", rev.Status, rev.Revision, key.ReleaseName(cr), maxHistory)
+		deleted++
+	}
+
+	if deleted > 0 {
+		r.eventRecorder.Eventf(&cr, corev1.EventTypeNormal, "HistoryPruned", "deleted %d revisions of release %#q above max history %d", deleted, key.ReleaseName(cr), maxHistory)
+	}
+
+	return nil
+}
+
 func (r *Resource) getReleaseHistory(ctx context.Context, namespace, releaseName string) ([]helmclient.ReleaseHistory, error) {
 	history, err := r.helmClient.GetReleaseHistory(ctx, namespace, releaseName)
 	if helmclient.IsReleaseNotFound(err) {
@@ -0,0 +1,154 @@
+package releasemaxhistory
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
+	"github.com/giantswarm/helmclient/v4/pkg/helmclienttest"
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/google/go-cmp/cmp"
+	helmrelease "helm.sh/helm/v3/pkg/release"
+	helmtime "helm.sh/helm/v3/pkg/time"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/service/helmstorage"
+)
+
+func Test_ReleaseMaxHistory_pruneHistory(t *testing.T) {
+	testCases := []struct {
+		name              string
+		maxHistory        string
+		statuses          []string
+		expectedRevisions []int
+	}{
+		{
+			name:              "case 0: no max history",
+			statuses:          []string{"superseded", "superseded", "superseded", "superseded", "superseded", "superseded", "deployed"},
+			expectedRevisions: []int{1, 2, 3, 4, 5, 6, 7},
+		},
+		{
+			name:              "case 1: history below max history",
+			maxHistory:        "10",
+			statuses:          []string{"superseded", "superseded", "deployed"},
+			expectedRevisions: []int{1, 2, 3},
+		},
+		{
+			name:              "case 2: superseded and failed revisions above max history are deleted",
+			maxHistory:        "6",
+			statuses:          []string{"superseded", "failed", "superseded", "superseded", "superseded", "superseded", "superseded", "superseded", "deployed"},
+			expectedRevisions: []int{4, 5, 6, 7, 8, 9},
+		},
+		{
+			name:              "case 3: deployed revision above max history is kept",
+			maxHistory:        "5",
+			statuses:          []string{"superseded", "deployed", "failed", "failed", "failed", "failed", "failed"},
+			expectedRevisions: []int{2, 3, 4, 5, 6, 7},
+		},
+		{
+			name:              "case 4: max history below failed max attempts",
+			maxHistory:        "2",
+			statuses:          []string{"superseded", "superseded", "superseded", "superseded", "superseded", "superseded", "deployed"},
+			expectedRevisions: []int{3, 4, 5, 6, 7},
+		},
+		{
+			name:              "case 5: invalid max history",
+			maxHistory:        "ten",
+			statuses:          []string{"superseded", "superseded", "superseded", "superseded", "superseded", "superseded", "deployed"},
+			expectedRevisions: []int{1, 2, 3, 4, 5, 6, 7},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			helmStorage, err := helmstorage.New(helmstorage.Config{
+				K8sClient: k8sfake.NewSimpleClientset(),
+			})
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			s, err := helmStorage.Releases("default")
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			var history []helmclient.ReleaseHistory
+			for i, status := range tc.statuses {
+				rel := &helmrelease.Release{
+					Name: "test-app",
+					Info: &helmrelease.Info{
+						LastDeployed: helmtime.Time{Time: time.Now()},
+						Status:       helmrelease.Status(status),
+					},
+					Namespace: "default",
+					Version:   i + 1,
+				}
+
+				err := s.Create(rel)
+				if err != nil {
+					t.Fatalf("error == %#v, want nil", err)
+				}
+
+				history = append([]helmclient.ReleaseHistory{{Name: "test-app", Revision: i + 1, Status: status}}, history...)
+			}
+
+			c := Config{
+				EventRecorder: &record.FakeRecorder{},
+				HelmClient:    helmclienttest.New(helmclienttest.Config{}),
+				HelmStorage:   helmStorage,
+				Logger:        microloggertest.New(),
+			}
+
+			r, err := New(c)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			cr := v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-app",
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name:      "test-app",
+					Namespace: "default",
+				},
+			}
+			if tc.maxHistory != "" {
+				cr.Annotations = map[string]string{
+					annotation.MaxHistory: tc.maxHistory,
+				}
+			}
+
+			err = r.pruneHistory(context.Background(), cr, history)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			releases, err := s.History("test-app")
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			var revisions []int
+			for _, rel := range releases {
+				revisions = append(revisions, rel.Version)
+			}
+			sort.Ints(revisions)
+
+			if !cmp.Equal(revisions, tc.expectedRevisions) {
+				t.Fatalf("want matching revisions \n %s", cmp.Diff(revisions, tc.expectedRevisions))
+			}
+		})
+	}
+}
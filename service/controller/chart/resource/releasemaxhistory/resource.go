@@ -4,7 +4,9 @@ import (
 	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/micrologger"
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/giantswarm/chart-operator/v2/service/helmstorage"
 )
 
 const (
@@ -13,35 +15,41 @@ const (
 
 type Config struct {
 	// Dependencies.
-	HelmClient helmclient.Interface
-	K8sClient  kubernetes.Interface
-	Logger     micrologger.Logger
+	EventRecorder record.EventRecorder
+	HelmClient    helmclient.Interface
+	HelmStorage   *helmstorage.Storage
+	Logger        micrologger.Logger
 }
 
 type Resource struct {
 	// Dependencies.
-	helmClient helmclient.Interface
-	k8sClient  kubernetes.Interface
-	logger     micrologger.Logger
+	eventRecorder record.EventRecorder
+	helmClient    helmclient.Interface
+	helmStorage   *helmstorage.Storage
+	logger        micrologger.Logger
 }
 
 // New creates a new configured releasemaxhistory resource.
 func New(config Config) (*Resource, error) {
 	// Dependencies.
+	if config.EventRecorder == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.EventRecorder must not be empty", config)
+	}
 	if config.HelmClient == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.HelmClient must not be empty", config)
 	}
-	if config.K8sClient == nil {
-		return nil, microerror.Maskf(invalidConfigError, "%T.K8sClient must not be empty", config)
+	if config.HelmStorage == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.HelmStorage must not be empty", config)
 	}
 	if config.Logger == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
 	}
 
 	r := &Resource{
-		helmClient: config.HelmClient,
-		k8sClient:  config.K8sClient,
-		logger:     config.Logger,
+		eventRecorder: config.EventRecorder,
+		helmClient:    config.HelmClient,
+		helmStorage:   config.HelmStorage,
+		logger:        config.Logger,
 	}
 
 	return r, nil
@@ -0,0 +1,181 @@
+package status
+
+import (
+	"context"
+	"strings"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
+	"github.com/giantswarm/microerror"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
+)
+
+const (
+	conditionChartPulled    = "ChartPulled"
+	conditionCordoned       = "Cordoned"
+	conditionDrifted        = "Drifted"
+	conditionReady          = "Ready"
+	conditionReconciling    = "Reconciling"
+	conditionStalled        = "Stalled"
+	conditionValuesResolved = "ValuesResolved"
+)
+
+const (
+	reasonChartPulled     = "ChartPulled"
+	reasonChartPullFailed = "ChartPullFailed"
+	reasonDrifted         = "Drifted"
+	reasonNotCordoned     = "NotCordoned"
+	reasonNotDrifted      = "NotDrifted"
+	reasonUnknown         = "Unknown"
+	reasonValuesResolved  = "ValuesResolved"
+	reasonValuesFailed    = "ValuesNotResolved"
+)
+
+// desiredConditions computes the conditions for the given chart CR status.
+// They are merged into the conditions stored in the chart CR so the last
+// transition time only changes when the status of a condition changes.
+func desiredConditions(stored []metav1.Condition, cr v1alpha1.Chart, cc *controllercontext.Context, status v1alpha1.ChartStatus) []metav1.Condition {
+	conditions := make([]metav1.Condition, len(stored))
+	copy(conditions, stored)
+
+	for _, c := range newConditions(cr, cc, status) {
+		meta.SetStatusCondition(&conditions, c)
+	}
+
+	return conditions
+}
+
+// conditionsEqual asseses the equality of conditions. The last transition
+// time is not compared as it only changes along with the status.
+func conditionsEqual(a, b []metav1.Condition) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, c := range a {
+		other := meta.FindStatusCondition(b, c.Type)
+		if other == nil {
+			return false
+		}
+
+		if c.Status != other.Status || c.Reason != other.Reason || c.Message != other.Message || c.ObservedGeneration != other.ObservedGeneration {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getConditions returns the conditions stored in the chart CR. They are not
+// part of the typed chart CR status so they are read with the dynamic client.
+func (r *Resource) getConditions(ctx context.Context, cr v1alpha1.Chart) ([]metav1.Condition, error) {
+	obj, err := r.dynamicClient.Resource(chartResource).Namespace(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	stored, found, err := unstructured.NestedMap(obj.Object, "status")
+	if err != nil {
+		return nil, microerror.Mask(err)
+	} else if !found {
+		return nil, nil
+	}
+
+	var status chartStatus
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(stored, &status)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return status.Conditions, nil
+}
+
+func newConditions(cr v1alpha1.Chart, cc *controllercontext.Context, status v1alpha1.ChartStatus) []metav1.Condition {
+	releaseStatus := status.Release.Status
+	reason := conditionReason(releaseStatus)
+
+	newCondition := func(conditionType string, isTrue bool, reason string) metav1.Condition {
+		c := metav1.Condition{
+			Type:               conditionType,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: cr.Generation,
+			Reason:             reason,
+			Message:            status.Reason,
+		}
+		if isTrue {
+			c.Status = metav1.ConditionTrue
+		}
+
+		return c
+	}
+
+	// Waiting for dependencies is progress rather than a failure.
+	waiting := releaseStatus == releaseStatusWaitingForDependencies
+	stalled := !waiting && (cc.Status.Reason != "" || releaseStatus == helmclient.StatusFailed || cc.Status.Release.FailedMaxAttempts)
+
+	conditions := []metav1.Condition{
+		newCondition(conditionReady, releaseStatus == helmclient.StatusDeployed, reason),
+		newCondition(conditionReconciling, waiting || strings.HasPrefix(releaseStatus, "pending-"), reason),
+		newCondition(conditionStalled, stalled, reason),
+	}
+
+	if cc.Status.ValuesResolveFailed {
+		conditions = append(conditions, newCondition(conditionValuesResolved, false, reasonValuesFailed))
+	} else {
+		c := newCondition(conditionValuesResolved, true, reasonValuesResolved)
+		if cc.Status.ValuesProvenance != "" {
+			c.Message = cc.Status.ValuesProvenance
+		}
+		conditions = append(conditions, c)
+	}
+
+	if cc.Status.ValuesResolveFailed {
+		// The chart is pulled after the values are resolved so we don't
+		// know whether pulling it would succeed.
+		c := newCondition(conditionChartPulled, false, reasonUnknown)
+		c.Status = metav1.ConditionUnknown
+		conditions = append(conditions, c)
+	} else if cc.Status.ChartPullFailed {
+		conditions = append(conditions, newCondition(conditionChartPulled, false, reasonChartPullFailed))
+	} else {
+		conditions = append(conditions, newCondition(conditionChartPulled, true, reasonChartPulled))
+	}
+
+	if releaseStatus == releaseStatusCordoned {
+		conditions = append(conditions, newCondition(conditionCordoned, true, reason))
+	} else {
+		conditions = append(conditions, newCondition(conditionCordoned, false, reasonNotCordoned))
+	}
+
+	if len(cc.Status.Release.DriftedObjects) > 0 {
+		conditions = append(conditions, newCondition(conditionDrifted, true, reasonDrifted))
+	} else {
+		conditions = append(conditions, newCondition(conditionDrifted, false, reasonNotDrifted))
+	}
+
+	return conditions
+}
+
+// conditionReason converts the release status into a CamelCase condition
+// reason e.g. `pending-upgrade` becomes `PendingUpgrade`.
+func conditionReason(releaseStatus string) string {
+	var reason strings.Builder
+
+	for _, word := range strings.FieldsFunc(releaseStatus, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	}) {
+		word = strings.ToLower(word)
+		reason.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+
+	if reason.Len() == 0 || !('A' <= reason.String()[0] && reason.String()[0] <= 'Z') {
+		return reasonUnknown
+	}
+
+	return reason.String()
+}
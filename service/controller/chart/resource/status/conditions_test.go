@@ -0,0 +1,330 @@
+package status
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
+)
+
+func Test_StatusResource_desiredConditions(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		cc                    controllercontext.Context
+		status                v1alpha1.ChartStatus
+		expectedConditions    map[string]metav1.ConditionStatus
+		expectedReason        string
+		expectedValuesMessage string
+	}{
+		{
+			name: "case 0: deployed",
+			status: v1alpha1.ChartStatus{
+				Release: v1alpha1.ChartStatusRelease{
+					Status: "deployed",
+				},
+			},
+			expectedConditions: map[string]metav1.ConditionStatus{
+				conditionChartPulled:    metav1.ConditionTrue,
+				conditionCordoned:       metav1.ConditionFalse,
+				conditionDrifted:        metav1.ConditionFalse,
+				conditionReady:          metav1.ConditionTrue,
+				conditionReconciling:    metav1.ConditionFalse,
+				conditionStalled:        metav1.ConditionFalse,
+				conditionValuesResolved: metav1.ConditionTrue,
+			},
+			expectedReason: "Deployed",
+		},
+		{
+			name: "case 1: pending upgrade",
+			status: v1alpha1.ChartStatus{
+				Release: v1alpha1.ChartStatusRelease{
+					Status: "pending-upgrade",
+				},
+			},
+			expectedConditions: map[string]metav1.ConditionStatus{
+				conditionChartPulled:    metav1.ConditionTrue,
+				conditionCordoned:       metav1.ConditionFalse,
+				conditionDrifted:        metav1.ConditionFalse,
+				conditionReady:          metav1.ConditionFalse,
+				conditionReconciling:    metav1.ConditionTrue,
+				conditionStalled:        metav1.ConditionFalse,
+				conditionValuesResolved: metav1.ConditionTrue,
+			},
+			expectedReason: "PendingUpgrade",
+		},
+		{
+			name: "case 2: chart pull failed",
+			cc: controllercontext.Context{
+				Status: controllercontext.Status{
+					ChartPullFailed: true,
+					Reason:          "chart `prometheus` not found",
+					Release: controllercontext.Release{
+						Status: "not-installed",
+					},
+				},
+			},
+			status: v1alpha1.ChartStatus{
+				Reason: "chart `prometheus` not found",
+				Release: v1alpha1.ChartStatusRelease{
+					Status: "not-installed",
+				},
+			},
+			expectedConditions: map[string]metav1.ConditionStatus{
+				conditionChartPulled:    metav1.ConditionFalse,
+				conditionCordoned:       metav1.ConditionFalse,
+				conditionDrifted:        metav1.ConditionFalse,
+				conditionReady:          metav1.ConditionFalse,
+				conditionReconciling:    metav1.ConditionFalse,
+				conditionStalled:        metav1.ConditionTrue,
+				conditionValuesResolved: metav1.ConditionTrue,
+			},
+			expectedReason: "NotInstalled",
+		},
+		{
+			name: "case 3: values not resolved",
+			cc: controllercontext.Context{
+				Status: controllercontext.Status{
+					Reason: "values not resolved",
+					Release: controllercontext.Release{
+						Status: "values-not-resolved",
+					},
+					ValuesResolveFailed: true,
+				},
+			},
+			status: v1alpha1.ChartStatus{
+				Reason: "values not resolved",
+				Release: v1alpha1.ChartStatusRelease{
+					Status: "values-not-resolved",
+				},
+			},
+			expectedConditions: map[string]metav1.ConditionStatus{
+				conditionChartPulled:    metav1.ConditionUnknown,
+				conditionCordoned:       metav1.ConditionFalse,
+				conditionDrifted:        metav1.ConditionFalse,
+				conditionReady:          metav1.ConditionFalse,
+				conditionReconciling:    metav1.ConditionFalse,
+				conditionStalled:        metav1.ConditionTrue,
+				conditionValuesResolved: metav1.ConditionFalse,
+			},
+			expectedReason: "ValuesNotResolved",
+		},
+		{
+			name: "case 4: cordoned",
+			status: v1alpha1.ChartStatus{
+				Reason: "testing upgrade",
+				Release: v1alpha1.ChartStatusRelease{
+					Status: releaseStatusCordoned,
+				},
+			},
+			expectedConditions: map[string]metav1.ConditionStatus{
+				conditionChartPulled:    metav1.ConditionTrue,
+				conditionCordoned:       metav1.ConditionTrue,
+				conditionDrifted:        metav1.ConditionFalse,
+				conditionReady:          metav1.ConditionFalse,
+				conditionReconciling:    metav1.ConditionFalse,
+				conditionStalled:        metav1.ConditionFalse,
+				conditionValuesResolved: metav1.ConditionTrue,
+			},
+			expectedReason: "Cordoned",
+		},
+		{
+			name: "case 5: failed max attempts",
+			cc: controllercontext.Context{
+				Status: controllercontext.Status{
+					Release: controllercontext.Release{
+						FailedMaxAttempts: true,
+					},
+				},
+			},
+			status: v1alpha1.ChartStatus{
+				Release: v1alpha1.ChartStatusRelease{
+					Status: "failed",
+				},
+			},
+			expectedConditions: map[string]metav1.ConditionStatus{
+				conditionChartPulled:    metav1.ConditionTrue,
+				conditionCordoned:       metav1.ConditionFalse,
+				conditionDrifted:        metav1.ConditionFalse,
+				conditionReady:          metav1.ConditionFalse,
+				conditionReconciling:    metav1.ConditionFalse,
+				conditionStalled:        metav1.ConditionTrue,
+				conditionValuesResolved: metav1.ConditionTrue,
+			},
+			expectedReason: "Failed",
+		},
+		{
+			name: "case 6: waiting for dependencies",
+			cc: controllercontext.Context{
+				Status: controllercontext.Status{
+					Reason: "waiting for dependencies: `cilium` in status `pending-install`",
+					Release: controllercontext.Release{
+						Status: releaseStatusWaitingForDependencies,
+					},
+				},
+			},
+			status: v1alpha1.ChartStatus{
+				Reason: "waiting for dependencies: `cilium` in status `pending-install`",
+				Release: v1alpha1.ChartStatusRelease{
+					Status: releaseStatusWaitingForDependencies,
+				},
+			},
+			expectedConditions: map[string]metav1.ConditionStatus{
+				conditionChartPulled:    metav1.ConditionTrue,
+				conditionCordoned:       metav1.ConditionFalse,
+				conditionDrifted:        metav1.ConditionFalse,
+				conditionReady:          metav1.ConditionFalse,
+				conditionReconciling:    metav1.ConditionTrue,
+				conditionStalled:        metav1.ConditionFalse,
+				conditionValuesResolved: metav1.ConditionTrue,
+			},
+			expectedReason: "WaitingForDependencies",
+		},
+		{
+			name: "case 7: deployed with drifted objects",
+			cc: controllercontext.Context{
+				Status: controllercontext.Status{
+					Release: controllercontext.Release{
+						DriftedObjects: []string{
+							"apps/v1 Deployment test-app (spec.replicas changed)",
+						},
+					},
+				},
+			},
+			status: v1alpha1.ChartStatus{
+				Reason: "objects drifted: apps/v1 Deployment test-app (spec.replicas changed)",
+				Release: v1alpha1.ChartStatusRelease{
+					Status: "deployed",
+				},
+			},
+			expectedConditions: map[string]metav1.ConditionStatus{
+				conditionChartPulled:    metav1.ConditionTrue,
+				conditionCordoned:       metav1.ConditionFalse,
+				conditionDrifted:        metav1.ConditionTrue,
+				conditionReady:          metav1.ConditionTrue,
+				conditionReconciling:    metav1.ConditionFalse,
+				conditionStalled:        metav1.ConditionFalse,
+				conditionValuesResolved: metav1.ConditionTrue,
+			},
+			expectedReason: "Deployed",
+		},
+		{
+			name: "case 8: deployed with values provenance",
+			cc: controllercontext.Context{
+				Status: controllercontext.Status{
+					ValuesProvenance: "values set by image=[configmap giantswarm/prometheus-values]",
+				},
+			},
+			status: v1alpha1.ChartStatus{
+				Release: v1alpha1.ChartStatusRelease{
+					Status: "deployed",
+				},
+			},
+			expectedConditions: map[string]metav1.ConditionStatus{
+				conditionChartPulled:    metav1.ConditionTrue,
+				conditionCordoned:       metav1.ConditionFalse,
+				conditionDrifted:        metav1.ConditionFalse,
+				conditionReady:          metav1.ConditionTrue,
+				conditionReconciling:    metav1.ConditionFalse,
+				conditionStalled:        metav1.ConditionFalse,
+				conditionValuesResolved: metav1.ConditionTrue,
+			},
+			expectedReason:        "Deployed",
+			expectedValuesMessage: "values set by image=[configmap giantswarm/prometheus-values]",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			cr := v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Generation: 3,
+					UID:        "prometheus",
+				},
+			}
+
+			conditions := desiredConditions(nil, cr, &tc.cc, tc.status)
+
+			result := map[string]metav1.ConditionStatus{}
+			for _, c := range conditions {
+				if c.ObservedGeneration != cr.Generation {
+					t.Fatalf("observed generation == %d, want %d", c.ObservedGeneration, cr.Generation)
+				}
+				if c.LastTransitionTime.IsZero() {
+					t.Fatalf("condition %#q has no last transition time", c.Type)
+				}
+				result[c.Type] = c.Status
+			}
+
+			if !cmp.Equal(result, tc.expectedConditions) {
+				t.Fatalf("want matching conditions \n %s", cmp.Diff(result, tc.expectedConditions))
+			}
+
+			for _, c := range conditions {
+				if c.Type == conditionReady && c.Reason != tc.expectedReason {
+					t.Fatalf("reason == %#q, want %#q", c.Reason, tc.expectedReason)
+				}
+				if tc.expectedValuesMessage != "" && c.Type == conditionValuesResolved && c.Message != tc.expectedValuesMessage {
+					t.Fatalf("values message == %#q, want %#q", c.Message, tc.expectedValuesMessage)
+				}
+			}
+		})
+	}
+}
+
+func Test_StatusResource_desiredConditions_lastTransitionTime(t *testing.T) {
+	cr := v1alpha1.Chart{
+		ObjectMeta: metav1.ObjectMeta{
+			UID: "prometheus",
+		},
+	}
+	cc := &controllercontext.Context{}
+	status := v1alpha1.ChartStatus{
+		Release: v1alpha1.ChartStatusRelease{
+			Status: "deployed",
+		},
+	}
+
+	first := desiredConditions(nil, cr, cc, status)
+
+	// Set an old transition time to check it is kept when the condition
+	// status does not change e.g. after the operator restarted.
+	lastTransitionTime := metav1.Unix(1600000000, 0)
+	for i := range first {
+		first[i].LastTransitionTime = lastTransitionTime
+	}
+
+	second := desiredConditions(first, cr, cc, status)
+	for _, c := range second {
+		if !c.LastTransitionTime.Equal(&lastTransitionTime) {
+			t.Fatalf("condition %#q last transition time == %s, want %s", c.Type, c.LastTransitionTime, lastTransitionTime)
+		}
+	}
+	if !conditionsEqual(first, second) {
+		t.Fatalf("conditions not equal, want equal")
+	}
+
+	status.Release.Status = "failed"
+
+	third := desiredConditions(second, cr, cc, status)
+	for _, c := range third {
+		if c.Type == conditionReady && c.LastTransitionTime.Equal(&lastTransitionTime) {
+			t.Fatalf("condition %#q last transition time not updated", c.Type)
+		}
+	}
+	if conditionsEqual(second, third) {
+		t.Fatalf("conditions equal, want not equal")
+	}
+
+	// The stored conditions must not be changed.
+	for _, c := range second {
+		if !c.LastTransitionTime.Equal(&lastTransitionTime) {
+			t.Fatalf("stored condition %#q changed", c.Type)
+		}
+	}
+}
@@ -1,24 +1,25 @@
 package status
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
+	"strings"
 	"time"
 
 	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
 	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/to"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
-	"github.com/giantswarm/chart-operator/v2/pkg/project"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+	"github.com/giantswarm/chart-operator/v2/service/webhookoutbox"
 )
 
 func (r *Resource) EnsureCreated(ctx context.Context, obj interface{}) error {
@@ -34,6 +35,11 @@ func (r *Resource) EnsureCreated(ctx context.Context, obj interface{}) error {
 	releaseName := key.ReleaseName(cr)
 	r.logger.Debugf(ctx, "getting status for release %#q", releaseName)
 
+	storedConditions, err := r.getConditions(ctx, cr)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
 	// If something goes wrong outside of Helm we add that to the
 	// controller context in the release resource. So we include this
 	// information in the CR status.
@@ -45,7 +51,7 @@ func (r *Resource) EnsureCreated(ctx context.Context, obj interface{}) error {
 			},
 		}
 
-		err = r.setStatus(ctx, cr, status)
+		err = r.setStatus(ctx, cr, status, desiredConditions(storedConditions, cr, cc, status))
 		if err != nil {
 			return microerror.Mask(err)
 		}
@@ -69,16 +75,21 @@ func (r *Resource) EnsureCreated(ctx context.Context, obj interface{}) error {
 
 	var status, reason string
 	{
-		if key.IsCordoned(cr) {
+		if key.IsCordoned(cr) && !key.IsCordonExpired(cr) {
 			status = releaseStatusCordoned
 			reason = key.CordonReason(cr)
 		} else {
 			status = releaseContent.Status
-			if releaseContent.Status != helmclient.StatusDeployed {
+			if releaseContent.Status == helmclient.StatusDeployed && len(cc.Status.Release.UnhealthyWorkloads) > 0 {
+				status = releaseStatusDeployedUnhealthy
+				reason = fmt.Sprintf("workloads not ready: %s", strings.Join(cc.Status.Release.UnhealthyWorkloads, ", "))
+			} else if releaseContent.Status == helmclient.StatusDeployed && len(cc.Status.Release.DriftedObjects) > 0 {
+				// Drifted releases stay deployed so chart CRs depending
+				// on them are not blocked.
+				reason = fmt.Sprintf("objects drifted: %s", strings.Join(cc.Status.Release.DriftedObjects, ", "))
+			} else if releaseContent.Status != helmclient.StatusDeployed {
 				if cc.Status.Release.FailedMaxAttempts {
-					reason = fmt.Sprintf("Release has failed %d times.\nReason: %s",
-						project.ReleaseFailedMaxAttempts,
-						releaseContent.Description)
+					reason = key.FailedMaxAttemptsReason(releaseContent.Description)
 				} else {
 					reason = releaseContent.Description
 				}
@@ -102,8 +113,15 @@ func (r *Resource) EnsureCreated(ctx context.Context, obj interface{}) error {
 		desiredStatus.Release.LastDeployed = &metav1.Time{Time: time.Unix(lastDeployed, 0)}
 	}
 
-	if !equals(desiredStatus, key.ChartStatus(cr)) {
-		err = r.setStatus(ctx, cr, desiredStatus)
+	conditions := desiredConditions(storedConditions, cr, cc, desiredStatus)
+
+	// The API server prunes the conditions until the chart CRD from
+	// apiextensions has them. So they are only compared once they are
+	// stored. Otherwise the status would be set on every reconciliation.
+	conditionsChanged := storedConditions != nil && !conditionsEqual(conditions, storedConditions)
+
+	if !equals(desiredStatus, key.ChartStatus(cr)) || conditionsChanged {
+		err = r.setStatus(ctx, cr, desiredStatus, conditions)
 		if err != nil {
 			return microerror.Mask(err)
 		}
@@ -114,55 +132,97 @@ func (r *Resource) EnsureCreated(ctx context.Context, obj interface{}) error {
 	return nil
 }
 
-func (r *Resource) getAuthToken(ctx context.Context) (string, error) {
-	secret, err := r.k8sClient.CoreV1().Secrets(namespace).Get(ctx, authTokenName, metav1.GetOptions{})
-	if apierrors.IsNotFound(err) {
-		// There is no auth token secret. It may not have been created yet. Or the app CR is using InCluster.
-		r.logger.Debugf(ctx, "no auth token secret found skip calling webhook")
-		return "", nil
-	} else if err != nil {
-		return "", microerror.Mask(err)
-	}
-
-	return string(secret.Data[token]), nil
-}
-
-func (r *Resource) setStatus(ctx context.Context, cr v1alpha1.Chart, status v1alpha1.ChartStatus) error {
+func (r *Resource) setStatus(ctx context.Context, cr v1alpha1.Chart, status v1alpha1.ChartStatus, conditions []metav1.Condition) error {
 	if url, ok := cr.GetAnnotations()[annotation.Webhook]; ok {
-		authToken, err := r.getAuthToken(ctx)
+		payload, err := newWebhookPayload(status, conditions)
 		if err != nil {
 			return microerror.Mask(err)
 		}
 
-		err = updateAppStatus(url, authToken, status, r.httpClientTimeout)
-		if err != nil {
-			r.logger.Errorf(ctx, err, "sending webhook to %#q failed", url)
+		err = r.webhookOutbox.Send(ctx, fmt.Sprintf("%s/%s", cr.Namespace, cr.Name), url, payload)
+		if webhookoutbox.IsHostNotAllowed(err) {
+			r.logger.Errorf(ctx, err, "not sending webhook to %#q", url)
+		} else if err != nil {
+			r.logger.Errorf(ctx, err, "sending webhook to %#q failed, retrying with backoff", url)
 		}
 	}
 
 	r.logger.Debugf(ctx, "setting status for release %#q status to %#q", key.ReleaseName(cr), status.Release.Status)
 
-	// Get chart CR again to ensure the resource version is correct.
-	currentCR, err := r.g8sClient.ApplicationV1alpha1().Charts(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if status.Release.Status != key.ChartStatus(cr).Release.Status || status.Reason != key.ChartStatus(cr).Reason {
+		r.emitStatusEvent(cr, status)
+	}
+
+	patch, err := newStatusPatch(status, conditions)
 	if err != nil {
 		return microerror.Mask(err)
 	}
 
-	currentCR.Status = status
-
-	_, err = r.g8sClient.ApplicationV1alpha1().Charts(cr.Namespace).UpdateStatus(ctx, currentCR, metav1.UpdateOptions{})
+	_, err = r.dynamicClient.Resource(chartResource).Namespace(cr.Namespace).Patch(ctx, cr.Name, types.JSONPatchType, patch, metav1.PatchOptions{}, "status")
 	if err != nil {
 		return microerror.Mask(err)
 	}
 
 	r.logger.Debugf(ctx, "set status for release %#q", key.ReleaseName(cr))
 
+	if status.Release.Status == helmclient.StatusDeployed && key.ChartStatus(cr).Release.Status != helmclient.StatusDeployed {
+		r.triggerDependents(ctx, cr, status)
+	}
+
 	return nil
 }
 
-func updateAppStatus(webhookURL, authToken string, status v1alpha1.ChartStatus, timeout time.Duration) error {
+// newStatusPatch returns the JSON patch replacing the status of the chart CR
+// including the conditions.
+func newStatusPatch(status v1alpha1.ChartStatus, conditions []metav1.Condition) ([]byte, error) {
+	value, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&chartStatus{
+		ChartStatus: status,
+		Conditions:  conditions,
+	})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	patch := []map[string]interface{}{
+		{
+			"op":    "add",
+			"path":  "/status",
+			"value": value,
+		},
+	}
+
+	b, err := json.Marshal(patch)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return b, nil
+}
+
+// emitStatusEvent emits an event for the new status of the chart CR. The event
+// reason is the release status converted to CamelCase e.g. AlreadyExists so
+// failures can be told apart. Statuses other than deployed, cordoned and
+// waiting for dependencies are warnings.
+func (r *Resource) emitStatusEvent(cr v1alpha1.Chart, status v1alpha1.ChartStatus) {
+	eventType := corev1.EventTypeWarning
+	if status.Release.Status == helmclient.StatusDeployed || status.Release.Status == releaseStatusCordoned || status.Release.Status == releaseStatusWaitingForDependencies {
+		eventType = corev1.EventTypeNormal
+	}
+
+	message := fmt.Sprintf("release %#q status is %#q", key.ReleaseName(cr), status.Release.Status)
+	if status.Reason != "" {
+		message = fmt.Sprintf("%s: %s", message, status.Reason)
+	}
+
+	r.eventRecorder.Event(&cr, eventType, conditionReason(status.Release.Status), message)
+}
+
+// newWebhookPayload returns the request sent to the webhook to update the
+// status of the app CR.
+func newWebhookPayload(status v1alpha1.ChartStatus, conditions []metav1.Condition) ([]byte, error) {
 	request := Request{
 		AppVersion: status.AppVersion,
+		Conditions: conditions,
 		Reason:     status.Reason,
 		Status:     status.Release.Status,
 		Version:    status.Version,
@@ -173,28 +233,8 @@ func updateAppStatus(webhookURL, authToken string, status v1alpha1.ChartStatus,
 
 	payload, err := json.Marshal(request)
 	if err != nil {
-		return microerror.Mask(err)
-	}
-
-	client := &http.Client{Timeout: timeout}
-	req, err := http.NewRequest(http.MethodPatch, webhookURL, bytes.NewBuffer(payload))
-	if err != nil {
-		return microerror.Mask(err)
-	}
-
-	req.Header.Set("Authorization", authToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return microerror.Mask(err)
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return microerror.Maskf(wrongStatusError, "expected http status '%d', got '%d'", http.StatusOK, resp.StatusCode)
+		return nil, microerror.Mask(err)
 	}
 
-	return nil
+	return payload, nil
 }
@@ -0,0 +1,98 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/to"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+)
+
+// triggerDependents triggers the reconciliation of the chart CRs waiting for
+// the release of the chart CR which was just deployed. Otherwise they would
+// wait for the next resync. Errors are only logged since the chart CRs are
+// reconciled with the next resync anyway.
+func (r *Resource) triggerDependents(ctx context.Context, cr v1alpha1.Chart, status v1alpha1.ChartStatus) {
+	priority, err := key.Priority(cr)
+	if err != nil {
+		r.logger.Errorf(ctx, err, "failed to trigger reconciliation of chart CRs depending on %#q", cr.Name)
+		return
+	}
+
+	list, err := r.g8sClient.ApplicationV1alpha1().Charts(cr.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		r.logger.Errorf(ctx, err, "failed to trigger reconciliation of chart CRs depending on %#q", cr.Name)
+		return
+	}
+
+	deployed := fmt.Sprintf("%s/%d", cr.Name, to.Int(status.Release.Revision))
+
+	for _, dependent := range list.Items {
+		if !isWaitingFor(dependent, cr.Name, priority) {
+			continue
+		}
+
+		err = r.triggerDependent(ctx, dependent, deployed)
+		if err != nil {
+			r.logger.Errorf(ctx, err, "failed to trigger reconciliation of chart CR %#q", dependent.Name)
+			continue
+		}
+
+		r.logger.Debugf(ctx, "triggered reconciliation of chart CR %#q as %#q was deployed", dependent.Name, cr.Name)
+	}
+}
+
+// triggerDependent sets the dependency deployed annotation on the chart CR.
+// The update event causes the chart controller to reconcile it.
+func (r *Resource) triggerDependent(ctx context.Context, cr v1alpha1.Chart, deployed string) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				annotation.DependencyDeployed: deployed,
+			},
+		},
+	}
+
+	bytes, err := json.Marshal(patch)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	_, err = r.g8sClient.ApplicationV1alpha1().Charts(cr.Namespace).Patch(ctx, cr.Name, types.MergePatchType, bytes, metav1.PatchOptions{})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// isWaitingFor returns true when the chart CR waits for its dependencies and
+// depends on the chart CR with the given name and priority.
+func isWaitingFor(cr v1alpha1.Chart, name string, priority int) bool {
+	if cr.Name == name || key.IsDeleted(cr) {
+		return false
+	}
+	if key.ChartStatus(cr).Release.Status != releaseStatusWaitingForDependencies {
+		return false
+	}
+
+	for _, dependency := range key.DependsOn(cr) {
+		if dependency == name {
+			return true
+		}
+	}
+
+	p, err := key.Priority(cr)
+	if err != nil {
+		return false
+	}
+
+	return p < priority
+}
@@ -0,0 +1,83 @@
+package status
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+)
+
+func Test_isWaitingFor(t *testing.T) {
+	testCases := []struct {
+		name           string
+		annotations    map[string]string
+		status         string
+		expectedResult bool
+	}{
+		{
+			name: "case 0: waiting for the chart CR",
+			annotations: map[string]string{
+				annotation.DependsOn: "coredns,cilium",
+			},
+			status:         releaseStatusWaitingForDependencies,
+			expectedResult: true,
+		},
+		{
+			name: "case 1: waiting for another chart CR",
+			annotations: map[string]string{
+				annotation.DependsOn: "coredns",
+				annotation.Priority:  "10",
+			},
+			status:         releaseStatusWaitingForDependencies,
+			expectedResult: false,
+		},
+		{
+			name:           "case 2: waiting for chart CRs with higher priority",
+			annotations:    map[string]string{},
+			status:         releaseStatusWaitingForDependencies,
+			expectedResult: true,
+		},
+		{
+			name: "case 3: priority not lower",
+			annotations: map[string]string{
+				annotation.Priority: "10",
+			},
+			status:         releaseStatusWaitingForDependencies,
+			expectedResult: false,
+		},
+		{
+			name: "case 4: not waiting",
+			annotations: map[string]string{
+				annotation.DependsOn: "cilium",
+			},
+			status:         "deployed",
+			expectedResult: false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			cr := v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "prometheus",
+					Annotations: tc.annotations,
+				},
+				Status: v1alpha1.ChartStatus{
+					Release: v1alpha1.ChartStatusRelease{
+						Status: tc.status,
+					},
+				},
+			}
+
+			result := isWaitingFor(cr, "cilium", 10)
+			if result != tc.expectedResult {
+				t.Fatalf("isWaitingFor == %t, want %t", result, tc.expectedResult)
+			}
+		})
+	}
+}
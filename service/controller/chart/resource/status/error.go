@@ -12,12 +12,3 @@ var invalidConfigError = &microerror.Error{
 func IsInvalidConfig(err error) bool {
 	return microerror.Cause(err) == invalidConfigError
 }
-
-var wrongStatusError = &microerror.Error{
-	Kind: "wrongStatusError",
-}
-
-// IsWrongStatusError asserts wrongStatusError.
-func IsWrongStatusError(err error) bool {
-	return microerror.Cause(err) == wrongStatusError
-}
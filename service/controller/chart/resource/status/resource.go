@@ -1,74 +1,83 @@
 package status
 
 import (
-	"time"
-
 	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
 	"github.com/giantswarm/apiextensions/v3/pkg/clientset/versioned"
 	"github.com/giantswarm/helmclient/v4/pkg/helmclient"
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/micrologger"
 	"github.com/giantswarm/to"
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/giantswarm/chart-operator/v2/service/webhookoutbox"
 )
 
 const (
 	Name = "status"
 
-	authTokenName = "auth-token"
-	// defaultHTTPClientTimeout is the timeout when updating app status.
-	defaultHTTPClientTimeout = 5
-	namespace                = "giantswarm"
-	releaseStatusCordoned    = "CORDONED"
-	token                    = "token"
+	releaseStatusCordoned = "CORDONED"
+	// releaseStatusDeployedUnhealthy is set when the release is deployed
+	// but its workloads are not ready.
+	releaseStatusDeployedUnhealthy = "deployed-unhealthy"
+	// releaseStatusWaitingForDependencies is set by the release resource
+	// while the chart CRs the release depends on are not deployed.
+	releaseStatusWaitingForDependencies = "waiting-for-dependencies"
 )
 
+// chartResource is the resource of the chart CRs used with the dynamic client.
+var chartResource = v1alpha1.SchemeGroupVersion.WithResource("charts")
+
 // Config represents the configuration used to create a new status resource.
 type Config struct {
-	G8sClient  versioned.Interface
-	HelmClient helmclient.Interface
-	K8sClient  kubernetes.Interface
-	Logger     micrologger.Logger
-
-	HTTPClientTimeout time.Duration
+	// DynamicClient reads and writes the conditions of the chart CRs which
+	// are not part of the typed chart CR status.
+	DynamicClient dynamic.Interface
+	EventRecorder record.EventRecorder
+	G8sClient     versioned.Interface
+	HelmClient    helmclient.Interface
+	Logger        micrologger.Logger
+	WebhookOutbox *webhookoutbox.Outbox
 }
 
 // Resource implements the status resource.
 type Resource struct {
-	g8sClient  versioned.Interface
-	helmClient helmclient.Interface
-	k8sClient  kubernetes.Interface
-	logger     micrologger.Logger
-
-	httpClientTimeout time.Duration
+	dynamicClient dynamic.Interface
+	eventRecorder record.EventRecorder
+	g8sClient     versioned.Interface
+	helmClient    helmclient.Interface
+	logger        micrologger.Logger
+	webhookOutbox *webhookoutbox.Outbox
 }
 
 // New creates a new configured status resource.
 func New(config Config) (*Resource, error) {
+	if config.DynamicClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.DynamicClient must not be empty", config)
+	}
+	if config.EventRecorder == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.EventRecorder must not be empty", config)
+	}
 	if config.G8sClient == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.G8sClient must not be empty", config)
 	}
 	if config.HelmClient == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.HelmClient must not be empty", config)
 	}
-	if config.K8sClient == nil {
-		return nil, microerror.Maskf(invalidConfigError, "%T.K8sClient must not be empty", config)
-	}
 	if config.Logger == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
 	}
-
-	if config.HTTPClientTimeout == 0 {
-		config.HTTPClientTimeout = defaultHTTPClientTimeout
+	if config.WebhookOutbox == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.WebhookOutbox must not be empty", config)
 	}
 
 	r := &Resource{
-		g8sClient:  config.G8sClient,
-		helmClient: config.HelmClient,
-		k8sClient:  config.K8sClient,
-		logger:     config.Logger,
-
-		httpClientTimeout: config.HTTPClientTimeout,
+		dynamicClient: config.DynamicClient,
+		eventRecorder: config.EventRecorder,
+		g8sClient:     config.G8sClient,
+		helmClient:    config.HelmClient,
+		logger:        config.Logger,
+		webhookOutbox: config.WebhookOutbox,
 	}
 
 	return r, nil
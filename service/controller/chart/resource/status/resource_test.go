@@ -1,14 +1,27 @@
 package status
 
 import (
+	"context"
 	"strconv"
 	"testing"
 	"time"
 
 	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/apiextensions/v3/pkg/clientset/versioned/fake"
+	"github.com/giantswarm/helmclient/v4/pkg/helmclienttest"
+	"github.com/giantswarm/micrologger/microloggertest"
 	"github.com/giantswarm/to"
 	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/controllercontext"
+	"github.com/giantswarm/chart-operator/v2/service/webhookoutbox"
 )
 
 func Test_StatusResource_equals(t *testing.T) {
@@ -167,3 +180,204 @@ func Test_StatusResource_equals(t *testing.T) {
 		})
 	}
 }
+
+func Test_StatusResource_emitStatusEvent(t *testing.T) {
+	testCases := []struct {
+		name          string
+		status        v1alpha1.ChartStatus
+		expectedEvent string
+	}{
+		{
+			name: "case 0: deployed",
+			status: v1alpha1.ChartStatus{
+				Release: v1alpha1.ChartStatusRelease{
+					Status: "deployed",
+				},
+			},
+			expectedEvent: "Normal Deployed release `prometheus` status is `deployed`",
+		},
+		{
+			name: "case 1: already exists",
+			status: v1alpha1.ChartStatus{
+				Reason: "resource already exists",
+				Release: v1alpha1.ChartStatusRelease{
+					Status: "already-exists",
+				},
+			},
+			expectedEvent: "Warning AlreadyExists release `prometheus` status is `already-exists`: resource already exists",
+		},
+		{
+			name: "case 2: cordoned",
+			status: v1alpha1.ChartStatus{
+				Reason: "testing upgrade",
+				Release: v1alpha1.ChartStatusRelease{
+					Status: releaseStatusCordoned,
+				},
+			},
+			expectedEvent: "Normal Cordoned release `prometheus` status is `CORDONED`: testing upgrade",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			eventRecorder := record.NewFakeRecorder(1)
+
+			c := Config{
+				DynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()),
+				EventRecorder: eventRecorder,
+				G8sClient:     fake.NewSimpleClientset(),
+				HelmClient:    helmclienttest.New(helmclienttest.Config{}),
+				Logger:        microloggertest.New(),
+				WebhookOutbox: newTestWebhookOutbox(t),
+			}
+
+			r, err := New(c)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			cr := v1alpha1.Chart{
+				Spec: v1alpha1.ChartSpec{
+					Name: "prometheus",
+				},
+			}
+
+			r.emitStatusEvent(cr, tc.status)
+
+			event := <-eventRecorder.Events
+			if event != tc.expectedEvent {
+				t.Fatalf("event == %#q, want %#q", event, tc.expectedEvent)
+			}
+		})
+	}
+}
+
+func Test_StatusResource_setStatus(t *testing.T) {
+	ctx := context.Background()
+
+	lastTransitionTime := metav1.Unix(1600000000, 0)
+
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "application.giantswarm.io/v1alpha1",
+			"kind":       "Chart",
+			"metadata": map[string]interface{}{
+				"name":      "prometheus",
+				"namespace": "giantswarm",
+			},
+			"status": map[string]interface{}{
+				"reason": "resource already exists",
+				"release": map[string]interface{}{
+					"status": "failed",
+				},
+				"conditions": []interface{}{
+					map[string]interface{}{
+						"type":               conditionValuesResolved,
+						"status":             "True",
+						"reason":             reasonValuesResolved,
+						"message":            "",
+						"lastTransitionTime": lastTransitionTime.UTC().Format(time.RFC3339),
+					},
+				},
+			},
+		},
+	}
+
+	c := Config{
+		DynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), obj),
+		EventRecorder: record.NewFakeRecorder(1),
+		G8sClient:     fake.NewSimpleClientset(),
+		HelmClient:    helmclienttest.New(helmclienttest.Config{}),
+		Logger:        microloggertest.New(),
+		WebhookOutbox: newTestWebhookOutbox(t),
+	}
+
+	r, err := New(c)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	cr := v1alpha1.Chart{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "prometheus",
+			Namespace: "giantswarm",
+		},
+		Spec: v1alpha1.ChartSpec{
+			Name: "prometheus",
+		},
+		Status: v1alpha1.ChartStatus{
+			Reason: "resource already exists",
+			Release: v1alpha1.ChartStatusRelease{
+				Status: "failed",
+			},
+		},
+	}
+
+	stored, err := r.getConditions(ctx, cr)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	if len(stored) != 1 || !stored[0].LastTransitionTime.Equal(&lastTransitionTime) {
+		t.Fatalf("stored conditions == %#v, want condition %#q", stored, conditionValuesResolved)
+	}
+
+	status := v1alpha1.ChartStatus{
+		AppVersion: "2.0.0",
+		Release: v1alpha1.ChartStatusRelease{
+			Revision: to.IntP(2),
+			Status:   "deployed",
+		},
+		Version: "1.0.0",
+	}
+	conditions := desiredConditions(stored, cr, &controllercontext.Context{}, status)
+
+	err = r.setStatus(ctx, cr, status, conditions)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	result, err := r.getConditions(ctx, cr)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	if !conditionsEqual(result, conditions) {
+		t.Fatalf("want matching conditions \n %s", cmp.Diff(result, conditions))
+	}
+
+	// The last transition time of the unchanged condition is kept.
+	c1 := meta.FindStatusCondition(result, conditionValuesResolved)
+	if c1 == nil || !c1.LastTransitionTime.Equal(&lastTransitionTime) {
+		t.Fatalf("condition %#q last transition time not kept", conditionValuesResolved)
+	}
+
+	updated, err := r.dynamicClient.Resource(chartResource).Namespace(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	// The reason of the previous status is removed.
+	_, found, _ := unstructured.NestedString(updated.Object, "status", "reason")
+	if found {
+		t.Fatalf("status reason found, want removed")
+	}
+	releaseStatus, _, _ := unstructured.NestedString(updated.Object, "status", "release", "status")
+	if releaseStatus != "deployed" {
+		t.Fatalf("release status == %#q, want %#q", releaseStatus, "deployed")
+	}
+}
+
+func newTestWebhookOutbox(t *testing.T) *webhookoutbox.Outbox {
+	c := webhookoutbox.Config{
+		K8sClient: k8sfake.NewSimpleClientset(),
+		Logger:    microloggertest.New(),
+	}
+
+	o, err := webhookoutbox.New(c)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	return o
+}
@@ -1,11 +1,23 @@
 package status
 
-import v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+import (
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// chartStatus is the status of the chart CR including the conditions. The
+// typed chart CR status from apiextensions has no conditions yet. So the
+// status is read and written with the dynamic client.
+type chartStatus struct {
+	v1alpha1.ChartStatus `json:",inline"`
+	Conditions           []v1.Condition `json:"conditions,omitempty"`
+}
 
 type Request struct {
-	AppVersion   string  `json:"app_version"`
-	LastDeployed v1.Time `json:"last_deployed"`
-	Reason       string  `json:"reason"`
-	Status       string  `json:"status"`
-	Version      string  `json:"version"`
+	AppVersion   string         `json:"app_version"`
+	Conditions   []v1.Condition `json:"conditions,omitempty"`
+	LastDeployed v1.Time        `json:"last_deployed"`
+	Reason       string         `json:"reason"`
+	Status       string         `json:"status"`
+	Version      string         `json:"version"`
 }
@@ -12,34 +12,57 @@ import (
 	"github.com/giantswarm/operatorkit/v4/pkg/resource/wrapper/metricsresource"
 	"github.com/giantswarm/operatorkit/v4/pkg/resource/wrapper/retryresource"
 	"github.com/spf13/afero"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/resource/namespace"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/resource/release"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/resource/releasemaxhistory"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/resource/status"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart/resource/tillermigration"
+	"github.com/giantswarm/chart-operator/v2/service/helmstorage"
+	"github.com/giantswarm/chart-operator/v2/service/releaseoperation"
+	"github.com/giantswarm/chart-operator/v2/service/webhookoutbox"
 )
 
 type chartResourcesConfig struct {
 	// Dependencies.
-	Fs         afero.Fs
-	G8sClient  versioned.Interface
-	HelmClient helmclient.Interface
-	K8sClient  kubernetes.Interface
-	Logger     micrologger.Logger
+	DynamicClient     dynamic.Interface
+	EventRecorder     record.EventRecorder
+	Fs                afero.Fs
+	G8sClient         versioned.Interface
+	HelmClient        helmclient.Interface
+	HelmStorage       *helmstorage.Storage
+	K8sClient         kubernetes.Interface
+	Logger            micrologger.Logger
+	ReleaseOperations *releaseoperation.Manager
+	RESTMapper        meta.RESTMapper
+	WebhookOutbox     *webhookoutbox.Outbox
 
 	// Settings.
-	HTTPClientTimeout time.Duration
-	K8sWaitTimeout    time.Duration
-	MaxRollback       int
-	TillerNamespace   string
+	DriftCheckInterval  time.Duration
+	HTTPClientTimeout   time.Duration
+	K8sWaitTimeout      time.Duration
+	MaxRollback         int
+	SecretNamespaces    []string
+	SelfHealInterval    time.Duration
+	TarballCacheMaxSize int64
+	TillerNamespace     string
+	VerifyPolicy        string
 }
 
 func newChartResources(config chartResourcesConfig) ([]resource.Interface, error) {
 	var err error
 
 	// Dependencies.
+	if config.DynamicClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.DynamicClient must not be empty", config)
+	}
+	if config.EventRecorder == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.EventRecorder must not be empty", config)
+	}
 	if config.Fs == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.Fs must not be empty", config)
 	}
@@ -49,12 +72,24 @@ func newChartResources(config chartResourcesConfig) ([]resource.Interface, error
 	if config.HelmClient == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.HelmClient must not be empty", config)
 	}
+	if config.HelmStorage == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.HelmStorage must not be empty", config)
+	}
 	if config.K8sClient == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.K8sClient must not be empty", config)
 	}
 	if config.Logger == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
 	}
+	if config.ReleaseOperations == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.ReleaseOperations must not be empty", config)
+	}
+	if config.RESTMapper == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.RESTMapper must not be empty", config)
+	}
+	if config.WebhookOutbox == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.WebhookOutbox must not be empty", config)
+	}
 
 	if config.TillerNamespace == "" {
 		return nil, microerror.Maskf(invalidConfigError, "%T.TillerNamespace must not be empty", config)
@@ -63,8 +98,9 @@ func newChartResources(config chartResourcesConfig) ([]resource.Interface, error
 	var namespaceResource resource.Interface
 	{
 		c := namespace.Config{
-			K8sClient: config.K8sClient,
-			Logger:    config.Logger,
+			EventRecorder: config.EventRecorder,
+			K8sClient:     config.K8sClient,
+			Logger:        config.Logger,
 
 			K8sWaitTimeout: config.K8sWaitTimeout,
 		}
@@ -79,16 +115,27 @@ func newChartResources(config chartResourcesConfig) ([]resource.Interface, error
 	{
 		c := release.Config{
 			// Dependencies
-			Fs:         config.Fs,
-			G8sClient:  config.G8sClient,
-			HelmClient: config.HelmClient,
-			K8sClient:  config.K8sClient,
-			Logger:     config.Logger,
+			DynamicClient:     config.DynamicClient,
+			EventRecorder:     config.EventRecorder,
+			Fs:                config.Fs,
+			G8sClient:         config.G8sClient,
+			HelmClient:        config.HelmClient,
+			HelmStorage:       config.HelmStorage,
+			K8sClient:         config.K8sClient,
+			Logger:            config.Logger,
+			ReleaseOperations: config.ReleaseOperations,
+			RESTMapper:        config.RESTMapper,
 
 			// Settings
-			K8sWaitTimeout:  config.K8sWaitTimeout,
-			MaxRollback:     config.MaxRollback,
-			TillerNamespace: config.TillerNamespace,
+			DriftCheckInterval:  config.DriftCheckInterval,
+			HTTPClientTimeout:   config.HTTPClientTimeout,
+			K8sWaitTimeout:      config.K8sWaitTimeout,
+			MaxRollback:         config.MaxRollback,
+			SecretNamespaces:    config.SecretNamespaces,
+			SelfHealInterval:    config.SelfHealInterval,
+			TarballCacheMaxSize: config.TarballCacheMaxSize,
+			TillerNamespace:     config.TillerNamespace,
+			VerifyPolicy:        config.VerifyPolicy,
 		}
 
 		ops, err := release.New(c)
@@ -106,9 +153,10 @@ func newChartResources(config chartResourcesConfig) ([]resource.Interface, error
 	{
 		c := releasemaxhistory.Config{
 			// Dependencies
-			HelmClient: config.HelmClient,
-			K8sClient:  config.K8sClient,
-			Logger:     config.Logger,
+			EventRecorder: config.EventRecorder,
+			HelmClient:    config.HelmClient,
+			HelmStorage:   config.HelmStorage,
+			Logger:        config.Logger,
 		}
 
 		releaseMaxHistoryResource, err = releasemaxhistory.New(c)
@@ -120,12 +168,12 @@ func newChartResources(config chartResourcesConfig) ([]resource.Interface, error
 	var statusResource resource.Interface
 	{
 		c := status.Config{
-			G8sClient:  config.G8sClient,
-			HelmClient: config.HelmClient,
-			K8sClient:  config.K8sClient,
-			Logger:     config.Logger,
-
-			HTTPClientTimeout: config.HTTPClientTimeout,
+			DynamicClient: config.DynamicClient,
+			EventRecorder: config.EventRecorder,
+			G8sClient:     config.G8sClient,
+			HelmClient:    config.HelmClient,
+			Logger:        config.Logger,
+			WebhookOutbox: config.WebhookOutbox,
 		}
 
 		statusResource, err = status.New(c)
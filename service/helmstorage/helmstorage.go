@@ -0,0 +1,37 @@
+// Package helmstorage creates the Helm release storage used by chart-operator
+// to read and prune release revisions. Releases are always stored in secrets.
+// Selecting the configmap or sql storage driver is not supported as the Helm
+// client creates its own storage with the secrets driver for every operation.
+package helmstorage
+
+import (
+	"github.com/giantswarm/microerror"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/client-go/kubernetes"
+)
+
+type Config struct {
+	K8sClient kubernetes.Interface
+}
+
+type Storage struct {
+	k8sClient kubernetes.Interface
+}
+
+func New(config Config) (*Storage, error) {
+	if config.K8sClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.K8sClient must not be empty", config)
+	}
+
+	s := &Storage{
+		k8sClient: config.K8sClient,
+	}
+
+	return s, nil
+}
+
+// Releases returns the Helm release storage for the namespace.
+func (s *Storage) Releases(namespace string) (*storage.Storage, error) {
+	return storage.Init(driver.NewSecrets(s.k8sClient.CoreV1().Secrets(namespace))), nil
+}
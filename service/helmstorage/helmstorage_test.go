@@ -0,0 +1,58 @@
+package helmstorage
+
+import (
+	"context"
+	"testing"
+
+	helmrelease "helm.sh/helm/v3/pkg/release"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_Releases(t *testing.T) {
+	k8sClient := k8sfake.NewSimpleClientset()
+
+	c := Config{
+		K8sClient: k8sClient,
+	}
+
+	s, err := New(c)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	releases, err := s.Releases("default")
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	err = releases.Create(&helmrelease.Release{
+		Name: "test-app",
+		Info: &helmrelease.Info{
+			Status: helmrelease.StatusDeployed,
+		},
+		Namespace: "default",
+		Version:   1,
+	})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	rel, err := releases.Deployed("test-app")
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	if rel.Version != 1 {
+		t.Fatalf("version == %d, want %d", rel.Version, 1)
+	}
+
+	// The Helm client stores releases in secrets so the revisions must be
+	// stored the same way.
+	secrets, err := k8sClient.CoreV1().Secrets("default").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	if len(secrets.Items) != 1 {
+		t.Fatalf("secrets == %d, want %d", len(secrets.Items), 1)
+	}
+}
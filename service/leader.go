@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/project"
+	"github.com/giantswarm/chart-operator/v2/service/collector"
+)
+
+var (
+	leaderGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: collector.Namespace,
+			Name:      "leader",
+			Help:      "Whether this replica is the leader reconciling chart CRs.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(leaderGauge)
+}
+
+type leaderElectorConfig struct {
+	K8sClient kubernetes.Interface
+	Logger    micrologger.Logger
+
+	LeaseDuration time.Duration
+	Namespace     string
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+
+	// OnStartedLeading is called once this replica became the leader.
+	OnStartedLeading func(ctx context.Context)
+}
+
+// newLeaderElector creates the leader elector for the lease of the operator.
+// The lease is released when the context of the elector is canceled so a
+// standby replica takes over without waiting for the lease to expire.
+func newLeaderElector(config leaderElectorConfig) (*leaderelection.LeaderElector, error) {
+	if config.K8sClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.K8sClient must not be empty", config)
+	}
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
+	}
+	if config.Namespace == "" {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Namespace must not be empty", config)
+	}
+	if config.OnStartedLeading == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.OnStartedLeading must not be empty", config)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	// The hostname is not unique when running with host network so a UUID is
+	// added.
+	identity := hostname + "_" + string(uuid.NewUUID())
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      project.Name() + "-leader",
+			Namespace: config.Namespace,
+		},
+		Client: config.K8sClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+
+	c := leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   config.LeaseDuration,
+		Name:            project.Name(),
+		ReleaseOnCancel: true,
+		RenewDeadline:   config.RenewDeadline,
+		RetryPeriod:     config.RetryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				config.Logger.Debugf(ctx, "replica %#q started leading", identity)
+				leaderGauge.Set(1)
+
+				config.OnStartedLeading(ctx)
+			},
+			OnStoppedLeading: func() {
+				config.Logger.Debugf(context.Background(), "replica %#q stopped leading", identity)
+				leaderGauge.Set(0)
+			},
+			OnNewLeader: func(leader string) {
+				config.Logger.Debugf(context.Background(), "replica %#q is the leader", leader)
+			},
+		},
+	}
+
+	leaderElector, err := leaderelection.NewLeaderElector(c)
+	if err != nil {
+		return nil, microerror.Maskf(invalidConfigError, "%s", err.Error())
+	}
+
+	return leaderElector, nil
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_newLeaderElector(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+
+	started := make(chan struct{})
+
+	leaderElector, err := newLeaderElector(leaderElectorConfig{
+		K8sClient: k8sClient,
+		Logger:    microloggertest.New(),
+
+		LeaseDuration: 2 * time.Second,
+		Namespace:     "giantswarm",
+		RenewDeadline: time.Second,
+		RetryPeriod:   100 * time.Millisecond,
+
+		OnStartedLeading: func(ctx context.Context) {
+			close(started)
+		},
+	})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stopped := make(chan struct{})
+	go func() {
+		leaderElector.Run(ctx)
+		close(stopped)
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("replica did not start leading")
+	}
+
+	cancel()
+	<-stopped
+
+	// The lease is released so a standby replica takes over immediately.
+	lease, err := k8sClient.CoordinationV1().Leases("giantswarm").Get(context.Background(), "chart-operator-leader", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	if lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity != "" {
+		t.Fatalf("holder == %#q, want released lease", *lease.Spec.HolderIdentity)
+	}
+}
+
+func Test_newLeaderElector_invalidDurations(t *testing.T) {
+	_, err := newLeaderElector(leaderElectorConfig{
+		K8sClient: fake.NewSimpleClientset(),
+		Logger:    microloggertest.New(),
+
+		LeaseDuration: time.Second,
+		Namespace:     "giantswarm",
+		RenewDeadline: 2 * time.Second,
+		RetryPeriod:   100 * time.Millisecond,
+
+		OnStartedLeading: func(ctx context.Context) {},
+	})
+	if !IsInvalidConfig(err) {
+		t.Fatalf("error == %#v, want invalidConfigError", err)
+	}
+}
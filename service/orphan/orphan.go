@@ -0,0 +1,124 @@
+// Package orphan finds the configmaps and secrets created by app-operator for
+// chart CRs which no longer exist.
+package orphan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/apiextensions/v3/pkg/clientset/versioned"
+	"github.com/giantswarm/apiextensions/v3/pkg/label"
+	"github.com/giantswarm/microerror"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+)
+
+const (
+	KindConfigMap = "ConfigMap"
+	KindSecret    = "Secret"
+)
+
+// Object is an orphaned configmap or secret.
+type Object struct {
+	Kind string
+	metav1.ObjectMeta
+}
+
+// ConfigMaps returns the configmaps managed by app-operator which are not
+// referenced by a chart CR.
+func ConfigMaps(ctx context.Context, g8sClient versioned.Interface, k8sClient kubernetes.Interface) ([]Object, error) {
+	charts, err := g8sClient.ApplicationV1alpha1().Charts(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	desired := referenced(charts.Items, KindConfigMap)
+
+	configMaps, err := k8sClient.CoreV1().ConfigMaps(metav1.NamespaceAll).List(ctx, managedByAppOperator())
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var orphans []Object
+	for _, cm := range configMaps.Items {
+		if !desired[[2]string{cm.Namespace, cm.Name}] {
+			orphans = append(orphans, Object{Kind: KindConfigMap, ObjectMeta: cm.ObjectMeta})
+		}
+	}
+
+	return orphans, nil
+}
+
+// Secrets returns the secrets managed by app-operator which are not
+// referenced by a chart CR.
+func Secrets(ctx context.Context, g8sClient versioned.Interface, k8sClient kubernetes.Interface) ([]Object, error) {
+	charts, err := g8sClient.ApplicationV1alpha1().Charts(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	desired := referenced(charts.Items, KindSecret)
+
+	secrets, err := k8sClient.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, managedByAppOperator())
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var orphans []Object
+	for _, secret := range secrets.Items {
+		if !desired[[2]string{secret.Namespace, secret.Name}] {
+			orphans = append(orphans, Object{Kind: KindSecret, ObjectMeta: secret.ObjectMeta})
+		}
+	}
+
+	return orphans, nil
+}
+
+// referenced returns the namespaces and names of the configmaps or secrets
+// referenced by the chart CRs. These are the values of the chart CR spec, the
+// values sources and for secrets the credentials and OCI pull secrets.
+func referenced(charts []v1alpha1.Chart, kind string) map[[2]string]bool {
+	desired := map[[2]string]bool{}
+
+	for _, chart := range charts {
+		switch kind {
+		case KindConfigMap:
+			desired[[2]string{key.ConfigMapNamespace(chart), key.ConfigMapName(chart)}] = true
+		case KindSecret:
+			desired[[2]string{key.SecretNamespace(chart), key.SecretName(chart)}] = true
+
+			namespace, name := key.CredentialsSecret(chart)
+			desired[[2]string{namespace, name}] = true
+
+			namespace, name = key.OCIPullSecret(chart)
+			desired[[2]string{namespace, name}] = true
+		}
+
+		// Chart CRs with invalid values sources fail to resolve their values
+		// so they do not reference any.
+		sources, _ := key.ValuesSources(chart)
+		for _, s := range sources {
+			if s.Kind != kind {
+				continue
+			}
+
+			namespace := s.Namespace
+			if namespace == "" {
+				namespace = chart.Namespace
+			}
+
+			desired[[2]string{namespace, s.Name}] = true
+		}
+	}
+
+	return desired
+}
+
+func managedByAppOperator() metav1.ListOptions {
+	return metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", label.ManagedBy, "app-operator"),
+	}
+}
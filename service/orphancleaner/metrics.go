@@ -0,0 +1,27 @@
+package orphancleaner
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/giantswarm/chart-operator/v2/service/collector"
+)
+
+const (
+	metricsSubsystem = "orphan"
+)
+
+var (
+	deletedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: collector.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "deleted_total",
+			Help:      "Number of orphaned configmaps and secrets deleted. With dry run they are only counted.",
+		},
+		[]string{"kind", "dry_run"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(deletedCounter)
+}
@@ -0,0 +1,209 @@
+// Package orphancleaner deletes the configmaps and secrets created by
+// app-operator for chart CRs which no longer exist. Otherwise they are never
+// deleted.
+//
+// Objects are deleted once they were orphaned for the grace period. The time
+// an object became orphaned is kept in memory so the grace period starts
+// again when the operator restarts. Objects with the keep orphan annotation
+// are never deleted.
+package orphancleaner
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/clientset/versioned"
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/service/orphan"
+)
+
+type Config struct {
+	G8sClient versioned.Interface
+	K8sClient kubernetes.Interface
+	Logger    micrologger.Logger
+
+	// DryRun logs the orphaned objects which would be deleted instead of
+	// deleting them.
+	DryRun bool
+	// GracePeriod is how long an object must be orphaned before it is
+	// deleted.
+	GracePeriod time.Duration
+	// Interval is how often orphaned objects are looked for.
+	Interval time.Duration
+}
+
+type Cleaner struct {
+	g8sClient versioned.Interface
+	k8sClient kubernetes.Interface
+	logger    micrologger.Logger
+
+	dryRun      bool
+	gracePeriod time.Duration
+	interval    time.Duration
+
+	// orphanedSince is when the objects were first found orphaned by kind,
+	// namespace and name.
+	orphanedSince map[string]time.Time
+}
+
+func New(config Config) (*Cleaner, error) {
+	if config.G8sClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.G8sClient must not be empty", config)
+	}
+	if config.K8sClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.K8sClient must not be empty", config)
+	}
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
+	}
+
+	if config.GracePeriod <= 0 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.GracePeriod must be positive", config)
+	}
+	if config.Interval <= 0 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Interval must be positive", config)
+	}
+
+	c := &Cleaner{
+		g8sClient: config.G8sClient,
+		k8sClient: config.K8sClient,
+		logger:    config.Logger,
+
+		dryRun:      config.DryRun,
+		gracePeriod: config.GracePeriod,
+		interval:    config.Interval,
+
+		orphanedSince: map[string]time.Time{},
+	}
+
+	return c, nil
+}
+
+// Boot looks for orphaned objects every interval and blocks until the context
+// is done.
+func (c *Cleaner) Boot(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		err := c.cleanup(ctx)
+		if err != nil {
+			c.logger.Errorf(ctx, err, "cleaning up orphaned configmaps and secrets failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Cleaner) cleanup(ctx context.Context) error {
+	configMaps, err := orphan.ConfigMaps(ctx, c.g8sClient, c.k8sClient)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	secrets, err := orphan.Secrets(ctx, c.g8sClient, c.k8sClient)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	now := time.Now()
+	orphaned := map[string]bool{}
+
+	for _, o := range append(configMaps, secrets...) {
+		k := fmt.Sprintf("%s/%s/%s", o.Kind, o.Namespace, o.Name)
+		orphaned[k] = true
+
+		if isKept(o) {
+			c.logger.Debugf(ctx, "keeping orphaned %s %#q in namespace %#q as it has the %#q annotation", o.Kind, o.Name, o.Namespace, annotation.KeepOrphan)
+			continue
+		}
+
+		since, ok := c.orphanedSince[k]
+		if !ok {
+			c.orphanedSince[k] = now
+			c.logger.Debugf(ctx, "found orphaned %s %#q in namespace %#q, deleting it after %s", o.Kind, o.Name, o.Namespace, c.gracePeriod)
+			continue
+		}
+		if now.Sub(since) < c.gracePeriod {
+			continue
+		}
+
+		if c.dryRun {
+			c.logger.Debugf(ctx, "dry run is enabled, not deleting orphaned %s %#q in namespace %#q orphaned since %s", o.Kind, o.Name, o.Namespace, since.Format(time.RFC3339))
+			deletedCounter.WithLabelValues(o.Kind, "true").Inc()
+
+			// The object is reported again after the next grace period.
+			c.orphanedSince[k] = now
+			continue
+		}
+
+		err = c.delete(ctx, o)
+		if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+			// The object was deleted or replaced in the meantime.
+			delete(c.orphanedSince, k)
+			continue
+		} else if err != nil {
+			c.logger.Errorf(ctx, err, "deleting orphaned %s %#q in namespace %#q failed", o.Kind, o.Name, o.Namespace)
+			continue
+		}
+
+		delete(c.orphanedSince, k)
+		deletedCounter.WithLabelValues(o.Kind, "false").Inc()
+
+		c.logger.Debugf(ctx, "deleted orphaned %s %#q in namespace %#q orphaned since %s", o.Kind, o.Name, o.Namespace, since.Format(time.RFC3339))
+	}
+
+	// Objects referenced by a chart CR again or deleted by someone else
+	// start a new grace period when they are orphaned again.
+	for k := range c.orphanedSince {
+		if !orphaned[k] {
+			delete(c.orphanedSince, k)
+		}
+	}
+
+	return nil
+}
+
+// delete deletes the orphaned object. The preconditions ensure an object
+// recreated with the same name since it was listed is not deleted.
+func (c *Cleaner) delete(ctx context.Context, o orphan.Object) error {
+	opts := metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{
+			ResourceVersion: &o.ResourceVersion,
+			UID:             &o.UID,
+		},
+	}
+
+	var err error
+	switch o.Kind {
+	case orphan.KindConfigMap:
+		err = c.k8sClient.CoreV1().ConfigMaps(o.Namespace).Delete(ctx, o.Name, opts)
+	case orphan.KindSecret:
+		err = c.k8sClient.CoreV1().Secrets(o.Namespace).Delete(ctx, o.Name, opts)
+	}
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func isKept(o orphan.Object) bool {
+	keep, err := strconv.ParseBool(o.Annotations[annotation.KeepOrphan])
+	if err != nil {
+		return false
+	}
+
+	return keep
+}
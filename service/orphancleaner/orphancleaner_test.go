@@ -0,0 +1,191 @@
+package orphancleaner
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/apiextensions/v3/pkg/clientset/versioned/fake"
+	"github.com/giantswarm/apiextensions/v3/pkg/label"
+	"github.com/giantswarm/micrologger/microloggertest"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+)
+
+func Test_Cleaner_cleanup(t *testing.T) {
+	testCases := []struct {
+		name            string
+		annotations     map[string]string
+		dryRun          bool
+		gracePeriod     time.Duration
+		labels          map[string]string
+		expectedDeleted bool
+	}{
+		{
+			name:        "case 0: orphan deleted after grace period",
+			gracePeriod: time.Nanosecond,
+			labels: map[string]string{
+				label.ManagedBy: "app-operator",
+			},
+			expectedDeleted: true,
+		},
+		{
+			name:        "case 1: orphan kept within grace period",
+			gracePeriod: time.Hour,
+			labels: map[string]string{
+				label.ManagedBy: "app-operator",
+			},
+			expectedDeleted: false,
+		},
+		{
+			name: "case 2: orphan kept with annotation",
+			annotations: map[string]string{
+				annotation.KeepOrphan: "true",
+			},
+			gracePeriod: time.Nanosecond,
+			labels: map[string]string{
+				label.ManagedBy: "app-operator",
+			},
+			expectedDeleted: false,
+		},
+		{
+			name:        "case 3: orphan kept with dry run",
+			dryRun:      true,
+			gracePeriod: time.Nanosecond,
+			labels: map[string]string{
+				label.ManagedBy: "app-operator",
+			},
+			expectedDeleted: false,
+		},
+		{
+			name:            "case 4: object not managed by app-operator",
+			gracePeriod:     time.Nanosecond,
+			expectedDeleted: false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			ctx := context.Background()
+
+			objectMeta := metav1.ObjectMeta{
+				Annotations: tc.annotations,
+				Labels:      tc.labels,
+				Name:        "grafana-chart-values",
+				Namespace:   "giantswarm",
+			}
+
+			// The prometheus chart CR uses its configmap and secret, values
+			// sources and credentials and pull secrets so they are never
+			// orphaned.
+			chart := &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.CredentialsSecret: "prometheus-credentials",
+						annotation.OCIPullSecret:     "prometheus-pull-secret",
+						annotation.ValuesSources:     `[{"kind":"ConfigMap","name":"prometheus-extra-values"},{"kind":"Secret","name":"prometheus-extra-secrets"}]`,
+					},
+					Name:      "prometheus",
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Config: v1alpha1.ChartSpecConfig{
+						ConfigMap: v1alpha1.ChartSpecConfigConfigMap{
+							Name:      "prometheus-chart-values",
+							Namespace: "giantswarm",
+						},
+						Secret: v1alpha1.ChartSpecConfigSecret{
+							Name:      "prometheus-chart-secrets",
+							Namespace: "giantswarm",
+						},
+					},
+				},
+			}
+			used := metav1.ObjectMeta{
+				Labels: map[string]string{
+					label.ManagedBy: "app-operator",
+				},
+				Namespace: "giantswarm",
+			}
+			usedConfigMaps := []string{"prometheus-chart-values", "prometheus-extra-values"}
+			usedSecrets := []string{"prometheus-chart-secrets", "prometheus-credentials", "prometheus-extra-secrets", "prometheus-pull-secret"}
+
+			k8sClient := k8sfake.NewSimpleClientset(
+				&corev1.ConfigMap{ObjectMeta: objectMeta},
+				&corev1.Secret{ObjectMeta: objectMeta},
+			)
+			for _, name := range usedConfigMaps {
+				cm := &corev1.ConfigMap{ObjectMeta: *used.DeepCopy()}
+				cm.Name = name
+
+				_, err := k8sClient.CoreV1().ConfigMaps("giantswarm").Create(ctx, cm, metav1.CreateOptions{})
+				if err != nil {
+					t.Fatalf("error == %#v, want nil", err)
+				}
+			}
+			for _, name := range usedSecrets {
+				secret := &corev1.Secret{ObjectMeta: *used.DeepCopy()}
+				secret.Name = name
+
+				_, err := k8sClient.CoreV1().Secrets("giantswarm").Create(ctx, secret, metav1.CreateOptions{})
+				if err != nil {
+					t.Fatalf("error == %#v, want nil", err)
+				}
+			}
+
+			c, err := New(Config{
+				G8sClient: fake.NewSimpleClientset(chart),
+				K8sClient: k8sClient,
+				Logger:    microloggertest.New(),
+
+				DryRun:      tc.dryRun,
+				GracePeriod: tc.gracePeriod,
+				Interval:    time.Minute,
+			})
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			// The first cleanup finds the orphans and the second one deletes
+			// them once the grace period is over.
+			for i := 0; i < 2; i++ {
+				time.Sleep(time.Millisecond)
+
+				err = c.cleanup(ctx)
+				if err != nil {
+					t.Fatalf("error == %#v, want nil", err)
+				}
+			}
+
+			_, err = k8sClient.CoreV1().ConfigMaps("giantswarm").Get(ctx, "grafana-chart-values", metav1.GetOptions{})
+			if deleted := apierrors.IsNotFound(err); deleted != tc.expectedDeleted {
+				t.Fatalf("configmap deleted == %t, want %t", deleted, tc.expectedDeleted)
+			}
+			_, err = k8sClient.CoreV1().Secrets("giantswarm").Get(ctx, "grafana-chart-values", metav1.GetOptions{})
+			if deleted := apierrors.IsNotFound(err); deleted != tc.expectedDeleted {
+				t.Fatalf("secret deleted == %t, want %t", deleted, tc.expectedDeleted)
+			}
+
+			for _, name := range usedConfigMaps {
+				_, err = k8sClient.CoreV1().ConfigMaps("giantswarm").Get(ctx, name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("used configmap %#q deleted: %#v", name, err)
+				}
+			}
+			for _, name := range usedSecrets {
+				_, err = k8sClient.CoreV1().Secrets("giantswarm").Get(ctx, name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("used secret %#q deleted: %#v", name, err)
+				}
+			}
+		})
+	}
+}
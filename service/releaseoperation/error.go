@@ -0,0 +1,41 @@
+package releaseoperation
+
+import (
+	"github.com/giantswarm/microerror"
+)
+
+var concurrencyLimitError = &microerror.Error{
+	Kind: "concurrencyLimitError",
+}
+
+// IsConcurrencyLimit asserts concurrencyLimitError.
+func IsConcurrencyLimit(err error) bool {
+	return microerror.Cause(err) == concurrencyLimitError
+}
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var operationInProgressError = &microerror.Error{
+	Kind: "operationInProgressError",
+}
+
+// IsOperationInProgress asserts operationInProgressError.
+func IsOperationInProgress(err error) bool {
+	return microerror.Cause(err) == operationInProgressError
+}
+
+var shuttingDownError = &microerror.Error{
+	Kind: "shuttingDownError",
+}
+
+// IsShuttingDown asserts shuttingDownError.
+func IsShuttingDown(err error) bool {
+	return microerror.Cause(err) == shuttingDownError
+}
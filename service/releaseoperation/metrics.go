@@ -0,0 +1,46 @@
+package releaseoperation
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/giantswarm/chart-operator/v2/service/collector"
+)
+
+const (
+	metricsSubsystem = "release_operations"
+)
+
+var (
+	inFlightGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: collector.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "in_flight",
+			Help:      "Helm operations in progress by release.",
+		},
+		[]string{"namespace", "release", "operation"},
+	)
+	interruptedGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: collector.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "interrupted",
+			Help:      "Helm operations interrupted by an operator restart and not yet recovered.",
+		},
+	)
+	rejectedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: collector.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "rejected_total",
+			Help:      "Number of Helm operations not started because one was in progress for the release, the concurrency limit was reached or the operator is shutting down.",
+		},
+		[]string{"reason"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(inFlightGauge)
+	prometheus.MustRegister(interruptedGauge)
+	prometheus.MustRegister(rejectedCounter)
+}
@@ -0,0 +1,409 @@
+// Package releaseoperation tracks the Helm operations in progress so only one
+// operation runs per release and the number of concurrent operations is
+// limited. Install and upgrade operations keep running in the background
+// after the release resource stopped waiting for them.
+//
+// The operations in progress are stored in a configmap when they start. So
+// operations interrupted by an operator restart are known on the next start
+// and the release resource can recover their releases.
+package releaseoperation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	"github.com/giantswarm/micrologger/loggermeta"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	Delete   = "delete"
+	Install  = "install"
+	Rollback = "rollback"
+	Upgrade  = "upgrade"
+
+	// configMapName is the name of the configmap storing the operations in
+	// progress and the interrupted operations.
+	configMapName = "chart-operator-release-operations"
+	// configMapKey is the key of the configmap storing the operations
+	// encoded as JSON.
+	configMapKey = "operations"
+	namespace    = "giantswarm"
+
+	// defaultMaxConcurrent is the default maximum number of Helm operations
+	// in progress at the same time.
+	defaultMaxConcurrent = 10
+	// defaultShutdownGracePeriod is the default time to wait for the Helm
+	// operations in progress when shutting down. The pod waits for them in
+	// its preStop hook as the microkit server exits 3 seconds after
+	// receiving a signal.
+	defaultShutdownGracePeriod = 2 * time.Minute
+	// shutdownPollInterval is how often the operations in progress are
+	// checked when shutting down.
+	shutdownPollInterval = 100 * time.Millisecond
+)
+
+type Config struct {
+	K8sClient kubernetes.Interface
+	Logger    micrologger.Logger
+
+	// MaxConcurrent is the maximum number of Helm operations in progress at
+	// the same time.
+	MaxConcurrent int
+	// ShutdownGracePeriod is how long to wait for the Helm operations in
+	// progress when shutting down.
+	ShutdownGracePeriod time.Duration
+}
+
+// Operation is a Helm operation in progress.
+type Operation struct {
+	Namespace string    `json:"namespace"`
+	Release   string    `json:"release"`
+	Started   time.Time `json:"started"`
+	Type      string    `json:"type"`
+}
+
+type Manager struct {
+	k8sClient kubernetes.Interface
+	logger    micrologger.Logger
+
+	maxConcurrent       int
+	shutdownGracePeriod time.Duration
+
+	// ctx is the context of the operations running in the background. It is
+	// canceled once Shutdown returned.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// interrupted are the operations which were in progress when the
+	// operator stopped by namespace and release.
+	interrupted map[string]Operation
+	mutex       sync.Mutex
+	// operations are the operations in progress by namespace and release.
+	operations map[string]Operation
+	// persistMutex ensures the configmap is written by one goroutine at a
+	// time.
+	persistMutex sync.Mutex
+	shuttingDown bool
+}
+
+func New(config Config) (*Manager, error) {
+	if config.K8sClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.K8sClient must not be empty", config)
+	}
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
+	}
+
+	if config.MaxConcurrent == 0 {
+		config.MaxConcurrent = defaultMaxConcurrent
+	}
+	if config.MaxConcurrent < 0 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.MaxConcurrent must not be negative", config)
+	}
+	if config.ShutdownGracePeriod == 0 {
+		config.ShutdownGracePeriod = defaultShutdownGracePeriod
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	m := &Manager{
+		k8sClient: config.K8sClient,
+		logger:    config.Logger,
+
+		maxConcurrent:       config.MaxConcurrent,
+		shutdownGracePeriod: config.ShutdownGracePeriod,
+
+		ctx:    ctx,
+		cancel: cancel,
+
+		interrupted: map[string]Operation{},
+		operations:  map[string]Operation{},
+	}
+
+	return m, nil
+}
+
+// Load reads the operations stored by the previous operator process. They
+// were interrupted and are returned by Interrupted until they are recovered.
+func (m *Manager) Load(ctx context.Context) error {
+	cm, err := m.k8sClient.CoreV1().ConfigMaps(namespace).Get(ctx, configMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	stored := map[string]Operation{}
+	if data := cm.Data[configMapKey]; data != "" {
+		err = json.Unmarshal([]byte(data), &stored)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	m.mutex.Lock()
+	for k, op := range stored {
+		if _, ok := m.operations[k]; ok {
+			continue
+		}
+		m.interrupted[k] = op
+
+		m.logger.Debugf(ctx, "%s of release %#q in namespace %#q started at %s was interrupted", op.Type, op.Release, op.Namespace, op.Started.Format(time.RFC3339))
+	}
+	interruptedGauge.Set(float64(len(m.interrupted)))
+	m.mutex.Unlock()
+
+	return nil
+}
+
+// Start registers the operation for the release. It returns
+// operationInProgressError when an operation is in progress for the release,
+// concurrencyLimitError when the maximum number of operations are in progress
+// and shuttingDownError once Shutdown was called. The returned function must
+// be called once the operation finished.
+func (m *Manager) Start(ctx context.Context, namespace, release, operationType string) (func(), error) {
+	m.mutex.Lock()
+
+	k := operationKey(namespace, release)
+
+	if m.shuttingDown {
+		m.mutex.Unlock()
+		rejectedCounter.WithLabelValues("shutting_down").Inc()
+		return nil, microerror.Maskf(shuttingDownError, "not starting %s of release %#q in namespace %#q", operationType, release, namespace)
+	}
+	if op, ok := m.operations[k]; ok {
+		m.mutex.Unlock()
+		rejectedCounter.WithLabelValues("in_progress").Inc()
+		return nil, microerror.Maskf(operationInProgressError, "%s of release %#q in namespace %#q in progress since %s", op.Type, release, namespace, op.Started.Format(time.RFC3339))
+	}
+	if len(m.operations) >= m.maxConcurrent {
+		n := len(m.operations)
+		m.mutex.Unlock()
+		rejectedCounter.WithLabelValues("concurrency_limit").Inc()
+		return nil, microerror.Maskf(concurrencyLimitError, "%d helm operations in progress", n)
+	}
+
+	op := Operation{
+		Namespace: namespace,
+		Release:   release,
+		Started:   time.Now(),
+		Type:      operationType,
+	}
+	m.operations[k] = op
+	inFlightGauge.WithLabelValues(namespace, release, operationType).Set(1)
+
+	m.mutex.Unlock()
+
+	// The operation is stored before it starts so it is known to be
+	// interrupted even when the operator is killed.
+	m.persist(ctx)
+
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			m.mutex.Lock()
+			delete(m.operations, k)
+			inFlightGauge.DeleteLabelValues(namespace, release, operationType)
+			m.mutex.Unlock()
+
+			// The operation may finish after the reconciliation which
+			// started it.
+			m.persist(m.Context(ctx))
+		})
+	}
+
+	return done, nil
+}
+
+// Context returns the context for running an operation in the background. It
+// lives as long as the operator and is not canceled when the reconciliation
+// which started the operation finished. The logger meta of ctx is kept so the
+// operation is still logged with its chart CR.
+func (m *Manager) Context(ctx context.Context) context.Context {
+	operationCtx := m.ctx
+
+	meta, ok := loggermeta.FromContext(ctx)
+	if ok {
+		operationCtx = loggermeta.NewContext(operationCtx, meta)
+	}
+
+	return operationCtx
+}
+
+// InProgress returns the operation in progress for the release.
+func (m *Manager) InProgress(namespace, release string) (Operation, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	op, ok := m.operations[operationKey(namespace, release)]
+	return op, ok
+}
+
+// Interrupted returns the operation for the release interrupted by an
+// operator restart.
+func (m *Manager) Interrupted(namespace, release string) (Operation, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	op, ok := m.interrupted[operationKey(namespace, release)]
+	return op, ok
+}
+
+// Recovered removes the interrupted operation for the release once its
+// release was recovered.
+func (m *Manager) Recovered(ctx context.Context, namespace, release string) {
+	m.mutex.Lock()
+	k := operationKey(namespace, release)
+	_, ok := m.interrupted[k]
+	delete(m.interrupted, k)
+	interruptedGauge.Set(float64(len(m.interrupted)))
+	m.mutex.Unlock()
+
+	if ok {
+		m.persist(ctx)
+	}
+}
+
+// List returns the operations in progress sorted by namespace and release.
+func (m *Manager) List() []Operation {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return sortOperations(m.operations)
+}
+
+// Shutdown stops starting new operations and waits for the operations in
+// progress until the shutdown grace period is over. The operations still in
+// progress then stay stored as interrupted for the next operator start and
+// their context is canceled.
+func (m *Manager) Shutdown(ctx context.Context) {
+	m.mutex.Lock()
+	m.shuttingDown = true
+	m.mutex.Unlock()
+
+	defer m.cancel()
+
+	m.logger.Debugf(ctx, "waiting %s for helm operations in progress", m.shutdownGracePeriod)
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	deadline := time.After(m.shutdownGracePeriod)
+
+	for {
+		m.mutex.Lock()
+		n := len(m.operations)
+		m.mutex.Unlock()
+
+		if n == 0 {
+			m.logger.Debugf(ctx, "no helm operations in progress")
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			for _, op := range m.List() {
+				m.logger.LogCtx(ctx, "level", "warning", "message", fmt.Sprintf("interrupting %s of release %#q in namespace %#q started at %s", op.Type, op.Release, op.Namespace, op.Started.Format(time.RFC3339)))
+			}
+			return
+		}
+	}
+}
+
+// persist stores the operations in progress and the interrupted operations
+// in the configmap. Errors are only logged so a failing Kubernetes API does
+// not block Helm operations.
+func (m *Manager) persist(ctx context.Context) {
+	m.persistMutex.Lock()
+	defer m.persistMutex.Unlock()
+
+	m.mutex.Lock()
+	stored := map[string]Operation{}
+	for k, op := range m.interrupted {
+		stored[k] = op
+	}
+	for k, op := range m.operations {
+		stored[k] = op
+	}
+	data, err := json.Marshal(stored)
+	m.mutex.Unlock()
+	if err != nil {
+		m.logger.Errorf(ctx, err, "encoding helm operations failed")
+		return
+	}
+
+	err = m.writeConfigMap(ctx, string(data))
+	if err != nil {
+		m.logger.Errorf(ctx, err, "storing helm operations failed")
+	}
+}
+
+func (m *Manager) writeConfigMap(ctx context.Context, data string) error {
+	cm, err := m.k8sClient.CoreV1().ConfigMaps(namespace).Get(ctx, configMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configMapName,
+				Namespace: namespace,
+			},
+			Data: map[string]string{
+				configMapKey: data,
+			},
+		}
+
+		_, err = m.k8sClient.CoreV1().ConfigMaps(namespace).Create(ctx, cm, metav1.CreateOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	if cm.Data[configMapKey] == data {
+		return nil
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[configMapKey] = data
+
+	_, err = m.k8sClient.CoreV1().ConfigMaps(namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func operationKey(namespace, release string) string {
+	return fmt.Sprintf("%s/%s", namespace, release)
+}
+
+func sortOperations(m map[string]Operation) []Operation {
+	operations := make([]Operation, 0, len(m))
+	for _, op := range m {
+		operations = append(operations, op)
+	}
+
+	sort.Slice(operations, func(i, j int) bool {
+		if operations[i].Namespace != operations[j].Namespace {
+			return operations[i].Namespace < operations[j].Namespace
+		}
+		return operations[i].Release < operations[j].Release
+	})
+
+	return operations
+}
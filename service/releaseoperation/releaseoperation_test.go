@@ -0,0 +1,173 @@
+package releaseoperation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_Manager(t *testing.T) {
+	ctx := context.Background()
+
+	m, err := New(Config{
+		K8sClient: fake.NewSimpleClientset(),
+		Logger:    microloggertest.New(),
+
+		MaxConcurrent: 2,
+	})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	doneInstall, err := m.Start(ctx, "monitoring", "prometheus", Install)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	// A second operation for the same release is refused.
+	_, err = m.Start(ctx, "monitoring", "prometheus", Upgrade)
+	if !IsOperationInProgress(err) {
+		t.Fatalf("error == %#v, want operationInProgressError", err)
+	}
+
+	// The same release name in another namespace is a different release.
+	doneUpgrade, err := m.Start(ctx, "kube-system", "prometheus", Upgrade)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	// The concurrency limit is reached.
+	_, err = m.Start(ctx, "monitoring", "grafana", Install)
+	if !IsConcurrencyLimit(err) {
+		t.Fatalf("error == %#v, want concurrencyLimitError", err)
+	}
+
+	operations := m.List()
+	if len(operations) != 2 || operations[0].Namespace != "kube-system" || operations[1].Type != Install {
+		t.Fatalf("operations == %#v, want sorted upgrade and install", operations)
+	}
+
+	doneInstall()
+	// Calling done again must not remove other operations.
+	doneInstall()
+
+	if _, ok := m.InProgress("monitoring", "prometheus"); ok {
+		t.Fatalf("operation in progress after done")
+	}
+	if _, ok := m.InProgress("kube-system", "prometheus"); !ok {
+		t.Fatalf("operation not in progress before done")
+	}
+
+	done, err := m.Start(ctx, "monitoring", "grafana", Install)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	done()
+	doneUpgrade()
+
+	if len(m.List()) != 0 {
+		t.Fatalf("operations == %#v, want none", m.List())
+	}
+}
+
+func Test_Manager_Shutdown(t *testing.T) {
+	ctx := context.Background()
+
+	k8sClient := fake.NewSimpleClientset()
+
+	m, err := New(Config{
+		K8sClient: k8sClient,
+		Logger:    microloggertest.New(),
+
+		ShutdownGracePeriod: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	done, err := m.Start(ctx, "monitoring", "grafana", Upgrade)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	// The upgrade finishes within the grace period.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		done()
+	}()
+
+	_, err = m.Start(ctx, "monitoring", "prometheus", Upgrade)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	// The context of the operations outlives the context they were started
+	// with.
+	reconcileCtx, cancel := context.WithCancel(ctx)
+	operationCtx := m.Context(reconcileCtx)
+	cancel()
+	if operationCtx.Err() != nil {
+		t.Fatalf("operation context canceled with the reconcile context")
+	}
+
+	start := time.Now()
+	m.Shutdown(ctx)
+	if time.Since(start) < 200*time.Millisecond {
+		t.Fatalf("shutdown returned before the grace period")
+	}
+	if operationCtx.Err() == nil {
+		t.Fatalf("operation context not canceled after shutdown")
+	}
+
+	_, err = m.Start(ctx, "monitoring", "loki", Install)
+	if !IsShuttingDown(err) {
+		t.Fatalf("error == %#v, want shuttingDownError", err)
+	}
+
+	cm, err := k8sClient.CoreV1().ConfigMaps(namespace).Get(ctx, configMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	if cm.Data[configMapKey] == "" {
+		t.Fatalf("operations not stored")
+	}
+
+	// The next operator process knows the upgrade was interrupted.
+	next, err := New(Config{
+		K8sClient: k8sClient,
+		Logger:    microloggertest.New(),
+	})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	err = next.Load(ctx)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	op, ok := next.Interrupted("monitoring", "prometheus")
+	if !ok || op.Type != Upgrade {
+		t.Fatalf("interrupted == %#v, want upgrade", op)
+	}
+	if _, ok := next.Interrupted("monitoring", "grafana"); ok {
+		t.Fatalf("finished operation is interrupted")
+	}
+
+	next.Recovered(ctx, "monitoring", "prometheus")
+
+	if _, ok := next.Interrupted("monitoring", "prometheus"); ok {
+		t.Fatalf("recovered operation is interrupted")
+	}
+
+	cm, err = k8sClient.CoreV1().ConfigMaps(namespace).Get(ctx, configMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	if cm.Data[configMapKey] != "{}" {
+		t.Fatalf("operations == %#q, want none", cm.Data[configMapKey])
+	}
+}
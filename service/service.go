@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"os"
 	"sync"
 
 	applicationv1alpha1 "github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
@@ -15,13 +16,20 @@ import (
 	"github.com/giantswarm/versionbundle"
 	"github.com/spf13/afero"
 	"github.com/spf13/viper"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 
 	"github.com/giantswarm/chart-operator/v2/flag"
 	"github.com/giantswarm/chart-operator/v2/pkg/project"
 	"github.com/giantswarm/chart-operator/v2/service/collector"
 	"github.com/giantswarm/chart-operator/v2/service/controller/chart"
+	"github.com/giantswarm/chart-operator/v2/service/helmstorage"
+	"github.com/giantswarm/chart-operator/v2/service/orphancleaner"
+	"github.com/giantswarm/chart-operator/v2/service/releaseoperation"
+	"github.com/giantswarm/chart-operator/v2/service/valueswatcher"
+	"github.com/giantswarm/chart-operator/v2/service/webhookoutbox"
 )
 
 // Config represents the configuration used to create a new service.
@@ -36,12 +44,21 @@ type Config struct {
 
 // Service is a type providing implementation of microkit service interface.
 type Service struct {
-	Version *version.Service
+	ReleaseOperations *releaseoperation.Manager
+	Version           *version.Service
 
 	// Internals
 	bootOnce          sync.Once
 	chartController   *chart.Chart
+	leaderElector     *leaderelection.LeaderElector
+	logger            micrologger.Logger
 	operatorCollector *collector.Set
+	orphanCleaner     *orphancleaner.Cleaner
+	shutdownOnce      sync.Once
+	valuesWatcher     *valueswatcher.ValuesWatcher
+	webhookOutbox     *webhookoutbox.Outbox
+	workerCancel      context.CancelFunc
+	workerCtx         context.Context
 }
 
 // New creates a new service with given configuration.
@@ -102,13 +119,15 @@ func New(config Config) (*Service, error) {
 
 	fs := afero.NewOsFs()
 
+	// restMapper is shared by the Helm client and the drift check of the
+	// release resource.
+	restMapper, err := apiutil.NewDynamicRESTMapper(rest.CopyConfig(k8sClient.RESTConfig()))
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
 	var helmClient *helmclient.Client
 	{
-		restMapper, err := apiutil.NewDynamicRESTMapper(rest.CopyConfig(k8sClient.RESTConfig()))
-		if err != nil {
-			return nil, microerror.Mask(err)
-		}
-
 		c := helmclient.Config{
 			Fs:         fs,
 			K8sClient:  k8sClient.K8sClient(),
@@ -126,18 +145,71 @@ func New(config Config) (*Service, error) {
 		}
 	}
 
-	var chartController *chart.Chart
+	var helmStorage *helmstorage.Storage
 	{
-		c := chart.Config{
-			Fs:         fs,
-			HelmClient: helmClient,
-			Logger:     config.Logger,
-			K8sClient:  k8sClient,
+		c := helmstorage.Config{
+			K8sClient: k8sClient.K8sClient(),
+		}
 
+		helmStorage, err = helmstorage.New(c)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	}
+
+	var webhookOutbox *webhookoutbox.Outbox
+	{
+		c := webhookoutbox.Config{
+			K8sClient: k8sClient.K8sClient(),
+			Logger:    config.Logger,
+
+			AllowedHosts:      config.Viper.GetStringSlice(config.Flag.Service.Webhook.AllowedHosts),
 			HTTPClientTimeout: config.Viper.GetDuration(config.Flag.Service.Helm.HTTP.ClientTimeout),
-			K8sWaitTimeout:    config.Viper.GetDuration(config.Flag.Service.Helm.Kubernetes.WaitTimeout),
-			MaxRollback:       config.Viper.GetInt(config.Flag.Service.Helm.MaxRollback),
-			TillerNamespace:   config.Viper.GetString(config.Flag.Service.Helm.TillerNamespace),
+		}
+
+		webhookOutbox, err = webhookoutbox.New(c)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	}
+
+	var releaseOperations *releaseoperation.Manager
+	{
+		c := releaseoperation.Config{
+			K8sClient: k8sClient.K8sClient(),
+			Logger:    config.Logger,
+
+			MaxConcurrent:       config.Viper.GetInt(config.Flag.Service.Helm.MaxConcurrentOperations),
+			ShutdownGracePeriod: config.Viper.GetDuration(config.Flag.Service.Helm.ShutdownGracePeriod),
+		}
+
+		releaseOperations, err = releaseoperation.New(c)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	}
+
+	var chartController *chart.Chart
+	{
+		c := chart.Config{
+			Fs:                fs,
+			HelmClient:        helmClient,
+			HelmStorage:       helmStorage,
+			Logger:            config.Logger,
+			K8sClient:         k8sClient,
+			ReleaseOperations: releaseOperations,
+			RESTMapper:        restMapper,
+			WebhookOutbox:     webhookOutbox,
+
+			DriftCheckInterval:  config.Viper.GetDuration(config.Flag.Service.Helm.DriftCheckInterval),
+			HTTPClientTimeout:   config.Viper.GetDuration(config.Flag.Service.Helm.HTTP.ClientTimeout),
+			K8sWaitTimeout:      config.Viper.GetDuration(config.Flag.Service.Helm.Kubernetes.WaitTimeout),
+			MaxRollback:         config.Viper.GetInt(config.Flag.Service.Helm.MaxRollback),
+			SecretNamespaces:    config.Viper.GetStringSlice(config.Flag.Service.Helm.SecretNamespaces),
+			SelfHealInterval:    config.Viper.GetDuration(config.Flag.Service.Helm.SelfHealInterval),
+			TarballCacheMaxSize: config.Viper.GetInt64(config.Flag.Service.Helm.TarballCacheMaxSize),
+			TillerNamespace:     config.Viper.GetString(config.Flag.Service.Helm.TillerNamespace),
+			VerifyPolicy:        config.Viper.GetString(config.Flag.Service.Helm.VerifyPolicy),
 		}
 
 		chartController, err = chart.NewChart(c)
@@ -162,6 +234,43 @@ func New(config Config) (*Service, error) {
 		}
 	}
 
+	var orphanCleaner *orphancleaner.Cleaner
+	if config.Viper.GetBool(config.Flag.Service.OrphanCleanup.Enabled) {
+		c := orphancleaner.Config{
+			G8sClient: k8sClient.G8sClient(),
+			K8sClient: k8sClient.K8sClient(),
+			Logger:    config.Logger,
+
+			DryRun:      config.Viper.GetBool(config.Flag.Service.OrphanCleanup.DryRun),
+			GracePeriod: config.Viper.GetDuration(config.Flag.Service.OrphanCleanup.GracePeriod),
+			Interval:    config.Viper.GetDuration(config.Flag.Service.OrphanCleanup.Interval),
+		}
+
+		orphanCleaner, err = orphancleaner.New(c)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	}
+
+	var valuesWatcher *valueswatcher.ValuesWatcher
+	{
+		metadataClient, err := metadata.NewForConfig(rest.CopyConfig(k8sClient.RESTConfig()))
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		c := valueswatcher.Config{
+			G8sClient:      k8sClient.G8sClient(),
+			Logger:         config.Logger,
+			MetadataClient: metadataClient,
+		}
+
+		valuesWatcher, err = valueswatcher.New(c)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	}
+
 	var versionService *version.Service
 	{
 		versionConfig := version.Config{
@@ -179,12 +288,41 @@ func New(config Config) (*Service, error) {
 		}
 	}
 
+	workerCtx, workerCancel := context.WithCancel(context.Background())
+
 	s := &Service{
-		Version: versionService,
+		ReleaseOperations: releaseOperations,
+		Version:           versionService,
 
 		bootOnce:          sync.Once{},
 		chartController:   chartController,
+		logger:            config.Logger,
 		operatorCollector: operatorCollector,
+		orphanCleaner:     orphanCleaner,
+		shutdownOnce:      sync.Once{},
+		valuesWatcher:     valuesWatcher,
+		webhookOutbox:     webhookOutbox,
+		workerCancel:      workerCancel,
+		workerCtx:         workerCtx,
+	}
+
+	if config.Viper.GetBool(config.Flag.Service.LeaderElection.Enabled) {
+		c := leaderElectorConfig{
+			K8sClient: k8sClient.K8sClient(),
+			Logger:    config.Logger,
+
+			LeaseDuration: config.Viper.GetDuration(config.Flag.Service.LeaderElection.LeaseDuration),
+			Namespace:     config.Viper.GetString(config.Flag.Service.LeaderElection.Namespace),
+			RenewDeadline: config.Viper.GetDuration(config.Flag.Service.LeaderElection.RenewDeadline),
+			RetryPeriod:   config.Viper.GetDuration(config.Flag.Service.LeaderElection.RetryPeriod),
+
+			OnStartedLeading: s.bootWorkers,
+		}
+
+		s.leaderElector, err = newLeaderElector(c)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
 	}
 
 	return s, nil
@@ -193,6 +331,7 @@ func New(config Config) (*Service, error) {
 // Boot starts top level service implementation.
 func (s *Service) Boot(ctx context.Context) {
 	s.bootOnce.Do(func() {
+		// Metrics are collected by all replicas.
 		go func() {
 			err := s.operatorCollector.Boot(ctx)
 			if err != nil {
@@ -200,6 +339,66 @@ func (s *Service) Boot(ctx context.Context) {
 			}
 		}()
 
-		go s.chartController.Boot(ctx)
+		// The context is canceled when the operator is stopped. The pod
+		// usually shuts down in its preStop hook already.
+		workerCtx := s.workerCtx
+		go func() {
+			<-ctx.Done()
+			s.Shutdown(context.Background())
+		}()
+
+		if s.leaderElector == nil {
+			s.bootWorkers(workerCtx)
+			return
+		}
+
+		// Standby replicas only serve healthz and metrics until they
+		// acquire the lease.
+		go func() {
+			s.leaderElector.Run(workerCtx)
+
+			// The chart controller cannot be stopped once it booted. So the
+			// replica exits when it lost the lease while it is not shutting
+			// down and restarts as a standby replica.
+			if workerCtx.Err() == nil {
+				s.logger.LogCtx(workerCtx, "level", "error", "message", "lost leader election lease, exiting")
+				os.Exit(1)
+			}
+		}()
+	})
+}
+
+// Shutdown stops starting Helm operations and waits for the ones in progress
+// until the shutdown grace period is over. Then the workers are stopped and the
+// lease is released. It is called by the preStop hook of the pod via the
+// shutdown endpoint as microkit exits 3 seconds after receiving SIGTERM.
+// Concurrent calls wait until the first call finished.
+func (s *Service) Shutdown(ctx context.Context) {
+	s.shutdownOnce.Do(func() {
+		s.ReleaseOperations.Shutdown(ctx)
+		s.workerCancel()
 	})
 }
+
+// bootWorkers starts the chart controller and the workers which must only
+// run in the leader replica.
+func (s *Service) bootWorkers(ctx context.Context) {
+	// The operations interrupted by the last operator restart are loaded
+	// before the chart controller boots so their releases are recovered.
+	// Failing to load them is fatal as they would be overwritten once the
+	// next operation starts.
+	err := s.ReleaseOperations.Load(ctx)
+	if err != nil {
+		panic(microerror.JSON(err))
+	}
+
+	go s.chartController.Boot(ctx)
+
+	if s.orphanCleaner != nil {
+		go s.orphanCleaner.Boot(ctx)
+	}
+
+	go s.valuesWatcher.Boot(ctx)
+
+	go s.webhookOutbox.Boot(ctx)
+}
@@ -0,0 +1,294 @@
+// Package valueswatcher triggers the reconciliation of chart CRs when the
+// configmaps and secrets providing their values are created, changed or
+// deleted. Otherwise changes are only picked up on the next resync of the
+// chart controller. The chart CRs are not reconciled by the watcher. It sets
+// the values changed annotation so the chart controller queues them.
+package valueswatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/apiextensions/v3/pkg/clientset/versioned"
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+)
+
+const (
+	// helmReleaseSecretType is the type of the secrets storing Helm
+	// releases. They are never used as values so they are not watched.
+	helmReleaseSecretType = "helm.sh/release.v1"
+	// valuesIndex is the name of the chart CR index by the configmaps and
+	// secrets providing their values.
+	valuesIndex = "values"
+)
+
+// trigger is the queued chart CR and the configmap or secret change
+// triggering its reconciliation.
+type trigger struct {
+	chart   types.NamespacedName
+	changed string
+}
+
+type Config struct {
+	G8sClient      versioned.Interface
+	Logger         micrologger.Logger
+	MetadataClient metadata.Interface
+}
+
+type ValuesWatcher struct {
+	g8sClient versioned.Interface
+	logger    micrologger.Logger
+
+	chartInformer     cache.SharedIndexInformer
+	configMapInformer cache.SharedIndexInformer
+	queue             workqueue.RateLimitingInterface
+	secretInformer    cache.SharedIndexInformer
+	// synced is set once the informers listed the existing objects. Adds
+	// are only handled afterwards so not all chart CRs are reconciled on
+	// start.
+	synced int32
+}
+
+func New(config Config) (*ValuesWatcher, error) {
+	if config.G8sClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.G8sClient must not be empty", config)
+	}
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
+	}
+	if config.MetadataClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.MetadataClient must not be empty", config)
+	}
+
+	chartInformer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return config.G8sClient.ApplicationV1alpha1().Charts(metav1.NamespaceAll).List(context.Background(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return config.G8sClient.ApplicationV1alpha1().Charts(metav1.NamespaceAll).Watch(context.Background(), options)
+			},
+		},
+		&v1alpha1.Chart{},
+		0,
+		cache.Indexers{
+			valuesIndex: valuesIndexFunc,
+		},
+	)
+
+	// Only the metadata of configmaps and secrets is cached. Their data is
+	// read by the release resource when the chart CR is reconciled.
+	configMapInformer := metadatainformer.NewFilteredMetadataInformer(config.MetadataClient, corev1.SchemeGroupVersion.WithResource("configmaps"), metav1.NamespaceAll, 0, cache.Indexers{}, nil)
+	secretInformer := metadatainformer.NewFilteredMetadataInformer(config.MetadataClient, corev1.SchemeGroupVersion.WithResource("secrets"), metav1.NamespaceAll, 0, cache.Indexers{}, func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermNotEqualSelector("type", helmReleaseSecretType).String()
+	})
+
+	w := &ValuesWatcher{
+		g8sClient: config.G8sClient,
+		logger:    config.Logger,
+
+		chartInformer:     chartInformer,
+		configMapInformer: configMapInformer.Informer(),
+		queue:             workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "valueswatcher"),
+		secretInformer:    secretInformer.Informer(),
+	}
+
+	return w, nil
+}
+
+// Boot starts the informers and triggers the reconciliation of the queued
+// chart CRs until the context is done.
+func (w *ValuesWatcher) Boot(ctx context.Context) {
+	informers := map[string]cache.SharedIndexInformer{
+		key.ValuesSourceKindConfigMap: w.configMapInformer,
+		key.ValuesSourceKindSecret:    w.secretInformer,
+	}
+	for kind, informer := range informers {
+		kind := kind
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if atomic.LoadInt32(&w.synced) == 0 {
+					return
+				}
+
+				w.onChange(ctx, kind, obj, "created")
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				w.onChange(ctx, kind, newObj, "updated")
+			},
+			DeleteFunc: func(obj interface{}) {
+				w.onChange(ctx, kind, obj, "deleted")
+			},
+		})
+	}
+
+	go func() {
+		<-ctx.Done()
+		w.queue.ShutDown()
+	}()
+
+	go w.chartInformer.Run(ctx.Done())
+	go w.configMapInformer.Run(ctx.Done())
+	go w.secretInformer.Run(ctx.Done())
+
+	w.logger.Debugf(ctx, "waiting for values watcher caches to sync")
+
+	if !cache.WaitForCacheSync(ctx.Done(), w.chartInformer.HasSynced, w.configMapInformer.HasSynced, w.secretInformer.HasSynced) {
+		return
+	}
+	atomic.StoreInt32(&w.synced, 1)
+
+	w.logger.Debugf(ctx, "waited for values watcher caches to sync")
+
+	for w.processNextItem(ctx) {
+	}
+}
+
+// onChange queues the chart CRs using the changed configmap or secret so
+// they are reconciled. Only the metadata is watched so any update queues
+// them.
+func (w *ValuesWatcher) onChange(ctx context.Context, kind string, obj interface{}, change string) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+
+	objs, err := w.chartInformer.GetIndexer().ByIndex(valuesIndex, valuesIndexKey(kind, m.GetNamespace(), m.GetName()))
+	if err != nil {
+		w.logger.Errorf(ctx, err, "failed to get chart CRs using %s %#q in namespace %#q", kind, m.GetName(), m.GetNamespace())
+		return
+	}
+
+	for _, obj := range objs {
+		cr, err := key.ToCustomResource(obj)
+		if err != nil {
+			w.logger.Errorf(ctx, err, "failed to convert chart CR")
+			continue
+		}
+
+		w.queue.Add(trigger{
+			chart:   types.NamespacedName{Namespace: cr.Namespace, Name: cr.Name},
+			changed: fmt.Sprintf("%s@%s", valuesIndexKey(kind, m.GetNamespace(), m.GetName()), m.GetResourceVersion()),
+		})
+
+		w.logger.Debugf(ctx, "queued reconciliation of chart CR %#q in namespace %#q as %s %#q in namespace %#q was %s", cr.Name, cr.Namespace, kind, m.GetName(), m.GetNamespace(), change)
+	}
+}
+
+// processNextItem triggers the reconciliation of the next queued chart CR.
+// The same change queued again before it is processed is only processed
+// once. It returns false once the queue is shut down.
+func (w *ValuesWatcher) processNextItem(ctx context.Context) bool {
+	item, shutdown := w.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer w.queue.Done(item)
+
+	t, ok := item.(trigger)
+	if !ok {
+		w.queue.Forget(item)
+		return true
+	}
+
+	err := w.triggerChart(ctx, t)
+	if apierrors.IsNotFound(err) {
+		// The chart CR was deleted in the meantime.
+	} else if err != nil {
+		w.logger.Errorf(ctx, err, "failed to trigger reconciliation of chart CR %#q in namespace %#q", t.chart.Name, t.chart.Namespace)
+		w.queue.AddRateLimited(item)
+		return true
+	}
+
+	w.queue.Forget(item)
+
+	return true
+}
+
+// triggerChart sets the values changed annotation on the chart CR. The update
+// event causes the chart controller to queue it so it is reconciled like any
+// other change of the chart CR.
+func (w *ValuesWatcher) triggerChart(ctx context.Context, t trigger) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				annotation.ValuesChanged: t.changed,
+			},
+		},
+	}
+
+	bytes, err := json.Marshal(patch)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	_, err = w.g8sClient.ApplicationV1alpha1().Charts(t.chart.Namespace).Patch(ctx, t.chart.Name, types.MergePatchType, bytes, metav1.PatchOptions{})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// valuesIndexFunc indexes chart CRs by the configmaps and secrets in their
+// spec and in the values sources annotation.
+func valuesIndexFunc(obj interface{}) ([]string, error) {
+	cr, err := key.ToCustomResource(obj)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var keys []string
+
+	if key.ConfigMapName(cr) != "" {
+		keys = append(keys, valuesIndexKey(key.ValuesSourceKindConfigMap, key.ConfigMapNamespace(cr), key.ConfigMapName(cr)))
+	}
+	if key.SecretName(cr) != "" {
+		keys = append(keys, valuesIndexKey(key.ValuesSourceKindSecret, key.SecretNamespace(cr), key.SecretName(cr)))
+	}
+
+	sources, err := key.ValuesSources(cr)
+	if err != nil {
+		// Invalid values sources are reported when the chart CR is
+		// reconciled so we only index the spec.
+		return keys, nil
+	}
+
+	for _, s := range sources {
+		namespace := s.Namespace
+		if namespace == "" {
+			namespace = cr.Namespace
+		}
+
+		keys = append(keys, valuesIndexKey(s.Kind, namespace, s.Name))
+	}
+
+	return keys, nil
+}
+
+func valuesIndexKey(kind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
@@ -0,0 +1,230 @@
+package valueswatcher
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/giantswarm/apiextensions/v3/pkg/apis/application/v1alpha1"
+	"github.com/giantswarm/apiextensions/v3/pkg/clientset/versioned/fake"
+	"github.com/giantswarm/micrologger/microloggertest"
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/annotation"
+	"github.com/giantswarm/chart-operator/v2/service/controller/chart/key"
+)
+
+func Test_valuesIndexFunc(t *testing.T) {
+	testCases := []struct {
+		name         string
+		obj          *v1alpha1.Chart
+		expectedKeys []string
+	}{
+		{
+			name: "case 0: no values",
+			obj: &v1alpha1.Chart{
+				Spec: v1alpha1.ChartSpec{
+					Name: "prometheus",
+				},
+			},
+		},
+		{
+			name: "case 1: configmap, secret and values sources",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.ValuesSources: `[{"kind":"ConfigMap","name":"catalog-values","namespace":"giantswarm"},{"kind":"Secret","name":"cluster-secrets"}]`,
+					},
+					Namespace: "default",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name: "prometheus",
+					Config: v1alpha1.ChartSpecConfig{
+						ConfigMap: v1alpha1.ChartSpecConfigConfigMap{
+							Name:      "prometheus-values",
+							Namespace: "monitoring",
+						},
+						Secret: v1alpha1.ChartSpecConfigSecret{
+							Name:      "prometheus-secrets",
+							Namespace: "monitoring",
+						},
+					},
+				},
+			},
+			expectedKeys: []string{
+				"ConfigMap/monitoring/prometheus-values",
+				"Secret/monitoring/prometheus-secrets",
+				"ConfigMap/giantswarm/catalog-values",
+				"Secret/default/cluster-secrets",
+			},
+		},
+		{
+			name: "case 2: invalid values sources",
+			obj: &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotation.ValuesSources: `invalid`,
+					},
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name: "prometheus",
+					Config: v1alpha1.ChartSpecConfig{
+						ConfigMap: v1alpha1.ChartSpecConfigConfigMap{
+							Name:      "prometheus-values",
+							Namespace: "monitoring",
+						},
+					},
+				},
+			},
+			expectedKeys: []string{
+				"ConfigMap/monitoring/prometheus-values",
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			keys, err := valuesIndexFunc(tc.obj)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			if !cmp.Equal(keys, tc.expectedKeys) {
+				t.Fatalf("want matching keys \n %s", cmp.Diff(keys, tc.expectedKeys))
+			}
+		})
+	}
+}
+
+func Test_ValuesWatcher_onChange(t *testing.T) {
+	testCases := []struct {
+		name              string
+		kind              string
+		obj               interface{}
+		expectedTriggered string
+	}{
+		{
+			name: "case 0: referenced configmap changed",
+			kind: key.ValuesSourceKindConfigMap,
+			obj: &metav1.PartialObjectMetadata{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "prometheus-values",
+					Namespace:       "monitoring",
+					ResourceVersion: "2",
+				},
+			},
+			expectedTriggered: "ConfigMap/monitoring/prometheus-values@2",
+		},
+		{
+			name: "case 1: referenced secret deleted",
+			kind: key.ValuesSourceKindSecret,
+			obj: cache.DeletedFinalStateUnknown{
+				Key: "monitoring/prometheus-secrets",
+				Obj: &metav1.PartialObjectMetadata{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:            "prometheus-secrets",
+						Namespace:       "monitoring",
+						ResourceVersion: "3",
+					},
+				},
+			},
+			expectedTriggered: "Secret/monitoring/prometheus-secrets@3",
+		},
+		{
+			name: "case 2: secret with the name of the referenced configmap changed",
+			kind: key.ValuesSourceKindSecret,
+			obj: &metav1.PartialObjectMetadata{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "prometheus-values",
+					Namespace: "monitoring",
+				},
+			},
+		},
+		{
+			name: "case 3: other configmap changed",
+			kind: key.ValuesSourceKindConfigMap,
+			obj: &metav1.PartialObjectMetadata{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "other-values",
+					Namespace: "monitoring",
+				},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			cr := &v1alpha1.Chart{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "prometheus",
+					Namespace: "giantswarm",
+				},
+				Spec: v1alpha1.ChartSpec{
+					Name: "prometheus",
+					Config: v1alpha1.ChartSpecConfig{
+						ConfigMap: v1alpha1.ChartSpecConfigConfigMap{
+							Name:      "prometheus-values",
+							Namespace: "monitoring",
+						},
+						Secret: v1alpha1.ChartSpecConfigSecret{
+							Name:      "prometheus-secrets",
+							Namespace: "monitoring",
+						},
+					},
+				},
+			}
+
+			g8sClient := fake.NewSimpleClientset(cr)
+
+			c := Config{
+				G8sClient:      g8sClient,
+				Logger:         microloggertest.New(),
+				MetadataClient: metadatafake.NewSimpleMetadataClient(runtime.NewScheme()),
+			}
+
+			w, err := New(c)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			err = w.chartInformer.GetIndexer().Add(cr)
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			ctx := context.Background()
+
+			w.onChange(ctx, tc.kind, tc.obj, "changed")
+
+			// The change is queued once when it is queued again before it
+			// is processed.
+			w.onChange(ctx, tc.kind, tc.obj, "changed")
+
+			if tc.expectedTriggered != "" && w.queue.Len() != 1 {
+				t.Fatalf("queue length == %d, want %d", w.queue.Len(), 1)
+			}
+
+			for w.queue.Len() > 0 {
+				w.processNextItem(ctx)
+			}
+
+			result, err := g8sClient.ApplicationV1alpha1().Charts(cr.Namespace).Get(ctx, cr.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			triggered := result.GetAnnotations()[annotation.ValuesChanged]
+			if triggered != tc.expectedTriggered {
+				t.Fatalf("values changed == %#q, want %#q", triggered, tc.expectedTriggered)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package webhookoutbox
+
+import (
+	"github.com/giantswarm/microerror"
+)
+
+var hostNotAllowedError = &microerror.Error{
+	Kind: "hostNotAllowedError",
+}
+
+// IsHostNotAllowed asserts hostNotAllowedError.
+func IsHostNotAllowed(err error) bool {
+	return microerror.Cause(err) == hostNotAllowedError
+}
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var invalidTLSConfigError = &microerror.Error{
+	Kind: "invalidTLSConfigError",
+}
+
+// IsInvalidTLSConfig asserts invalidTLSConfigError.
+func IsInvalidTLSConfig(err error) bool {
+	return microerror.Cause(err) == invalidTLSConfigError
+}
+
+var wrongStatusError = &microerror.Error{
+	Kind: "wrongStatusError",
+}
+
+// IsWrongStatusError asserts wrongStatusError.
+func IsWrongStatusError(err error) bool {
+	return microerror.Cause(err) == wrongStatusError
+}
@@ -0,0 +1,44 @@
+package webhookoutbox
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/giantswarm/chart-operator/v2/service/collector"
+)
+
+const (
+	metricsSubsystem = "webhook"
+)
+
+var (
+	deliveredCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: collector.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "deliveries_delivered_total",
+			Help:      "Number of status webhooks delivered.",
+		},
+	)
+	failedCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: collector.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "deliveries_failed_total",
+			Help:      "Number of failed status webhook delivery attempts.",
+		},
+	)
+	pendingGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: collector.Namespace,
+			Subsystem: metricsSubsystem,
+			Name:      "deliveries_pending",
+			Help:      "Number of status webhooks waiting to be retried.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(deliveredCounter)
+	prometheus.MustRegister(failedCounter)
+	prometheus.MustRegister(pendingGauge)
+}
@@ -0,0 +1,521 @@
+// Package webhookoutbox delivers the status webhooks of chart CRs. Failed
+// deliveries are retried with exponential backoff. Only the latest status of
+// each chart CR is kept and the pending deliveries are stored in a configmap
+// so they are not lost when the operator restarts.
+package webhookoutbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/webhook"
+)
+
+const (
+	authTokenName = "auth-token"
+	// caKey is the key of the webhook secret with the PEM encoded CA the
+	// webhook server certificate must be signed by.
+	caKey = "ca.crt"
+	// configMapName is the name of the configmap storing the pending
+	// deliveries.
+	configMapName = "chart-operator-webhook-outbox"
+	// configMapKey is the key of the configmap storing the pending deliveries
+	// encoded as JSON.
+	configMapKey = "deliveries"
+	// defaultHTTPClientTimeout is the timeout when sending a webhook.
+	defaultHTTPClientTimeout = 5 * time.Second
+	// initialBackoff is the delay before the first retry. It is doubled on
+	// every failed attempt up to maxBackoff.
+	initialBackoff = 5 * time.Second
+	maxBackoff     = 10 * time.Minute
+	// maxAge is how long a delivery is retried before it is dropped e.g.
+	// because its chart CR was deleted.
+	maxAge        = 24 * time.Hour
+	namespace     = "giantswarm"
+	retryInterval = 5 * time.Second
+	// signingKey is the key of the webhook secret with the key used to sign
+	// the payloads.
+	signingKey = "signing-key"
+	// tlsCertKey and tlsKeyKey are the keys of the webhook secret with the
+	// PEM encoded client certificate and key.
+	tlsCertKey = "tls.crt"
+	tlsKeyKey  = "tls.key"
+	token      = "token"
+	// webhookSecretName is the name of the optional secret with the signing
+	// key and TLS settings for the webhooks.
+	webhookSecretName = "chart-operator-webhook"
+)
+
+type Config struct {
+	K8sClient kubernetes.Interface
+	Logger    micrologger.Logger
+
+	// AllowedHosts are the hosts webhooks may be sent to. Entries starting
+	// with a dot match subdomains e.g. .svc. When empty no webhooks are
+	// sent.
+	AllowedHosts      []string
+	HTTPClientTimeout time.Duration
+}
+
+type Outbox struct {
+	k8sClient kubernetes.Interface
+	logger    micrologger.Logger
+
+	allowedHosts      []string
+	httpClientTimeout time.Duration
+
+	// deliveries are the pending deliveries by chart CR.
+	deliveries map[string]delivery
+	mutex      sync.Mutex
+	// persistMutex ensures the configmap is written by one goroutine at a
+	// time.
+	persistMutex sync.Mutex
+	// sequence identifies the deliveries so a retry does not remove a newer
+	// delivery queued for the same chart CR meanwhile.
+	sequence int64
+}
+
+type delivery struct {
+	Attempts    int             `json:"attempts"`
+	Created     time.Time       `json:"created"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	Payload     json.RawMessage `json:"payload"`
+	Sequence    int64           `json:"sequence"`
+	URL         string          `json:"url"`
+}
+
+func New(config Config) (*Outbox, error) {
+	if config.K8sClient == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.K8sClient must not be empty", config)
+	}
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Logger must not be empty", config)
+	}
+
+	if config.HTTPClientTimeout == 0 {
+		config.HTTPClientTimeout = defaultHTTPClientTimeout
+	}
+
+	o := &Outbox{
+		k8sClient: config.K8sClient,
+		logger:    config.Logger,
+
+		allowedHosts:      config.AllowedHosts,
+		httpClientTimeout: config.HTTPClientTimeout,
+
+		deliveries: map[string]delivery{},
+	}
+
+	return o, nil
+}
+
+// Boot loads the pending deliveries and retries them until the context is
+// done.
+func (o *Outbox) Boot(ctx context.Context) {
+	err := o.load(ctx)
+	if err != nil {
+		o.logger.Errorf(ctx, err, "loading pending webhook deliveries failed")
+	}
+
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.retry(ctx)
+		}
+	}
+}
+
+// Send delivers the payload to the webhook URL for the chart CR with the given
+// key. If the delivery fails it is queued and retried with backoff. When a
+// delivery for the chart CR is already queued it is replaced by this one so
+// only the latest status is sent.
+func (o *Outbox) Send(ctx context.Context, key, url string, payload []byte) error {
+	err := o.checkHost(url)
+	if err != nil {
+		// The delivery is not queued as it will never be allowed.
+		failedCounter.Inc()
+		return microerror.Mask(err)
+	}
+
+	o.mutex.Lock()
+	_, pending := o.deliveries[key]
+	o.mutex.Unlock()
+
+	if pending {
+		// The queued delivery is replaced and retried right away so older
+		// statuses are never sent after newer ones.
+		o.enqueue(ctx, key, url, payload, time.Now())
+		return nil
+	}
+
+	err = o.deliver(ctx, url, payload)
+	if err != nil {
+		failedCounter.Inc()
+		o.enqueue(ctx, key, url, payload, time.Now().Add(backoff(1)))
+		return microerror.Mask(err)
+	}
+
+	deliveredCounter.Inc()
+
+	return nil
+}
+
+func (o *Outbox) enqueue(ctx context.Context, key, url string, payload []byte, nextAttempt time.Time) {
+	o.mutex.Lock()
+	o.sequence++
+	d := delivery{
+		Attempts:    1,
+		Created:     time.Now(),
+		NextAttempt: nextAttempt,
+		Payload:     payload,
+		Sequence:    o.sequence,
+		URL:         url,
+	}
+	if current, ok := o.deliveries[key]; ok {
+		d.Attempts = current.Attempts
+		d.Created = current.Created
+	}
+	o.deliveries[key] = d
+	o.mutex.Unlock()
+
+	o.persist(ctx)
+}
+
+// retry delivers the queued deliveries which are due.
+func (o *Outbox) retry(ctx context.Context) {
+	now := time.Now()
+
+	due := map[string]delivery{}
+	{
+		o.mutex.Lock()
+		for k, d := range o.deliveries {
+			if !d.NextAttempt.After(now) {
+				due[k] = d
+			}
+		}
+		o.mutex.Unlock()
+	}
+
+	if len(due) == 0 {
+		return
+	}
+
+	for k, d := range due {
+		err := o.checkHost(d.URL)
+		if err == nil {
+			err = o.deliver(ctx, d.URL, d.Payload)
+		}
+
+		o.mutex.Lock()
+		current, ok := o.deliveries[k]
+		if !ok || current.Sequence != d.Sequence {
+			// A newer delivery was queued meanwhile. It is sent on the
+			// next retry.
+			o.mutex.Unlock()
+			continue
+		}
+
+		if err == nil {
+			deliveredCounter.Inc()
+			delete(o.deliveries, k)
+			o.logger.Debugf(ctx, "delivered webhook for chart %#q after %d attempts", k, d.Attempts+1)
+		} else if IsHostNotAllowed(err) || now.Sub(d.Created) > maxAge {
+			failedCounter.Inc()
+			delete(o.deliveries, k)
+			o.logger.Errorf(ctx, err, "dropping webhook for chart %#q after %d attempts", k, d.Attempts+1)
+		} else {
+			failedCounter.Inc()
+			current.Attempts++
+			current.NextAttempt = now.Add(backoff(current.Attempts))
+			o.deliveries[k] = current
+			o.logger.Debugf(ctx, "sending webhook for chart %#q failed, retrying in %s", k, backoff(current.Attempts))
+		}
+		o.mutex.Unlock()
+	}
+
+	o.persist(ctx)
+}
+
+func (o *Outbox) deliver(ctx context.Context, url string, payload []byte) error {
+	authToken, err := o.getAuthToken(ctx)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	secret, err := o.getWebhookSecret(ctx)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	client, err := o.newHTTPClient(secret)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, url, bytes.NewBuffer(payload))
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	req.Header.Set("Authorization", authToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	if key := secret.Data[signingKey]; len(key) > 0 {
+		// Each attempt is signed again so retries are not rejected as
+		// expired or replayed.
+		nonce, err := newNonce()
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		timestamp := time.Now().Unix()
+
+		req.Header.Set(webhook.NonceHeader, nonce)
+		req.Header.Set(webhook.SignatureHeader, webhook.Sign(key, timestamp, nonce, payload))
+		req.Header.Set(webhook.TimestampHeader, strconv.FormatInt(timestamp, 10))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return microerror.Maskf(wrongStatusError, "expected http status '%d', got '%d'", http.StatusOK, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// checkHost returns an error if the host of the webhook URL is not in the
+// allowed hosts. This prevents chart CRs from making the operator send
+// credentials to arbitrary endpoints. No hosts are allowed by default.
+func (o *Outbox) checkHost(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return microerror.Maskf(hostNotAllowedError, "webhook URL %#q is invalid: %s", rawURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return microerror.Maskf(hostNotAllowedError, "webhook URL %#q must use http or https", rawURL)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range o.allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasPrefix(allowed, ".") && strings.HasSuffix(host, allowed) {
+			return nil
+		}
+	}
+
+	return microerror.Maskf(hostNotAllowedError, "webhook host %#q is not in the allowed hosts", host)
+}
+
+// getWebhookSecret returns the secret with the signing key and TLS settings.
+// An empty secret is returned when it does not exist.
+func (o *Outbox) getWebhookSecret(ctx context.Context) (*corev1.Secret, error) {
+	secret, err := o.k8sClient.CoreV1().Secrets(namespace).Get(ctx, webhookSecretName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return &corev1.Secret{}, nil
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return secret, nil
+}
+
+// newHTTPClient returns the client for sending webhooks. When the webhook
+// secret has a client certificate it is presented to the server and when it
+// has a CA only server certificates signed by it are trusted.
+func (o *Outbox) newHTTPClient(secret *corev1.Secret) (*http.Client, error) {
+	client := &http.Client{Timeout: o.httpClientTimeout}
+
+	cert, key, ca := secret.Data[tlsCertKey], secret.Data[tlsKeyKey], secret.Data[caKey]
+	if len(cert) == 0 && len(key) == 0 && len(ca) == 0 {
+		return client, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if len(cert) > 0 || len(key) > 0 {
+		certificate, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, microerror.Maskf(invalidTLSConfigError, "loading client certificate from secret %#q: %s", webhookSecretName, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if len(ca) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, microerror.Maskf(invalidTLSConfigError, "loading CA from secret %#q", webhookSecretName)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	client.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+
+	return client, nil
+}
+
+func (o *Outbox) getAuthToken(ctx context.Context) (string, error) {
+	secret, err := o.k8sClient.CoreV1().Secrets(namespace).Get(ctx, authTokenName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// There is no auth token secret. It may not have been created yet. Or the app CR is using InCluster.
+		o.logger.Debugf(ctx, "no auth token secret found")
+		return "", nil
+	} else if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return string(secret.Data[token]), nil
+}
+
+// load adds the deliveries stored in the configmap. Deliveries queued since
+// the operator started are newer and are kept.
+func (o *Outbox) load(ctx context.Context) error {
+	cm, err := o.k8sClient.CoreV1().ConfigMaps(namespace).Get(ctx, configMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	stored := map[string]delivery{}
+	if data := cm.Data[configMapKey]; data != "" {
+		err = json.Unmarshal([]byte(data), &stored)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	o.mutex.Lock()
+	for k, d := range stored {
+		if _, ok := o.deliveries[k]; ok {
+			continue
+		}
+		if d.Sequence > o.sequence {
+			o.sequence = d.Sequence
+		}
+		o.deliveries[k] = d
+	}
+	pendingGauge.Set(float64(len(o.deliveries)))
+	o.mutex.Unlock()
+
+	o.logger.Debugf(ctx, "loaded %d pending webhook deliveries", len(stored))
+
+	return nil
+}
+
+// persist stores the pending deliveries in the configmap. Errors are only
+// logged as the deliveries are still retried while the operator is running.
+func (o *Outbox) persist(ctx context.Context) {
+	o.persistMutex.Lock()
+	defer o.persistMutex.Unlock()
+
+	o.mutex.Lock()
+	data, err := json.Marshal(o.deliveries)
+	pendingGauge.Set(float64(len(o.deliveries)))
+	o.mutex.Unlock()
+	if err != nil {
+		o.logger.Errorf(ctx, err, "encoding pending webhook deliveries failed")
+		return
+	}
+
+	err = o.writeConfigMap(ctx, string(data))
+	if err != nil {
+		o.logger.Errorf(ctx, err, "storing pending webhook deliveries failed")
+	}
+}
+
+func (o *Outbox) writeConfigMap(ctx context.Context, data string) error {
+	cm, err := o.k8sClient.CoreV1().ConfigMaps(namespace).Get(ctx, configMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configMapName,
+				Namespace: namespace,
+			},
+			Data: map[string]string{
+				configMapKey: data,
+			},
+		}
+
+		_, err = o.k8sClient.CoreV1().ConfigMaps(namespace).Create(ctx, cm, metav1.CreateOptions{})
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	if cm.Data[configMapKey] == data {
+		return nil
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[configMapKey] = data
+
+	_, err = o.k8sClient.CoreV1().ConfigMaps(namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// backoff returns the delay before the next attempt after the given number of
+// failed attempts.
+func backoff(attempts int) time.Duration {
+	d := initialBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= maxBackoff {
+			return maxBackoff
+		}
+	}
+
+	return d
+}
@@ -0,0 +1,386 @@
+package webhookoutbox
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/giantswarm/chart-operator/v2/pkg/webhook"
+)
+
+func Test_backoff(t *testing.T) {
+	testCases := []struct {
+		name            string
+		attempts        int
+		expectedBackoff time.Duration
+	}{
+		{
+			name:            "case 0: first attempt",
+			attempts:        1,
+			expectedBackoff: 5 * time.Second,
+		},
+		{
+			name:            "case 1: third attempt",
+			attempts:        3,
+			expectedBackoff: 20 * time.Second,
+		},
+		{
+			name:            "case 2: capped",
+			attempts:        20,
+			expectedBackoff: maxBackoff,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			result := backoff(tc.attempts)
+			if result != tc.expectedBackoff {
+				t.Fatalf("backoff == %s, want %s", result, tc.expectedBackoff)
+			}
+		})
+	}
+}
+
+func Test_Outbox(t *testing.T) {
+	ctx := context.Background()
+
+	var mutex sync.Mutex
+	var received []string
+	statusCode := http.StatusServiceUnavailable
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if statusCode == http.StatusOK {
+			received = append(received, string(body))
+		}
+		w.WriteHeader(statusCode)
+	}))
+	defer server.Close()
+
+	k8sClient := fake.NewSimpleClientset()
+
+	o, err := New(Config{
+		K8sClient: k8sClient,
+		Logger:    microloggertest.New(),
+
+		AllowedHosts: []string{"127.0.0.1"},
+	})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	err = o.Send(ctx, "default/prometheus", server.URL, []byte(`{"status":"pending-install"}`))
+	if !IsWrongStatusError(err) {
+		t.Fatalf("error == %#v, want wrongStatusError", err)
+	}
+
+	// A newer status replaces the queued one.
+	err = o.Send(ctx, "default/prometheus", server.URL, []byte(`{"status":"deployed"}`))
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	cm, err := k8sClient.CoreV1().ConfigMaps(namespace).Get(ctx, configMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	stored := map[string]delivery{}
+	err = json.Unmarshal([]byte(cm.Data[configMapKey]), &stored)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	if len(stored) != 1 || string(stored["default/prometheus"].Payload) != `{"status":"deployed"}` {
+		t.Fatalf("stored deliveries == %v, want latest status", stored)
+	}
+
+	// A new outbox loads the pending deliveries stored by the previous one.
+	restarted, err := New(Config{
+		K8sClient: k8sClient,
+		Logger:    microloggertest.New(),
+
+		AllowedHosts: []string{"127.0.0.1"},
+	})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	err = restarted.load(ctx)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	mutex.Lock()
+	statusCode = http.StatusOK
+	mutex.Unlock()
+
+	restarted.retry(ctx)
+
+	if len(restarted.deliveries) != 0 {
+		t.Fatalf("len(deliveries) == %d, want 0", len(restarted.deliveries))
+	}
+	if len(received) != 1 || received[0] != `{"status":"deployed"}` {
+		t.Fatalf("received == %v, want latest status", received)
+	}
+
+	cm, err = k8sClient.CoreV1().ConfigMaps(namespace).Get(ctx, configMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	if cm.Data[configMapKey] != "{}" {
+		t.Fatalf("stored deliveries == %#q, want %#q", cm.Data[configMapKey], "{}")
+	}
+}
+
+func Test_Outbox_checkHost(t *testing.T) {
+	testCases := []struct {
+		name         string
+		allowedHosts []string
+		url          string
+		errorMatcher func(error) bool
+	}{
+		{
+			name:         "case 0: no allowed hosts",
+			url:          "http://app-operator.giantswarm:8000/status",
+			errorMatcher: IsHostNotAllowed,
+		},
+		{
+			name:         "case 1: allowed host",
+			allowedHosts: []string{"app-operator.giantswarm"},
+			url:          "http://app-operator.giantswarm:8000/status",
+		},
+		{
+			name:         "case 2: allowed subdomain",
+			allowedHosts: []string{".svc.cluster.local"},
+			url:          "https://app-operator.giantswarm.svc.cluster.local/status",
+		},
+		{
+			name:         "case 3: host not allowed",
+			allowedHosts: []string{"app-operator.giantswarm"},
+			url:          "http://attacker.example.com/status",
+			errorMatcher: IsHostNotAllowed,
+		},
+		{
+			name:         "case 4: suffix without dot is not a subdomain",
+			allowedHosts: []string{".cluster.local"},
+			url:          "http://evilcluster.local/status",
+			errorMatcher: IsHostNotAllowed,
+		},
+		{
+			name:         "case 5: unsupported scheme",
+			url:          "file:///etc/passwd",
+			errorMatcher: IsHostNotAllowed,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			o, err := New(Config{
+				K8sClient: fake.NewSimpleClientset(),
+				Logger:    microloggertest.New(),
+
+				AllowedHosts: tc.allowedHosts,
+			})
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			err = o.checkHost(tc.url)
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+		})
+	}
+}
+
+func Test_Outbox_deliver_signed(t *testing.T) {
+	ctx := context.Background()
+	key := []byte("signing-secret")
+	payload := []byte(`{"status":"deployed"}`)
+
+	var verifyErr error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		verifyErr = webhook.Verify(key, r.Header.Get(webhook.TimestampHeader), r.Header.Get(webhook.NonceHeader), r.Header.Get(webhook.SignatureHeader), body, time.Now(), time.Minute)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	k8sClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      webhookSecretName,
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{
+			signingKey: key,
+		},
+	})
+
+	o, err := New(Config{
+		K8sClient: k8sClient,
+		Logger:    microloggertest.New(),
+
+		AllowedHosts: []string{"127.0.0.1"},
+	})
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	err = o.deliver(ctx, server.URL, payload)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+	if verifyErr != nil {
+		t.Fatalf("verify error == %#v, want nil", verifyErr)
+	}
+}
+
+func Test_Outbox_deliver_mTLS(t *testing.T) {
+	ctx := context.Background()
+
+	clientCert, clientKey := newTestCertificate(t)
+
+	var peerCertificates int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peerCertificates = len(r.TLS.PeerCertificates)
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAnyClientCert,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	serverCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	testCases := []struct {
+		name         string
+		data         map[string][]byte
+		errorMatcher func(error) bool
+	}{
+		{
+			name: "case 0: pinned CA and client certificate",
+			data: map[string][]byte{
+				caKey:      serverCA,
+				tlsCertKey: clientCert,
+				tlsKeyKey:  clientKey,
+			},
+		},
+		{
+			name: "case 1: server CA not trusted",
+			data: map[string][]byte{
+				tlsCertKey: clientCert,
+				tlsKeyKey:  clientKey,
+			},
+			errorMatcher: func(err error) bool { return err != nil },
+		},
+		{
+			name: "case 2: invalid client certificate",
+			data: map[string][]byte{
+				caKey:      serverCA,
+				tlsCertKey: []byte("invalid"),
+				tlsKeyKey:  clientKey,
+			},
+			errorMatcher: IsInvalidTLSConfig,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			t.Log(tc.name)
+
+			peerCertificates = 0
+
+			k8sClient := fake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      webhookSecretName,
+					Namespace: namespace,
+				},
+				Data: tc.data,
+			})
+
+			o, err := New(Config{
+				K8sClient: k8sClient,
+				Logger:    microloggertest.New(),
+
+				AllowedHosts: []string{"127.0.0.1"},
+			})
+			if err != nil {
+				t.Fatalf("error == %#v, want nil", err)
+			}
+
+			err = o.deliver(ctx, server.URL, []byte(`{}`))
+			switch {
+			case err != nil && tc.errorMatcher == nil:
+				t.Fatalf("error == %#v, want nil", err)
+			case err == nil && tc.errorMatcher != nil:
+				t.Fatalf("error == nil, want non-nil")
+			case err != nil && !tc.errorMatcher(err):
+				t.Fatalf("error == %#v, want matching", err)
+			}
+
+			if err == nil && peerCertificates != 1 {
+				t.Fatalf("peer certificates == %d, want 1", peerCertificates)
+			}
+		})
+	}
+}
+
+func newTestCertificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "chart-operator"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("error == %#v, want nil", err)
+	}
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return cert, keyPEM
+}